@@ -0,0 +1,183 @@
+// Copyright © Go Opus Authors (see AUTHORS file)
+//
+// License for use of this code is detailed in the LICENSE file
+
+package opus
+
+import (
+	"math"
+	"time"
+)
+
+// ActivityEvent is reported by an ActivityDetector when a talk spurt starts or
+// ends.
+type ActivityEvent int
+
+const (
+	// Nothing changed
+	ActivityNone ActivityEvent = iota
+	// The participant started talking
+	ActivityTalkStart
+	// The participant stopped talking
+	ActivityTalkEnd
+)
+
+func (e ActivityEvent) String() string {
+	switch e {
+	case ActivityNone:
+		return "none"
+	case ActivityTalkStart:
+		return "talk start"
+	case ActivityTalkEnd:
+		return "talk end"
+	default:
+		return "unknown"
+	}
+}
+
+// Defaults for ActivityDetector
+const (
+	defaultActivityStart    = 0.5
+	defaultActivityEnd      = 0.2
+	defaultActivityHangover = 300 * time.Millisecond
+	activityAttack          = 40 * time.Millisecond
+	activityRelease         = 150 * time.Millisecond
+	// Time it takes for the bitrate floor to catch up with a louder
+	// background.
+	activityFloorRise = 10 * time.Second
+	// A pause in the packet stream longer than this is treated as DTX.
+	activityMaxGap = 60 * time.Millisecond
+)
+
+// ActivityDetector estimates the voice activity of a single participant from
+// their packet stream, without decoding any audio. This is meant for selecting
+// the active speaker in a conference server (SFU).
+//
+// The estimate is based on the size of each packet relative to the smallest
+// packets recently seen from the same participant: with VBR, speech needs
+// considerably more bits than background noise. Packets sent during DTX (see
+// Encoder.SetDTX), gaps in the stream where DTX suppressed packets altogether,
+// and the comfort noise update that follows such a gap all count as silence.
+// Streams encoded with CBR and without DTX carry no activity information.
+//
+// The zero value is not usable; use NewActivityDetector.
+type ActivityDetector struct {
+	// Smoothed level at which a talk spurt starts, between 0 and 1.
+	StartThreshold float64
+	// Smoothed level below which a talk spurt may end, between 0 and 1.
+	EndThreshold float64
+	// Time the level must stay below EndThreshold before a talk spurt ends.
+	Hangover time.Duration
+
+	level   float64
+	talking bool
+	// Bitrate (bits per second) of the quietest recent non-DTX packets
+	floor float64
+	// End of the last packet, in stream time
+	end     time.Duration
+	started bool
+	// How long the level has been below EndThreshold
+	quiet time.Duration
+}
+
+// NewActivityDetector creates an activity detector with default thresholds.
+func NewActivityDetector() *ActivityDetector {
+	return &ActivityDetector{
+		StartThreshold: defaultActivityStart,
+		EndThreshold:   defaultActivityEnd,
+		Hangover:       defaultActivityHangover,
+	}
+}
+
+// Push feeds the next packet of the stream into the detector. ts is the
+// stream time of the first sample in the packet, e.g. derived from the RTP
+// timestamp. Packets must be pushed in order; late packets should be dropped.
+//
+// Returns the talk spurt event caused by this packet, if any.
+func (d *ActivityDetector) Push(data []byte, ts time.Duration) (ActivityEvent, error) {
+	p, err := ParsePacket(data)
+	if err != nil {
+		return ActivityNone, err
+	}
+	afterGap := false
+	if d.started && ts-d.end > activityMaxGap {
+		afterGap = true
+		if ev := d.update(0, ts-d.end); ev != ActivityNone {
+			d.end = ts + p.Duration()
+			return ev, nil
+		}
+	}
+	d.started = true
+	d.end = ts + p.Duration()
+	if p.DTX() || afterGap {
+		// The first packet after a gap is the comfort noise update of DTX.
+		// If it is speech instead, the packets that follow will tell.
+		return d.update(0, p.Duration()), nil
+	}
+	return d.update(d.packetActivity(len(data), p.Duration()), p.Duration()), nil
+}
+
+// Advance moves the stream time forward to ts without a packet, e.g. when a
+// timer fires while the participant is in DTX. Returns ActivityTalkEnd if the
+// talk spurt ended because of the silence.
+func (d *ActivityDetector) Advance(ts time.Duration) ActivityEvent {
+	if !d.started || ts <= d.end {
+		return ActivityNone
+	}
+	ev := d.update(0, ts-d.end)
+	d.end = ts
+	return ev
+}
+
+// Level returns the smoothed activity level, between 0 (silence) and 1
+// (speech).
+func (d *ActivityDetector) Level() float64 {
+	return d.level
+}
+
+// Talking reports whether the participant is currently in a talk spurt.
+func (d *ActivityDetector) Talking() bool {
+	return d.talking
+}
+
+// packetActivity returns the raw activity of a non-DTX packet, between 0
+// and 1.
+func (d *ActivityDetector) packetActivity(size int, duration time.Duration) float64 {
+	if duration <= 0 {
+		return 0
+	}
+	rate := float64(size*8) / duration.Seconds()
+	if d.floor == 0 || rate < d.floor {
+		d.floor = rate
+	} else {
+		d.floor += (rate - d.floor) * duration.Seconds() / activityFloorRise.Seconds()
+	}
+	// Speech at twice the bitrate of the background saturates the estimate
+	return math.Min(math.Max(rate/d.floor-1, 0), 1)
+}
+
+// update smooths the raw activity over the given duration and detects the
+// start and end of talk spurts.
+func (d *ActivityDetector) update(raw float64, duration time.Duration) ActivityEvent {
+	tau := activityRelease
+	if raw > d.level {
+		tau = activityAttack
+	}
+	alpha := 1 - math.Exp(-duration.Seconds()/tau.Seconds())
+	d.level += (raw - d.level) * alpha
+	switch {
+	case !d.talking && d.level >= d.StartThreshold:
+		d.talking = true
+		d.quiet = 0
+		return ActivityTalkStart
+	case d.talking && d.level < d.EndThreshold:
+		d.quiet += duration
+		if d.quiet >= d.Hangover {
+			d.talking = false
+			return ActivityTalkEnd
+		}
+	case d.talking:
+		d.quiet = 0
+	}
+	return ActivityNone
+}
@@ -0,0 +1,75 @@
+// Copyright © Go Opus Authors (see AUTHORS file)
+//
+// License for use of this code is detailed in the LICENSE file
+
+package opus
+
+import (
+	"testing"
+	"time"
+)
+
+// Fake 20 ms SILK wideband packet of the given size
+func fakeSILKPacket(size int) []byte {
+	data := make([]byte, size)
+	data[0] = 9 << 3
+	return data
+}
+
+func TestActivityDetector(t *testing.T) {
+	const frame = 20 * time.Millisecond
+	d := NewActivityDetector()
+	ts := time.Duration(0)
+	events := map[ActivityEvent]int{}
+	push := func(size int, n int) {
+		for i := 0; i < n; i++ {
+			ev, err := d.Push(fakeSILKPacket(size), ts)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			events[ev]++
+			ts += frame
+		}
+	}
+	// Background noise
+	push(20, 50)
+	if d.Talking() || events[ActivityTalkStart] != 0 {
+		t.Fatalf("Unexpected talk spurt during background noise")
+	}
+	// Speech
+	push(60, 50)
+	if !d.Talking() || events[ActivityTalkStart] != 1 {
+		t.Fatalf("Expected a single talk spurt start during speech, got %d", events[ActivityTalkStart])
+	}
+	if d.Level() < d.StartThreshold {
+		t.Errorf("Unexpected activity level during speech: %f", d.Level())
+	}
+	// DTX frames
+	push(1, 50)
+	if d.Talking() || events[ActivityTalkEnd] != 1 {
+		t.Fatalf("Expected talk spurt to end during DTX")
+	}
+	// Speech, then silence without any packets
+	push(60, 10)
+	if !d.Talking() {
+		t.Fatalf("Expected talk spurt after DTX")
+	}
+	if ev := d.Advance(ts + time.Second); ev != ActivityTalkEnd {
+		t.Errorf("Expected talk spurt to end after gap, got: %v", ev)
+	}
+}
+
+func TestActivityDetectorComfortNoise(t *testing.T) {
+	d := NewActivityDetector()
+	ts := time.Duration(0)
+	for i := 0; i < 20; i++ {
+		if _, err := d.Push(fakeSILKPacket(10), ts); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		// Comfort noise updates every 400 ms, never more than one in a row
+		ts += 400 * time.Millisecond
+	}
+	if d.Talking() || d.Level() != 0 {
+		t.Errorf("Comfort noise treated as activity: level %f", d.Level())
+	}
+}
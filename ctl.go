@@ -0,0 +1,279 @@
+// Copyright © Go Opus Authors (see AUTHORS file)
+//
+// License for use of this code is detailed in the LICENSE file
+
+package opus
+
+import (
+	"fmt"
+)
+
+/*
+#cgo pkg-config: opus
+#include <opus.h>
+
+// The ctl functions are variadic, which cgo cannot call. These bridges cover
+// the argument shapes used by the integer ctls.
+
+int
+bridge_encoder_ctl(OpusEncoder *st, int request)
+{
+	return opus_encoder_ctl(st, request);
+}
+
+int
+bridge_encoder_ctl_set_int32(OpusEncoder *st, int request, opus_int32 value)
+{
+	return opus_encoder_ctl(st, request, value);
+}
+
+int
+bridge_encoder_ctl_get_int32(OpusEncoder *st, int request, opus_int32 *value)
+{
+	return opus_encoder_ctl(st, request, value);
+}
+
+int
+bridge_encoder_ctl_get_uint32(OpusEncoder *st, int request, opus_uint32 *value)
+{
+	return opus_encoder_ctl(st, request, value);
+}
+
+int
+bridge_decoder_ctl(OpusDecoder *st, int request)
+{
+	return opus_decoder_ctl(st, request);
+}
+
+int
+bridge_decoder_ctl_set_int32(OpusDecoder *st, int request, opus_int32 value)
+{
+	return opus_decoder_ctl(st, request, value);
+}
+
+int
+bridge_decoder_ctl_get_int32(OpusDecoder *st, int request, opus_int32 *value)
+{
+	return opus_decoder_ctl(st, request, value);
+}
+
+int
+bridge_decoder_ctl_get_uint32(OpusDecoder *st, int request, opus_uint32 *value)
+{
+	return opus_decoder_ctl(st, request, value);
+}
+*/
+import "C"
+
+// Known ctls whose argument is not a single opus_int32 or opus_uint32. Passing
+// them through the generic bridges would make libopus read or write memory of
+// the wrong size.
+var unsafeCtls = map[int]bool{
+	4052:  true, // OPUS_SET_DNN_BLOB: pointer and length
+	5120:  true, // OPUS_MULTISTREAM_GET_ENCODER_STATE: stream index and pointer
+	5122:  true, // OPUS_MULTISTREAM_GET_DECODER_STATE: stream index and pointer
+	6005:  true, // OPUS_PROJECTION_GET_DEMIXING_MATRIX: pointer and size
+	10015: true, // CELT_GET_MODE: pointer to pointer
+	10026: true, // OPUS_SET_ENERGY_MASK: pointer
+}
+
+// checkCtl verifies that a request can be passed through the generic ctl
+// bridges. By libopus convention, requests that set a value are even and
+// requests that get a value are odd.
+func checkCtl(request int, get bool) error {
+	if unsafeCtls[request] || noArgCtls[request] || (request%2 == 1) != get {
+		return ErrBadArg
+	}
+	return nil
+}
+
+// noArgCtls lists the requests that take no argument at all. Any other
+// request would make libopus read an argument that was never passed.
+var noArgCtls = map[int]bool{
+	4028: true, // OPUS_RESET_STATE
+}
+
+// checkNoArgCtl verifies that a request can be passed through the no-argument
+// ctl bridges.
+func checkNoArgCtl(request int) error {
+	if !noArgCtls[request] {
+		return ErrBadArg
+	}
+	return nil
+}
+
+// CtlInt32 performs an encoder ctl that takes a single opus_int32 value, like
+// OPUS_SET_BITRATE (4002). This is a low-level escape hatch for ctls that do
+// not have a dedicated method yet; prefer the dedicated methods where they
+// exist.
+//
+// Returns ErrBadArg for requests that do not set a value (odd request
+// numbers) or that are known to take a different kind of argument.
+func (enc *Encoder) CtlInt32(request int, value int32) error {
+	if enc.p == nil {
+		return ErrEncoderUninitialized
+	}
+	if err := checkCtl(request, false); err != nil {
+		return err
+	}
+	if request == int(C.OPUS_SET_EXPERT_FRAME_DURATION_REQUEST) {
+		// Keep the frame duration used to validate Encode in sync
+		return enc.SetExpertFrameDuration(FrameDuration(value))
+	}
+	res := C.bridge_encoder_ctl_set_int32(enc.p, C.int(request), C.opus_int32(value))
+	if res != C.OPUS_OK {
+		return &OpError{
+			Op:   "opus_encoder_ctl",
+			Args: fmt.Sprintf("%d, %d", request, value),
+			Err:  Error(res),
+		}
+	}
+	return nil
+}
+
+// CtlGetInt32 performs an encoder ctl that returns a single opus_int32 value,
+// like OPUS_GET_BITRATE (4003).
+//
+// Returns ErrBadArg for requests that do not get a value (even request
+// numbers) or that are known to take a different kind of argument.
+func (enc *Encoder) CtlGetInt32(request int) (int32, error) {
+	if enc.p == nil {
+		return 0, ErrEncoderUninitialized
+	}
+	if err := checkCtl(request, true); err != nil {
+		return 0, err
+	}
+	var value C.opus_int32
+	res := C.bridge_encoder_ctl_get_int32(enc.p, C.int(request), &value)
+	if res != C.OPUS_OK {
+		return 0, &OpError{
+			Op:   "opus_encoder_ctl",
+			Args: fmt.Sprintf("%d", request),
+			Err:  Error(res),
+		}
+	}
+	return int32(value), nil
+}
+
+// CtlGetUint32 performs an encoder ctl that returns a single opus_uint32
+// value, like OPUS_GET_FINAL_RANGE (4031).
+func (enc *Encoder) CtlGetUint32(request int) (uint32, error) {
+	if enc.p == nil {
+		return 0, ErrEncoderUninitialized
+	}
+	if err := checkCtl(request, true); err != nil {
+		return 0, err
+	}
+	var value C.opus_uint32
+	res := C.bridge_encoder_ctl_get_uint32(enc.p, C.int(request), &value)
+	if res != C.OPUS_OK {
+		return 0, &OpError{
+			Op:   "opus_encoder_ctl",
+			Args: fmt.Sprintf("%d", request),
+			Err:  Error(res),
+		}
+	}
+	return uint32(value), nil
+}
+
+// Ctl performs an encoder ctl that takes no argument. The only such request
+// is OPUS_RESET_STATE (4028); any other request returns ErrBadArg.
+func (enc *Encoder) Ctl(request int) error {
+	if enc.p == nil {
+		return ErrEncoderUninitialized
+	}
+	if err := checkNoArgCtl(request); err != nil {
+		return err
+	}
+	res := C.bridge_encoder_ctl(enc.p, C.int(request))
+	if res != C.OPUS_OK {
+		return &OpError{
+			Op:   "opus_encoder_ctl",
+			Args: fmt.Sprintf("%d", request),
+			Err:  Error(res),
+		}
+	}
+	return nil
+}
+
+// CtlInt32 performs a decoder ctl that takes a single opus_int32 value, like
+// OPUS_SET_GAIN (4034). See Encoder.CtlInt32.
+func (dec *Decoder) CtlInt32(request int, value int32) error {
+	if dec.p == nil {
+		return ErrDecoderUninitialized
+	}
+	if err := checkCtl(request, false); err != nil {
+		return err
+	}
+	res := C.bridge_decoder_ctl_set_int32(dec.p, C.int(request), C.opus_int32(value))
+	if res != C.OPUS_OK {
+		return &OpError{
+			Op:   "opus_decoder_ctl",
+			Args: fmt.Sprintf("%d, %d", request, value),
+			Err:  Error(res),
+		}
+	}
+	return nil
+}
+
+// CtlGetInt32 performs a decoder ctl that returns a single opus_int32 value,
+// like OPUS_GET_PITCH (4033). See Encoder.CtlGetInt32.
+func (dec *Decoder) CtlGetInt32(request int) (int32, error) {
+	if dec.p == nil {
+		return 0, ErrDecoderUninitialized
+	}
+	if err := checkCtl(request, true); err != nil {
+		return 0, err
+	}
+	var value C.opus_int32
+	res := C.bridge_decoder_ctl_get_int32(dec.p, C.int(request), &value)
+	if res != C.OPUS_OK {
+		return 0, &OpError{
+			Op:   "opus_decoder_ctl",
+			Args: fmt.Sprintf("%d", request),
+			Err:  Error(res),
+		}
+	}
+	return int32(value), nil
+}
+
+// CtlGetUint32 performs a decoder ctl that returns a single opus_uint32
+// value, like OPUS_GET_FINAL_RANGE (4031).
+func (dec *Decoder) CtlGetUint32(request int) (uint32, error) {
+	if dec.p == nil {
+		return 0, ErrDecoderUninitialized
+	}
+	if err := checkCtl(request, true); err != nil {
+		return 0, err
+	}
+	var value C.opus_uint32
+	res := C.bridge_decoder_ctl_get_uint32(dec.p, C.int(request), &value)
+	if res != C.OPUS_OK {
+		return 0, &OpError{
+			Op:   "opus_decoder_ctl",
+			Args: fmt.Sprintf("%d", request),
+			Err:  Error(res),
+		}
+	}
+	return uint32(value), nil
+}
+
+// Ctl performs a decoder ctl that takes no argument. The only such request
+// is OPUS_RESET_STATE (4028); any other request returns ErrBadArg.
+func (dec *Decoder) Ctl(request int) error {
+	if dec.p == nil {
+		return ErrDecoderUninitialized
+	}
+	if err := checkNoArgCtl(request); err != nil {
+		return err
+	}
+	res := C.bridge_decoder_ctl(dec.p, C.int(request))
+	if res != C.OPUS_OK {
+		return &OpError{
+			Op:   "opus_decoder_ctl",
+			Args: fmt.Sprintf("%d", request),
+			Err:  Error(res),
+		}
+	}
+	return nil
+}
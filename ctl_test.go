@@ -0,0 +1,89 @@
+// Copyright © Go Opus Authors (see AUTHORS file)
+//
+// License for use of this code is detailed in the LICENSE file
+
+package opus
+
+import (
+	"errors"
+	"testing"
+)
+
+const (
+	ctlSetBitrate    = 4002
+	ctlGetBitrate    = 4003
+	ctlResetState    = 4028
+	ctlGetFinalRange = 4031
+	ctlSetGain       = 4034
+	ctlGetGain       = 4045
+)
+
+func TestEncoder_Ctl(t *testing.T) {
+	enc, err := NewEncoder(48000, 1, AppVoIP)
+	if err != nil || enc == nil {
+		t.Fatalf("Error creating new encoder: %v", err)
+	}
+	if err := enc.CtlInt32(ctlSetBitrate, 12345); err != nil {
+		t.Fatalf("Error setting bitrate through ctl: %v", err)
+	}
+	bitrate, err := enc.CtlGetInt32(ctlGetBitrate)
+	if err != nil {
+		t.Fatalf("Error getting bitrate through ctl: %v", err)
+	}
+	if bitrate != 12345 {
+		t.Errorf("Unexpected bitrate. Got %d, but expected 12345", bitrate)
+	}
+	if _, err := enc.CtlGetUint32(ctlGetFinalRange); err != nil {
+		t.Errorf("Error getting final range through ctl: %v", err)
+	}
+	if err := enc.Ctl(ctlResetState); err != nil {
+		t.Errorf("Error resetting encoder through ctl: %v", err)
+	}
+	// Wrong direction for the request
+	if err := enc.CtlInt32(ctlGetBitrate, 1); err != ErrBadArg {
+		t.Errorf("Expected ErrBadArg for get request, got %v", err)
+	}
+	if _, err := enc.CtlGetInt32(ctlSetBitrate); err != ErrBadArg {
+		t.Errorf("Expected ErrBadArg for set request, got %v", err)
+	}
+	// OPUS_SET_DNN_BLOB takes a pointer
+	if err := enc.CtlInt32(4052, 0); err != ErrBadArg {
+		t.Errorf("Expected ErrBadArg for pointer ctl, got %v", err)
+	}
+	// OPUS_SET_BITRATE needs an argument
+	if err := enc.Ctl(ctlSetBitrate); err != ErrBadArg {
+		t.Errorf("Expected ErrBadArg for ctl with argument, got %v", err)
+	}
+}
+
+func TestDecoder_Ctl(t *testing.T) {
+	dec, err := NewDecoder(48000, 1)
+	if err != nil || dec == nil {
+		t.Fatalf("Error creating new decoder: %v", err)
+	}
+	if err := dec.CtlInt32(ctlSetGain, 256); err != nil {
+		t.Fatalf("Error setting gain through ctl: %v", err)
+	}
+	gain, err := dec.CtlGetInt32(ctlGetGain)
+	if err != nil {
+		t.Fatalf("Error getting gain through ctl: %v", err)
+	}
+	if gain != 256 {
+		t.Errorf("Unexpected gain. Got %d, but expected 256", gain)
+	}
+	if err := dec.Ctl(ctlResetState); err != nil {
+		t.Errorf("Error resetting decoder through ctl: %v", err)
+	}
+	if err := dec.Ctl(ctlSetGain); err != ErrBadArg {
+		t.Errorf("Expected ErrBadArg for ctl with argument, got %v", err)
+	}
+	// Unknown requests are reported by libopus
+	err = dec.CtlInt32(4998, 0)
+	if !errors.Is(err, ErrUnimplemented) {
+		t.Errorf("Expected ErrUnimplemented for unknown request, got %v", err)
+	}
+	var opErr *OpError
+	if !errors.As(err, &opErr) || opErr.Op != "opus_decoder_ctl" || opErr.Args != "4998, 0" {
+		t.Errorf("Expected OpError for opus_decoder_ctl, got %v", err)
+	}
+}
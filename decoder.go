@@ -18,11 +18,63 @@ bridge_decoder_get_last_packet_duration(OpusDecoder *st, opus_int32 *samples)
 {
 	return opus_decoder_ctl(st, OPUS_GET_LAST_PACKET_DURATION(samples));
 }
+
+int
+bridge_decoder_get_final_range(OpusDecoder *st, opus_uint32 *final_range)
+{
+	return opus_decoder_ctl(st, OPUS_GET_FINAL_RANGE(final_range));
+}
+
+int
+bridge_decoder_set_gain(OpusDecoder *st, opus_int32 gain)
+{
+	return opus_decoder_ctl(st, OPUS_SET_GAIN(gain));
+}
+
+int
+bridge_decoder_get_gain(OpusDecoder *st, opus_int32 *gain)
+{
+	return opus_decoder_ctl(st, OPUS_GET_GAIN(gain));
+}
+
+int
+bridge_decoder_get_pitch(OpusDecoder *st, opus_int32 *pitch)
+{
+	return opus_decoder_ctl(st, OPUS_GET_PITCH(pitch));
+}
+
+int
+bridge_decoder_get_bandwidth(OpusDecoder *st, opus_int32 *bw)
+{
+	return opus_decoder_ctl(st, OPUS_GET_BANDWIDTH(bw));
+}
+
+int
+bridge_decoder_get_sample_rate(OpusDecoder *st, opus_int32 *sample_rate)
+{
+	return opus_decoder_ctl(st, OPUS_GET_SAMPLE_RATE(sample_rate));
+}
+
+int
+bridge_decoder_set_phase_inversion_disabled(OpusDecoder *st, opus_int32 disabled)
+{
+	return opus_decoder_ctl(st, OPUS_SET_PHASE_INVERSION_DISABLED(disabled));
+}
+
+int
+bridge_decoder_get_phase_inversion_disabled(OpusDecoder *st, opus_int32 *disabled)
+{
+	return opus_decoder_ctl(st, OPUS_GET_PHASE_INVERSION_DISABLED(disabled));
+}
+
+int
+bridge_decoder_reset_state(OpusDecoder *st)
+{
+	return opus_decoder_ctl(st, OPUS_RESET_STATE);
+}
 */
 import "C"
 
-var errDecUninitialized = fmt.Errorf("opus decoder uninitialized")
-
 type Decoder struct {
 	p *C.struct_OpusDecoder
 	// Same purpose as encoder struct
@@ -44,10 +96,10 @@ func NewDecoder(sample_rate int, channels int) (*Decoder, error) {
 
 func (dec *Decoder) Init(sample_rate int, channels int) error {
 	if dec.p != nil {
-		return fmt.Errorf("opus decoder already initialized")
+		return ErrAlreadyInitialized
 	}
 	if channels != 1 && channels != 2 {
-		return fmt.Errorf("Number of channels must be 1 or 2: %d", channels)
+		return fmt.Errorf("%w: must be 1 or 2, got %d", ErrInvalidChannels, channels)
 	}
 	size := C.opus_decoder_get_size(C.int(channels))
 	dec.sample_rate = sample_rate
@@ -59,7 +111,11 @@ func (dec *Decoder) Init(sample_rate int, channels int) error {
 		C.opus_int32(sample_rate),
 		C.int(channels))
 	if errno != 0 {
-		return Error(errno)
+		return &OpError{
+			Op:   "opus_decoder_init",
+			Args: fmt.Sprintf("Fs=%d, channels=%d", sample_rate, channels),
+			Err:  Error(errno),
+		}
 	}
 	return nil
 }
@@ -67,57 +123,13 @@ func (dec *Decoder) Init(sample_rate int, channels int) error {
 // Decode encoded Opus data into the supplied buffer. On success, returns the
 // number of samples correctly written to the target buffer.
 func (dec *Decoder) Decode(data []byte, pcm []int16) (int, error) {
-	if dec.p == nil {
-		return 0, errDecUninitialized
-	}
-	if len(data) == 0 {
-		return 0, fmt.Errorf("opus: no data supplied")
-	}
-	if len(pcm) == 0 {
-		return 0, fmt.Errorf("opus: target buffer empty")
-	}
-	if cap(pcm)%dec.channels != 0 {
-		return 0, fmt.Errorf("opus: target buffer capacity must be multiple of channels")
-	}
-	n := int(C.opus_decode(
-		dec.p,
-		(*C.uchar)(&data[0]),
-		C.opus_int32(len(data)),
-		(*C.opus_int16)(&pcm[0]),
-		C.int(cap(pcm)/dec.channels),
-		0))
-	if n < 0 {
-		return 0, Error(n)
-	}
-	return n, nil
+	return dec.decode(data, int16PCM(pcm), decodeNormal)
 }
 
 // Decode encoded Opus data into the supplied buffer. On success, returns the
 // number of samples correctly written to the target buffer.
 func (dec *Decoder) DecodeFloat32(data []byte, pcm []float32) (int, error) {
-	if dec.p == nil {
-		return 0, errDecUninitialized
-	}
-	if len(data) == 0 {
-		return 0, fmt.Errorf("opus: no data supplied")
-	}
-	if len(pcm) == 0 {
-		return 0, fmt.Errorf("opus: target buffer empty")
-	}
-	if cap(pcm)%dec.channels != 0 {
-		return 0, fmt.Errorf("opus: target buffer capacity must be multiple of channels")
-	}
-	n := int(C.opus_decode_float(
-		dec.p,
-		(*C.uchar)(&data[0]),
-		C.opus_int32(len(data)),
-		(*C.float)(&pcm[0]),
-		C.int(cap(pcm)/dec.channels),
-		0))
-	if n < 0 {
-		return 0, Error(n)
-	}
-	return n, nil
+	return dec.decode(data, float32PCM(pcm), decodeNormal)
 }
 
 // DecodeFEC encoded Opus data into the supplied buffer with forward error
@@ -136,58 +148,16 @@ func (dec *Decoder) DecodeFloat32(data []byte, pcm []float32) (int, error) {
 // Note that DecodeFEC automatically falls back to PLC when no FEC data is
 // available in the provided packet.
 func (dec *Decoder) DecodeFEC(data []byte, pcm []int16) error {
-	if dec.p == nil {
-		return errDecUninitialized
-	}
-	if len(data) == 0 {
-		return fmt.Errorf("opus: no data supplied")
-	}
-	if len(pcm) == 0 {
-		return fmt.Errorf("opus: target buffer empty")
-	}
-	if cap(pcm)%dec.channels != 0 {
-		return fmt.Errorf("opus: target buffer capacity must be multiple of channels")
-	}
-	n := int(C.opus_decode(
-		dec.p,
-		(*C.uchar)(&data[0]),
-		C.opus_int32(len(data)),
-		(*C.opus_int16)(&pcm[0]),
-		C.int(cap(pcm)/dec.channels),
-		1))
-	if n < 0 {
-		return Error(n)
-	}
-	return nil
+	_, err := dec.decode(data, int16PCM(pcm), decodeFEC)
+	return err
 }
 
 // DecodeFECFloat32 encoded Opus data into the supplied buffer with forward error
 // correction. It is to be used on the packet directly following the lost one.
 // The supplied buffer needs to be exactly the duration of audio that is missing
 func (dec *Decoder) DecodeFECFloat32(data []byte, pcm []float32) error {
-	if dec.p == nil {
-		return errDecUninitialized
-	}
-	if len(data) == 0 {
-		return fmt.Errorf("opus: no data supplied")
-	}
-	if len(pcm) == 0 {
-		return fmt.Errorf("opus: target buffer empty")
-	}
-	if cap(pcm)%dec.channels != 0 {
-		return fmt.Errorf("opus: target buffer capacity must be multiple of channels")
-	}
-	n := int(C.opus_decode_float(
-		dec.p,
-		(*C.uchar)(&data[0]),
-		C.opus_int32(len(data)),
-		(*C.float)(&pcm[0]),
-		C.int(cap(pcm)/dec.channels),
-		1))
-	if n < 0 {
-		return Error(n)
-	}
-	return nil
+	_, err := dec.decode(data, float32PCM(pcm), decodeFEC)
+	return err
 }
 
 // DecodePLC recovers a lost packet using Opus Packet Loss Concealment feature.
@@ -203,51 +173,76 @@ func (dec *Decoder) DecodeFECFloat32(data []byte, pcm []float32) error {
 // PLC does not introduce additional latency. It is calculated from the previous
 // packet, not from the next one.
 func (dec *Decoder) DecodePLC(pcm []int16) error {
-	if dec.p == nil {
-		return errDecUninitialized
-	}
-	if len(pcm) == 0 {
-		return fmt.Errorf("opus: target buffer empty")
-	}
-	if cap(pcm)%dec.channels != 0 {
-		return fmt.Errorf("opus: output buffer capacity must be multiple of channels")
-	}
-	n := int(C.opus_decode(
-		dec.p,
-		nil,
-		0,
-		(*C.opus_int16)(&pcm[0]),
-		C.int(cap(pcm)/dec.channels),
-		0))
-	if n < 0 {
-		return Error(n)
-	}
-	return nil
+	_, err := dec.decode(nil, int16PCM(pcm), decodePLC)
+	return err
 }
 
 // DecodePLCFloat32 recovers a lost packet using Opus Packet Loss Concealment feature.
 // The supplied buffer needs to be exactly the duration of audio that is missing.
 func (dec *Decoder) DecodePLCFloat32(pcm []float32) error {
+	_, err := dec.decode(nil, float32PCM(pcm), decodePLC)
+	return err
+}
+
+// Kinds of decoding done by Decoder.decode.
+const (
+	decodeNormal = iota
+	decodeFEC
+	decodePLC
+)
+
+// decode implements all Decode methods for both sample types.
+func (dec *Decoder) decode(data []byte, pcm pcmBuffer, mode int) (int, error) {
 	if dec.p == nil {
-		return errDecUninitialized
+		return 0, ErrDecoderUninitialized
+	}
+	if mode != decodePLC && len(data) == 0 {
+		return 0, ErrNoData
+	}
+	if pcm.len == 0 {
+		return 0, ErrTargetBufferEmpty
+	}
+	if pcm.cap%dec.channels != 0 {
+		return 0, ErrBufferChannels
+	}
+	// PLC passes no data to libopus
+	var dataPtr *C.uchar
+	if mode != decodePLC {
+		dataPtr = (*C.uchar)(&data[0])
+	}
+	fec := 0
+	if mode == decodeFEC {
+		fec = 1
+	}
+	frameSize := pcm.cap / dec.channels
+	var n int
+	op := "opus_decode"
+	if pcm.float {
+		op = "opus_decode_float"
+		n = int(C.opus_decode_float(
+			dec.p,
+			dataPtr,
+			C.opus_int32(len(data)),
+			(*C.float)(pcm.p),
+			C.int(frameSize),
+			C.int(fec)))
+	} else {
+		n = int(C.opus_decode(
+			dec.p,
+			dataPtr,
+			C.opus_int32(len(data)),
+			(*C.opus_int16)(pcm.p),
+			C.int(frameSize),
+			C.int(fec)))
 	}
-	if len(pcm) == 0 {
-		return fmt.Errorf("opus: target buffer empty")
-	}
-	if cap(pcm)%dec.channels != 0 {
-		return fmt.Errorf("opus: output buffer capacity must be multiple of channels")
-	}
-	n := int(C.opus_decode_float(
-		dec.p,
-		nil,
-		0,
-		(*C.float)(&pcm[0]),
-		C.int(cap(pcm)/dec.channels),
-		0))
 	if n < 0 {
-		return Error(n)
+		return 0, &OpError{
+			Op:   op,
+			Args: fmt.Sprintf("len=%d, frame_size=%d, decode_fec=%d", len(data), frameSize, fec),
+			Err:  Error(n),
+		}
 	}
-	return nil
+	return n, nil
 }
 
 // LastPacketDuration gets the duration (in samples)
@@ -256,7 +251,168 @@ func (dec *Decoder) LastPacketDuration() (int, error) {
 	var samples C.opus_int32
 	res := C.bridge_decoder_get_last_packet_duration(dec.p, &samples)
 	if res != C.OPUS_OK {
-		return 0, Error(res)
+		return 0, &OpError{
+			Op:   "opus_decoder_ctl",
+			Args: "OPUS_GET_LAST_PACKET_DURATION",
+			Err:  Error(res),
+		}
 	}
 	return int(samples), nil
 }
+
+// concealSamples returns the number of samples per channel to conceal for a
+// lost packet: the duration of the last packet, or 20 ms if no packet has been
+// decoded yet, like opus_demo.
+func (dec *Decoder) concealSamples() (int, error) {
+	samples, err := dec.LastPacketDuration()
+	if err != nil {
+		return 0, err
+	}
+	if samples == 0 {
+		samples = dec.sample_rate / 50
+	}
+	return samples, nil
+}
+
+// FinalRange returns the final state of the range coder for the last decoded
+// packet. It matches the value reported by the encoder for that packet if the
+// packet was decoded exactly as it was encoded.
+func (dec *Decoder) FinalRange() (uint32, error) {
+	var finalRange C.opus_uint32
+	res := C.bridge_decoder_get_final_range(dec.p, &finalRange)
+	if res != C.OPUS_OK {
+		return 0, &OpError{
+			Op:   "opus_decoder_ctl",
+			Args: "OPUS_GET_FINAL_RANGE",
+			Err:  Error(res),
+		}
+	}
+	return uint32(finalRange), nil
+}
+
+// SetGain configures a gain applied by the decoder to its output, in Q8 dB
+// units (1/256 dB), between -32768 and 32767. This is the unit used for the
+// output gain in an Ogg Opus header.
+func (dec *Decoder) SetGain(gain int) error {
+	res := C.bridge_decoder_set_gain(dec.p, C.opus_int32(gain))
+	if res != C.OPUS_OK {
+		return &OpError{
+			Op:   "opus_decoder_ctl",
+			Args: fmt.Sprintf("OPUS_SET_GAIN(%d)", gain),
+			Err:  Error(res),
+		}
+	}
+	return nil
+}
+
+// Gain returns the output gain of the decoder in Q8 dB units.
+func (dec *Decoder) Gain() (int, error) {
+	var gain C.opus_int32
+	res := C.bridge_decoder_get_gain(dec.p, &gain)
+	if res != C.OPUS_OK {
+		return 0, &OpError{
+			Op:   "opus_decoder_ctl",
+			Args: "OPUS_GET_GAIN",
+			Err:  Error(res),
+		}
+	}
+	return int(gain), nil
+}
+
+// Pitch returns the pitch of the last decoded frame, if available, as reported
+// by OPUS_GET_PITCH. It is 0 if the frame was not voiced or carried no pitch.
+// Otherwise it is a codec-internal value whose scale depends on how the frame
+// was coded, not a period in samples at a fixed rate.
+func (dec *Decoder) Pitch() (int, error) {
+	var pitch C.opus_int32
+	res := C.bridge_decoder_get_pitch(dec.p, &pitch)
+	if res != C.OPUS_OK {
+		return 0, &OpError{
+			Op:   "opus_decoder_ctl",
+			Args: "OPUS_GET_PITCH",
+			Err:  Error(res),
+		}
+	}
+	return int(pitch), nil
+}
+
+// Bandwidth returns the bandpass of the last decoded packet.
+func (dec *Decoder) Bandwidth() (Bandwidth, error) {
+	var bw C.opus_int32
+	res := C.bridge_decoder_get_bandwidth(dec.p, &bw)
+	if res != C.OPUS_OK {
+		return 0, &OpError{
+			Op:   "opus_decoder_ctl",
+			Args: "OPUS_GET_BANDWIDTH",
+			Err:  Error(res),
+		}
+	}
+	return Bandwidth(bw), nil
+}
+
+// SampleRate returns the decoder sample rate in Hz.
+func (dec *Decoder) SampleRate() (int, error) {
+	var sr C.opus_int32
+	res := C.bridge_decoder_get_sample_rate(dec.p, &sr)
+	if res != C.OPUS_OK {
+		return 0, &OpError{
+			Op:   "opus_decoder_ctl",
+			Args: "OPUS_GET_SAMPLE_RATE",
+			Err:  Error(res),
+		}
+	}
+	return int(sr), nil
+}
+
+// Channels returns the number of channels the decoder was initialized with.
+func (dec *Decoder) Channels() int {
+	return dec.channels
+}
+
+// SetPhaseInversionDisabled configures whether the decoder undoes the phase
+// inversion used in intensity stereo. Disabling it improves the quality of mono
+// downmixes at a slight cost in stereo quality.
+func (dec *Decoder) SetPhaseInversionDisabled(disabled bool) error {
+	i := 0
+	if disabled {
+		i = 1
+	}
+	res := C.bridge_decoder_set_phase_inversion_disabled(dec.p, C.opus_int32(i))
+	if res != C.OPUS_OK {
+		return &OpError{
+			Op:   "opus_decoder_ctl",
+			Args: fmt.Sprintf("OPUS_SET_PHASE_INVERSION_DISABLED(%d)", i),
+			Err:  Error(res),
+		}
+	}
+	return nil
+}
+
+// PhaseInversionDisabled reports whether phase inversion is disabled.
+func (dec *Decoder) PhaseInversionDisabled() (bool, error) {
+	var disabled C.opus_int32
+	res := C.bridge_decoder_get_phase_inversion_disabled(dec.p, &disabled)
+	if res != C.OPUS_OK {
+		return false, &OpError{
+			Op:   "opus_decoder_ctl",
+			Args: "OPUS_GET_PHASE_INVERSION_DISABLED",
+			Err:  Error(res),
+		}
+	}
+	return disabled != 0, nil
+}
+
+// Reset resets the decoder state to be equivalent to a freshly initialized
+// state, e.g. after a discontinuity in the stream. Settings like the gain are
+// kept.
+func (dec *Decoder) Reset() error {
+	res := C.bridge_decoder_reset_state(dec.p)
+	if res != C.OPUS_OK {
+		return &OpError{
+			Op:   "opus_decoder_ctl",
+			Args: "OPUS_RESET_STATE",
+			Err:  Error(res),
+		}
+	}
+	return nil
+}
@@ -22,11 +22,11 @@ func TestDecoderNew(t *testing.T) {
 func TestDecoderUnitialized(t *testing.T) {
 	var dec Decoder
 	_, err := dec.Decode(nil, nil)
-	if err != errDecUninitialized {
+	if err != ErrDecoderUninitialized {
 		t.Errorf("Expected \"unitialized decoder\" error: %v", err)
 	}
 	_, err = dec.DecodeFloat32(nil, nil)
-	if err != errDecUninitialized {
+	if err != ErrDecoderUninitialized {
 		t.Errorf("Expected \"unitialized decoder\" error: %v", err)
 	}
 }
@@ -66,3 +66,124 @@ func TestDecoder_GetLastPacketDuration(t *testing.T) {
 		t.Fatalf("Wrong duration length. Expected %d. Got %d", n, samples)
 	}
 }
+
+func TestDecoder_SetGetGain(t *testing.T) {
+	dec, err := NewDecoder(48000, 1)
+	if err != nil || dec == nil {
+		t.Fatalf("Error creating new decoder: %v", err)
+	}
+	vals := []int{-32768, -256, 0, 1536, 32767}
+	for _, gain := range vals {
+		if err := dec.SetGain(gain); err != nil {
+			t.Error("Error setting gain:", err)
+		}
+		got, err := dec.Gain()
+		if err != nil {
+			t.Error("Error getting gain", err)
+		}
+		if got != gain {
+			t.Errorf("Unexpected gain. Got %d, but expected %d", got, gain)
+		}
+	}
+	if err := dec.SetGain(32768); err == nil {
+		t.Errorf("Expected Error invalid gain")
+	}
+}
+
+func TestDecoder_Getters(t *testing.T) {
+	const SAMPLE_RATE = 24000
+	const FRAME_SIZE = SAMPLE_RATE * 20 / 1000
+	enc, err := NewEncoder(SAMPLE_RATE, 2, AppVoIP)
+	if err != nil || enc == nil {
+		t.Fatalf("Error creating new encoder: %v", err)
+	}
+	if err := enc.SetBandwidth(Wideband); err != nil {
+		t.Fatalf("Error setting bandwidth: %v", err)
+	}
+	dec, err := NewDecoder(SAMPLE_RATE, 2)
+	if err != nil || dec == nil {
+		t.Fatalf("Error creating new decoder: %v", err)
+	}
+	if dec.Channels() != 2 {
+		t.Errorf("Unexpected number of channels: %d", dec.Channels())
+	}
+	sr, err := dec.SampleRate()
+	if err != nil || sr != SAMPLE_RATE {
+		t.Errorf("Unexpected sample rate: %d (%v)", sr, err)
+	}
+	pcm := make([]int16, FRAME_SIZE*2)
+	addSine(pcm, SAMPLE_RATE, 220)
+	data := make([]byte, 1000)
+	n, err := enc.Encode(pcm, data)
+	if err != nil {
+		t.Fatalf("Couldn't encode data: %v", err)
+	}
+	if _, err := dec.Decode(data[:n], pcm); err != nil {
+		t.Fatalf("Couldn't decode data: %v", err)
+	}
+	bw, err := dec.Bandwidth()
+	if err != nil || bw != Wideband {
+		t.Errorf("Unexpected bandwidth: %v (%v)", bw, err)
+	}
+	if _, err := dec.Pitch(); err != nil {
+		t.Errorf("Error getting pitch: %v", err)
+	}
+}
+
+func TestDecoder_SetGetPhaseInversionDisabled(t *testing.T) {
+	dec, err := NewDecoder(48000, 2)
+	if err != nil || dec == nil {
+		t.Fatalf("Error creating new decoder: %v", err)
+	}
+	vals := []bool{true, false}
+	for _, disabled := range vals {
+		if err := dec.SetPhaseInversionDisabled(disabled); err != nil {
+			t.Error("Error setting phase inversion disabled:", err)
+		}
+		got, err := dec.PhaseInversionDisabled()
+		if err != nil {
+			t.Error("Error getting phase inversion disabled", err)
+		}
+		if got != disabled {
+			t.Errorf("Wrong phase inversion disabled value. Got %t, but expected %t", got, disabled)
+		}
+	}
+}
+
+func TestDecoder_Reset(t *testing.T) {
+	const SAMPLE_RATE = 48000
+	const FRAME_SIZE = SAMPLE_RATE * 20 / 1000
+	enc, err := NewEncoder(SAMPLE_RATE, 1, AppAudio)
+	if err != nil || enc == nil {
+		t.Fatalf("Error creating new encoder: %v", err)
+	}
+	pcm := make([]int16, FRAME_SIZE)
+	addSine(pcm, SAMPLE_RATE, 440)
+	data := make([]byte, 1000)
+	n, err := enc.Encode(pcm, data)
+	if err != nil {
+		t.Fatalf("Couldn't encode data: %v", err)
+	}
+	data = data[:n]
+
+	dec, err := NewDecoder(SAMPLE_RATE, 1)
+	if err != nil || dec == nil {
+		t.Fatalf("Error creating new decoder: %v", err)
+	}
+	first := make([]int16, FRAME_SIZE)
+	if _, err := dec.Decode(data, first); err != nil {
+		t.Fatalf("Couldn't decode data: %v", err)
+	}
+	// Decoding the same packet again without a reset gives different output,
+	// because the decoder state has changed.
+	if err := dec.Reset(); err != nil {
+		t.Fatalf("Error resetting decoder: %v", err)
+	}
+	second := make([]int16, FRAME_SIZE)
+	if _, err := dec.Decode(data, second); err != nil {
+		t.Fatalf("Couldn't decode data: %v", err)
+	}
+	if d := maxDiff(first, second); d != 0 {
+		t.Errorf("Decoder output after reset differs from fresh decoder: %d", d)
+	}
+}
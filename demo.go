@@ -0,0 +1,229 @@
+// Copyright © Go Opus Authors (see AUTHORS file)
+//
+// License for use of this code is detailed in the LICENSE file
+
+package opus
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Largest packet accepted by opus_demo when reading a bitstream.
+const maxDemoPacketSize = 1500
+
+// DemoWriter writes Opus packets in the bitstream format used by the opus_demo
+// tool that ships with libopus. Every packet is stored as a 32-bit big-endian
+// length, the 32-bit big-endian final range of the encoder, and the packet
+// itself.
+//
+// A packet of length zero marks a lost packet.
+type DemoWriter struct {
+	w   io.Writer
+	hdr [8]byte
+}
+
+// NewDemoWriter creates a writer for opus_demo bitstreams.
+func NewDemoWriter(w io.Writer) *DemoWriter {
+	return &DemoWriter{w: w}
+}
+
+// WritePacket writes a single packet along with the final range reported by
+// the encoder after encoding it.
+func (dw *DemoWriter) WritePacket(data []byte, finalRange uint32) error {
+	if len(data) > maxDemoPacketSize {
+		return fmt.Errorf("%w: packet too large for opus_demo bitstream: %d bytes", ErrBadArg, len(data))
+	}
+	binary.BigEndian.PutUint32(dw.hdr[0:4], uint32(len(data)))
+	binary.BigEndian.PutUint32(dw.hdr[4:8], finalRange)
+	if _, err := dw.w.Write(dw.hdr[:]); err != nil {
+		return err
+	}
+	_, err := dw.w.Write(data)
+	return err
+}
+
+// DemoReader reads Opus packets from an opus_demo bitstream.
+type DemoReader struct {
+	r   io.Reader
+	hdr [8]byte
+	buf []byte
+}
+
+// NewDemoReader creates a reader for opus_demo bitstreams.
+func NewDemoReader(r io.Reader) *DemoReader {
+	return &DemoReader{r: r, buf: make([]byte, maxDemoPacketSize)}
+}
+
+// ReadPacket reads the next packet and the encoder final range stored with it.
+// The returned slice is only valid until the next call to ReadPacket. An empty
+// packet means the packet was lost. Returns io.EOF when the stream ends cleanly
+// between two packets.
+func (dr *DemoReader) ReadPacket() ([]byte, uint32, error) {
+	if _, err := io.ReadFull(dr.r, dr.hdr[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, 0, fmt.Errorf("opus: truncated opus_demo packet header: %w", io.ErrUnexpectedEOF)
+		}
+		return nil, 0, err
+	}
+	n := binary.BigEndian.Uint32(dr.hdr[0:4])
+	finalRange := binary.BigEndian.Uint32(dr.hdr[4:8])
+	if n > maxDemoPacketSize {
+		return nil, 0, fmt.Errorf("%w: opus_demo payload length %d", ErrInvalidPacket, n)
+	}
+	data := dr.buf[:n]
+	if _, err := io.ReadFull(dr.r, data); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, 0, fmt.Errorf("opus: truncated opus_demo packet: %w", io.ErrUnexpectedEOF)
+		}
+		return nil, 0, err
+	}
+	return data, finalRange, nil
+}
+
+// DemoEncoder encodes raw PCM data with an Encoder and writes the resulting
+// packets as an opus_demo bitstream.
+type DemoEncoder struct {
+	enc *Encoder
+	w   *DemoWriter
+	buf []byte
+}
+
+// NewDemoEncoder creates an opus_demo bitstream writer on top of an
+// initialized encoder.
+func NewDemoEncoder(w io.Writer, enc *Encoder) *DemoEncoder {
+	return &DemoEncoder{
+		enc: enc,
+		w:   NewDemoWriter(w),
+		buf: make([]byte, maxDemoPacketSize),
+	}
+}
+
+// Encode encodes a single frame of PCM data and writes it to the bitstream.
+func (de *DemoEncoder) Encode(pcm []int16) error {
+	n, err := de.enc.Encode(pcm, de.buf)
+	if err != nil {
+		return err
+	}
+	return de.writePacket(de.buf[:n])
+}
+
+// EncodeFloat32 is the same as Encode, but for float32 PCM data.
+func (de *DemoEncoder) EncodeFloat32(pcm []float32) error {
+	n, err := de.enc.EncodeFloat32(pcm, de.buf)
+	if err != nil {
+		return err
+	}
+	return de.writePacket(de.buf[:n])
+}
+
+func (de *DemoEncoder) writePacket(data []byte) error {
+	finalRange, err := de.enc.FinalRange()
+	if err != nil {
+		return err
+	}
+	return de.w.WritePacket(data, finalRange)
+}
+
+// DemoDecoder reads an opus_demo bitstream and decodes it with a Decoder,
+// verifying the final range of every packet against the one stored by the
+// encoder.
+type DemoDecoder struct {
+	dec *Decoder
+	r   *DemoReader
+	// Number of packets read so far, used in error messages.
+	packets int
+}
+
+// NewDemoDecoder creates an opus_demo bitstream reader on top of an
+// initialized decoder.
+func NewDemoDecoder(r io.Reader, dec *Decoder) *DemoDecoder {
+	return &DemoDecoder{
+		dec: dec,
+		r:   NewDemoReader(r),
+	}
+}
+
+// Decode reads the next packet from the bitstream and decodes it into the
+// supplied buffer. Lost packets are concealed using PLC. On success, returns
+// the number of samples per channel written to pcm.
+//
+// If the decoder's final range does not match the one stored in the
+// bitstream, the decoded samples are still returned, along with an error
+// describing the mismatch. A stored final range of zero is not checked, just
+// like opus_demo does.
+func (dd *DemoDecoder) Decode(pcm []int16) (int, error) {
+	data, encRange, err := dd.r.ReadPacket()
+	if err != nil {
+		return 0, err
+	}
+	dd.packets++
+	if len(data) == 0 {
+		samples, err := dd.concealedSamples(len(pcm))
+		if err != nil {
+			return 0, err
+		}
+		if err := dd.dec.DecodePLC(pcm[:samples*dd.dec.channels]); err != nil {
+			return 0, err
+		}
+		return samples, nil
+	}
+	n, err := dd.dec.Decode(data, pcm)
+	if err != nil {
+		return 0, err
+	}
+	return n, dd.verify(encRange)
+}
+
+// DecodeFloat32 is the same as Decode, but decodes to float32 PCM data.
+func (dd *DemoDecoder) DecodeFloat32(pcm []float32) (int, error) {
+	data, encRange, err := dd.r.ReadPacket()
+	if err != nil {
+		return 0, err
+	}
+	dd.packets++
+	if len(data) == 0 {
+		samples, err := dd.concealedSamples(len(pcm))
+		if err != nil {
+			return 0, err
+		}
+		if err := dd.dec.DecodePLCFloat32(pcm[:samples*dd.dec.channels]); err != nil {
+			return 0, err
+		}
+		return samples, nil
+	}
+	n, err := dd.dec.DecodeFloat32(data, pcm)
+	if err != nil {
+		return 0, err
+	}
+	return n, dd.verify(encRange)
+}
+
+// concealedSamples returns the number of samples per channel to conceal for a
+// lost packet, checking that they fit in a buffer of bufSize samples.
+func (dd *DemoDecoder) concealedSamples(bufSize int) (int, error) {
+	samples, err := dd.dec.concealSamples()
+	if err != nil {
+		return 0, err
+	}
+	if samples*dd.dec.channels > bufSize {
+		return 0, fmt.Errorf("%w: concealed packet has %d samples", ErrBufferTooSmall, samples)
+	}
+	return samples, nil
+}
+
+func (dd *DemoDecoder) verify(encRange uint32) error {
+	if encRange == 0 {
+		return nil
+	}
+	decRange, err := dd.dec.FinalRange()
+	if err != nil {
+		return err
+	}
+	if decRange != encRange {
+		return fmt.Errorf("%w in packet %d: encoder %#08x, decoder %#08x", ErrRangeMismatch,
+			dd.packets, encRange, decRange)
+	}
+	return nil
+}
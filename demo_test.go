@@ -0,0 +1,118 @@
+// Copyright © Go Opus Authors (see AUTHORS file)
+//
+// License for use of this code is detailed in the LICENSE file
+
+package opus
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+)
+
+func encodeDemoStream(t *testing.T, frames int) []byte {
+	const G4 = 391.995
+	const SAMPLE_RATE = 48000
+	const FRAME_SIZE_MS = 20
+	const FRAME_SIZE = SAMPLE_RATE * FRAME_SIZE_MS / 1000
+	enc, err := NewEncoder(SAMPLE_RATE, 1, AppVoIP)
+	if err != nil || enc == nil {
+		t.Fatalf("Error creating new encoder: %v", err)
+	}
+	pcm := make([]int16, FRAME_SIZE*frames)
+	addSine(pcm, SAMPLE_RATE, G4)
+	var buf bytes.Buffer
+	de := NewDemoEncoder(&buf, enc)
+	for i := 0; i < len(pcm); i += FRAME_SIZE {
+		if err := de.Encode(pcm[i : i+FRAME_SIZE]); err != nil {
+			t.Fatalf("Couldn't encode frame: %v", err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestDemoRoundTrip(t *testing.T) {
+	const NUMBER_OF_FRAMES = 10
+	stream := encodeDemoStream(t, NUMBER_OF_FRAMES)
+	// Append a lost packet, which must be concealed
+	var lostBuf bytes.Buffer
+	if err := NewDemoWriter(&lostBuf).WritePacket(nil, 0); err != nil {
+		t.Fatalf("Couldn't write lost packet: %v", err)
+	}
+	stream = append(stream, lostBuf.Bytes()...)
+
+	dec, err := NewDecoder(48000, 1)
+	if err != nil || dec == nil {
+		t.Fatalf("Error creating new decoder: %v", err)
+	}
+	dd := NewDemoDecoder(bytes.NewReader(stream), dec)
+	pcm := make([]int16, 5760)
+	for i := 0; i < NUMBER_OF_FRAMES+1; i++ {
+		n, err := dd.Decode(pcm)
+		if err != nil {
+			t.Fatalf("Couldn't decode packet %d: %v", i, err)
+		}
+		if n != 960 {
+			t.Errorf("Unexpected number of samples in packet %d: %d", i, n)
+		}
+	}
+	if _, err := dd.Decode(pcm); err != io.EOF {
+		t.Errorf("Expected EOF at end of stream, got: %v", err)
+	}
+}
+
+func TestDemoRangeMismatch(t *testing.T) {
+	stream := encodeDemoStream(t, 3)
+	// Flip the last bit of the first packet
+	n := binary.BigEndian.Uint32(stream[0:4])
+	stream[8+n-1] ^= 1
+
+	dec, err := NewDecoder(48000, 1)
+	if err != nil || dec == nil {
+		t.Fatalf("Error creating new decoder: %v", err)
+	}
+	dd := NewDemoDecoder(bytes.NewReader(stream), dec)
+	pcm := make([]int16, 5760)
+	_, err = dd.Decode(pcm)
+	if !errors.Is(err, ErrRangeMismatch) {
+		t.Errorf("Expected final range mismatch for corrupted packet, got: %v", err)
+	}
+	if _, err := dd.Decode(pcm); err != nil {
+		t.Errorf("Unexpected error for intact packet: %v", err)
+	}
+}
+
+func TestDemoReaderTruncated(t *testing.T) {
+	stream := encodeDemoStream(t, 1)
+	dr := NewDemoReader(bytes.NewReader(stream[:len(stream)-1]))
+	if _, _, err := dr.ReadPacket(); err == nil || err == io.EOF {
+		t.Errorf("Expected error for truncated packet, got: %v", err)
+	}
+	dr = NewDemoReader(bytes.NewReader([]byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0}))
+	if _, _, err := dr.ReadPacket(); err == nil {
+		t.Errorf("Expected error for invalid payload length")
+	}
+}
+
+func TestDemoFirstPacketLost(t *testing.T) {
+	var buf bytes.Buffer
+	if err := NewDemoWriter(&buf).WritePacket(nil, 0); err != nil {
+		t.Fatalf("Couldn't write lost packet: %v", err)
+	}
+	dec, err := NewDecoder(16000, 2)
+	if err != nil || dec == nil {
+		t.Fatalf("Error creating new decoder: %v", err)
+	}
+	dd := NewDemoDecoder(bytes.NewReader(buf.Bytes()), dec)
+	pcm := make([]float32, 5760)
+	n, err := dd.DecodeFloat32(pcm)
+	if err != nil {
+		t.Fatalf("Couldn't conceal lost first packet: %v", err)
+	}
+	// 20 ms at 16 kHz
+	if n != 320 {
+		t.Errorf("Unexpected number of concealed samples: %d", n)
+	}
+}
@@ -0,0 +1,268 @@
+// Copyright © Go Opus Authors (see AUTHORS file)
+//
+// License for use of this code is detailed in the LICENSE file
+
+package opus
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// EBML and Matroska element IDs used for WebM audio, see RFC 8794 and the
+// Matroska specification.
+const (
+	ebmlIDHeader             = 0x1A45DFA3
+	ebmlIDVersion            = 0x4286
+	ebmlIDReadVersion        = 0x42F7
+	ebmlIDMaxIDLength        = 0x42F2
+	ebmlIDMaxSizeLength      = 0x42F3
+	ebmlIDDocType            = 0x4282
+	ebmlIDDocTypeVersion     = 0x4287
+	ebmlIDDocTypeReadVersion = 0x4285
+	ebmlIDVoid               = 0xEC
+	ebmlIDCRC32              = 0xBF
+
+	mkvIDSegment           = 0x18538067
+	mkvIDSeekHead          = 0x114D9B74
+	mkvIDSeek              = 0x4DBB
+	mkvIDSeekID            = 0x53AB
+	mkvIDSeekPosition      = 0x53AC
+	mkvIDInfo              = 0x1549A966
+	mkvIDTimestampScale    = 0x2AD7B1
+	mkvIDDuration          = 0x4489
+	mkvIDMuxingApp         = 0x4D80
+	mkvIDWritingApp        = 0x5741
+	mkvIDTracks            = 0x1654AE6B
+	mkvIDTrackEntry        = 0xAE
+	mkvIDTrackNumber       = 0xD7
+	mkvIDTrackUID          = 0x73C5
+	mkvIDTrackType         = 0x83
+	mkvIDCodecID           = 0x86
+	mkvIDCodecPrivate      = 0x63A2
+	mkvIDCodecDelay        = 0x56AA
+	mkvIDSeekPreRoll       = 0x56BB
+	mkvIDAudio             = 0xE1
+	mkvIDSamplingFrequency = 0xB5
+	mkvIDChannels          = 0x9F
+	mkvIDBitDepth          = 0x6264
+	mkvIDCluster           = 0x1F43B675
+	mkvIDTimestamp         = 0xE7
+	mkvIDSimpleBlock       = 0xA3
+	mkvIDBlockGroup        = 0xA0
+	mkvIDBlock             = 0xA1
+	mkvIDBlockDuration     = 0x9B
+	mkvIDDiscardPadding    = 0x75A2
+	mkvIDCues              = 0x1C53BB6B
+	mkvIDCuePoint          = 0xBB
+	mkvIDCueTime           = 0xB3
+	mkvIDCueTrackPositions = 0xB7
+	mkvIDCueTrack          = 0xF7
+	mkvIDCueClusterPos     = 0xF1
+)
+
+// Matroska track type of audio tracks
+const mkvTrackTypeAudio = 2
+
+// Matroska codec ID of Opus
+const mkvCodecOpus = "A_OPUS"
+
+// Element size meaning "until the parent ends", for live streams.
+const ebmlUnknownSize = -1
+
+// Largest element read into memory, e.g. Tracks or a block. Larger elements
+// can only be skipped.
+const ebmlMaxElementSize = 16 << 20
+
+// readVint reads an EBML variable size integer, with its length marker when
+// keepMarker is set (element IDs), or without (element sizes). Returns the
+// value and the number of bytes read. A size with all value bits set is
+// ebmlUnknownSize.
+func readVint(r io.ByteReader, keepMarker bool) (int64, int, error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return 0, 0, err
+	}
+	length := 1
+	for mask := byte(0x80); first&mask == 0; mask >>= 1 {
+		length++
+		if mask == 1 {
+			return 0, 1, fmt.Errorf("%w: invalid EBML variable size integer", ErrInvalidContainer)
+		}
+	}
+	value := int64(first)
+	if !keepMarker {
+		value &= int64(0xff >> length)
+	}
+	allOnes := value == int64(0xff>>length)
+	for i := 1; i < length; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, i, err
+		}
+		value = value<<8 | int64(b)
+		allOnes = allOnes && b == 0xff
+	}
+	if !keepMarker && allOnes {
+		return ebmlUnknownSize, length, nil
+	}
+	return value, length, nil
+}
+
+// appendVint appends an element size, using the shortest encoding, or at
+// least minLength bytes.
+func appendVint(b []byte, value int64, minLength int) []byte {
+	if value == ebmlUnknownSize {
+		return append(b, 0x01, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff)
+	}
+	length := 1
+	// All ones is reserved for the unknown size
+	for value >= int64(1)<<(7*length)-1 {
+		length++
+	}
+	if length < minLength {
+		length = minLength
+	}
+	value |= int64(1) << (7 * length)
+	for i := length - 1; i >= 0; i-- {
+		b = append(b, byte(value>>(8*i)))
+	}
+	return b
+}
+
+// appendID appends an element ID, which includes its length marker.
+func appendID(b []byte, id uint32) []byte {
+	switch {
+	case id >= 1<<24:
+		return append(b, byte(id>>24), byte(id>>16), byte(id>>8), byte(id))
+	case id >= 1<<16:
+		return append(b, byte(id>>16), byte(id>>8), byte(id))
+	case id >= 1<<8:
+		return append(b, byte(id>>8), byte(id))
+	}
+	return append(b, byte(id))
+}
+
+// appendElement appends a complete element with the given payload.
+func appendElement(b []byte, id uint32, payload []byte) []byte {
+	b = appendID(b, id)
+	b = appendVint(b, int64(len(payload)), 1)
+	return append(b, payload...)
+}
+
+// appendUintElement appends an unsigned integer element in as few bytes as
+// possible.
+func appendUintElement(b []byte, id uint32, v uint64) []byte {
+	n := 1
+	for v>>(8*n) != 0 && n < 8 {
+		n++
+	}
+	payload := make([]byte, n)
+	for i := range payload {
+		payload[i] = byte(v >> (8 * (n - 1 - i)))
+	}
+	return appendElement(b, id, payload)
+}
+
+// appendIntElement appends a signed integer element in as few bytes as
+// possible.
+func appendIntElement(b []byte, id uint32, v int64) []byte {
+	n := 1
+	for n < 8 && (v < -(int64(1)<<(8*n-1)) || v >= int64(1)<<(8*n-1)) {
+		n++
+	}
+	payload := make([]byte, n)
+	for i := range payload {
+		payload[i] = byte(v >> (8 * (n - 1 - i)))
+	}
+	return appendElement(b, id, payload)
+}
+
+func appendFloatElement(b []byte, id uint32, v float64) []byte {
+	payload := make([]byte, 8)
+	binary.BigEndian.PutUint64(payload, math.Float64bits(v))
+	return appendElement(b, id, payload)
+}
+
+func ebmlUint(payload []byte) (uint64, error) {
+	if len(payload) > 8 {
+		return 0, fmt.Errorf("%w: %d byte integer", ErrInvalidContainer, len(payload))
+	}
+	var v uint64
+	for _, b := range payload {
+		v = v<<8 | uint64(b)
+	}
+	return v, nil
+}
+
+func ebmlInt(payload []byte) (int64, error) {
+	if len(payload) > 8 {
+		return 0, fmt.Errorf("%w: %d byte integer", ErrInvalidContainer, len(payload))
+	}
+	if len(payload) == 0 {
+		return 0, nil
+	}
+	v := int64(int8(payload[0]))
+	for _, b := range payload[1:] {
+		v = v<<8 | int64(b)
+	}
+	return v, nil
+}
+
+func ebmlFloat(payload []byte) (float64, error) {
+	switch len(payload) {
+	case 0:
+		return 0, nil
+	case 4:
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(payload))), nil
+	case 8:
+		return math.Float64frombits(binary.BigEndian.Uint64(payload)), nil
+	}
+	return 0, fmt.Errorf("%w: %d byte float", ErrInvalidContainer, len(payload))
+}
+
+// byteSliceReader is a minimal io.ByteReader over a slice, used to parse
+// elements that are already in memory.
+type byteSliceReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *byteSliceReader) ReadByte() (byte, error) {
+	if r.pos >= len(r.data) {
+		return 0, io.EOF
+	}
+	b := r.data[r.pos]
+	r.pos++
+	return b, nil
+}
+
+// parseElements calls fn for every child element in the payload of a master
+// element that is already in memory.
+func parseElements(data []byte, fn func(id uint32, payload []byte) error) error {
+	r := &byteSliceReader{data: data}
+	for r.pos < len(data) {
+		id, _, err := readVint(r, true)
+		if err != nil {
+			return fmt.Errorf("%w: truncated element", ErrInvalidContainer)
+		}
+		size, _, err := readVint(r, false)
+		if err != nil {
+			return fmt.Errorf("%w: truncated element", ErrInvalidContainer)
+		}
+		if size == ebmlUnknownSize || size > int64(len(data)-r.pos) {
+			return fmt.Errorf("%w: element %#x overflows its parent", ErrInvalidContainer, id)
+		}
+		payload := data[r.pos : r.pos+int(size)]
+		r.pos += int(size)
+		if err := fn(uint32(id), payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -6,6 +6,7 @@ package opus
 
 import (
 	"fmt"
+	"time"
 	"unsafe"
 )
 
@@ -104,12 +105,146 @@ bridge_encoder_reset_state(OpusEncoder *st)
 	return opus_encoder_ctl(st, OPUS_RESET_STATE);
 }
 
+int
+bridge_encoder_get_final_range(OpusEncoder *st, opus_uint32 *final_range)
+{
+	return opus_encoder_ctl(st, OPUS_GET_FINAL_RANGE(final_range));
+}
+
+int
+bridge_encoder_set_vbr(OpusEncoder *st, opus_int32 vbr)
+{
+	return opus_encoder_ctl(st, OPUS_SET_VBR(vbr));
+}
+
+int
+bridge_encoder_get_vbr(OpusEncoder *st, opus_int32 *vbr)
+{
+	return opus_encoder_ctl(st, OPUS_GET_VBR(vbr));
+}
+
+int
+bridge_encoder_set_vbr_constraint(OpusEncoder *st, opus_int32 constraint)
+{
+	return opus_encoder_ctl(st, OPUS_SET_VBR_CONSTRAINT(constraint));
+}
+
+int
+bridge_encoder_get_vbr_constraint(OpusEncoder *st, opus_int32 *constraint)
+{
+	return opus_encoder_ctl(st, OPUS_GET_VBR_CONSTRAINT(constraint));
+}
+
+int
+bridge_encoder_set_signal(OpusEncoder *st, opus_int32 signal)
+{
+	return opus_encoder_ctl(st, OPUS_SET_SIGNAL(signal));
+}
+
+int
+bridge_encoder_get_signal(OpusEncoder *st, opus_int32 *signal)
+{
+	return opus_encoder_ctl(st, OPUS_GET_SIGNAL(signal));
+}
+
+int
+bridge_encoder_set_application(OpusEncoder *st, opus_int32 application)
+{
+	return opus_encoder_ctl(st, OPUS_SET_APPLICATION(application));
+}
+
+int
+bridge_encoder_get_application(OpusEncoder *st, opus_int32 *application)
+{
+	return opus_encoder_ctl(st, OPUS_GET_APPLICATION(application));
+}
+
+int
+bridge_encoder_set_force_channels(OpusEncoder *st, opus_int32 channels)
+{
+	return opus_encoder_ctl(st, OPUS_SET_FORCE_CHANNELS(channels));
+}
+
+int
+bridge_encoder_get_force_channels(OpusEncoder *st, opus_int32 *channels)
+{
+	return opus_encoder_ctl(st, OPUS_GET_FORCE_CHANNELS(channels));
+}
+
+int
+bridge_encoder_set_expert_frame_duration(OpusEncoder *st, opus_int32 duration)
+{
+	return opus_encoder_ctl(st, OPUS_SET_EXPERT_FRAME_DURATION(duration));
+}
+
+int
+bridge_encoder_get_expert_frame_duration(OpusEncoder *st, opus_int32 *duration)
+{
+	return opus_encoder_ctl(st, OPUS_GET_EXPERT_FRAME_DURATION(duration));
+}
+
+int
+bridge_encoder_set_prediction_disabled(OpusEncoder *st, opus_int32 disabled)
+{
+	return opus_encoder_ctl(st, OPUS_SET_PREDICTION_DISABLED(disabled));
+}
+
+int
+bridge_encoder_get_prediction_disabled(OpusEncoder *st, opus_int32 *disabled)
+{
+	return opus_encoder_ctl(st, OPUS_GET_PREDICTION_DISABLED(disabled));
+}
+
+int
+bridge_encoder_set_lsb_depth(OpusEncoder *st, opus_int32 depth)
+{
+	return opus_encoder_ctl(st, OPUS_SET_LSB_DEPTH(depth));
+}
+
+int
+bridge_encoder_get_lsb_depth(OpusEncoder *st, opus_int32 *depth)
+{
+	return opus_encoder_ctl(st, OPUS_GET_LSB_DEPTH(depth));
+}
+
+int
+bridge_encoder_set_phase_inversion_disabled(OpusEncoder *st, opus_int32 disabled)
+{
+	return opus_encoder_ctl(st, OPUS_SET_PHASE_INVERSION_DISABLED(disabled));
+}
+
+int
+bridge_encoder_get_phase_inversion_disabled(OpusEncoder *st, opus_int32 *disabled)
+{
+	return opus_encoder_ctl(st, OPUS_GET_PHASE_INVERSION_DISABLED(disabled));
+}
+
+int
+bridge_encoder_set_bandwidth(OpusEncoder *st, opus_int32 bw)
+{
+	return opus_encoder_ctl(st, OPUS_SET_BANDWIDTH(bw));
+}
+
+int
+bridge_encoder_get_bandwidth(OpusEncoder *st, opus_int32 *bw)
+{
+	return opus_encoder_ctl(st, OPUS_GET_BANDWIDTH(bw));
+}
+
+int
+bridge_encoder_get_lookahead(OpusEncoder *st, opus_int32 *lookahead)
+{
+	return opus_encoder_ctl(st, OPUS_GET_LOOKAHEAD(lookahead));
+}
+
 */
 import "C"
 
 type Bandwidth int
 
 const (
+	// Let the encoder pick the bandwidth
+	BandwidthAuto = Bandwidth(C.OPUS_AUTO)
 	// 4 kHz passband
 	Narrowband = Bandwidth(C.OPUS_BANDWIDTH_NARROWBAND)
 	// 6 kHz passband
@@ -122,12 +257,93 @@ const (
 	Fullband = Bandwidth(C.OPUS_BANDWIDTH_FULLBAND)
 )
 
-var errEncUninitialized = fmt.Errorf("opus encoder uninitialized")
+func (bw Bandwidth) String() string {
+	switch bw {
+	case Narrowband:
+		return "narrowband"
+	case Mediumband:
+		return "mediumband"
+	case Wideband:
+		return "wideband"
+	case SuperWideband:
+		return "superwideband"
+	case Fullband:
+		return "fullband"
+	case BandwidthAuto:
+		return "auto"
+	default:
+		return "unknown"
+	}
+}
+
+// Signal is a hint to the encoder about the type of audio it is encoding.
+type Signal int
+
+const (
+	// Let the encoder detect the type of signal
+	SignalAuto = Signal(C.OPUS_AUTO)
+	// Bias thresholds towards choosing LPC or Hybrid modes
+	SignalVoice = Signal(C.OPUS_SIGNAL_VOICE)
+	// Bias thresholds towards choosing MDCT modes
+	SignalMusic = Signal(C.OPUS_SIGNAL_MUSIC)
+)
+
+// Let the encoder decide on the number of channels, see SetForceChannels.
+const ForceChannelsAuto = int(C.OPUS_AUTO)
+
+// Special bitrate values, equivalent to SetBitrateToAuto and SetBitrateToMax.
+const (
+	BitrateAuto = int(C.OPUS_AUTO)
+	BitrateMax  = int(C.OPUS_BITRATE_MAX)
+)
+
+// FrameDuration is the frame duration used by the encoder, see
+// SetExpertFrameDuration.
+type FrameDuration int
+
+const (
+	// Use the duration of the PCM data passed to Encode
+	FrameDurationArg   = FrameDuration(C.OPUS_FRAMESIZE_ARG)
+	FrameDuration2_5Ms = FrameDuration(C.OPUS_FRAMESIZE_2_5_MS)
+	FrameDuration5Ms   = FrameDuration(C.OPUS_FRAMESIZE_5_MS)
+	FrameDuration10Ms  = FrameDuration(C.OPUS_FRAMESIZE_10_MS)
+	FrameDuration20Ms  = FrameDuration(C.OPUS_FRAMESIZE_20_MS)
+	FrameDuration40Ms  = FrameDuration(C.OPUS_FRAMESIZE_40_MS)
+	FrameDuration60Ms  = FrameDuration(C.OPUS_FRAMESIZE_60_MS)
+	FrameDuration80Ms  = FrameDuration(C.OPUS_FRAMESIZE_80_MS)
+	FrameDuration100Ms = FrameDuration(C.OPUS_FRAMESIZE_100_MS)
+	FrameDuration120Ms = FrameDuration(C.OPUS_FRAMESIZE_120_MS)
+)
+
+// Duration returns the length of a frame, or 0 for FrameDurationArg and
+// invalid values.
+func (fd FrameDuration) Duration() time.Duration {
+	switch fd {
+	case FrameDuration2_5Ms:
+		return 2500 * time.Microsecond
+	case FrameDuration5Ms, FrameDuration10Ms, FrameDuration20Ms:
+		return (5 * time.Millisecond) << uint(fd-FrameDuration5Ms)
+	case FrameDuration40Ms, FrameDuration60Ms, FrameDuration80Ms, FrameDuration100Ms, FrameDuration120Ms:
+		return time.Duration(fd-FrameDuration40Ms+2) * 20 * time.Millisecond
+	default:
+		return 0
+	}
+}
+
+// Samples returns the number of samples per channel in a frame at the given
+// sample rate, or 0 for FrameDurationArg and invalid values.
+func (fd FrameDuration) Samples(sample_rate int) int {
+	return int(fd.Duration() * time.Duration(sample_rate) / time.Second)
+}
 
 // Encoder contains the state of an Opus encoder for libopus.
 type Encoder struct {
-	p        *C.struct_OpusEncoder
-	channels int
+	p           *C.struct_OpusEncoder
+	channels    int
+	sample_rate int
+	// Frame duration set with SetExpertFrameDuration, used to validate the
+	// length of the PCM data passed to Encode.
+	frameDuration FrameDuration
 	// Memory for the encoder struct allocated on the Go heap to allow Go GC to
 	// manage it (and obviate need to free())
 	mem []byte
@@ -149,13 +365,15 @@ func NewEncoder(sample_rate int, channels int, application Application) (*Encode
 // life-time of this object, before calling any other methods.
 func (enc *Encoder) Init(sample_rate int, channels int, application Application) error {
 	if enc.p != nil {
-		return fmt.Errorf("opus encoder already initialized")
+		return ErrAlreadyInitialized
 	}
 	if channels != 1 && channels != 2 {
-		return fmt.Errorf("Number of channels must be 1 or 2: %d", channels)
+		return fmt.Errorf("%w: must be 1 or 2, got %d", ErrInvalidChannels, channels)
 	}
 	size := C.opus_encoder_get_size(C.int(channels))
 	enc.channels = channels
+	enc.sample_rate = sample_rate
+	enc.frameDuration = FrameDurationArg
 	enc.mem = make([]byte, size)
 	enc.p = (*C.OpusEncoder)(unsafe.Pointer(&enc.mem[0]))
 	errno := int(C.opus_encoder_init(
@@ -164,7 +382,11 @@ func (enc *Encoder) Init(sample_rate int, channels int, application Application)
 		C.int(channels),
 		C.int(application)))
 	if errno != 0 {
-		return Error(int(errno))
+		return &OpError{
+			Op:   "opus_encoder_init",
+			Args: fmt.Sprintf("Fs=%d, channels=%d, application=%d", sample_rate, channels, application),
+			Err:  Error(int(errno)),
+		}
 	}
 	return nil
 }
@@ -172,59 +394,138 @@ func (enc *Encoder) Init(sample_rate int, channels int, application Application)
 // Encode raw PCM data and store the result in the supplied buffer. On success,
 // returns the number of bytes used up by the encoded data.
 func (enc *Encoder) Encode(pcm []int16, data []byte) (int, error) {
+	return enc.encode(int16PCM(pcm), data)
+}
+
+// Encode raw PCM data and store the result in the supplied buffer. On success,
+// returns the number of bytes used up by the encoded data.
+func (enc *Encoder) EncodeFloat32(pcm []float32, data []byte) (int, error) {
+	return enc.encode(float32PCM(pcm), data)
+}
+
+// encode implements Encode and EncodeFloat32.
+func (enc *Encoder) encode(pcm pcmBuffer, data []byte) (int, error) {
 	if enc.p == nil {
-		return 0, errEncUninitialized
+		return 0, ErrEncoderUninitialized
 	}
-	if len(pcm) == 0 {
-		return 0, fmt.Errorf("opus: no data supplied")
+	if pcm.len == 0 {
+		return 0, ErrNoData
 	}
 	if len(data) == 0 {
-		return 0, fmt.Errorf("opus: no target buffer")
+		return 0, ErrTargetBufferEmpty
 	}
 	// libopus talks about samples as 1 sample containing multiple channels. So
 	// e.g. 20 samples of 2-channel data is actually 40 raw data points.
-	if len(pcm)%enc.channels != 0 {
-		return 0, fmt.Errorf("opus: input buffer length must be multiple of channels")
+	if pcm.len%enc.channels != 0 {
+		return 0, ErrBufferChannels
+	}
+	samples := pcm.len / enc.channels
+	if err := checkFrameDuration(enc.frameDuration, enc.sample_rate, samples); err != nil {
+		return 0, err
+	}
+	var n int
+	op := "opus_encode"
+	if pcm.float {
+		op = "opus_encode_float"
+		n = int(C.opus_encode_float(
+			enc.p,
+			(*C.float)(pcm.p),
+			C.int(samples),
+			(*C.uchar)(&data[0]),
+			C.opus_int32(cap(data))))
+	} else {
+		n = int(C.opus_encode(
+			enc.p,
+			(*C.opus_int16)(pcm.p),
+			C.int(samples),
+			(*C.uchar)(&data[0]),
+			C.opus_int32(cap(data))))
 	}
-	samples := len(pcm) / enc.channels
-	n := int(C.opus_encode(
-		enc.p,
-		(*C.opus_int16)(&pcm[0]),
-		C.int(samples),
-		(*C.uchar)(&data[0]),
-		C.opus_int32(cap(data))))
 	if n < 0 {
-		return 0, Error(n)
+		return 0, &OpError{
+			Op:   op,
+			Args: fmt.Sprintf("frame_size=%d, max_data_bytes=%d", samples, cap(data)),
+			Err:  Error(n),
+		}
 	}
 	return n, nil
 }
 
-// Encode raw PCM data and store the result in the supplied buffer. On success,
-// returns the number of bytes used up by the encoded data.
-func (enc *Encoder) EncodeFloat32(pcm []float32, data []byte) (int, error) {
-	if enc.p == nil {
-		return 0, errEncUninitialized
+// EncodeResult describes a packet produced by EncodeWithInfo or
+// EncodeFloat32WithInfo.
+type EncodeResult struct {
+	// Number of bytes of encoded data stored in the target buffer.
+	Bytes int
+	// Samples per channel consumed from the input.
+	Samples  int
+	Duration time.Duration
+	Mode     Mode
+	// Audio bandwidth of the packet, as opposed to the bandwidth configured on
+	// the encoder.
+	Bandwidth Bandwidth
+	// Whether the packet is a comfort noise update during DTX, or carries no
+	// audio at all because of DTX.
+	DTX        bool
+	FinalRange uint32
+}
+
+// EncodeWithInfo is like Encode, but also returns information about the
+// encoded packet. This costs a few ctl calls per packet, so use Encode when
+// only the packet is needed.
+func (enc *Encoder) EncodeWithInfo(pcm []int16, data []byte) (EncodeResult, error) {
+	n, err := enc.Encode(pcm, data)
+	if err != nil {
+		return EncodeResult{}, err
 	}
-	if len(pcm) == 0 {
-		return 0, fmt.Errorf("opus: no data supplied")
+	return enc.encodeResult(data[:n], len(pcm)/enc.channels)
+}
+
+// EncodeFloat32WithInfo is like EncodeFloat32, but also returns information
+// about the encoded packet. See EncodeWithInfo.
+func (enc *Encoder) EncodeFloat32WithInfo(pcm []float32, data []byte) (EncodeResult, error) {
+	n, err := enc.EncodeFloat32(pcm, data)
+	if err != nil {
+		return EncodeResult{}, err
 	}
-	if len(data) == 0 {
-		return 0, fmt.Errorf("opus: no target buffer")
+	return enc.encodeResult(data[:n], len(pcm)/enc.channels)
+}
+
+func (enc *Encoder) encodeResult(packet []byte, samples int) (EncodeResult, error) {
+	p, err := ParsePacket(packet)
+	if err != nil {
+		return EncodeResult{}, err
 	}
-	if len(pcm)%enc.channels != 0 {
-		return 0, fmt.Errorf("opus: input buffer length must be multiple of channels")
+	inDTX, err := enc.InDTX()
+	if err != nil {
+		return EncodeResult{}, err
 	}
-	samples := len(pcm) / enc.channels
-	n := int(C.opus_encode_float(
-		enc.p,
-		(*C.float)(&pcm[0]),
-		C.int(samples),
-		(*C.uchar)(&data[0]),
-		C.opus_int32(cap(data))))
-	if n < 0 {
-		return 0, Error(n)
+	finalRange, err := enc.FinalRange()
+	if err != nil {
+		return EncodeResult{}, err
 	}
-	return n, nil
+	return EncodeResult{
+		Bytes:      len(packet),
+		Samples:    samples,
+		Duration:   p.Duration(),
+		Mode:       p.TOC.Mode(),
+		Bandwidth:  p.TOC.Bandwidth(),
+		DTX:        inDTX,
+		FinalRange: finalRange,
+	}, nil
+}
+
+// checkFrameDuration verifies that the number of samples per channel matches
+// the frame duration configured with SetExpertFrameDuration. libopus would
+// otherwise silently encode only part of the PCM data.
+func checkFrameDuration(duration FrameDuration, sample_rate int, samples int) error {
+	if duration == FrameDurationArg {
+		return nil
+	}
+	if expected := duration.Samples(sample_rate); samples != expected {
+		return fmt.Errorf("%w: got %d samples per channel, expected %d",
+			ErrFrameDuration, samples, expected)
+	}
+	return nil
 }
 
 // SetDTX configures the encoder's use of discontinuous transmission (DTX).
@@ -235,7 +536,11 @@ func (enc *Encoder) SetDTX(dtx bool) error {
 	}
 	res := C.bridge_encoder_set_dtx(enc.p, C.opus_int32(i))
 	if res != C.OPUS_OK {
-		return Error(res)
+		return &OpError{
+			Op:   "opus_encoder_ctl",
+			Args: fmt.Sprintf("OPUS_SET_DTX(%d)", i),
+			Err:  Error(res),
+		}
 	}
 	return nil
 }
@@ -246,7 +551,11 @@ func (enc *Encoder) DTX() (bool, error) {
 	var dtx C.opus_int32
 	res := C.bridge_encoder_get_dtx(enc.p, &dtx)
 	if res != C.OPUS_OK {
-		return false, Error(res)
+		return false, &OpError{
+			Op:   "opus_encoder_ctl",
+			Args: "OPUS_GET_DTX",
+			Err:  Error(res),
+		}
 	}
 	return dtx != 0, nil
 }
@@ -257,7 +566,11 @@ func (enc *Encoder) InDTX() (bool, error) {
 	var inDTX C.opus_int32
 	res := C.bridge_encoder_get_in_dtx(enc.p, &inDTX)
 	if res != C.OPUS_OK {
-		return false, Error(res)
+		return false, &OpError{
+			Op:   "opus_encoder_ctl",
+			Args: "OPUS_GET_IN_DTX",
+			Err:  Error(res),
+		}
 	}
 	return inDTX != 0, nil
 }
@@ -267,7 +580,11 @@ func (enc *Encoder) SampleRate() (int, error) {
 	var sr C.opus_int32
 	res := C.bridge_encoder_get_sample_rate(enc.p, &sr)
 	if res != C.OPUS_OK {
-		return 0, Error(res)
+		return 0, &OpError{
+			Op:   "opus_encoder_ctl",
+			Args: "OPUS_GET_SAMPLE_RATE",
+			Err:  Error(res),
+		}
 	}
 	return int(sr), nil
 }
@@ -276,7 +593,11 @@ func (enc *Encoder) SampleRate() (int, error) {
 func (enc *Encoder) SetBitrate(bitrate int) error {
 	res := C.bridge_encoder_set_bitrate(enc.p, C.opus_int32(bitrate))
 	if res != C.OPUS_OK {
-		return Error(res)
+		return &OpError{
+			Op:   "opus_encoder_ctl",
+			Args: fmt.Sprintf("OPUS_SET_BITRATE(%d)", bitrate),
+			Err:  Error(res),
+		}
 	}
 	return nil
 }
@@ -285,7 +606,11 @@ func (enc *Encoder) SetBitrate(bitrate int) error {
 func (enc *Encoder) SetBitrateToAuto() error {
 	res := C.bridge_encoder_set_bitrate(enc.p, C.opus_int32(C.OPUS_AUTO))
 	if res != C.OPUS_OK {
-		return Error(res)
+		return &OpError{
+			Op:   "opus_encoder_ctl",
+			Args: "OPUS_SET_BITRATE(OPUS_AUTO)",
+			Err:  Error(res),
+		}
 	}
 	return nil
 }
@@ -295,7 +620,11 @@ func (enc *Encoder) SetBitrateToAuto() error {
 func (enc *Encoder) SetBitrateToMax() error {
 	res := C.bridge_encoder_set_bitrate(enc.p, C.opus_int32(C.OPUS_BITRATE_MAX))
 	if res != C.OPUS_OK {
-		return Error(res)
+		return &OpError{
+			Op:   "opus_encoder_ctl",
+			Args: "OPUS_SET_BITRATE(OPUS_BITRATE_MAX)",
+			Err:  Error(res),
+		}
 	}
 	return nil
 }
@@ -305,7 +634,11 @@ func (enc *Encoder) Bitrate() (int, error) {
 	var bitrate C.opus_int32
 	res := C.bridge_encoder_get_bitrate(enc.p, &bitrate)
 	if res != C.OPUS_OK {
-		return 0, Error(res)
+		return 0, &OpError{
+			Op:   "opus_encoder_ctl",
+			Args: "OPUS_GET_BITRATE",
+			Err:  Error(res),
+		}
 	}
 	return int(bitrate), nil
 }
@@ -314,7 +647,11 @@ func (enc *Encoder) Bitrate() (int, error) {
 func (enc *Encoder) SetComplexity(complexity int) error {
 	res := C.bridge_encoder_set_complexity(enc.p, C.opus_int32(complexity))
 	if res != C.OPUS_OK {
-		return Error(res)
+		return &OpError{
+			Op:   "opus_encoder_ctl",
+			Args: fmt.Sprintf("OPUS_SET_COMPLEXITY(%d)", complexity),
+			Err:  Error(res),
+		}
 	}
 	return nil
 }
@@ -324,7 +661,11 @@ func (enc *Encoder) Complexity() (int, error) {
 	var complexity C.opus_int32
 	res := C.bridge_encoder_get_complexity(enc.p, &complexity)
 	if res != C.OPUS_OK {
-		return 0, Error(res)
+		return 0, &OpError{
+			Op:   "opus_encoder_ctl",
+			Args: "OPUS_GET_COMPLEXITY",
+			Err:  Error(res),
+		}
 	}
 	return int(complexity), nil
 }
@@ -334,7 +675,11 @@ func (enc *Encoder) Complexity() (int, error) {
 func (enc *Encoder) SetMaxBandwidth(maxBw Bandwidth) error {
 	res := C.bridge_encoder_set_max_bandwidth(enc.p, C.opus_int32(maxBw))
 	if res != C.OPUS_OK {
-		return Error(res)
+		return &OpError{
+			Op:   "opus_encoder_ctl",
+			Args: fmt.Sprintf("OPUS_SET_MAX_BANDWIDTH(%d)", maxBw),
+			Err:  Error(res),
+		}
 	}
 	return nil
 }
@@ -344,7 +689,11 @@ func (enc *Encoder) MaxBandwidth() (Bandwidth, error) {
 	var maxBw C.opus_int32
 	res := C.bridge_encoder_get_max_bandwidth(enc.p, &maxBw)
 	if res != C.OPUS_OK {
-		return 0, Error(res)
+		return 0, &OpError{
+			Op:   "opus_encoder_ctl",
+			Args: "OPUS_GET_MAX_BANDWIDTH",
+			Err:  Error(res),
+		}
 	}
 	return Bandwidth(maxBw), nil
 }
@@ -358,7 +707,11 @@ func (enc *Encoder) SetInBandFEC(fec bool) error {
 	}
 	res := C.bridge_encoder_set_inband_fec(enc.p, C.opus_int32(i))
 	if res != C.OPUS_OK {
-		return Error(res)
+		return &OpError{
+			Op:   "opus_encoder_ctl",
+			Args: fmt.Sprintf("OPUS_SET_INBAND_FEC(%d)", i),
+			Err:  Error(res),
+		}
 	}
 	return nil
 }
@@ -368,7 +721,11 @@ func (enc *Encoder) InBandFEC() (bool, error) {
 	var fec C.opus_int32
 	res := C.bridge_encoder_get_inband_fec(enc.p, &fec)
 	if res != C.OPUS_OK {
-		return false, Error(res)
+		return false, &OpError{
+			Op:   "opus_encoder_ctl",
+			Args: "OPUS_GET_INBAND_FEC",
+			Err:  Error(res),
+		}
 	}
 	return fec != 0, nil
 }
@@ -377,7 +734,11 @@ func (enc *Encoder) InBandFEC() (bool, error) {
 func (enc *Encoder) SetPacketLossPerc(lossPerc int) error {
 	res := C.bridge_encoder_set_packet_loss_perc(enc.p, C.opus_int32(lossPerc))
 	if res != C.OPUS_OK {
-		return Error(res)
+		return &OpError{
+			Op:   "opus_encoder_ctl",
+			Args: fmt.Sprintf("OPUS_SET_PACKET_LOSS_PERC(%d)", lossPerc),
+			Err:  Error(res),
+		}
 	}
 	return nil
 }
@@ -387,7 +748,11 @@ func (enc *Encoder) PacketLossPerc() (int, error) {
 	var lossPerc C.opus_int32
 	res := C.bridge_encoder_get_packet_loss_perc(enc.p, &lossPerc)
 	if res != C.OPUS_OK {
-		return 0, Error(res)
+		return 0, &OpError{
+			Op:   "opus_encoder_ctl",
+			Args: "OPUS_GET_PACKET_LOSS_PERC",
+			Err:  Error(res),
+		}
 	}
 	return int(lossPerc), nil
 }
@@ -396,7 +761,458 @@ func (enc *Encoder) PacketLossPerc() (int, error) {
 func (enc *Encoder) Reset() error {
 	res := C.bridge_encoder_reset_state(enc.p)
 	if res != C.OPUS_OK {
-		return Error(res)
+		return &OpError{
+			Op:   "opus_encoder_ctl",
+			Args: "OPUS_RESET_STATE",
+			Err:  Error(res),
+		}
+	}
+	return nil
+}
+
+// FinalRange returns the final state of the range coder for the last encoded
+// packet. A decoder that decoded the same packet reports the same value, which
+// makes it useful to verify that a packet survived transport bit-exactly.
+func (enc *Encoder) FinalRange() (uint32, error) {
+	var finalRange C.opus_uint32
+	res := C.bridge_encoder_get_final_range(enc.p, &finalRange)
+	if res != C.OPUS_OK {
+		return 0, &OpError{
+			Op:   "opus_encoder_ctl",
+			Args: "OPUS_GET_FINAL_RANGE",
+			Err:  Error(res),
+		}
+	}
+	return uint32(finalRange), nil
+}
+
+// SetVBR configures whether the encoder uses variable bitrate (VBR). Disabling
+// VBR makes the encoder use constant bitrate (CBR).
+func (enc *Encoder) SetVBR(vbr bool) error {
+	i := 0
+	if vbr {
+		i = 1
+	}
+	res := C.bridge_encoder_set_vbr(enc.p, C.opus_int32(i))
+	if res != C.OPUS_OK {
+		return &OpError{
+			Op:   "opus_encoder_ctl",
+			Args: fmt.Sprintf("OPUS_SET_VBR(%d)", i),
+			Err:  Error(res),
+		}
+	}
+	return nil
+}
+
+// VBR reports whether the encoder uses variable bitrate (VBR).
+func (enc *Encoder) VBR() (bool, error) {
+	var vbr C.opus_int32
+	res := C.bridge_encoder_get_vbr(enc.p, &vbr)
+	if res != C.OPUS_OK {
+		return false, &OpError{
+			Op:   "opus_encoder_ctl",
+			Args: "OPUS_GET_VBR",
+			Err:  Error(res),
+		}
+	}
+	return vbr != 0, nil
+}
+
+// SetVBRConstraint configures whether the encoder uses constrained VBR. This
+// has no effect when VBR is disabled.
+func (enc *Encoder) SetVBRConstraint(constraint bool) error {
+	i := 0
+	if constraint {
+		i = 1
+	}
+	res := C.bridge_encoder_set_vbr_constraint(enc.p, C.opus_int32(i))
+	if res != C.OPUS_OK {
+		return &OpError{
+			Op:   "opus_encoder_ctl",
+			Args: fmt.Sprintf("OPUS_SET_VBR_CONSTRAINT(%d)", i),
+			Err:  Error(res),
+		}
+	}
+	return nil
+}
+
+// VBRConstraint reports whether the encoder uses constrained VBR.
+func (enc *Encoder) VBRConstraint() (bool, error) {
+	var constraint C.opus_int32
+	res := C.bridge_encoder_get_vbr_constraint(enc.p, &constraint)
+	if res != C.OPUS_OK {
+		return false, &OpError{
+			Op:   "opus_encoder_ctl",
+			Args: "OPUS_GET_VBR_CONSTRAINT",
+			Err:  Error(res),
+		}
+	}
+	return constraint != 0, nil
+}
+
+// SetSignal hints the encoder about the type of audio it is encoding.
+func (enc *Encoder) SetSignal(signal Signal) error {
+	res := C.bridge_encoder_set_signal(enc.p, C.opus_int32(signal))
+	if res != C.OPUS_OK {
+		return &OpError{
+			Op:   "opus_encoder_ctl",
+			Args: fmt.Sprintf("OPUS_SET_SIGNAL(%d)", signal),
+			Err:  Error(res),
+		}
+	}
+	return nil
+}
+
+// Signal returns the signal type hint configured on the encoder.
+func (enc *Encoder) Signal() (Signal, error) {
+	var signal C.opus_int32
+	res := C.bridge_encoder_get_signal(enc.p, &signal)
+	if res != C.OPUS_OK {
+		return 0, &OpError{
+			Op:   "opus_encoder_ctl",
+			Args: "OPUS_GET_SIGNAL",
+			Err:  Error(res),
+		}
+	}
+	return Signal(signal), nil
+}
+
+// SetApplication changes the application the encoder optimizes for. This can
+// only be done before the first call to Encode, or after a Reset.
+func (enc *Encoder) SetApplication(application Application) error {
+	res := C.bridge_encoder_set_application(enc.p, C.opus_int32(application))
+	if res != C.OPUS_OK {
+		return &OpError{
+			Op:   "opus_encoder_ctl",
+			Args: fmt.Sprintf("OPUS_SET_APPLICATION(%d)", application),
+			Err:  Error(res),
+		}
+	}
+	return nil
+}
+
+// Application returns the application the encoder optimizes for.
+func (enc *Encoder) Application() (Application, error) {
+	var application C.opus_int32
+	res := C.bridge_encoder_get_application(enc.p, &application)
+	if res != C.OPUS_OK {
+		return 0, &OpError{
+			Op:   "opus_encoder_ctl",
+			Args: "OPUS_GET_APPLICATION",
+			Err:  Error(res),
+		}
+	}
+	return Application(application), nil
+}
+
+// SetForceChannels forces the encoder to code mono or stereo, regardless of
+// the number of channels in the input. Use ForceChannelsAuto to let the encoder
+// decide.
+func (enc *Encoder) SetForceChannels(channels int) error {
+	res := C.bridge_encoder_set_force_channels(enc.p, C.opus_int32(channels))
+	if res != C.OPUS_OK {
+		return &OpError{
+			Op:   "opus_encoder_ctl",
+			Args: fmt.Sprintf("OPUS_SET_FORCE_CHANNELS(%d)", channels),
+			Err:  Error(res),
+		}
+	}
+	return nil
+}
+
+// ForceChannels returns the forced number of channels, or ForceChannelsAuto.
+func (enc *Encoder) ForceChannels() (int, error) {
+	var channels C.opus_int32
+	res := C.bridge_encoder_get_force_channels(enc.p, &channels)
+	if res != C.OPUS_OK {
+		return 0, &OpError{
+			Op:   "opus_encoder_ctl",
+			Args: "OPUS_GET_FORCE_CHANNELS",
+			Err:  Error(res),
+		}
+	}
+	return int(channels), nil
+}
+
+// SetExpertFrameDuration configures the encoder to use a fixed frame
+// duration. Unless this is FrameDurationArg (the default), the PCM data passed
+// to Encode and EncodeFloat32 must have exactly this duration.
+func (enc *Encoder) SetExpertFrameDuration(duration FrameDuration) error {
+	res := C.bridge_encoder_set_expert_frame_duration(enc.p, C.opus_int32(duration))
+	if res != C.OPUS_OK {
+		return &OpError{
+			Op:   "opus_encoder_ctl",
+			Args: fmt.Sprintf("OPUS_SET_EXPERT_FRAME_DURATION(%d)", duration),
+			Err:  Error(res),
+		}
+	}
+	enc.frameDuration = duration
+	return nil
+}
+
+// ExpertFrameDuration returns the frame duration configured on the encoder.
+func (enc *Encoder) ExpertFrameDuration() (FrameDuration, error) {
+	var duration C.opus_int32
+	res := C.bridge_encoder_get_expert_frame_duration(enc.p, &duration)
+	if res != C.OPUS_OK {
+		return 0, &OpError{
+			Op:   "opus_encoder_ctl",
+			Args: "OPUS_GET_EXPERT_FRAME_DURATION",
+			Err:  Error(res),
+		}
+	}
+	return FrameDuration(duration), nil
+}
+
+// SetPredictionDisabled configures whether the encoder avoids prediction
+// between frames, making every frame decodable on its own at the cost of
+// quality.
+func (enc *Encoder) SetPredictionDisabled(disabled bool) error {
+	i := 0
+	if disabled {
+		i = 1
+	}
+	res := C.bridge_encoder_set_prediction_disabled(enc.p, C.opus_int32(i))
+	if res != C.OPUS_OK {
+		return &OpError{
+			Op:   "opus_encoder_ctl",
+			Args: fmt.Sprintf("OPUS_SET_PREDICTION_DISABLED(%d)", i),
+			Err:  Error(res),
+		}
 	}
 	return nil
 }
+
+// PredictionDisabled reports whether inter-frame prediction is disabled.
+func (enc *Encoder) PredictionDisabled() (bool, error) {
+	var disabled C.opus_int32
+	res := C.bridge_encoder_get_prediction_disabled(enc.p, &disabled)
+	if res != C.OPUS_OK {
+		return false, &OpError{
+			Op:   "opus_encoder_ctl",
+			Args: "OPUS_GET_PREDICTION_DISABLED",
+			Err:  Error(res),
+		}
+	}
+	return disabled != 0, nil
+}
+
+// SetLSBDepth tells the encoder the depth of the signal in bits, between 8 and
+// 24. Below this depth, the encoder treats the signal as noise.
+func (enc *Encoder) SetLSBDepth(depth int) error {
+	res := C.bridge_encoder_set_lsb_depth(enc.p, C.opus_int32(depth))
+	if res != C.OPUS_OK {
+		return &OpError{
+			Op:   "opus_encoder_ctl",
+			Args: fmt.Sprintf("OPUS_SET_LSB_DEPTH(%d)", depth),
+			Err:  Error(res),
+		}
+	}
+	return nil
+}
+
+// LSBDepth returns the signal depth in bits configured on the encoder.
+func (enc *Encoder) LSBDepth() (int, error) {
+	var depth C.opus_int32
+	res := C.bridge_encoder_get_lsb_depth(enc.p, &depth)
+	if res != C.OPUS_OK {
+		return 0, &OpError{
+			Op:   "opus_encoder_ctl",
+			Args: "OPUS_GET_LSB_DEPTH",
+			Err:  Error(res),
+		}
+	}
+	return int(depth), nil
+}
+
+// SetPhaseInversionDisabled configures whether the encoder avoids phase
+// inversion in intensity stereo, which improves the quality of mono downmixes.
+func (enc *Encoder) SetPhaseInversionDisabled(disabled bool) error {
+	i := 0
+	if disabled {
+		i = 1
+	}
+	res := C.bridge_encoder_set_phase_inversion_disabled(enc.p, C.opus_int32(i))
+	if res != C.OPUS_OK {
+		return &OpError{
+			Op:   "opus_encoder_ctl",
+			Args: fmt.Sprintf("OPUS_SET_PHASE_INVERSION_DISABLED(%d)", i),
+			Err:  Error(res),
+		}
+	}
+	return nil
+}
+
+// PhaseInversionDisabled reports whether phase inversion is disabled.
+func (enc *Encoder) PhaseInversionDisabled() (bool, error) {
+	var disabled C.opus_int32
+	res := C.bridge_encoder_get_phase_inversion_disabled(enc.p, &disabled)
+	if res != C.OPUS_OK {
+		return false, &OpError{
+			Op:   "opus_encoder_ctl",
+			Args: "OPUS_GET_PHASE_INVERSION_DISABLED",
+			Err:  Error(res),
+		}
+	}
+	return disabled != 0, nil
+}
+
+// SetBandwidth forces the encoder to use the given bandpass. Unlike
+// SetMaxBandwidth, this does not leave the choice to the encoder, unless
+// BandwidthAuto is used.
+func (enc *Encoder) SetBandwidth(bw Bandwidth) error {
+	res := C.bridge_encoder_set_bandwidth(enc.p, C.opus_int32(bw))
+	if res != C.OPUS_OK {
+		return &OpError{
+			Op:   "opus_encoder_ctl",
+			Args: fmt.Sprintf("OPUS_SET_BANDWIDTH(%d)", bw),
+			Err:  Error(res),
+		}
+	}
+	return nil
+}
+
+// Bandwidth returns the bandpass used by the encoder for the last encoded
+// frame. Unlike MaxBandwidth, this is what the encoder actually picked, which
+// makes it useful to display the current call quality.
+func (enc *Encoder) Bandwidth() (Bandwidth, error) {
+	var bw C.opus_int32
+	res := C.bridge_encoder_get_bandwidth(enc.p, &bw)
+	if res != C.OPUS_OK {
+		return 0, &OpError{
+			Op:   "opus_encoder_ctl",
+			Args: "OPUS_GET_BANDWIDTH",
+			Err:  Error(res),
+		}
+	}
+	return Bandwidth(bw), nil
+}
+
+// Lookahead returns the number of samples the encoder adds to the start of the
+// stream, at the encoder's sample rate. This is the delay to compensate for
+// when synchronizing with other media, and the value to write as pre-skip in
+// an Ogg Opus header (after converting it to 48 kHz).
+func (enc *Encoder) Lookahead() (int, error) {
+	var lookahead C.opus_int32
+	res := C.bridge_encoder_get_lookahead(enc.p, &lookahead)
+	if res != C.OPUS_OK {
+		return 0, &OpError{
+			Op:   "opus_encoder_ctl",
+			Args: "OPUS_GET_LOOKAHEAD",
+			Err:  Error(res),
+		}
+	}
+	return int(lookahead), nil
+}
+
+// Channels returns the number of channels the encoder was initialized with.
+func (enc *Encoder) Channels() int {
+	return enc.channels
+}
+
+// Head returns the header of an Ogg Opus stream encoded by this encoder, with
+// mapping family 0. The pre-skip is the encoder lookahead.
+func (enc *Encoder) Head() (*Head, error) {
+	if enc.p == nil {
+		return nil, ErrEncoderUninitialized
+	}
+	lookahead, err := enc.Lookahead()
+	if err != nil {
+		return nil, err
+	}
+	return &Head{
+		Version:         1,
+		Channels:        enc.channels,
+		PreSkip:         lookahead * 48000 / enc.sample_rate,
+		InputSampleRate: enc.sample_rate,
+	}, nil
+}
+
+// EncoderSnapshot holds all settings of an encoder at one point in time, see
+// Encoder.Snapshot.
+type EncoderSnapshot struct {
+	SampleRate             int           `json:"sample_rate"`
+	Channels               int           `json:"channels"`
+	Application            Application   `json:"application"`
+	Bitrate                int           `json:"bitrate"`
+	VBR                    bool          `json:"vbr"`
+	VBRConstraint          bool          `json:"vbr_constraint"`
+	Complexity             int           `json:"complexity"`
+	MaxBandwidth           Bandwidth     `json:"max_bandwidth"`
+	Bandwidth              Bandwidth     `json:"bandwidth"`
+	InBandFEC              bool          `json:"inband_fec"`
+	PacketLossPerc         int           `json:"packet_loss_perc"`
+	DTX                    bool          `json:"dtx"`
+	Signal                 Signal        `json:"signal"`
+	ForceChannels          int           `json:"force_channels"`
+	ExpertFrameDuration    FrameDuration `json:"expert_frame_duration"`
+	PredictionDisabled     bool          `json:"prediction_disabled"`
+	LSBDepth               int           `json:"lsb_depth"`
+	PhaseInversionDisabled bool          `json:"phase_inversion_disabled"`
+	Lookahead              int           `json:"lookahead"`
+}
+
+// Snapshot returns all settings of the encoder in one struct, e.g. for
+// logging.
+func (enc *Encoder) Snapshot() (EncoderSnapshot, error) {
+	if enc.p == nil {
+		return EncoderSnapshot{}, ErrEncoderUninitialized
+	}
+	snap := EncoderSnapshot{Channels: enc.channels}
+	var err error
+	if snap.SampleRate, err = enc.SampleRate(); err != nil {
+		return EncoderSnapshot{}, err
+	}
+	if snap.Application, err = enc.Application(); err != nil {
+		return EncoderSnapshot{}, err
+	}
+	if snap.Bitrate, err = enc.Bitrate(); err != nil {
+		return EncoderSnapshot{}, err
+	}
+	if snap.VBR, err = enc.VBR(); err != nil {
+		return EncoderSnapshot{}, err
+	}
+	if snap.VBRConstraint, err = enc.VBRConstraint(); err != nil {
+		return EncoderSnapshot{}, err
+	}
+	if snap.Complexity, err = enc.Complexity(); err != nil {
+		return EncoderSnapshot{}, err
+	}
+	if snap.MaxBandwidth, err = enc.MaxBandwidth(); err != nil {
+		return EncoderSnapshot{}, err
+	}
+	if snap.Bandwidth, err = enc.Bandwidth(); err != nil {
+		return EncoderSnapshot{}, err
+	}
+	if snap.InBandFEC, err = enc.InBandFEC(); err != nil {
+		return EncoderSnapshot{}, err
+	}
+	if snap.PacketLossPerc, err = enc.PacketLossPerc(); err != nil {
+		return EncoderSnapshot{}, err
+	}
+	if snap.DTX, err = enc.DTX(); err != nil {
+		return EncoderSnapshot{}, err
+	}
+	if snap.Signal, err = enc.Signal(); err != nil {
+		return EncoderSnapshot{}, err
+	}
+	if snap.ForceChannels, err = enc.ForceChannels(); err != nil {
+		return EncoderSnapshot{}, err
+	}
+	if snap.ExpertFrameDuration, err = enc.ExpertFrameDuration(); err != nil {
+		return EncoderSnapshot{}, err
+	}
+	if snap.PredictionDisabled, err = enc.PredictionDisabled(); err != nil {
+		return EncoderSnapshot{}, err
+	}
+	if snap.LSBDepth, err = enc.LSBDepth(); err != nil {
+		return EncoderSnapshot{}, err
+	}
+	if snap.PhaseInversionDisabled, err = enc.PhaseInversionDisabled(); err != nil {
+		return EncoderSnapshot{}, err
+	}
+	if snap.Lookahead, err = enc.Lookahead(); err != nil {
+		return EncoderSnapshot{}, err
+	}
+	return snap, nil
+}
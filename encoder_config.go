@@ -0,0 +1,383 @@
+// Copyright © Go Opus Authors (see AUTHORS file)
+//
+// License for use of this code is detailed in the LICENSE file
+
+package opus
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// BitrateMode selects between variable, constrained variable and constant
+// bitrate.
+type BitrateMode int
+
+const (
+	// Variable bitrate
+	BitrateVBR BitrateMode = iota + 1
+	// Constrained variable bitrate
+	BitrateCVBR
+	// Constant bitrate
+	BitrateCBR
+)
+
+// EncoderConfig describes the settings of an Encoder. Nil fields are left
+// unchanged when the configuration is applied. The struct can be stored in
+// JSON or YAML files; enum values are stored by name, e.g. "voip" or
+// "fullband", and values without a name as a decimal string, e.g. "1106".
+type EncoderConfig struct {
+	// Required for NewEncoderWithConfig
+	Application *Application `json:"application,omitempty" yaml:"application,omitempty"`
+	// Bits per second, or BitrateAuto or BitrateMax
+	Bitrate                *int           `json:"bitrate,omitempty" yaml:"bitrate,omitempty"`
+	BitrateMode            *BitrateMode   `json:"bitrate_mode,omitempty" yaml:"bitrate_mode,omitempty"`
+	Complexity             *int           `json:"complexity,omitempty" yaml:"complexity,omitempty"`
+	MaxBandwidth           *Bandwidth     `json:"max_bandwidth,omitempty" yaml:"max_bandwidth,omitempty"`
+	Bandwidth              *Bandwidth     `json:"bandwidth,omitempty" yaml:"bandwidth,omitempty"`
+	InBandFEC              *bool          `json:"inband_fec,omitempty" yaml:"inband_fec,omitempty"`
+	PacketLossPerc         *int           `json:"packet_loss_perc,omitempty" yaml:"packet_loss_perc,omitempty"`
+	DTX                    *bool          `json:"dtx,omitempty" yaml:"dtx,omitempty"`
+	Signal                 *Signal        `json:"signal,omitempty" yaml:"signal,omitempty"`
+	ForceChannels          *int           `json:"force_channels,omitempty" yaml:"force_channels,omitempty"`
+	FrameDuration          *FrameDuration `json:"frame_duration,omitempty" yaml:"frame_duration,omitempty"`
+	PredictionDisabled     *bool          `json:"prediction_disabled,omitempty" yaml:"prediction_disabled,omitempty"`
+	LSBDepth               *int           `json:"lsb_depth,omitempty" yaml:"lsb_depth,omitempty"`
+	PhaseInversionDisabled *bool          `json:"phase_inversion_disabled,omitempty" yaml:"phase_inversion_disabled,omitempty"`
+}
+
+// Validate checks all fields of the configuration against the ranges accepted
+// by libopus, without touching an encoder.
+func (cfg *EncoderConfig) Validate() error {
+	if cfg.Application != nil {
+		if _, ok := applicationNames[*cfg.Application]; !ok {
+			return fmt.Errorf("%w: application %d", ErrBadArg, *cfg.Application)
+		}
+	}
+	if cfg.Bitrate != nil && *cfg.Bitrate <= 0 && *cfg.Bitrate != BitrateAuto && *cfg.Bitrate != BitrateMax {
+		return fmt.Errorf("%w: bitrate %d", ErrBadArg, *cfg.Bitrate)
+	}
+	if cfg.BitrateMode != nil {
+		if _, ok := bitrateModeNames[*cfg.BitrateMode]; !ok {
+			return fmt.Errorf("%w: bitrate mode %d", ErrBadArg, *cfg.BitrateMode)
+		}
+	}
+	if cfg.Complexity != nil && (*cfg.Complexity < 0 || *cfg.Complexity > 10) {
+		return fmt.Errorf("%w: complexity %d", ErrBadArg, *cfg.Complexity)
+	}
+	if cfg.MaxBandwidth != nil {
+		if _, ok := bandwidthNames[*cfg.MaxBandwidth]; !ok || *cfg.MaxBandwidth == BandwidthAuto {
+			return fmt.Errorf("%w: max bandwidth %d", ErrBadArg, *cfg.MaxBandwidth)
+		}
+	}
+	if cfg.Bandwidth != nil {
+		if _, ok := bandwidthNames[*cfg.Bandwidth]; !ok {
+			return fmt.Errorf("%w: bandwidth %d", ErrBadArg, *cfg.Bandwidth)
+		}
+	}
+	if cfg.PacketLossPerc != nil && (*cfg.PacketLossPerc < 0 || *cfg.PacketLossPerc > 100) {
+		return fmt.Errorf("%w: packet loss percentage %d", ErrBadArg, *cfg.PacketLossPerc)
+	}
+	if cfg.Signal != nil {
+		if _, ok := signalNames[*cfg.Signal]; !ok {
+			return fmt.Errorf("%w: signal %d", ErrBadArg, *cfg.Signal)
+		}
+	}
+	if cfg.ForceChannels != nil && *cfg.ForceChannels != 1 && *cfg.ForceChannels != 2 &&
+		*cfg.ForceChannels != ForceChannelsAuto {
+		return fmt.Errorf("%w: forced channels %d", ErrBadArg, *cfg.ForceChannels)
+	}
+	if cfg.FrameDuration != nil {
+		if _, ok := frameDurationNames[*cfg.FrameDuration]; !ok {
+			return fmt.Errorf("%w: frame duration %d", ErrBadArg, *cfg.FrameDuration)
+		}
+	}
+	if cfg.LSBDepth != nil && (*cfg.LSBDepth < 8 || *cfg.LSBDepth > 24) {
+		return fmt.Errorf("%w: LSB depth %d", ErrBadArg, *cfg.LSBDepth)
+	}
+	return nil
+}
+
+// NewEncoderWithConfig allocates a new Opus encoder and configures it. The
+// configuration must include an application.
+func NewEncoderWithConfig(sample_rate int, channels int, cfg EncoderConfig) (*Encoder, error) {
+	if cfg.Application == nil {
+		return nil, fmt.Errorf("%w: encoder config has no application", ErrBadArg)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	enc, err := NewEncoder(sample_rate, channels, *cfg.Application)
+	if err != nil {
+		return nil, err
+	}
+	if err := enc.Apply(cfg); err != nil {
+		return nil, err
+	}
+	return enc, nil
+}
+
+// Apply changes all settings present in the configuration at once. The
+// configuration is validated first. If libopus rejects any of the settings,
+// the encoder is rolled back to the state it was in before the call.
+//
+// Note that the application can only be changed before the first call to
+// Encode, or after a Reset.
+func (enc *Encoder) Apply(cfg EncoderConfig) error {
+	if enc.p == nil {
+		return ErrEncoderUninitialized
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	saved := make([]byte, len(enc.mem))
+	copy(saved, enc.mem)
+	savedFrameDuration := enc.frameDuration
+	if err := enc.apply(&cfg); err != nil {
+		copy(enc.mem, saved)
+		enc.frameDuration = savedFrameDuration
+		return err
+	}
+	return nil
+}
+
+func (enc *Encoder) apply(cfg *EncoderConfig) error {
+	if cfg.Application != nil {
+		if err := enc.SetApplication(*cfg.Application); err != nil {
+			return fmt.Errorf("opus: setting application: %w", err)
+		}
+	}
+	if cfg.Bitrate != nil {
+		if err := enc.SetBitrate(*cfg.Bitrate); err != nil {
+			return fmt.Errorf("opus: setting bitrate: %w", err)
+		}
+	}
+	if cfg.BitrateMode != nil {
+		mode := *cfg.BitrateMode
+		if err := enc.SetVBR(mode != BitrateCBR); err != nil {
+			return fmt.Errorf("opus: setting VBR: %w", err)
+		}
+		if err := enc.SetVBRConstraint(mode == BitrateCVBR); err != nil {
+			return fmt.Errorf("opus: setting VBR constraint: %w", err)
+		}
+	}
+	if cfg.Complexity != nil {
+		if err := enc.SetComplexity(*cfg.Complexity); err != nil {
+			return fmt.Errorf("opus: setting complexity: %w", err)
+		}
+	}
+	if cfg.MaxBandwidth != nil {
+		if err := enc.SetMaxBandwidth(*cfg.MaxBandwidth); err != nil {
+			return fmt.Errorf("opus: setting max bandwidth: %w", err)
+		}
+	}
+	if cfg.Bandwidth != nil {
+		if err := enc.SetBandwidth(*cfg.Bandwidth); err != nil {
+			return fmt.Errorf("opus: setting bandwidth: %w", err)
+		}
+	}
+	if cfg.InBandFEC != nil {
+		if err := enc.SetInBandFEC(*cfg.InBandFEC); err != nil {
+			return fmt.Errorf("opus: setting inband FEC: %w", err)
+		}
+	}
+	if cfg.PacketLossPerc != nil {
+		if err := enc.SetPacketLossPerc(*cfg.PacketLossPerc); err != nil {
+			return fmt.Errorf("opus: setting packet loss percentage: %w", err)
+		}
+	}
+	if cfg.DTX != nil {
+		if err := enc.SetDTX(*cfg.DTX); err != nil {
+			return fmt.Errorf("opus: setting DTX: %w", err)
+		}
+	}
+	if cfg.Signal != nil {
+		if err := enc.SetSignal(*cfg.Signal); err != nil {
+			return fmt.Errorf("opus: setting signal: %w", err)
+		}
+	}
+	if cfg.ForceChannels != nil {
+		if err := enc.SetForceChannels(*cfg.ForceChannels); err != nil {
+			return fmt.Errorf("opus: setting forced channels: %w", err)
+		}
+	}
+	if cfg.FrameDuration != nil {
+		if err := enc.SetExpertFrameDuration(*cfg.FrameDuration); err != nil {
+			return fmt.Errorf("opus: setting frame duration: %w", err)
+		}
+	}
+	if cfg.PredictionDisabled != nil {
+		if err := enc.SetPredictionDisabled(*cfg.PredictionDisabled); err != nil {
+			return fmt.Errorf("opus: setting prediction disabled: %w", err)
+		}
+	}
+	if cfg.LSBDepth != nil {
+		if err := enc.SetLSBDepth(*cfg.LSBDepth); err != nil {
+			return fmt.Errorf("opus: setting LSB depth: %w", err)
+		}
+	}
+	if cfg.PhaseInversionDisabled != nil {
+		if err := enc.SetPhaseInversionDisabled(*cfg.PhaseInversionDisabled); err != nil {
+			return fmt.Errorf("opus: setting phase inversion disabled: %w", err)
+		}
+	}
+	return nil
+}
+
+// Names used by the text marshalers. Values without a name, e.g. from a newer
+// libopus, are marshalled as a decimal string instead. Being text, that string
+// is quoted in JSON: "1106", not 1106.
+var applicationNames = map[Application]string{
+	AppVoIP:               "voip",
+	AppAudio:              "audio",
+	AppRestrictedLowdelay: "restricted_lowdelay",
+}
+
+var bitrateModeNames = map[BitrateMode]string{
+	BitrateVBR:  "vbr",
+	BitrateCVBR: "cvbr",
+	BitrateCBR:  "cbr",
+}
+
+var bandwidthNames = map[Bandwidth]string{
+	BandwidthAuto: "auto",
+	Narrowband:    "narrowband",
+	Mediumband:    "mediumband",
+	Wideband:      "wideband",
+	SuperWideband: "superwideband",
+	Fullband:      "fullband",
+}
+
+var signalNames = map[Signal]string{
+	SignalAuto:  "auto",
+	SignalVoice: "voice",
+	SignalMusic: "music",
+}
+
+var frameDurationNames = map[FrameDuration]string{
+	FrameDurationArg:   "arg",
+	FrameDuration2_5Ms: "2.5ms",
+	FrameDuration5Ms:   "5ms",
+	FrameDuration10Ms:  "10ms",
+	FrameDuration20Ms:  "20ms",
+	FrameDuration40Ms:  "40ms",
+	FrameDuration60Ms:  "60ms",
+	FrameDuration80Ms:  "80ms",
+	FrameDuration100Ms: "100ms",
+	FrameDuration120Ms: "120ms",
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (app Application) MarshalText() ([]byte, error) {
+	if name, ok := applicationNames[app]; ok {
+		return []byte(name), nil
+	}
+	return []byte(strconv.Itoa(int(app))), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (app *Application) UnmarshalText(text []byte) error {
+	for v, name := range applicationNames {
+		if name == string(text) {
+			*app = v
+			return nil
+		}
+	}
+	if v, err := strconv.Atoi(string(text)); err == nil {
+		*app = Application(v)
+		return nil
+	}
+	return fmt.Errorf("%w: application %q", ErrBadArg, text)
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (mode BitrateMode) MarshalText() ([]byte, error) {
+	if name, ok := bitrateModeNames[mode]; ok {
+		return []byte(name), nil
+	}
+	return []byte(strconv.Itoa(int(mode))), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (mode *BitrateMode) UnmarshalText(text []byte) error {
+	for v, name := range bitrateModeNames {
+		if name == string(text) {
+			*mode = v
+			return nil
+		}
+	}
+	if v, err := strconv.Atoi(string(text)); err == nil {
+		*mode = BitrateMode(v)
+		return nil
+	}
+	return fmt.Errorf("%w: bitrate mode %q", ErrBadArg, text)
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (bw Bandwidth) MarshalText() ([]byte, error) {
+	if name, ok := bandwidthNames[bw]; ok {
+		return []byte(name), nil
+	}
+	return []byte(strconv.Itoa(int(bw))), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (bw *Bandwidth) UnmarshalText(text []byte) error {
+	for v, name := range bandwidthNames {
+		if name == string(text) {
+			*bw = v
+			return nil
+		}
+	}
+	if v, err := strconv.Atoi(string(text)); err == nil {
+		*bw = Bandwidth(v)
+		return nil
+	}
+	return fmt.Errorf("%w: bandwidth %q", ErrBadArg, text)
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (signal Signal) MarshalText() ([]byte, error) {
+	if name, ok := signalNames[signal]; ok {
+		return []byte(name), nil
+	}
+	return []byte(strconv.Itoa(int(signal))), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (signal *Signal) UnmarshalText(text []byte) error {
+	for v, name := range signalNames {
+		if name == string(text) {
+			*signal = v
+			return nil
+		}
+	}
+	if v, err := strconv.Atoi(string(text)); err == nil {
+		*signal = Signal(v)
+		return nil
+	}
+	return fmt.Errorf("%w: signal %q", ErrBadArg, text)
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (fd FrameDuration) MarshalText() ([]byte, error) {
+	if name, ok := frameDurationNames[fd]; ok {
+		return []byte(name), nil
+	}
+	return []byte(strconv.Itoa(int(fd))), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (fd *FrameDuration) UnmarshalText(text []byte) error {
+	for v, name := range frameDurationNames {
+		if name == string(text) {
+			*fd = v
+			return nil
+		}
+	}
+	if v, err := strconv.Atoi(string(text)); err == nil {
+		*fd = FrameDuration(v)
+		return nil
+	}
+	return fmt.Errorf("%w: frame duration %q", ErrBadArg, text)
+}
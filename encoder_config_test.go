@@ -0,0 +1,171 @@
+// Copyright © Go Opus Authors (see AUTHORS file)
+//
+// License for use of this code is detailed in the LICENSE file
+
+package opus
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestEncoderConfig_JSON(t *testing.T) {
+	app := AppRestrictedLowdelay
+	bitrate := 48000
+	mode := BitrateCVBR
+	bw := Wideband
+	signal := SignalMusic
+	fd := FrameDuration2_5Ms
+	dtx := true
+	cfg := EncoderConfig{
+		Application:   &app,
+		Bitrate:       &bitrate,
+		BitrateMode:   &mode,
+		MaxBandwidth:  &bw,
+		Signal:        &signal,
+		FrameDuration: &fd,
+		DTX:           &dtx,
+	}
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatalf("Error marshalling config: %v", err)
+	}
+	const expected = `{"application":"restricted_lowdelay","bitrate":48000,"bitrate_mode":"cvbr","max_bandwidth":"wideband","dtx":true,"signal":"music","frame_duration":"2.5ms"}`
+	if string(data) != expected {
+		t.Errorf("Unexpected JSON. Got %s, but expected %s", data, expected)
+	}
+	var decoded EncoderConfig
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Error unmarshalling config: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, cfg) {
+		t.Errorf("Config changed in JSON round trip: %+v", decoded)
+	}
+	if err := json.Unmarshal([]byte(`{"signal":"noise"}`), &decoded); err == nil {
+		t.Errorf("Expected error for unknown signal")
+	}
+
+	// Values without a name, e.g. from a newer libopus, are kept as decimal
+	// strings
+	unknown := Bandwidth(1106)
+	data, err = json.Marshal(EncoderConfig{Bandwidth: &unknown})
+	if err != nil {
+		t.Fatalf("Error marshalling unknown bandwidth: %v", err)
+	}
+	if string(data) != `{"bandwidth":"1106"}` {
+		t.Errorf("Unexpected JSON for unknown bandwidth: %s", data)
+	}
+	decoded = EncoderConfig{}
+	if err := json.Unmarshal(data, &decoded); err != nil || decoded.Bandwidth == nil || *decoded.Bandwidth != unknown {
+		t.Errorf("Unknown bandwidth changed in JSON round trip: %+v (%v)", decoded, err)
+	}
+	unknownApp := Application(2052)
+	unknownMode := BitrateMode(4)
+	unknownSignal := Signal(3003)
+	unknownFD := FrameDuration(5011)
+	data, err = json.Marshal(EncoderConfig{
+		Application:   &unknownApp,
+		BitrateMode:   &unknownMode,
+		Signal:        &unknownSignal,
+		FrameDuration: &unknownFD,
+	})
+	if err != nil {
+		t.Fatalf("Error marshalling unknown values: %v", err)
+	}
+	const expectedUnknown = `{"application":"2052","bitrate_mode":"4","signal":"3003","frame_duration":"5011"}`
+	if string(data) != expectedUnknown {
+		t.Errorf("Unexpected JSON for unknown values. Got %s, but expected %s", data, expectedUnknown)
+	}
+	if err := (&EncoderConfig{Bandwidth: &unknown}).Validate(); err == nil {
+		t.Errorf("Expected validation error for unknown bandwidth")
+	}
+}
+
+func TestEncoderConfig_Validate(t *testing.T) {
+	complexity := 11
+	loss := -1
+	lsb := 25
+	bw := BandwidthAuto
+	forced := 3
+	bitrate := -5
+	for _, cfg := range []EncoderConfig{
+		{Complexity: &complexity},
+		{PacketLossPerc: &loss},
+		{LSBDepth: &lsb},
+		{MaxBandwidth: &bw},
+		{ForceChannels: &forced},
+		{Bitrate: &bitrate},
+	} {
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Expected validation error for %+v", cfg)
+		}
+	}
+	bitrate = BitrateMax
+	cfg := EncoderConfig{Bitrate: &bitrate, MaxBandwidth: new(Bandwidth)}
+	*cfg.MaxBandwidth = Fullband
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Unexpected validation error: %v", err)
+	}
+}
+
+func TestNewEncoderWithConfig(t *testing.T) {
+	if _, err := NewEncoderWithConfig(48000, 1, EncoderConfig{}); err == nil {
+		t.Errorf("Expected error for config without application")
+	}
+	app := AppVoIP
+	bitrate := 24000
+	mode := BitrateCBR
+	complexity := 3
+	fec := true
+	cfg := EncoderConfig{
+		Application: &app,
+		Bitrate:     &bitrate,
+		BitrateMode: &mode,
+		Complexity:  &complexity,
+		InBandFEC:   &fec,
+	}
+	enc, err := NewEncoderWithConfig(48000, 1, cfg)
+	if err != nil || enc == nil {
+		t.Fatalf("Error creating encoder from config: %v", err)
+	}
+	snap, err := enc.Snapshot()
+	if err != nil {
+		t.Fatalf("Error getting snapshot: %v", err)
+	}
+	if snap.Application != AppVoIP || snap.Bitrate != 24000 || snap.VBR ||
+		snap.Complexity != 3 || !snap.InBandFEC {
+		t.Errorf("Config not applied: %+v", snap)
+	}
+}
+
+func TestEncoder_ApplyRollback(t *testing.T) {
+	enc, err := NewEncoder(48000, 1, AppAudio)
+	if err != nil || enc == nil {
+		t.Fatalf("Error creating new encoder: %v", err)
+	}
+	if err := enc.SetBitrate(32000); err != nil {
+		t.Fatalf("Error setting bitrate: %v", err)
+	}
+	bitrate := 96000
+	fd := FrameDuration10Ms
+	// Passes validation, but a mono encoder cannot be forced to stereo
+	forced := 2
+	err = enc.Apply(EncoderConfig{Bitrate: &bitrate, FrameDuration: &fd, ForceChannels: &forced})
+	if err == nil {
+		t.Fatalf("Expected error forcing stereo on a mono encoder")
+	}
+	if got, _ := enc.Bitrate(); got != 32000 {
+		t.Errorf("Bitrate not rolled back. Got %d, but expected 32000", got)
+	}
+	if got, _ := enc.ExpertFrameDuration(); got != FrameDurationArg {
+		t.Errorf("Frame duration not rolled back. Got %v", got)
+	}
+	err = enc.Apply(EncoderConfig{Bitrate: &bitrate, FrameDuration: &fd})
+	if err != nil {
+		t.Fatalf("Error applying config: %v", err)
+	}
+	if got, _ := enc.Bitrate(); got != 96000 {
+		t.Errorf("Bitrate not applied. Got %d, but expected 96000", got)
+	}
+}
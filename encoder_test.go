@@ -4,7 +4,11 @@
 
 package opus
 
-import "testing"
+import (
+	"errors"
+	"testing"
+	"time"
+)
 
 func TestEncoderNew(t *testing.T) {
 	enc, err := NewEncoder(48000, 1, AppVoIP)
@@ -20,11 +24,11 @@ func TestEncoderNew(t *testing.T) {
 func TestEncoderUnitialized(t *testing.T) {
 	var enc Encoder
 	_, err := enc.Encode(nil, nil)
-	if err != errEncUninitialized {
+	if err != ErrEncoderUninitialized {
 		t.Errorf("Expected \"unitialized encoder\" error: %v", err)
 	}
 	_, err = enc.EncodeFloat32(nil, nil)
-	if err != errEncUninitialized {
+	if err != ErrEncoderUninitialized {
 		t.Errorf("Expected \"unitialized encoder\" error: %v", err)
 	}
 }
@@ -391,3 +395,403 @@ func TestEncoder_Reset(t *testing.T) {
 	}
 	RunTestCodec(t, enc)
 }
+
+func TestEncoder_SetGetVBR(t *testing.T) {
+	enc, err := NewEncoder(48000, 1, AppVoIP)
+	if err != nil || enc == nil {
+		t.Errorf("Error creating new encoder: %v", err)
+	}
+	vals := []bool{false, true}
+	for _, vbr := range vals {
+		if err := enc.SetVBR(vbr); err != nil {
+			t.Error("Error setting VBR:", err)
+		}
+		got, err := enc.VBR()
+		if err != nil {
+			t.Error("Error getting VBR", err)
+		}
+		if got != vbr {
+			t.Errorf("Wrong VBR value. Got %t, but expected %t", got, vbr)
+		}
+	}
+}
+
+func TestEncoder_CBR(t *testing.T) {
+	const SAMPLE_RATE = 48000
+	const FRAME_SIZE = SAMPLE_RATE * 20 / 1000
+	enc, err := NewEncoder(SAMPLE_RATE, 1, AppVoIP)
+	if err != nil || enc == nil {
+		t.Fatalf("Error creating new encoder: %v", err)
+	}
+	if err := enc.SetVBR(false); err != nil {
+		t.Fatalf("Error setting VBR: %v", err)
+	}
+	if err := enc.SetBitrate(32000); err != nil {
+		t.Fatalf("Error setting bitrate: %v", err)
+	}
+	pcm := make([]int16, FRAME_SIZE)
+	addSine(pcm, SAMPLE_RATE, 440)
+	data := make([]byte, 1000)
+	for i := 0; i < 5; i++ {
+		n, err := enc.Encode(pcm, data)
+		if err != nil {
+			t.Fatalf("Couldn't encode data: %v", err)
+		}
+		// 32 kbit/s at 20 ms is 80 bytes per packet
+		if n != 80 {
+			t.Errorf("Unexpected CBR packet size: %d", n)
+		}
+	}
+}
+
+func TestEncoder_SetGetVBRConstraint(t *testing.T) {
+	enc, err := NewEncoder(48000, 1, AppVoIP)
+	if err != nil || enc == nil {
+		t.Errorf("Error creating new encoder: %v", err)
+	}
+	vals := []bool{false, true}
+	for _, constraint := range vals {
+		if err := enc.SetVBRConstraint(constraint); err != nil {
+			t.Error("Error setting VBR constraint:", err)
+		}
+		got, err := enc.VBRConstraint()
+		if err != nil {
+			t.Error("Error getting VBR constraint", err)
+		}
+		if got != constraint {
+			t.Errorf("Wrong VBR constraint value. Got %t, but expected %t", got, constraint)
+		}
+	}
+}
+
+func TestEncoder_SetGetSignal(t *testing.T) {
+	enc, err := NewEncoder(48000, 1, AppVoIP)
+	if err != nil || enc == nil {
+		t.Errorf("Error creating new encoder: %v", err)
+	}
+	vals := []Signal{SignalVoice, SignalMusic, SignalAuto}
+	for _, signal := range vals {
+		if err := enc.SetSignal(signal); err != nil {
+			t.Error("Error setting signal:", err)
+		}
+		got, err := enc.Signal()
+		if err != nil {
+			t.Error("Error getting signal", err)
+		}
+		if got != signal {
+			t.Errorf("Unexpected signal value. Got %d, but expected %d", got, signal)
+		}
+	}
+	if err := enc.SetSignal(Signal(1234)); err == nil {
+		t.Errorf("Expected Error invalid signal value")
+	}
+}
+
+func TestEncoder_SetGetApplication(t *testing.T) {
+	enc, err := NewEncoder(48000, 1, AppVoIP)
+	if err != nil || enc == nil {
+		t.Errorf("Error creating new encoder: %v", err)
+	}
+	vals := []Application{AppAudio, AppRestrictedLowdelay, AppVoIP}
+	for _, app := range vals {
+		if err := enc.SetApplication(app); err != nil {
+			t.Error("Error setting application:", err)
+		}
+		got, err := enc.Application()
+		if err != nil {
+			t.Error("Error getting application", err)
+		}
+		if got != app {
+			t.Errorf("Unexpected application. Got %d, but expected %d", got, app)
+		}
+	}
+}
+
+func TestEncoder_SetGetForceChannels(t *testing.T) {
+	enc, err := NewEncoder(48000, 2, AppAudio)
+	if err != nil || enc == nil {
+		t.Errorf("Error creating new encoder: %v", err)
+	}
+	vals := []int{1, 2, ForceChannelsAuto}
+	for _, channels := range vals {
+		if err := enc.SetForceChannels(channels); err != nil {
+			t.Error("Error setting forced channels:", err)
+		}
+		got, err := enc.ForceChannels()
+		if err != nil {
+			t.Error("Error getting forced channels", err)
+		}
+		if got != channels {
+			t.Errorf("Unexpected forced channels. Got %d, but expected %d", got, channels)
+		}
+	}
+	if err := enc.SetForceChannels(3); err == nil {
+		t.Errorf("Expected Error invalid forced channels")
+	}
+}
+
+func TestEncoder_SetGetExpertFrameDuration(t *testing.T) {
+	enc, err := NewEncoder(48000, 1, AppAudio)
+	if err != nil || enc == nil {
+		t.Errorf("Error creating new encoder: %v", err)
+	}
+	vals := []FrameDuration{
+		FrameDuration2_5Ms,
+		FrameDuration5Ms,
+		FrameDuration10Ms,
+		FrameDuration20Ms,
+		FrameDuration40Ms,
+		FrameDuration60Ms,
+		FrameDurationArg,
+	}
+	for _, duration := range vals {
+		if err := enc.SetExpertFrameDuration(duration); err != nil {
+			t.Error("Error setting frame duration:", err)
+		}
+		got, err := enc.ExpertFrameDuration()
+		if err != nil {
+			t.Error("Error getting frame duration", err)
+		}
+		if got != duration {
+			t.Errorf("Unexpected frame duration. Got %d, but expected %d", got, duration)
+		}
+	}
+}
+
+func TestEncoder_ExpertFrameDurationValidation(t *testing.T) {
+	enc, err := NewEncoder(16000, 2, AppAudio)
+	if err != nil || enc == nil {
+		t.Fatalf("Error creating new encoder: %v", err)
+	}
+	if err := enc.SetExpertFrameDuration(FrameDuration20Ms); err != nil {
+		t.Fatalf("Error setting frame duration: %v", err)
+	}
+	data := make([]byte, 1000)
+	// 40 ms of stereo audio
+	if _, err := enc.Encode(make([]int16, 640*2), data); !errors.Is(err, ErrFrameDuration) {
+		t.Errorf("Expected error for 40 ms input with 20 ms frame duration")
+	}
+	if _, err := enc.EncodeFloat32(make([]float32, 640*2), data); err == nil {
+		t.Errorf("Expected error for 40 ms input with 20 ms frame duration")
+	}
+	if _, err := enc.Encode(make([]int16, 320*2), data); err != nil {
+		t.Errorf("Couldn't encode 20 ms frame: %v", err)
+	}
+}
+
+func TestFrameDuration(t *testing.T) {
+	if s := FrameDuration2_5Ms.Samples(48000); s != 120 {
+		t.Errorf("Unexpected number of samples in 2.5 ms: %d", s)
+	}
+	if s := FrameDuration10Ms.Samples(8000); s != 80 {
+		t.Errorf("Unexpected number of samples in 10 ms: %d", s)
+	}
+	if s := FrameDuration120Ms.Samples(48000); s != 5760 {
+		t.Errorf("Unexpected number of samples in 120 ms: %d", s)
+	}
+	if s := FrameDurationArg.Samples(48000); s != 0 {
+		t.Errorf("Unexpected number of samples for FrameDurationArg: %d", s)
+	}
+}
+
+func TestEncoder_SetGetPredictionDisabled(t *testing.T) {
+	enc, err := NewEncoder(48000, 1, AppVoIP)
+	if err != nil || enc == nil {
+		t.Errorf("Error creating new encoder: %v", err)
+	}
+	vals := []bool{true, false}
+	for _, disabled := range vals {
+		if err := enc.SetPredictionDisabled(disabled); err != nil {
+			t.Error("Error setting prediction disabled:", err)
+		}
+		got, err := enc.PredictionDisabled()
+		if err != nil {
+			t.Error("Error getting prediction disabled", err)
+		}
+		if got != disabled {
+			t.Errorf("Wrong prediction disabled value. Got %t, but expected %t", got, disabled)
+		}
+	}
+}
+
+func TestEncoder_SetGetLSBDepth(t *testing.T) {
+	enc, err := NewEncoder(48000, 1, AppVoIP)
+	if err != nil || enc == nil {
+		t.Errorf("Error creating new encoder: %v", err)
+	}
+	vals := []int{8, 16, 24}
+	for _, depth := range vals {
+		if err := enc.SetLSBDepth(depth); err != nil {
+			t.Error("Error setting LSB depth:", err)
+		}
+		got, err := enc.LSBDepth()
+		if err != nil {
+			t.Error("Error getting LSB depth", err)
+		}
+		if got != depth {
+			t.Errorf("Unexpected LSB depth. Got %d, but expected %d", got, depth)
+		}
+	}
+	invalidVals := []int{7, 25}
+	for _, depth := range invalidVals {
+		if err := enc.SetLSBDepth(depth); err == nil {
+			t.Errorf("Expected Error invalid LSB depth: %d", depth)
+		}
+	}
+}
+
+func TestEncoder_SetGetPhaseInversionDisabled(t *testing.T) {
+	enc, err := NewEncoder(48000, 2, AppAudio)
+	if err != nil || enc == nil {
+		t.Errorf("Error creating new encoder: %v", err)
+	}
+	vals := []bool{true, false}
+	for _, disabled := range vals {
+		if err := enc.SetPhaseInversionDisabled(disabled); err != nil {
+			t.Error("Error setting phase inversion disabled:", err)
+		}
+		got, err := enc.PhaseInversionDisabled()
+		if err != nil {
+			t.Error("Error getting phase inversion disabled", err)
+		}
+		if got != disabled {
+			t.Errorf("Wrong phase inversion disabled value. Got %t, but expected %t", got, disabled)
+		}
+	}
+}
+
+func TestEncoder_SetBandwidth(t *testing.T) {
+	const SAMPLE_RATE = 48000
+	const FRAME_SIZE = SAMPLE_RATE * 20 / 1000
+	pcm := make([]int16, FRAME_SIZE)
+	addSine(pcm, SAMPLE_RATE, 440)
+	data := make([]byte, 1000)
+	vals := []Bandwidth{Narrowband, Wideband, Fullband}
+	for _, bw := range vals {
+		enc, err := NewEncoder(SAMPLE_RATE, 1, AppAudio)
+		if err != nil || enc == nil {
+			t.Fatalf("Error creating new encoder: %v", err)
+		}
+		if err := enc.SetBandwidth(bw); err != nil {
+			t.Error("Error setting bandwidth:", err)
+		}
+		n, err := enc.Encode(pcm, data)
+		if err != nil {
+			t.Fatalf("Couldn't encode data: %v", err)
+		}
+		got, err := enc.Bandwidth()
+		if err != nil {
+			t.Error("Error getting bandwidth", err)
+		}
+		if got != bw {
+			t.Errorf("Unexpected bandwidth. Got %v, but expected %v", got, bw)
+		}
+		if toc := TOC(data[0]); n > 0 && toc.Bandwidth() != bw {
+			t.Errorf("Unexpected bandwidth in packet. Got %v, but expected %v", toc.Bandwidth(), bw)
+		}
+	}
+}
+
+func TestEncoder_Lookahead(t *testing.T) {
+	enc, err := NewEncoder(48000, 1, AppAudio)
+	if err != nil || enc == nil {
+		t.Fatalf("Error creating new encoder: %v", err)
+	}
+	lookahead, err := enc.Lookahead()
+	if err != nil {
+		t.Fatalf("Error getting lookahead: %v", err)
+	}
+	// 2.5 ms of algorithmic delay plus 4 ms of delay compensation
+	if lookahead != 312 {
+		t.Errorf("Unexpected lookahead for 48 kHz audio encoder: %d", lookahead)
+	}
+	enc, err = NewEncoder(48000, 1, AppRestrictedLowdelay)
+	if err != nil || enc == nil {
+		t.Fatalf("Error creating new encoder: %v", err)
+	}
+	lookahead, err = enc.Lookahead()
+	if err != nil {
+		t.Fatalf("Error getting lookahead: %v", err)
+	}
+	if lookahead != 120 {
+		t.Errorf("Unexpected lookahead for 48 kHz low delay encoder: %d", lookahead)
+	}
+}
+
+func TestEncoder_Channels(t *testing.T) {
+	for _, channels := range []int{1, 2} {
+		enc, err := NewEncoder(48000, channels, AppAudio)
+		if err != nil || enc == nil {
+			t.Fatalf("Error creating new encoder: %v", err)
+		}
+		if enc.Channels() != channels {
+			t.Errorf("Unexpected number of channels. Got %d, but expected %d", enc.Channels(), channels)
+		}
+	}
+}
+
+func TestEncoder_Snapshot(t *testing.T) {
+	enc, err := NewEncoder(24000, 2, AppAudio)
+	if err != nil || enc == nil {
+		t.Fatalf("Error creating new encoder: %v", err)
+	}
+	if err := enc.SetBitrate(64000); err != nil {
+		t.Fatalf("Error setting bitrate: %v", err)
+	}
+	if err := enc.SetDTX(true); err != nil {
+		t.Fatalf("Error setting DTX: %v", err)
+	}
+	snap, err := enc.Snapshot()
+	if err != nil {
+		t.Fatalf("Error getting snapshot: %v", err)
+	}
+	if snap.SampleRate != 24000 || snap.Channels != 2 || snap.Application != AppAudio {
+		t.Errorf("Unexpected encoder parameters in snapshot: %+v", snap)
+	}
+	if snap.Bitrate != 64000 || !snap.DTX || !snap.VBR || snap.Complexity != 9 {
+		t.Errorf("Unexpected encoder settings in snapshot: %+v", snap)
+	}
+	var uninitialized Encoder
+	if _, err := uninitialized.Snapshot(); err != ErrEncoderUninitialized {
+		t.Errorf("Expected \"unitialized encoder\" error: %v", err)
+	}
+}
+
+func TestEncoder_EncodeWithInfo(t *testing.T) {
+	const SAMPLE_RATE = 48000
+	const FRAME_SIZE = SAMPLE_RATE * 20 / 1000
+	enc, err := NewEncoder(SAMPLE_RATE, 1, AppRestrictedLowdelay)
+	if err != nil || enc == nil {
+		t.Fatalf("Error creating new encoder: %v", err)
+	}
+	pcm := make([]int16, FRAME_SIZE)
+	addSine(pcm, SAMPLE_RATE, 440)
+	data := make([]byte, 1000)
+	res, err := enc.EncodeWithInfo(pcm, data)
+	if err != nil {
+		t.Fatalf("Couldn't encode data: %v", err)
+	}
+	if res.Bytes <= 0 || res.Samples != FRAME_SIZE || res.Duration != 20*time.Millisecond {
+		t.Errorf("Unexpected packet size or duration: %+v", res)
+	}
+	// Restricted low delay never uses SILK
+	if res.Mode != ModeCELT || res.Bandwidth != Fullband || res.DTX {
+		t.Errorf("Unexpected packet info: %+v", res)
+	}
+	finalRange, err := enc.FinalRange()
+	if err != nil {
+		t.Fatalf("Error getting final range: %v", err)
+	}
+	if res.FinalRange != finalRange {
+		t.Errorf("Unexpected final range. Got %#x, but expected %#x", res.FinalRange, finalRange)
+	}
+	pcmFloat := make([]float32, FRAME_SIZE/2)
+	addSineFloat32(pcmFloat, SAMPLE_RATE, 440)
+	res, err = enc.EncodeFloat32WithInfo(pcmFloat, data)
+	if err != nil {
+		t.Fatalf("Couldn't encode data: %v", err)
+	}
+	if res.Samples != FRAME_SIZE/2 || res.Duration != 10*time.Millisecond {
+		t.Errorf("Unexpected packet duration: %+v", res)
+	}
+}
@@ -5,7 +5,9 @@
 package opus
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 )
 
 /*
@@ -34,3 +36,54 @@ const (
 func (e Error) Error() string {
 	return fmt.Sprintf("opus: %s", C.GoString(C.opus_strerror(C.int(e))))
 }
+
+// ErrRangeMismatch is returned when the final range of a decoder differs from
+// the one reported by the encoder for the same packet.
+var ErrRangeMismatch = errors.New("opus: final range mismatch")
+
+// ErrFrameDuration is returned when PCM data does not match the frame
+// duration set with SetExpertFrameDuration.
+var ErrFrameDuration = errors.New("opus: input does not match frame duration")
+
+// ErrIncompatibleState is returned when a saved state cannot be restored into
+// an encoder or decoder.
+var ErrIncompatibleState = errors.New("opus: incompatible saved state")
+
+// Errors for invalid use of this package. These are detected before calling
+// into libopus, so they don't have a libopus error code.
+var (
+	ErrNoData               = errors.New("opus: no data supplied")
+	ErrTargetBufferEmpty    = errors.New("opus: target buffer empty")
+	ErrBufferChannels       = errors.New("opus: buffer length must be multiple of channels")
+	ErrInvalidChannels      = errors.New("opus: invalid number of channels")
+	ErrEncoderUninitialized = errors.New("opus: encoder uninitialized")
+	ErrDecoderUninitialized = errors.New("opus: decoder uninitialized")
+	ErrAlreadyInitialized   = errors.New("opus: already initialized")
+	ErrStreamClosed         = errors.New("opus: stream is uninitialized or already closed")
+	ErrNilReader            = errors.New("opus: reader must be non-nil")
+	// OpusHead or OpusTags packet does not follow RFC 7845.
+	ErrInvalidHeader = errors.New("opus: invalid header packet")
+	// Malformed WebM, MP4 or MPEG-TS data.
+	ErrInvalidContainer = errors.New("opus: invalid container data")
+	// Container holds no Opus track.
+	ErrNoOpusTrack = errors.New("opus: no Opus track found")
+)
+
+// OpError is returned when a call into libopus or libopusfile fails. Err is the
+// Error or StreamError code returned by the library; use errors.Is or errors.As
+// to inspect it.
+type OpError struct {
+	// Name of the library function, e.g. "opus_encode".
+	Op string
+	// Arguments of the call, e.g. "frame_size=960, max_data_bytes=1000".
+	Args string
+	Err  error
+}
+
+func (e *OpError) Error() string {
+	return fmt.Sprintf("opus: %s(%s): %s", e.Op, e.Args, strings.TrimPrefix(e.Err.Error(), "opus: "))
+}
+
+func (e *OpError) Unwrap() error {
+	return e.Err
+}
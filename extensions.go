@@ -0,0 +1,182 @@
+// Copyright © Go Opus Authors (see AUTHORS file)
+//
+// License for use of this code is detailed in the LICENSE file
+
+package opus
+
+import (
+	"sort"
+)
+
+// Extension is a single piece of extension data carried in the padding of an
+// Opus packet, like DRED (deep redundancy) data. Extensions were introduced
+// with libopus 1.5.
+type Extension struct {
+	// Extension ID, from 2 to 127. IDs below 32 carry at most one byte of data.
+	ID int
+	// Index of the frame in the packet that the extension belongs to.
+	Frame int
+	Data  []byte
+}
+
+// extensionsSupported reports whether the linked libopus knows about
+// extensions in packet padding.
+func extensionsSupported() bool {
+	return libopusAtLeast(1, 5)
+}
+
+// PacketExtensions returns all extensions found in the padding of an Opus
+// packet, in the order in which they are stored. The extension data points into
+// the supplied buffer.
+//
+// Returns ErrUnimplemented if the linked libopus is older than 1.5.
+func PacketExtensions(data []byte) ([]Extension, error) {
+	if !extensionsSupported() {
+		return nil, ErrUnimplemented
+	}
+	p, err := ParsePacket(data)
+	if err != nil {
+		return nil, err
+	}
+	return parseExtensions(p.Padding, len(p.Frames))
+}
+
+// SetPacketExtensions rebuilds an Opus packet with the given extensions in its
+// padding, replacing any existing padding. Passing no extensions strips all of
+// them. To keep only some extensions, filter the result of PacketExtensions
+// and pass it back in.
+//
+// Returns ErrUnimplemented if the linked libopus is older than 1.5.
+func SetPacketExtensions(data []byte, exts []Extension) ([]byte, error) {
+	if !extensionsSupported() {
+		return nil, ErrUnimplemented
+	}
+	p, err := ParsePacket(data)
+	if err != nil {
+		return nil, err
+	}
+	padding, err := generateExtensions(exts, len(p.Frames))
+	if err != nil {
+		return nil, err
+	}
+	p.Padding = padding
+	return p.MarshalBinary()
+}
+
+// parseExtensions is a port of opus_packet_extensions_parse() from libopus.
+func parseExtensions(data []byte, frames int) ([]Extension, error) {
+	var exts []Extension
+	frame := 0
+	for len(data) > 0 {
+		id := int(data[0] >> 1)
+		long := data[0]&1 != 0
+		switch {
+		case id == 0 && long:
+			// Single byte of padding
+			data = data[1:]
+		case id == 0:
+			// The rest is padding
+			data = nil
+		case id == 1:
+			// Frame separator
+			if !long {
+				frame++
+				data = data[1:]
+			} else {
+				if len(data) < 2 {
+					return nil, ErrInvalidPacket
+				}
+				frame += int(data[1])
+				data = data[2:]
+			}
+			if frame >= frames {
+				return nil, ErrInvalidPacket
+			}
+		case id < 32:
+			// Short extension, with an optional single byte of data
+			size := 0
+			if long {
+				size = 1
+			}
+			if len(data) < 1+size {
+				return nil, ErrInvalidPacket
+			}
+			exts = append(exts, Extension{ID: id, Frame: frame, Data: data[1 : 1+size]})
+			data = data[1+size:]
+		case !long:
+			// Long extension without length: data runs until the end
+			exts = append(exts, Extension{ID: id, Frame: frame, Data: data[1:]})
+			data = nil
+		default:
+			size := 0
+			data = data[1:]
+			for {
+				if len(data) == 0 {
+					return nil, ErrInvalidPacket
+				}
+				b := data[0]
+				data = data[1:]
+				size += int(b)
+				if b != 255 {
+					break
+				}
+			}
+			if size > len(data) {
+				return nil, ErrInvalidPacket
+			}
+			exts = append(exts, Extension{ID: id, Frame: frame, Data: data[:size]})
+			data = data[size:]
+		}
+	}
+	return exts, nil
+}
+
+// generateExtensions is a port of opus_packet_extensions_generate() from
+// libopus, without the padding to a fixed size.
+func generateExtensions(exts []Extension, frames int) ([]byte, error) {
+	if len(exts) == 0 {
+		return nil, nil
+	}
+	for _, ext := range exts {
+		if ext.ID < 2 || ext.ID > 127 || ext.Frame < 0 || ext.Frame >= frames {
+			return nil, ErrBadArg
+		}
+		if ext.ID < 32 && len(ext.Data) > 1 {
+			return nil, ErrBadArg
+		}
+	}
+	// Extensions are stored in frame order, but keep their relative order
+	// within a frame.
+	sorted := make([]Extension, len(exts))
+	copy(sorted, exts)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Frame < sorted[j].Frame
+	})
+	var b []byte
+	frame := 0
+	for i, ext := range sorted {
+		if diff := ext.Frame - frame; diff == 1 {
+			b = append(b, 0x02)
+		} else if diff > 1 {
+			b = append(b, 0x03, byte(diff))
+		}
+		frame = ext.Frame
+		if ext.ID < 32 {
+			b = append(b, byte(ext.ID<<1|len(ext.Data)))
+			b = append(b, ext.Data...)
+			continue
+		}
+		if i == len(sorted)-1 {
+			// The last extension runs until the end, no length needed
+			b = append(b, byte(ext.ID<<1))
+		} else {
+			b = append(b, byte(ext.ID<<1|1))
+			for j := 0; j < len(ext.Data)/255; j++ {
+				b = append(b, 255)
+			}
+			b = append(b, byte(len(ext.Data)%255))
+		}
+		b = append(b, ext.Data...)
+	}
+	return b, nil
+}
@@ -0,0 +1,92 @@
+// Copyright © Go Opus Authors (see AUTHORS file)
+//
+// License for use of this code is detailed in the LICENSE file
+
+package opus
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestPacketExtensions(t *testing.T) {
+	if !extensionsSupported() {
+		t.Skipf("Extensions not supported by %s", Version())
+	}
+	// 3 frames of 20 ms CELT
+	packet := []byte{31<<3 | 3, 3, 1, 2, 3}
+	exts := []Extension{
+		{ID: 40, Frame: 2, Data: bytes.Repeat([]byte{0xab}, 300)},
+		{ID: 5, Frame: 0, Data: []byte{42}},
+		{ID: 6, Frame: 0, Data: []byte{}},
+		{ID: 33, Frame: 1, Data: []byte{1, 2, 3}},
+		{ID: 34, Frame: 2, Data: []byte{4, 5}},
+	}
+	withExts, err := SetPacketExtensions(packet, exts)
+	if err != nil {
+		t.Fatalf("Couldn't set extensions: %v", err)
+	}
+	got, err := PacketExtensions(withExts)
+	if err != nil {
+		t.Fatalf("Couldn't parse extensions: %v", err)
+	}
+	expected := []Extension{exts[1], exts[2], exts[3], exts[0], exts[4]}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Unexpected extensions: %v", got)
+	}
+	p, err := ParsePacket(withExts)
+	if err != nil {
+		t.Fatalf("Couldn't parse packet with extensions: %v", err)
+	}
+	if !reflect.DeepEqual(p.Frames, [][]byte{{1}, {2}, {3}}) {
+		t.Errorf("Frames changed by adding extensions: %v", p.Frames)
+	}
+
+	stripped, err := SetPacketExtensions(withExts, nil)
+	if err != nil {
+		t.Fatalf("Couldn't strip extensions: %v", err)
+	}
+	got, err = PacketExtensions(stripped)
+	if err != nil || len(got) != 0 {
+		t.Errorf("Expected no extensions after stripping, got %v (%v)", got, err)
+	}
+	if len(stripped) != len(packet) {
+		t.Errorf("Unexpected size of stripped packet: %d", len(stripped))
+	}
+}
+
+func TestParseExtensions(t *testing.T) {
+	padding := []byte{
+		// Padding byte
+		0x01,
+		// ID 3, one byte of data
+		3<<1 | 1, 0x77,
+		// Skip to frame 2
+		0x03, 2,
+		// ID 50, explicit length
+		50<<1 | 1, 2, 8, 9,
+		// Rest is padding
+		0x00, 0xff, 0xff,
+	}
+	got, err := parseExtensions(padding, 3)
+	if err != nil {
+		t.Fatalf("Couldn't parse extensions: %v", err)
+	}
+	expected := []Extension{
+		{ID: 3, Frame: 0, Data: []byte{0x77}},
+		{ID: 50, Frame: 2, Data: []byte{8, 9}},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Unexpected extensions: %v", got)
+	}
+	if _, err := parseExtensions(padding, 2); err != ErrInvalidPacket {
+		t.Errorf("Expected error for extension beyond last frame, got: %v", err)
+	}
+	if _, err := parseExtensions([]byte{50<<1 | 1, 5, 1}, 1); err != ErrInvalidPacket {
+		t.Errorf("Expected error for truncated extension, got: %v", err)
+	}
+	if _, err := generateExtensions([]Extension{{ID: 4, Data: []byte{1, 2}}}, 1); err != ErrBadArg {
+		t.Errorf("Expected error for oversized short extension, got: %v", err)
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright © Go Opus Authors (see AUTHORS file)
+//
+// License for use of this code is detailed in the LICENSE file
+
+//go:build go1.18
+// +build go1.18
+
+package opus
+
+import "unsafe"
+
+// Sample is the type of a single PCM sample: 16-bit signed integer or 32-bit
+// float in the range [-1, 1].
+type Sample interface {
+	int16 | float32
+}
+
+// pcmOf describes pcm for the shared encoding and decoding code.
+func pcmOf[T Sample](pcm []T) pcmBuffer {
+	var zero T
+	_, float := any(zero).(float32)
+	b := pcmBuffer{len: len(pcm), cap: cap(pcm), float: float}
+	if cap(pcm) > 0 {
+		b.p = unsafe.Pointer(&pcm[:1][0])
+	}
+	return b
+}
+
+// Encode encodes PCM data of either sample type, see Encoder.Encode and
+// Encoder.EncodeFloat32.
+func Encode[T Sample](enc *Encoder, pcm []T, data []byte) (int, error) {
+	return enc.encode(pcmOf(pcm), data)
+}
+
+// Decode decodes a packet into PCM data of either sample type, see
+// Decoder.Decode and Decoder.DecodeFloat32.
+func Decode[T Sample](dec *Decoder, data []byte, pcm []T) (int, error) {
+	return dec.decode(data, pcmOf(pcm), decodeNormal)
+}
+
+// DecodeFEC recovers a lost packet from the FEC data in the next packet, see
+// Decoder.DecodeFEC and Decoder.DecodeFECFloat32.
+func DecodeFEC[T Sample](dec *Decoder, data []byte, pcm []T) error {
+	_, err := dec.decode(data, pcmOf(pcm), decodeFEC)
+	return err
+}
+
+// DecodePLC conceals a lost packet, see Decoder.DecodePLC and
+// Decoder.DecodePLCFloat32.
+func DecodePLC[T Sample](dec *Decoder, pcm []T) error {
+	_, err := dec.decode(nil, pcmOf(pcm), decodePLC)
+	return err
+}
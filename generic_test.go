@@ -0,0 +1,64 @@
+// Copyright © Go Opus Authors (see AUTHORS file)
+//
+// License for use of this code is detailed in the LICENSE file
+
+//go:build go1.18
+// +build go1.18
+
+package opus
+
+import "testing"
+
+// roundTrip encodes and decodes a single frame, independent of the sample type.
+func roundTrip[T Sample](t *testing.T, pcm []T) []T {
+	enc, err := NewEncoder(48000, 1, AppVoIP)
+	if err != nil || enc == nil {
+		t.Fatalf("Error creating new encoder: %v", err)
+	}
+	dec, err := NewDecoder(48000, 1)
+	if err != nil || dec == nil {
+		t.Fatalf("Error creating new decoder: %v", err)
+	}
+	data := make([]byte, 1000)
+	n, err := Encode(enc, pcm, data)
+	if err != nil {
+		t.Fatalf("Couldn't encode data: %v", err)
+	}
+	out := make([]T, len(pcm))
+	m, err := Decode(dec, data[:n], out)
+	if err != nil {
+		t.Fatalf("Couldn't decode data: %v", err)
+	}
+	if m != len(pcm) {
+		t.Errorf("Length mismatch: %d samples in, %d out", len(pcm), m)
+	}
+	if err := DecodePLC(dec, out); err != nil {
+		t.Errorf("Couldn't conceal lost packet: %v", err)
+	}
+	if err := DecodeFEC(dec, data[:n], out); err != nil {
+		t.Errorf("Couldn't decode FEC data: %v", err)
+	}
+	return out
+}
+
+func TestGenericCodec(t *testing.T) {
+	const FRAME_SIZE = 960
+	pcm := make([]int16, FRAME_SIZE)
+	addSine(pcm, 48000, 440)
+	roundTrip(t, pcm)
+	pcmFloat := make([]float32, FRAME_SIZE)
+	addSineFloat32(pcmFloat, 48000, 440)
+	roundTrip(t, pcmFloat)
+}
+
+func TestPCMOf(t *testing.T) {
+	if b := pcmOf(make([]int16, 2, 4)); b.float || b.len != 2 || b.cap != 4 || b.p == nil {
+		t.Errorf("Unexpected buffer for int16 samples: %+v", b)
+	}
+	if b := pcmOf(make([]float32, 0, 4)); !b.float || b.len != 0 || b.cap != 4 || b.p == nil {
+		t.Errorf("Unexpected buffer for float32 samples: %+v", b)
+	}
+	if b := pcmOf([]float32(nil)); b.p != nil {
+		t.Errorf("Expected no sample pointer for nil buffer: %+v", b)
+	}
+}
@@ -0,0 +1,340 @@
+// Copyright © Go Opus Authors (see AUTHORS file)
+//
+// License for use of this code is detailed in the LICENSE file
+
+package opus
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// Head is the identification header (OpusHead) of an Ogg Opus stream, see RFC
+// 7845, section 5.1. Other containers, like Matroska and MP4, store the same
+// information.
+type Head struct {
+	// Encapsulation version. Only the major version (upper 4 bits) must be 0;
+	// 0 is written as 1.
+	Version int
+	// Number of output channels.
+	Channels int
+	// Number of samples at 48 kHz to discard from the decoder output when
+	// starting playback.
+	PreSkip int
+	// Sample rate of the original input, for information only. 0 if unknown.
+	InputSampleRate int
+	// Gain to apply to the decoder output, in Q8 dB units (1/256 dB).
+	OutputGain int
+	// Channel mapping family: 0 for mono or stereo, 1 for Vorbis surround
+	// layouts, 2 and 3 for ambisonics, 255 for discrete channels.
+	MappingFamily int
+	// Stream layout, for every family but 0.
+	Streams        int
+	CoupledStreams int
+	// Channel mapping table, with one entry per channel, for every family but
+	// 0 and 3.
+	Mapping []byte
+	// Demixing matrix of mapping family 3, as returned by
+	// ProjectionEncoder.DemixingMatrix.
+	DemixingMatrix []byte
+}
+
+const headMinSize = 19
+
+// Validate checks the fields of the header against RFC 7845 and, for families
+// 2 and 3, RFC 8486.
+func (h *Head) Validate() error {
+	if h.Version < 0 || h.Version > 15 {
+		return fmt.Errorf("%w: unsupported version %d", ErrInvalidHeader, h.Version)
+	}
+	if h.Channels < 1 || h.Channels > 255 {
+		return fmt.Errorf("%w: %d channels", ErrInvalidHeader, h.Channels)
+	}
+	if h.PreSkip < 0 || h.PreSkip > 0xffff {
+		return fmt.Errorf("%w: pre-skip %d", ErrInvalidHeader, h.PreSkip)
+	}
+	if h.InputSampleRate < 0 || int64(h.InputSampleRate) > 0xffffffff {
+		return fmt.Errorf("%w: input sample rate %d", ErrInvalidHeader, h.InputSampleRate)
+	}
+	if h.OutputGain < -0x8000 || h.OutputGain > 0x7fff {
+		return fmt.Errorf("%w: output gain %d", ErrInvalidHeader, h.OutputGain)
+	}
+	switch h.MappingFamily {
+	case 0:
+		if h.Channels > 2 {
+			return fmt.Errorf("%w: %d channels in mapping family 0", ErrInvalidHeader, h.Channels)
+		}
+		return nil
+	case 1:
+		if h.Channels > 8 {
+			return fmt.Errorf("%w: %d channels in mapping family 1", ErrInvalidHeader, h.Channels)
+		}
+	case 2, 3:
+		if _, ok := AmbisonicOrder(h.Channels); !ok {
+			return fmt.Errorf("%w: %d channels in ambisonic mapping family %d",
+				ErrInvalidHeader, h.Channels, h.MappingFamily)
+		}
+	}
+	if h.Streams < 1 || h.CoupledStreams < 0 || h.CoupledStreams > h.Streams ||
+		h.Streams+h.CoupledStreams > 255 {
+		return fmt.Errorf("%w: %d streams of which %d coupled", ErrInvalidHeader, h.Streams, h.CoupledStreams)
+	}
+	if h.MappingFamily == 3 {
+		if expected := 2 * h.Channels * (h.Streams + h.CoupledStreams); len(h.DemixingMatrix) != expected {
+			return fmt.Errorf("%w: demixing matrix has %d bytes, expected %d",
+				ErrInvalidHeader, len(h.DemixingMatrix), expected)
+		}
+		return nil
+	}
+	if err := checkMapping(h.Channels, h.Streams, h.CoupledStreams, h.Mapping); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidHeader, err)
+	}
+	return nil
+}
+
+// MarshalBinary encodes the header as an OpusHead packet.
+func (h *Head) MarshalBinary() ([]byte, error) {
+	if err := h.Validate(); err != nil {
+		return nil, err
+	}
+	version := h.Version
+	if version == 0 {
+		version = 1
+	}
+	data := make([]byte, headMinSize, headMinSize+2+len(h.Mapping)+len(h.DemixingMatrix))
+	copy(data, "OpusHead")
+	data[8] = byte(version)
+	data[9] = byte(h.Channels)
+	binary.LittleEndian.PutUint16(data[10:], uint16(h.PreSkip))
+	binary.LittleEndian.PutUint32(data[12:], uint32(h.InputSampleRate))
+	binary.LittleEndian.PutUint16(data[16:], uint16(int16(h.OutputGain)))
+	data[18] = byte(h.MappingFamily)
+	if h.MappingFamily == 0 {
+		return data, nil
+	}
+	data = append(data, byte(h.Streams), byte(h.CoupledStreams))
+	if h.MappingFamily == 3 {
+		return append(data, h.DemixingMatrix...), nil
+	}
+	return append(data, h.Mapping...), nil
+}
+
+// UnmarshalBinary decodes an OpusHead packet. Data following the header, which
+// later minor versions may add, is ignored.
+func (h *Head) UnmarshalBinary(data []byte) error {
+	if len(data) < headMinSize || string(data[:8]) != "OpusHead" {
+		return fmt.Errorf("%w: not an OpusHead packet", ErrInvalidHeader)
+	}
+	head := Head{
+		Version:         int(data[8]),
+		Channels:        int(data[9]),
+		PreSkip:         int(binary.LittleEndian.Uint16(data[10:])),
+		InputSampleRate: int(binary.LittleEndian.Uint32(data[12:])),
+		OutputGain:      int(int16(binary.LittleEndian.Uint16(data[16:]))),
+		MappingFamily:   int(data[18]),
+	}
+	if head.MappingFamily != 0 {
+		if len(data) < headMinSize+2 {
+			return fmt.Errorf("%w: missing channel mapping table", ErrInvalidHeader)
+		}
+		head.Streams = int(data[19])
+		head.CoupledStreams = int(data[20])
+		table := data[21:]
+		size := head.Channels
+		if head.MappingFamily == 3 {
+			size = 2 * head.Channels * (head.Streams + head.CoupledStreams)
+		}
+		if len(table) < size {
+			return fmt.Errorf("%w: channel mapping table too short", ErrInvalidHeader)
+		}
+		if head.MappingFamily == 3 {
+			head.DemixingMatrix = append([]byte(nil), table[:size]...)
+		} else {
+			head.Mapping = append([]byte(nil), table[:size]...)
+		}
+	}
+	if err := head.Validate(); err != nil {
+		return err
+	}
+	*h = head
+	return nil
+}
+
+// PacketDecoder is implemented by Decoder, MultistreamDecoder and
+// ProjectionDecoder.
+type PacketDecoder interface {
+	Decode(data []byte, pcm []int16) (int, error)
+	DecodeFloat32(data []byte, pcm []float32) (int, error)
+	DecodeFEC(data []byte, pcm []int16) error
+	DecodeFECFloat32(data []byte, pcm []float32) error
+	DecodePLC(pcm []int16) error
+	DecodePLCFloat32(pcm []float32) error
+	Channels() int
+	LastPacketDuration() (int, error)
+	SetGain(gain int) error
+	Gain() (int, error)
+	FinalRange() (uint32, error)
+	Reset() error
+}
+
+var (
+	_ PacketDecoder = (*Decoder)(nil)
+	_ PacketDecoder = (*MultistreamDecoder)(nil)
+	_ PacketDecoder = (*ProjectionDecoder)(nil)
+)
+
+// NewDecoderFromHead creates a decoder for the stream described by the header,
+// decoding at the given sample rate: a Decoder for mapping family 0, a
+// ProjectionDecoder for family 3 and a MultistreamDecoder otherwise. The output
+// gain of the header is applied by the decoder. Pre-skip is left to the
+// caller.
+func NewDecoderFromHead(sample_rate int, h *Head) (PacketDecoder, error) {
+	if err := h.Validate(); err != nil {
+		return nil, err
+	}
+	var dec PacketDecoder
+	var err error
+	switch h.MappingFamily {
+	case 0:
+		dec, err = NewDecoder(sample_rate, h.Channels)
+	case 1, 2, 255:
+		dec, err = NewMultistreamDecoder(sample_rate, h.Channels, h.Streams, h.CoupledStreams, h.Mapping)
+	case 3:
+		dec, err = NewProjectionDecoder(sample_rate, h.Channels, h.Streams, h.CoupledStreams,
+			h.DemixingMatrix)
+	default:
+		// RFC 7845 forbids decoding reserved families
+		return nil, fmt.Errorf("%w: mapping family %d", ErrUnimplemented, h.MappingFamily)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if h.OutputGain != 0 {
+		if err := dec.SetGain(h.OutputGain); err != nil {
+			return nil, err
+		}
+	}
+	return dec, nil
+}
+
+// Tags is the comment header (OpusTags) of an Ogg Opus stream, see RFC 7845,
+// section 5.2.
+type Tags struct {
+	Vendor string
+	// User comments of the form "NAME=value".
+	Comments []string
+	// Binary data after the comments. RFC 7845 requires keeping it only if
+	// the least significant bit of the first byte is set; other data is
+	// dropped when decoding, and rejected when encoding.
+	Binary []byte
+}
+
+// Get returns the value of the first comment with the given name, compared
+// case insensitively.
+func (t *Tags) Get(name string) (string, bool) {
+	for _, c := range t.Comments {
+		if i := strings.IndexByte(c, '='); i >= 0 && strings.EqualFold(c[:i], name) {
+			return c[i+1:], true
+		}
+	}
+	return "", false
+}
+
+// Add appends a comment. Names are case insensitive ASCII, without '='.
+func (t *Tags) Add(name string, value string) error {
+	if err := checkTagName(name); err != nil {
+		return err
+	}
+	t.Comments = append(t.Comments, name+"="+value)
+	return nil
+}
+
+func checkTagName(name string) error {
+	if name == "" {
+		return fmt.Errorf("%w: empty comment name", ErrInvalidHeader)
+	}
+	for _, r := range name {
+		if r < 0x20 || r > 0x7d || r == '=' {
+			return fmt.Errorf("%w: invalid comment name %q", ErrInvalidHeader, name)
+		}
+	}
+	return nil
+}
+
+// MarshalBinary encodes the comments as an OpusTags packet.
+func (t *Tags) MarshalBinary() ([]byte, error) {
+	for _, c := range t.Comments {
+		i := strings.IndexByte(c, '=')
+		if i < 0 {
+			return nil, fmt.Errorf("%w: comment %q has no '='", ErrInvalidHeader, c)
+		}
+		if err := checkTagName(c[:i]); err != nil {
+			return nil, err
+		}
+	}
+	if len(t.Binary) > 0 && t.Binary[0]&1 == 0 {
+		return nil, fmt.Errorf("%w: binary data must start with an odd byte", ErrInvalidHeader)
+	}
+	data := []byte("OpusTags")
+	data = appendUint32(data, uint32(len(t.Vendor)))
+	data = append(data, t.Vendor...)
+	data = appendUint32(data, uint32(len(t.Comments)))
+	for _, c := range t.Comments {
+		data = appendUint32(data, uint32(len(c)))
+		data = append(data, c...)
+	}
+	return append(data, t.Binary...), nil
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+// UnmarshalBinary decodes an OpusTags packet.
+func (t *Tags) UnmarshalBinary(data []byte) error {
+	if len(data) < 8 || string(data[:8]) != "OpusTags" {
+		return fmt.Errorf("%w: not an OpusTags packet", ErrInvalidHeader)
+	}
+	data = data[8:]
+	readString := func() (string, error) {
+		if len(data) < 4 {
+			return "", fmt.Errorf("%w: OpusTags packet too short", ErrInvalidHeader)
+		}
+		n := binary.LittleEndian.Uint32(data)
+		if uint64(n) > uint64(len(data)-4) {
+			return "", fmt.Errorf("%w: OpusTags packet too short", ErrInvalidHeader)
+		}
+		s := string(data[4 : 4+n])
+		data = data[4+n:]
+		return s, nil
+	}
+	var tags Tags
+	var err error
+	if tags.Vendor, err = readString(); err != nil {
+		return err
+	}
+	if len(data) < 4 {
+		return fmt.Errorf("%w: OpusTags packet too short", ErrInvalidHeader)
+	}
+	count := binary.LittleEndian.Uint32(data)
+	data = data[4:]
+	// Every comment takes at least 4 bytes, don't trust the count for
+	// allocation
+	if uint64(count) > uint64(len(data)/4) {
+		return fmt.Errorf("%w: OpusTags packet too short", ErrInvalidHeader)
+	}
+	tags.Comments = make([]string, 0, count)
+	for i := uint32(0); i < count; i++ {
+		c, err := readString()
+		if err != nil {
+			return err
+		}
+		tags.Comments = append(tags.Comments, c)
+	}
+	if len(data) > 0 && data[0]&1 == 1 {
+		tags.Binary = append([]byte(nil), data...)
+	}
+	*t = tags
+	return nil
+}
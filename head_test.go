@@ -0,0 +1,150 @@
+// Copyright © Go Opus Authors (see AUTHORS file)
+//
+// License for use of this code is detailed in the LICENSE file
+
+package opus
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestHeadMarshal(t *testing.T) {
+	// Stereo header from RFC 7845 example values
+	head := Head{Version: 1, Channels: 2, PreSkip: 312, InputSampleRate: 44100, OutputGain: -256}
+	data, err := head.MarshalBinary()
+	if err != nil {
+		t.Fatalf("Couldn't marshal header: %v", err)
+	}
+	expected := []byte{'O', 'p', 'u', 's', 'H', 'e', 'a', 'd', 1, 2, 0x38, 0x01, 0x44, 0xac, 0, 0, 0x00, 0xff, 0}
+	if !bytes.Equal(data, expected) {
+		t.Errorf("Unexpected OpusHead:\n%v\nexpected\n%v", data, expected)
+	}
+	for _, h := range []Head{
+		head,
+		{Version: 1, Channels: 6, PreSkip: 312, MappingFamily: 1, Streams: 4, CoupledStreams: 2,
+			Mapping: []byte{0, 4, 1, 2, 3, 5}},
+		{Version: 1, Channels: 4, MappingFamily: 2, Streams: 4, Mapping: []byte{0, 1, 2, 3}},
+		{Version: 1, Channels: 4, MappingFamily: 3, Streams: 2, CoupledStreams: 2,
+			DemixingMatrix: make([]byte, 2*4*4)},
+		{Version: 1, Channels: 3, MappingFamily: 255, Streams: 3, Mapping: []byte{0, 255, 2}},
+	} {
+		data, err := h.MarshalBinary()
+		if err != nil {
+			t.Fatalf("Couldn't marshal header %+v: %v", h, err)
+		}
+		var parsed Head
+		if err := parsed.UnmarshalBinary(data); err != nil {
+			t.Fatalf("Couldn't unmarshal header %+v: %v", h, err)
+		}
+		if !reflect.DeepEqual(parsed, h) {
+			t.Errorf("Header changed in round trip: %+v, expected %+v", parsed, h)
+		}
+	}
+}
+
+func TestHeadUnmarshal(t *testing.T) {
+	valid := []byte{'O', 'p', 'u', 's', 'H', 'e', 'a', 'd', 1, 1, 0, 0, 0x80, 0xbb, 0, 0, 0, 0, 0}
+	var head Head
+	// Later minor versions may add fields
+	next := append(append([]byte(nil), valid...), 0xaa, 0xbb)
+	next[8] = 15
+	if err := head.UnmarshalBinary(next); err != nil || head.Version != 15 || head.InputSampleRate != 48000 {
+		t.Errorf("Couldn't unmarshal minor version 15: %+v (%v)", head, err)
+	}
+	for name, mutate := range map[string]func([]byte) []byte{
+		"magic":         func(b []byte) []byte { b[0] = 'o'; return b },
+		"short":         func(b []byte) []byte { return b[:18] },
+		"major version": func(b []byte) []byte { b[8] = 0x10; return b },
+		"no channels":   func(b []byte) []byte { b[9] = 0; return b },
+		"family 0":      func(b []byte) []byte { b[9] = 3; return b },
+		"no table":      func(b []byte) []byte { b[18] = 1; return b },
+		"short table":   func(b []byte) []byte { b[18] = 1; return append(b, 1, 0) },
+		"bad mapping":   func(b []byte) []byte { b[18] = 255; return append(b, 1, 0, 1) },
+		"family 1":      func(b []byte) []byte { b[9] = 9; b[18] = 1; return append(b, 9, 0, 0, 1, 2, 3, 4, 5, 6, 7, 8) },
+		"ambisonics":    func(b []byte) []byte { b[9] = 2; b[18] = 2; return append(b, 2, 0, 0, 1) },
+		"matrix":        func(b []byte) []byte { b[18] = 3; return append(b, 1, 0, 0) },
+	} {
+		err := head.UnmarshalBinary(mutate(append([]byte(nil), valid...)))
+		if !errors.Is(err, ErrInvalidHeader) {
+			t.Errorf("Expected ErrInvalidHeader for %s, got %v", name, err)
+		}
+	}
+}
+
+func TestTagsMarshal(t *testing.T) {
+	tags := Tags{Vendor: "libopus 1.3", Comments: []string{"TITLE=Test", "artist=Someone"},
+		Binary: []byte{1, 2, 3}}
+	data, err := tags.MarshalBinary()
+	if err != nil {
+		t.Fatalf("Couldn't marshal tags: %v", err)
+	}
+	var parsed Tags
+	if err := parsed.UnmarshalBinary(data); err != nil {
+		t.Fatalf("Couldn't unmarshal tags: %v", err)
+	}
+	if !reflect.DeepEqual(parsed, tags) {
+		t.Errorf("Tags changed in round trip: %+v, expected %+v", parsed, tags)
+	}
+	if v, ok := parsed.Get("ARTIST"); !ok || v != "Someone" {
+		t.Errorf("Unexpected artist: %q, %v", v, ok)
+	}
+	if _, ok := parsed.Get("ALBUM"); ok {
+		t.Errorf("Unexpected album")
+	}
+	// Padding, with the lowest bit of the first byte unset, is dropped
+	padded := append(data[:len(data)-3], 0, 0, 0)
+	if err := parsed.UnmarshalBinary(padded); err != nil || parsed.Binary != nil {
+		t.Errorf("Unexpected binary data: %v (%v)", parsed.Binary, err)
+	}
+	if err := parsed.Add("BAD=NAME", "x"); !errors.Is(err, ErrInvalidHeader) {
+		t.Errorf("Expected ErrInvalidHeader, got %v", err)
+	}
+	if _, err := (&Tags{Binary: []byte{2}}).MarshalBinary(); !errors.Is(err, ErrInvalidHeader) {
+		t.Errorf("Expected ErrInvalidHeader, got %v", err)
+	}
+	// Comment count larger than the packet
+	if err := parsed.UnmarshalBinary(append([]byte("OpusTags"), 0, 0, 0, 0, 0xff, 0xff, 0xff, 0xff)); !errors.Is(err, ErrInvalidHeader) {
+		t.Errorf("Expected ErrInvalidHeader, got %v", err)
+	}
+}
+
+func TestNewDecoderFromHead(t *testing.T) {
+	enc, err := NewEncoder(48000, 2, AppAudio)
+	if err != nil {
+		t.Fatalf("Error creating encoder: %v", err)
+	}
+	head, err := enc.Head()
+	if err != nil {
+		t.Fatalf("Couldn't create header: %v", err)
+	}
+	if head.MappingFamily != 0 || head.Channels != 2 || head.PreSkip <= 0 {
+		t.Errorf("Unexpected header: %+v", head)
+	}
+	head.OutputGain = 512
+	dec, err := NewDecoderFromHead(48000, head)
+	if err != nil {
+		t.Fatalf("Error creating decoder: %v", err)
+	}
+	if _, ok := dec.(*Decoder); !ok {
+		t.Errorf("Expected Decoder, got %T", dec)
+	}
+	if gain, err := dec.Gain(); err != nil || gain != 512 {
+		t.Errorf("Unexpected gain: %d (%v)", gain, err)
+	}
+	ms := &Head{Channels: 6, MappingFamily: 1, Streams: surround51Streams,
+		CoupledStreams: surround51CoupledStreams, Mapping: surround51Mapping}
+	dec, err = NewDecoderFromHead(48000, ms)
+	if err != nil {
+		t.Fatalf("Error creating decoder: %v", err)
+	}
+	if _, ok := dec.(*MultistreamDecoder); !ok || dec.Channels() != 6 {
+		t.Errorf("Expected MultistreamDecoder with 6 channels, got %T", dec)
+	}
+	reserved := &Head{Channels: 1, MappingFamily: 4, Streams: 1, Mapping: []byte{0}}
+	if _, err := NewDecoderFromHead(48000, reserved); !errors.Is(err, ErrUnimplemented) {
+		t.Errorf("Expected ErrUnimplemented, got %v", err)
+	}
+}
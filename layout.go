@@ -0,0 +1,382 @@
+// Copyright © Go Opus Authors (see AUTHORS file)
+//
+// License for use of this code is detailed in the LICENSE file
+
+package opus
+
+import (
+	"fmt"
+	"math"
+)
+
+// ChannelPosition is the speaker position of a single channel.
+type ChannelPosition int
+
+const (
+	// Position of channels in mapping family 255, which has no defined
+	// meaning.
+	PositionUnknown ChannelPosition = iota
+	FrontLeft
+	FrontRight
+	FrontCenter
+	LowFrequency
+	SideLeft
+	SideRight
+	RearLeft
+	RearRight
+	RearCenter
+)
+
+var channelPositionNames = map[ChannelPosition]string{
+	PositionUnknown: "?",
+	FrontLeft:       "L",
+	FrontRight:      "R",
+	FrontCenter:     "C",
+	LowFrequency:    "LFE",
+	SideLeft:        "Ls",
+	SideRight:       "Rs",
+	RearLeft:        "Lr",
+	RearRight:       "Rr",
+	RearCenter:      "Cs",
+}
+
+func (p ChannelPosition) String() string {
+	if name, ok := channelPositionNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("ChannelPosition(%d)", int(p))
+}
+
+// ChannelLayout lists the position of every channel, in the order of the
+// channels in an interleaved buffer.
+type ChannelLayout []ChannelPosition
+
+// Channel layouts in Vorbis channel order, as used by Ogg Opus mapping families
+// 0 and 1. See RFC 7845, section 5.1.1.2.
+var (
+	LayoutMono           = ChannelLayout{FrontCenter}
+	LayoutStereo         = ChannelLayout{FrontLeft, FrontRight}
+	LayoutLinearSurround = ChannelLayout{FrontLeft, FrontCenter, FrontRight}
+	LayoutQuad           = ChannelLayout{FrontLeft, FrontRight, RearLeft, RearRight}
+	Layout50             = ChannelLayout{FrontLeft, FrontCenter, FrontRight, RearLeft, RearRight}
+	Layout51             = ChannelLayout{FrontLeft, FrontCenter, FrontRight, RearLeft, RearRight, LowFrequency}
+	Layout61             = ChannelLayout{FrontLeft, FrontCenter, FrontRight, SideLeft, SideRight, RearCenter,
+		LowFrequency}
+	Layout71 = ChannelLayout{FrontLeft, FrontCenter, FrontRight, SideLeft, SideRight, RearLeft, RearRight,
+		LowFrequency}
+)
+
+var vorbisLayouts = []ChannelLayout{
+	LayoutMono, LayoutStereo, LayoutLinearSurround, LayoutQuad, Layout50, Layout51, Layout61, Layout71,
+}
+
+// VorbisLayout returns the channel layout for a number of channels in Vorbis
+// channel order, from 1 to 8 channels.
+func VorbisLayout(channels int) (ChannelLayout, error) {
+	if channels < 1 || channels > len(vorbisLayouts) {
+		return nil, fmt.Errorf("%w: no Vorbis channel layout for %d channels", ErrInvalidChannels, channels)
+	}
+	return vorbisLayouts[channels-1], nil
+}
+
+// LayoutForMappingFamily returns the channel layout of decoded audio for an
+// Ogg Opus channel mapping family. Family 0 and 1 use Vorbis channel order;
+// the channels of family 255 have no defined position. The ambisonic families
+// 2 and 3 have no speaker layout and return ErrUnimplemented.
+func LayoutForMappingFamily(family int, channels int) (ChannelLayout, error) {
+	switch family {
+	case 0:
+		if channels > 2 {
+			return nil, fmt.Errorf("%w: %d channels in mapping family 0", ErrInvalidChannels, channels)
+		}
+		return VorbisLayout(channels)
+	case 1:
+		return VorbisLayout(channels)
+	case 255:
+		if channels < 1 || channels > 255 {
+			return nil, fmt.Errorf("%w: %d channels in mapping family 255", ErrInvalidChannels, channels)
+		}
+		return make(ChannelLayout, channels), nil
+	case 2, 3:
+		return nil, fmt.Errorf("%w: mapping family %d has no speaker layout", ErrUnimplemented, family)
+	}
+	return nil, fmt.Errorf("%w: unknown mapping family %d", ErrBadArg, family)
+}
+
+// Equal reports whether two layouts have the same positions in the same order.
+func (l ChannelLayout) Equal(other ChannelLayout) bool {
+	if len(l) != len(other) {
+		return false
+	}
+	for i := range l {
+		if l[i] != other[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (l ChannelLayout) index(p ChannelPosition) int {
+	for i, q := range l {
+		if q == p {
+			return i
+		}
+	}
+	return -1
+}
+
+// MappingFamily returns the Ogg Opus channel mapping family to store this
+// layout with: 0 for mono and stereo, 1 for the other Vorbis layouts, and 255
+// for anything else.
+func (l ChannelLayout) MappingFamily() int {
+	if len(l) <= 2 && (l.Equal(LayoutMono) || l.Equal(LayoutStereo)) {
+		return 0
+	}
+	if layout, err := VorbisLayout(len(l)); err == nil && l.Equal(layout) {
+		return 1
+	}
+	return 255
+}
+
+// Positions that are coded together in one stereo stream. libopus also
+// couples the front and rear center channels of 6.1.
+var channelPairs = [][2]ChannelPosition{
+	{FrontLeft, FrontRight},
+	{SideLeft, SideRight},
+	{RearLeft, RearRight},
+	{FrontCenter, RearCenter},
+}
+
+// MappingTable returns the stream layout and channel mapping table of the
+// OpusHead for this layout, as chosen by libopus for mapping family 1: a
+// stereo stream for every left and right pair and for the center channels of
+// 6.1, a mono stream for every other channel, with the LFE channel last. For family 0 and 255 layouts, every
+// channel gets its own mono stream. The result can be passed to
+// NewMultistreamEncoder and NewMultistreamDecoder.
+func (l ChannelLayout) MappingTable() (streams int, coupledStreams int, mapping []byte, err error) {
+	if len(l) < 1 || len(l) > 255 {
+		return 0, 0, nil, fmt.Errorf("%w: %d channels", ErrInvalidChannels, len(l))
+	}
+	mapping = make([]byte, len(l))
+	if l.MappingFamily() != 1 {
+		if l.Equal(LayoutStereo) {
+			return 1, 1, []byte{0, 1}, nil
+		}
+		for i := range mapping {
+			mapping[i] = byte(i)
+		}
+		return len(l), 0, mapping, nil
+	}
+	coupled := make([]bool, len(l))
+	next := 0
+	for _, pair := range channelPairs {
+		left, right := l.index(pair[0]), l.index(pair[1])
+		if left >= 0 && right >= 0 {
+			mapping[left] = byte(next)
+			mapping[right] = byte(next + 1)
+			coupled[left], coupled[right] = true, true
+			next += 2
+			coupledStreams++
+		}
+	}
+	lfe := -1
+	for i, p := range l {
+		if coupled[i] {
+			continue
+		}
+		if p == LowFrequency {
+			lfe = i
+			continue
+		}
+		mapping[i] = byte(next)
+		next++
+	}
+	if lfe >= 0 {
+		mapping[lfe] = byte(next)
+	}
+	return len(l) - coupledStreams, coupledStreams, mapping, nil
+}
+
+// Matrix remixes interleaved PCM data from one number of channels to another.
+// Every output channel is a weighted sum of the input channels.
+type Matrix struct {
+	In  int
+	Out int
+	// Weight of input channel i in output channel o at Coeffs[o*In+i].
+	Coeffs []float32
+}
+
+// NewMatrix creates a remix matrix from in to out channels. The coefficients
+// are stored row by row, one row of in coefficients per output channel.
+func NewMatrix(in int, out int, coeffs []float32) (*Matrix, error) {
+	if in < 1 || out < 1 {
+		return nil, fmt.Errorf("%w: %d input and %d output channels", ErrInvalidChannels, in, out)
+	}
+	if len(coeffs) != in*out {
+		return nil, fmt.Errorf("%w: %d coefficients for a %dx%d matrix", ErrBadArg, len(coeffs), out, in)
+	}
+	return &Matrix{In: in, Out: out, Coeffs: append([]float32(nil), coeffs...)}, nil
+}
+
+// Weight of a position in the left output channel of a stereo downmix, from
+// ITU-R BS.775. Right positions mirror the left ones; the LFE channel is
+// dropped.
+var stereoDownmixWeights = map[ChannelPosition]float64{
+	FrontLeft:   1,
+	FrontCenter: math.Sqrt2 / 2,
+	SideLeft:    math.Sqrt2 / 2,
+	RearLeft:    math.Sqrt2 / 2,
+	RearCenter:  0.5,
+}
+
+// Mirror image of the right positions.
+var leftPositions = map[ChannelPosition]ChannelPosition{
+	FrontRight: FrontLeft,
+	SideRight:  SideLeft,
+	RearRight:  RearLeft,
+}
+
+// Downmix returns the standard matrix to downmix a layout to LayoutStereo or
+// LayoutMono. The stereo downmix follows ITU-R BS.775 without the LFE channel;
+// the mono downmix averages the channels of the stereo downmix. Each output
+// channel is scaled so a full-scale input cannot clip.
+func Downmix(from ChannelLayout, to ChannelLayout) (*Matrix, error) {
+	if len(from) < 1 {
+		return nil, fmt.Errorf("%w: empty layout", ErrInvalidChannels)
+	}
+	if !to.Equal(LayoutStereo) && !to.Equal(LayoutMono) {
+		return nil, fmt.Errorf("%w: can only downmix to mono or stereo, not %v", ErrBadArg, to)
+	}
+	left := make([]float64, len(from))
+	right := make([]float64, len(from))
+	for i, p := range from {
+		if p == PositionUnknown {
+			return nil, fmt.Errorf("%w: channel %d has no position", ErrBadArg, i)
+		}
+		switch {
+		case p == FrontCenter || p == RearCenter:
+			left[i] = stereoDownmixWeights[p]
+			right[i] = stereoDownmixWeights[p]
+		case leftPositions[p] != PositionUnknown:
+			right[i] = stereoDownmixWeights[leftPositions[p]]
+		default:
+			left[i] = stereoDownmixWeights[p]
+		}
+	}
+	rows := [][]float64{left, right}
+	if to.Equal(LayoutMono) {
+		mono := make([]float64, len(from))
+		for i := range mono {
+			mono[i] = (left[i] + right[i]) / 2
+		}
+		rows = [][]float64{mono}
+	}
+	m := &Matrix{In: len(from), Out: len(rows), Coeffs: make([]float32, len(from)*len(rows))}
+	for o, row := range rows {
+		var sum float64
+		for _, w := range row {
+			sum += w
+		}
+		if sum == 0 {
+			// Only LFE: silence
+			continue
+		}
+		for i, w := range row {
+			m.Coeffs[o*m.In+i] = float32(w / sum)
+		}
+	}
+	return m, nil
+}
+
+func (m *Matrix) checkBuffers(src int, dst int) (int, error) {
+	if m.In < 1 || m.Out < 1 || len(m.Coeffs) != m.In*m.Out {
+		return 0, fmt.Errorf("%w: malformed %dx%d matrix", ErrBadArg, m.Out, m.In)
+	}
+	if src%m.In != 0 {
+		return 0, ErrBufferChannels
+	}
+	frames := src / m.In
+	if dst < frames*m.Out {
+		return 0, ErrBufferTooSmall
+	}
+	return frames, nil
+}
+
+// ApplyInt16 remixes interleaved src into dst, clipping the result to the
+// int16 range. dst must have room for the same number of samples per channel
+// as src. Returns the number of samples per channel written to dst.
+func (m *Matrix) ApplyInt16(dst []int16, src []int16) (int, error) {
+	frames, err := m.checkBuffers(len(src), len(dst))
+	if err != nil {
+		return 0, err
+	}
+	for f := 0; f < frames; f++ {
+		in := src[f*m.In : (f+1)*m.In]
+		for o := 0; o < m.Out; o++ {
+			var v float32
+			for i, c := range m.Coeffs[o*m.In : (o+1)*m.In] {
+				v += c * float32(in[i])
+			}
+			v = float32(math.Round(float64(v)))
+			if v > math.MaxInt16 {
+				v = math.MaxInt16
+			} else if v < math.MinInt16 {
+				v = math.MinInt16
+			}
+			dst[f*m.Out+o] = int16(v)
+		}
+	}
+	return frames, nil
+}
+
+// ApplyFloat32 is the same as ApplyInt16, but for float32 PCM data. The
+// result is not clipped.
+func (m *Matrix) ApplyFloat32(dst []float32, src []float32) (int, error) {
+	frames, err := m.checkBuffers(len(src), len(dst))
+	if err != nil {
+		return 0, err
+	}
+	for f := 0; f < frames; f++ {
+		in := src[f*m.In : (f+1)*m.In]
+		for o := 0; o < m.Out; o++ {
+			var v float32
+			for i, c := range m.Coeffs[o*m.In : (o+1)*m.In] {
+				v += c * in[i]
+			}
+			dst[f*m.Out+o] = v
+		}
+	}
+	return frames, nil
+}
+
+// ExtractChannel copies a single channel out of interleaved PCM data, e.g. one
+// microphone of a discrete (mapping family 255) stream.
+func ExtractChannel(pcm []int16, channels int, channel int) ([]int16, error) {
+	if channel < 0 || channel >= channels {
+		return nil, fmt.Errorf("%w: channel %d of %d", ErrBadArg, channel, channels)
+	}
+	if len(pcm)%channels != 0 {
+		return nil, ErrBufferChannels
+	}
+	out := make([]int16, len(pcm)/channels)
+	for i := range out {
+		out[i] = pcm[i*channels+channel]
+	}
+	return out, nil
+}
+
+// ExtractChannelFloat32 is the same as ExtractChannel, but for float32 PCM
+// data.
+func ExtractChannelFloat32(pcm []float32, channels int, channel int) ([]float32, error) {
+	if channel < 0 || channel >= channels {
+		return nil, fmt.Errorf("%w: channel %d of %d", ErrBadArg, channel, channels)
+	}
+	if len(pcm)%channels != 0 {
+		return nil, ErrBufferChannels
+	}
+	out := make([]float32, len(pcm)/channels)
+	for i := range out {
+		out[i] = pcm[i*channels+channel]
+	}
+	return out, nil
+}
@@ -0,0 +1,163 @@
+// Copyright © Go Opus Authors (see AUTHORS file)
+//
+// License for use of this code is detailed in the LICENSE file
+
+package opus
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestChannelLayoutMappingTable(t *testing.T) {
+	// Same layouts as libopus chooses in TestSurroundEncoder
+	for _, c := range []struct {
+		layout           ChannelLayout
+		family           int
+		streams, coupled int
+		mapping          []byte
+	}{
+		{LayoutMono, 0, 1, 0, []byte{0}},
+		{LayoutStereo, 0, 1, 1, []byte{0, 1}},
+		{LayoutLinearSurround, 1, 2, 1, []byte{0, 2, 1}},
+		{LayoutQuad, 1, 2, 2, []byte{0, 1, 2, 3}},
+		{Layout50, 1, 3, 2, []byte{0, 4, 1, 2, 3}},
+		{Layout51, 1, 4, 2, surround51Mapping},
+		{Layout61, 1, 4, 3, []byte{0, 4, 1, 2, 3, 5, 6}},
+		{Layout71, 1, 5, 3, []byte{0, 6, 1, 2, 3, 4, 5, 7}},
+		{ChannelLayout{FrontRight, FrontLeft, PositionUnknown}, 255, 3, 0, []byte{0, 1, 2}},
+	} {
+		if family := c.layout.MappingFamily(); family != c.family {
+			t.Errorf("Unexpected mapping family for %v: %d", c.layout, family)
+		}
+		streams, coupled, mapping, err := c.layout.MappingTable()
+		if err != nil {
+			t.Fatalf("Couldn't get mapping table for %v: %v", c.layout, err)
+		}
+		if streams != c.streams || coupled != c.coupled || !bytes.Equal(mapping, c.mapping) {
+			t.Errorf("Unexpected mapping table for %v: %d streams, %d coupled, mapping %v",
+				c.layout, streams, coupled, mapping)
+		}
+		if c.family == 255 {
+			continue
+		}
+		layout, err := LayoutForMappingFamily(c.family, len(c.layout))
+		if err != nil || !layout.Equal(c.layout) {
+			t.Errorf("Unexpected layout for family %d, %d channels: %v (%v)",
+				c.family, len(c.layout), layout, err)
+		}
+	}
+	if _, err := LayoutForMappingFamily(0, 3); !errors.Is(err, ErrInvalidChannels) {
+		t.Errorf("Expected ErrInvalidChannels, got %v", err)
+	}
+	if _, err := VorbisLayout(9); !errors.Is(err, ErrInvalidChannels) {
+		t.Errorf("Expected ErrInvalidChannels, got %v", err)
+	}
+	if s := LowFrequency.String(); s != "LFE" {
+		t.Errorf("Unexpected name for LowFrequency: %q", s)
+	}
+}
+
+func TestDownmix(t *testing.T) {
+	m, err := Downmix(Layout51, LayoutStereo)
+	if err != nil {
+		t.Fatalf("Couldn't create downmix matrix: %v", err)
+	}
+	if m.In != 6 || m.Out != 2 {
+		t.Fatalf("Unexpected matrix size: %dx%d", m.Out, m.In)
+	}
+	// Left only takes from the left and center channels, never from LFE
+	for i, p := range Layout51 {
+		left, right := m.Coeffs[i], m.Coeffs[m.In+i]
+		switch p {
+		case FrontLeft, RearLeft:
+			if left <= 0 || right != 0 {
+				t.Errorf("Unexpected weights for %v: %f, %f", p, left, right)
+			}
+		case FrontRight, RearRight:
+			if left != 0 || right <= 0 {
+				t.Errorf("Unexpected weights for %v: %f, %f", p, left, right)
+			}
+		case FrontCenter:
+			if left <= 0 || left != right {
+				t.Errorf("Unexpected weights for %v: %f, %f", p, left, right)
+			}
+		case LowFrequency:
+			if left != 0 || right != 0 {
+				t.Errorf("Unexpected weights for %v: %f, %f", p, left, right)
+			}
+		}
+	}
+	// Full scale on every channel must not clip
+	src := []int16{math.MaxInt16, math.MaxInt16, math.MaxInt16, math.MaxInt16, math.MaxInt16, math.MaxInt16}
+	dst := make([]int16, 2)
+	if n, err := m.ApplyInt16(dst, src); err != nil || n != 1 {
+		t.Fatalf("Couldn't apply matrix: %d, %v", n, err)
+	}
+	if dst[0] < math.MaxInt16-1 || dst[1] < math.MaxInt16-1 {
+		t.Errorf("Unexpected downmix of full scale input: %v", dst)
+	}
+
+	mono, err := Downmix(LayoutStereo, LayoutMono)
+	if err != nil {
+		t.Fatalf("Couldn't create downmix matrix: %v", err)
+	}
+	out := make([]float32, 2)
+	if n, err := mono.ApplyFloat32(out, []float32{1, 0, 0.25, 0.75}); err != nil || n != 2 {
+		t.Fatalf("Couldn't apply matrix: %d, %v", n, err)
+	}
+	if out[0] != 0.5 || out[1] != 0.5 {
+		t.Errorf("Unexpected mono downmix: %v", out)
+	}
+	if _, err := mono.ApplyFloat32(out, []float32{1, 0, 1}); err != ErrBufferChannels {
+		t.Errorf("Expected ErrBufferChannels, got %v", err)
+	}
+	if _, err := mono.ApplyFloat32(out[:1], []float32{1, 0, 1, 0}); err != ErrBufferTooSmall {
+		t.Errorf("Expected ErrBufferTooSmall, got %v", err)
+	}
+	if _, err := Downmix(Layout51, Layout51); !errors.Is(err, ErrBadArg) {
+		t.Errorf("Expected ErrBadArg, got %v", err)
+	}
+}
+
+func TestMatrix(t *testing.T) {
+	// Swap left and right, and clip the boosted sum
+	m, err := NewMatrix(2, 3, []float32{0, 1, 1, 0, 2, 2})
+	if err != nil {
+		t.Fatalf("Couldn't create matrix: %v", err)
+	}
+	dst := make([]int16, 6)
+	if _, err := m.ApplyInt16(dst, []int16{100, -200, 30000, 20000}); err != nil {
+		t.Fatalf("Couldn't apply matrix: %v", err)
+	}
+	expected := []int16{-200, 100, -200, 20000, 30000, math.MaxInt16}
+	for i := range expected {
+		if dst[i] != expected[i] {
+			t.Errorf("Unexpected remix: %v, expected %v", dst, expected)
+			break
+		}
+	}
+	if _, err := NewMatrix(2, 2, []float32{1, 0, 0}); !errors.Is(err, ErrBadArg) {
+		t.Errorf("Expected ErrBadArg, got %v", err)
+	}
+}
+
+func TestExtractChannel(t *testing.T) {
+	pcm := []int16{1, 2, 3, 4, 5, 6}
+	ch, err := ExtractChannel(pcm, 3, 1)
+	if err != nil || len(ch) != 2 || ch[0] != 2 || ch[1] != 5 {
+		t.Errorf("Unexpected channel: %v (%v)", ch, err)
+	}
+	chFloat, err := ExtractChannelFloat32([]float32{1, 2, 3, 4}, 2, 1)
+	if err != nil || len(chFloat) != 2 || chFloat[0] != 2 || chFloat[1] != 4 {
+		t.Errorf("Unexpected channel: %v (%v)", chFloat, err)
+	}
+	if _, err := ExtractChannel(pcm, 3, 3); !errors.Is(err, ErrBadArg) {
+		t.Errorf("Expected ErrBadArg, got %v", err)
+	}
+	if _, err := ExtractChannel(pcm, 4, 0); err != ErrBufferChannels {
+		t.Errorf("Expected ErrBufferChannels, got %v", err)
+	}
+}
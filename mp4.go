@@ -0,0 +1,866 @@
+// Copyright © Go Opus Authors (see AUTHORS file)
+//
+// License for use of this code is detailed in the LICENSE file
+
+package opus
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// Media timescale of Opus tracks: samples at 48 kHz, as required by
+// "Encapsulation of Opus in ISO Base Media File Format".
+const mp4Timescale = 48000
+
+// Pre-roll recommended for Opus, in samples at 48 kHz (80 ms).
+const mp4PreRoll = 3840
+
+// Largest box read into memory, e.g. moov. Larger boxes can only be skipped.
+const mp4MaxBoxSize = 64 << 20
+
+// Most samples in a track read by MP4Reader.
+const mp4MaxSamples = 1 << 24
+
+// MP4Packet is an Opus packet read from an MP4 file.
+type MP4Packet struct {
+	Data []byte
+	// Decoding time of the packet in the media. The decoded audio of the track
+	// starts with Head.PreSkip priming samples, which the edit list removes
+	// from the presentation.
+	Timestamp time.Duration
+	Duration  time.Duration
+}
+
+type mp4Sample struct {
+	offset   int64
+	size     uint32
+	time     int64
+	duration uint32
+}
+
+// MP4Reader reads Opus packets from the first Opus track of an MP4 (ISO base
+// media) file, such as .mp4 or .m4a. The packets can be decoded by a Decoder
+// or by NewDecoderFromHead(48000, r.Head()). Fragmented files are not
+// supported.
+type MP4Reader struct {
+	r            io.ReadSeeker
+	head         *Head
+	timescale    uint32
+	samples      []mp4Sample
+	next         int
+	rollDistance int
+	duration     time.Duration
+}
+
+// NewMP4Reader reads the movie header of an MP4 file and selects the first
+// Opus track. Returns ErrNoOpusTrack if there is none.
+func NewMP4Reader(r io.ReadSeeker) (*MP4Reader, error) {
+	if r == nil {
+		return nil, ErrNilReader
+	}
+	for {
+		typ, size, err := readBoxHeader(r)
+		if err == io.EOF {
+			return nil, fmt.Errorf("%w: no movie box", ErrNoOpusTrack)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if typ != "moov" {
+			if size < 0 {
+				return nil, fmt.Errorf("%w: no movie box", ErrNoOpusTrack)
+			}
+			if _, err := r.Seek(size, io.SeekCurrent); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if size < 0 || size > mp4MaxBoxSize {
+			return nil, fmt.Errorf("%w: movie box of %d bytes", ErrInvalidContainer, size)
+		}
+		moov := make([]byte, size)
+		if _, err := io.ReadFull(r, moov); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		mr := &MP4Reader{r: r}
+		if err := mr.parseMovie(moov); err != nil {
+			return nil, err
+		}
+		return mr, nil
+	}
+}
+
+// readBoxHeader reads the type and payload size of the next top level box. A
+// size of -1 means the box extends to the end of the file.
+func readBoxHeader(r io.Reader) (string, int64, error) {
+	var header [16]byte
+	if _, err := io.ReadFull(r, header[:8]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return "", 0, fmt.Errorf("%w: truncated box", ErrInvalidContainer)
+		}
+		return "", 0, err
+	}
+	typ := string(header[4:8])
+	switch size := int64(binary.BigEndian.Uint32(header[:4])); size {
+	case 0:
+		return typ, -1, nil
+	case 1:
+		if _, err := io.ReadFull(r, header[8:16]); err != nil {
+			return "", 0, fmt.Errorf("%w: truncated box", ErrInvalidContainer)
+		}
+		size := binary.BigEndian.Uint64(header[8:16])
+		if size < 16 || size > math.MaxInt64 {
+			return "", 0, fmt.Errorf("%w: box %q of %d bytes", ErrInvalidContainer, typ, size)
+		}
+		return typ, int64(size) - 16, nil
+	default:
+		if size < 8 {
+			return "", 0, fmt.Errorf("%w: box %q of %d bytes", ErrInvalidContainer, typ, size)
+		}
+		return typ, size - 8, nil
+	}
+}
+
+// parseBoxes calls fn for every child box in the payload of a box that is
+// already in memory.
+func parseBoxes(data []byte, fn func(typ string, payload []byte) error) error {
+	for len(data) > 0 {
+		if len(data) < 8 {
+			return fmt.Errorf("%w: truncated box", ErrInvalidContainer)
+		}
+		typ := string(data[4:8])
+		size := uint64(binary.BigEndian.Uint32(data))
+		header := uint64(8)
+		switch size {
+		case 0:
+			size = uint64(len(data))
+		case 1:
+			if len(data) < 16 {
+				return fmt.Errorf("%w: truncated box", ErrInvalidContainer)
+			}
+			size = binary.BigEndian.Uint64(data[8:])
+			header = 16
+		}
+		if size < header || size > uint64(len(data)) {
+			return fmt.Errorf("%w: box %q overflows its parent", ErrInvalidContainer, typ)
+		}
+		if err := fn(typ, data[header:size]); err != nil {
+			return err
+		}
+		data = data[size:]
+	}
+	return nil
+}
+
+// fullBox splits the version and flags off the payload of a full box.
+func fullBox(payload []byte) (byte, []byte, error) {
+	if len(payload) < 4 {
+		return 0, nil, fmt.Errorf("%w: truncated full box", ErrInvalidContainer)
+	}
+	return payload[0], payload[4:], nil
+}
+
+func (mr *MP4Reader) parseMovie(moov []byte) error {
+	movieTimescale := uint32(0)
+	err := parseBoxes(moov, func(typ string, payload []byte) error {
+		switch typ {
+		case "mvhd":
+			version, body, err := fullBox(payload)
+			if err != nil {
+				return err
+			}
+			// Creation and modification time are 32 or 64 bits
+			if off := 8 + 8*int(version); len(body) >= off+4 {
+				movieTimescale = binary.BigEndian.Uint32(body[off:])
+			}
+		case "trak":
+			if mr.head != nil {
+				return nil
+			}
+			return mr.parseTrack(payload, movieTimescale)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if mr.head == nil {
+		return ErrNoOpusTrack
+	}
+	return nil
+}
+
+// parseTrack selects the track if it is an Opus track, and reads its sample
+// table. Other tracks are ignored.
+func (mr *MP4Reader) parseTrack(trak []byte, movieTimescale uint32) error {
+	var mdia, elst []byte
+	err := parseBoxes(trak, func(typ string, payload []byte) error {
+		switch typ {
+		case "mdia":
+			mdia = payload
+		case "edts":
+			return parseBoxes(payload, func(typ string, payload []byte) error {
+				if typ == "elst" {
+					elst = payload
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	if err != nil || mdia == nil {
+		return err
+	}
+	var handler string
+	var timescale uint32
+	var mediaDuration uint64
+	var stbl []byte
+	err = parseBoxes(mdia, func(typ string, payload []byte) error {
+		switch typ {
+		case "hdlr":
+			_, body, err := fullBox(payload)
+			if err != nil {
+				return err
+			}
+			if len(body) >= 8 {
+				handler = string(body[4:8])
+			}
+		case "mdhd":
+			version, body, err := fullBox(payload)
+			if err != nil {
+				return err
+			}
+			if version == 1 && len(body) >= 28 {
+				timescale = binary.BigEndian.Uint32(body[16:])
+				mediaDuration = binary.BigEndian.Uint64(body[20:])
+			} else if len(body) >= 16 {
+				timescale = binary.BigEndian.Uint32(body[8:])
+				mediaDuration = uint64(binary.BigEndian.Uint32(body[12:]))
+			}
+		case "minf":
+			return parseBoxes(payload, func(typ string, payload []byte) error {
+				if typ == "stbl" {
+					stbl = payload
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	if err != nil || handler != "soun" || stbl == nil {
+		return err
+	}
+	if timescale == 0 {
+		return fmt.Errorf("%w: media timescale 0", ErrInvalidContainer)
+	}
+	boxes := map[string][]byte{}
+	err = parseBoxes(stbl, func(typ string, payload []byte) error {
+		if _, ok := boxes[typ]; !ok {
+			boxes[typ] = payload
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	head, err := parseOpusSampleEntry(boxes["stsd"])
+	if err != nil || head == nil {
+		return err
+	}
+	if err := mr.parseSampleTable(boxes); err != nil {
+		return err
+	}
+	mr.head = head
+	mr.timescale = timescale
+	mr.rollDistance = parseRollDistance(boxes["sgpd"])
+
+	// Playable duration from the first edit that isn't empty, otherwise the
+	// whole media minus the priming samples
+	mr.duration = mr.toDuration(int64(mediaDuration)) - time.Duration(head.PreSkip)*time.Second/48000
+	if version, body, err := fullBox(elst); err == nil && movieTimescale != 0 && len(body) >= 4 {
+		count := int(binary.BigEndian.Uint32(body))
+		entrySize := 12 + 8*int(version)
+		for i := 0; i < count && len(body) >= 4+(i+1)*entrySize; i++ {
+			entry := body[4+i*entrySize:]
+			var segmentDuration uint64
+			var mediaTime int64
+			if version == 1 {
+				segmentDuration = binary.BigEndian.Uint64(entry)
+				mediaTime = int64(binary.BigEndian.Uint64(entry[8:]))
+			} else {
+				segmentDuration = uint64(binary.BigEndian.Uint32(entry))
+				mediaTime = int64(int32(binary.BigEndian.Uint32(entry[4:])))
+			}
+			if mediaTime >= 0 {
+				mr.duration = time.Duration(segmentDuration) * time.Second / time.Duration(movieTimescale)
+				break
+			}
+		}
+	}
+	if mr.duration < 0 {
+		mr.duration = 0
+	}
+	return nil
+}
+
+// parseOpusSampleEntry returns the header in the dOps box of the first sample
+// entry, or nil if it isn't an Opus sample entry.
+func parseOpusSampleEntry(stsd []byte) (*Head, error) {
+	_, body, err := fullBox(stsd)
+	if err != nil {
+		return nil, err
+	}
+	if len(body) < 4 {
+		return nil, fmt.Errorf("%w: truncated sample description", ErrInvalidContainer)
+	}
+	var head *Head
+	err = parseBoxes(body[4:], func(typ string, payload []byte) error {
+		if head != nil || typ != "Opus" {
+			return nil
+		}
+		// Fields of the audio sample entry, followed by its child boxes
+		if len(payload) < 28 {
+			return fmt.Errorf("%w: truncated Opus sample entry", ErrInvalidContainer)
+		}
+		head = &Head{}
+		return parseBoxes(payload[28:], func(typ string, payload []byte) error {
+			if typ != "dOps" {
+				return nil
+			}
+			return head.unmarshalDOps(payload)
+		})
+	})
+	if err != nil || head == nil {
+		return nil, err
+	}
+	if head.Channels == 0 {
+		return nil, fmt.Errorf("%w: Opus sample entry without dOps box", ErrInvalidContainer)
+	}
+	return head, nil
+}
+
+// unmarshalDOps reads an Opus specific box. It has the fields of an ID header
+// in big endian, without the magic signature.
+func (h *Head) unmarshalDOps(data []byte) error {
+	if len(data) < 11 {
+		return fmt.Errorf("%w: dOps box of %d bytes", ErrInvalidHeader, len(data))
+	}
+	if data[0] != 0 {
+		return fmt.Errorf("%w: unsupported dOps version %d", ErrInvalidHeader, data[0])
+	}
+	*h = Head{
+		Version:         1,
+		Channels:        int(data[1]),
+		PreSkip:         int(binary.BigEndian.Uint16(data[2:])),
+		InputSampleRate: int(binary.BigEndian.Uint32(data[4:])),
+		OutputGain:      int(int16(binary.BigEndian.Uint16(data[8:]))),
+		MappingFamily:   int(data[10]),
+	}
+	if h.MappingFamily != 0 {
+		if len(data) < 13+h.Channels {
+			return fmt.Errorf("%w: truncated channel mapping", ErrInvalidHeader)
+		}
+		h.Streams = int(data[11])
+		h.CoupledStreams = int(data[12])
+		h.Mapping = append([]byte(nil), data[13:13+h.Channels]...)
+	}
+	return h.Validate()
+}
+
+// appendDOps appends the payload of an Opus specific box.
+func (h *Head) appendDOps(b []byte) []byte {
+	b = append(b, 0, byte(h.Channels))
+	b = appendUint16BE(b, uint16(h.PreSkip))
+	b = appendUint32BE(b, uint32(h.InputSampleRate))
+	b = appendUint16BE(b, uint16(int16(h.OutputGain)))
+	b = append(b, byte(h.MappingFamily))
+	if h.MappingFamily != 0 {
+		b = append(b, byte(h.Streams), byte(h.CoupledStreams))
+		b = append(b, h.Mapping...)
+	}
+	return b
+}
+
+// parseSampleTable computes the position, size and time of every sample.
+func (mr *MP4Reader) parseSampleTable(boxes map[string][]byte) error {
+	truncated := fmt.Errorf("%w: truncated sample table", ErrInvalidContainer)
+
+	// The durations come first: their total bounds the number of samples
+	// before any allocation
+	_, stts, err := fullBox(boxes["stts"])
+	if err != nil || len(stts) < 4 {
+		return truncated
+	}
+	entries := int64(binary.BigEndian.Uint32(stts))
+	if int64(len(stts)-4) < 8*entries {
+		return truncated
+	}
+	total := int64(0)
+	for e := 0; e < int(entries); e++ {
+		total += int64(binary.BigEndian.Uint32(stts[4+8*e:]))
+	}
+
+	_, stsz, err := fullBox(boxes["stsz"])
+	if err != nil || len(stsz) < 8 {
+		return truncated
+	}
+	fixedSize := binary.BigEndian.Uint32(stsz)
+	count := int64(binary.BigEndian.Uint32(stsz[4:]))
+	if count != total {
+		return fmt.Errorf("%w: %d sample durations for %d samples", ErrInvalidContainer, total, count)
+	}
+	if count > mp4MaxSamples || (fixedSize == 0 && int64(len(stsz)-8) < 4*count) {
+		return truncated
+	}
+	if fixedSize != 0 {
+		// Without a size table, only the file size limits the sample count
+		size, err := mr.r.Seek(0, io.SeekEnd)
+		if err != nil {
+			return err
+		}
+		if count*int64(fixedSize) > size {
+			return fmt.Errorf("%w: %d samples of %d bytes", ErrInvalidContainer, count, fixedSize)
+		}
+	}
+	samples := make([]mp4Sample, count)
+	for i := range samples {
+		samples[i].size = fixedSize
+		if fixedSize == 0 {
+			samples[i].size = binary.BigEndian.Uint32(stsz[8+4*i:])
+		}
+	}
+	i := 0
+	t := int64(0)
+	for e := 0; e < int(entries); e++ {
+		n := binary.BigEndian.Uint32(stts[4+8*e:])
+		delta := binary.BigEndian.Uint32(stts[8+8*e:])
+		for ; n > 0; n-- {
+			samples[i].time = t
+			samples[i].duration = delta
+			t += int64(delta)
+			i++
+		}
+	}
+
+	var offsets []int64
+	if _, stco, err := fullBox(boxes["stco"]); err == nil && len(stco) >= 4 {
+		n := int64(binary.BigEndian.Uint32(stco))
+		if int64(len(stco)-4) < 4*n {
+			return truncated
+		}
+		for c := 0; c < int(n); c++ {
+			offsets = append(offsets, int64(binary.BigEndian.Uint32(stco[4+4*c:])))
+		}
+	} else if _, co64, err := fullBox(boxes["co64"]); err == nil && len(co64) >= 4 {
+		n := int64(binary.BigEndian.Uint32(co64))
+		if int64(len(co64)-4) < 8*n {
+			return truncated
+		}
+		for c := 0; c < int(n); c++ {
+			offsets = append(offsets, int64(binary.BigEndian.Uint64(co64[4+8*c:])))
+		}
+	}
+
+	_, stsc, err := fullBox(boxes["stsc"])
+	if err != nil || len(stsc) < 4 {
+		return truncated
+	}
+	entries = int64(binary.BigEndian.Uint32(stsc))
+	if int64(len(stsc)-4) < 12*entries {
+		return truncated
+	}
+	i = 0
+	for e := 0; e < int(entries) && i < len(samples); e++ {
+		firstChunk := int64(binary.BigEndian.Uint32(stsc[4+12*e:]))
+		perChunk := binary.BigEndian.Uint32(stsc[8+12*e:])
+		lastChunk := int64(len(offsets))
+		if e+1 < int(entries) {
+			lastChunk = int64(binary.BigEndian.Uint32(stsc[16+12*e:])) - 1
+		}
+		if firstChunk < 1 || lastChunk > int64(len(offsets)) {
+			return fmt.Errorf("%w: invalid sample to chunk table", ErrInvalidContainer)
+		}
+		for c := firstChunk; c <= lastChunk && i < len(samples); c++ {
+			offset := offsets[c-1]
+			for n := uint32(0); n < perChunk && i < len(samples); n++ {
+				samples[i].offset = offset
+				offset += int64(samples[i].size)
+				i++
+			}
+		}
+	}
+	if i != len(samples) {
+		return fmt.Errorf("%w: %d sample offsets for %d samples", ErrInvalidContainer, i, len(samples))
+	}
+	mr.samples = samples
+	return nil
+}
+
+// parseRollDistance returns the roll distance of the first roll group in a
+// sample group description, or 0 if there is none.
+func parseRollDistance(sgpd []byte) int {
+	version, body, err := fullBox(sgpd)
+	if err != nil || len(body) < 8 || string(body[:4]) != "roll" {
+		return 0
+	}
+	entry := body[8:]
+	if version >= 1 {
+		// Default length, or default description index from version 2, before
+		// the entry count
+		if len(body) < 12 {
+			return 0
+		}
+		entry = body[12:]
+		if version == 1 && binary.BigEndian.Uint32(body[4:]) == 0 {
+			// Each entry starts with its length
+			if len(entry) < 4 {
+				return 0
+			}
+			entry = entry[4:]
+		}
+	}
+	if len(entry) < 2 {
+		return 0
+	}
+	return int(int16(binary.BigEndian.Uint16(entry)))
+}
+
+func (mr *MP4Reader) toDuration(t int64) time.Duration {
+	return time.Duration(t) * time.Second / time.Duration(mr.timescale)
+}
+
+// Head returns the Opus header of the track, from its dOps box.
+func (mr *MP4Reader) Head() *Head {
+	return mr.head
+}
+
+// Duration returns the playable duration of the track from its edit list,
+// i.e. without the priming samples and trailing padding.
+func (mr *MP4Reader) Duration() time.Duration {
+	return mr.duration
+}
+
+// RollDistance returns the number of packets to decode before the audio is
+// correct after a seek, as a negative number, or 0 if the file doesn't say.
+func (mr *MP4Reader) RollDistance() int {
+	return mr.rollDistance
+}
+
+// ReadPacket returns the next packet of the Opus track, or io.EOF at the end
+// of the track.
+func (mr *MP4Reader) ReadPacket() (*MP4Packet, error) {
+	if mr.next >= len(mr.samples) {
+		return nil, io.EOF
+	}
+	s := mr.samples[mr.next]
+	if s.size > mp4MaxBoxSize {
+		return nil, fmt.Errorf("%w: packet of %d bytes", ErrInvalidContainer, s.size)
+	}
+	if _, err := mr.r.Seek(s.offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	data := make([]byte, s.size)
+	if _, err := io.ReadFull(mr.r, data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	mr.next++
+	return &MP4Packet{
+		Data:      data,
+		Timestamp: mr.toDuration(s.time),
+		Duration:  mr.toDuration(int64(s.duration)),
+	}, nil
+}
+
+// MP4Writer writes Opus packets to an MP4 file with a single audio track. The
+// packets are written as they come, and the movie header with the sample
+// table follows on Close.
+type MP4Writer struct {
+	w    io.WriteSeeker
+	head *Head
+	// Offset of the mdat box, whose size is patched on Close
+	mdatPos   int64
+	dataSize  int64
+	sizes     []uint32
+	durations []uint32
+	samples   int64
+	closed    bool
+}
+
+// NewMP4Writer starts an MP4 file on w for an Opus track described by head,
+// e.g. from Encoder.Head. Its pre-skip is removed from the presentation by an
+// edit list. Mapping family 3 can't be stored in MP4.
+func NewMP4Writer(w io.WriteSeeker, head *Head) (*MP4Writer, error) {
+	if err := head.Validate(); err != nil {
+		return nil, err
+	}
+	if head.MappingFamily == 3 {
+		return nil, fmt.Errorf("%w: mapping family 3 in MP4", ErrUnimplemented)
+	}
+	pos, err := w.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	var ftyp []byte
+	ftyp = append(ftyp, "isom"...)
+	ftyp = appendUint32BE(ftyp, 0x200)
+	ftyp = append(ftyp, "isomiso2mp41"...)
+	b := appendBox(nil, "ftyp", ftyp)
+	// 64-bit size, patched on Close
+	b = appendUint32BE(b, 1)
+	b = append(b, "mdat"...)
+	b = append(b, make([]byte, 8)...)
+	if _, err := w.Write(b); err != nil {
+		return nil, err
+	}
+	return &MP4Writer{w: w, head: head, mdatPos: pos + int64(len(b)) - 16}, nil
+}
+
+func appendUint16BE(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
+
+func appendUint32BE(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func appendUint64BE(b []byte, v uint64) []byte {
+	return appendUint32BE(appendUint32BE(b, uint32(v>>32)), uint32(v))
+}
+
+func appendBox(b []byte, typ string, payload []byte) []byte {
+	b = appendUint32BE(b, uint32(8+len(payload)))
+	b = append(b, typ...)
+	return append(b, payload...)
+}
+
+func appendFullBox(b []byte, typ string, version byte, flags uint32, payload []byte) []byte {
+	b = appendUint32BE(b, uint32(12+len(payload)))
+	b = append(b, typ...)
+	b = appendUint32BE(b, uint32(version)<<24|flags)
+	return append(b, payload...)
+}
+
+// WritePacket adds an encoded Opus packet to the track. samples is the
+// duration of the packet in samples per channel at 48 kHz, regardless of the
+// sample rate of the encoder; e.g. 960 for a 20 ms packet.
+func (mw *MP4Writer) WritePacket(data []byte, samples int) error {
+	if mw.closed {
+		return ErrStreamClosed
+	}
+	if len(data) == 0 {
+		return ErrNoData
+	}
+	if samples <= 0 {
+		return fmt.Errorf("%w: packet of %d samples", ErrBadArg, samples)
+	}
+	if mw.samples+int64(samples) > math.MaxUint32 {
+		return fmt.Errorf("%w: track longer than %d samples", ErrBadArg, uint32(math.MaxUint32))
+	}
+	if _, err := mw.w.Write(data); err != nil {
+		return err
+	}
+	mw.dataSize += int64(len(data))
+	mw.sizes = append(mw.sizes, uint32(len(data)))
+	mw.durations = append(mw.durations, uint32(samples))
+	mw.samples += int64(samples)
+	return nil
+}
+
+// Close writes the movie header after the packets. It does not close the
+// underlying writer.
+func (mw *MP4Writer) Close() error {
+	if mw.closed {
+		return ErrStreamClosed
+	}
+	mw.closed = true
+	end, err := mw.w.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := mw.w.Seek(mw.mdatPos+8, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := mw.w.Write(appendUint64BE(nil, uint64(16+mw.dataSize))); err != nil {
+		return err
+	}
+	if _, err := mw.w.Seek(end, io.SeekStart); err != nil {
+		return err
+	}
+	_, err = mw.w.Write(mw.movie())
+	return err
+}
+
+// Unity transformation matrix of movie and track headers
+var mp4Matrix = []uint32{0x10000, 0, 0, 0, 0x10000, 0, 0, 0, 0x40000000}
+
+// movie builds the moov box. Movie and media both use the 48 kHz timescale.
+func (mw *MP4Writer) movie() []byte {
+	duration := uint32(mw.samples)
+	presented := uint32(0)
+	if mw.samples > int64(mw.head.PreSkip) {
+		presented = uint32(mw.samples - int64(mw.head.PreSkip))
+	}
+
+	var mvhd []byte
+	mvhd = appendUint64BE(mvhd, 0) // creation and modification time
+	mvhd = appendUint32BE(mvhd, mp4Timescale)
+	mvhd = appendUint32BE(mvhd, presented)
+	mvhd = appendUint32BE(mvhd, 0x10000) // rate 1.0
+	mvhd = appendUint16BE(mvhd, 0x100)   // volume 1.0
+	mvhd = append(mvhd, make([]byte, 10)...)
+	for _, m := range mp4Matrix {
+		mvhd = appendUint32BE(mvhd, m)
+	}
+	mvhd = append(mvhd, make([]byte, 24)...)
+	mvhd = appendUint32BE(mvhd, 2) // next track ID
+
+	var tkhd []byte
+	tkhd = appendUint64BE(tkhd, 0)
+	tkhd = appendUint32BE(tkhd, 1) // track ID
+	tkhd = appendUint32BE(tkhd, 0)
+	tkhd = appendUint32BE(tkhd, presented)
+	tkhd = append(tkhd, make([]byte, 12)...) // reserved, layer, alternate group
+	tkhd = appendUint16BE(tkhd, 0x100)
+	tkhd = appendUint16BE(tkhd, 0)
+	for _, m := range mp4Matrix {
+		tkhd = appendUint32BE(tkhd, m)
+	}
+	tkhd = appendUint64BE(tkhd, 0) // width and height
+
+	// A single edit skips the priming samples
+	var elst []byte
+	elst = appendUint32BE(elst, 1)
+	elst = appendUint32BE(elst, presented)
+	elst = appendUint32BE(elst, uint32(mw.head.PreSkip))
+	elst = appendUint32BE(elst, 0x10000) // rate 1.0
+	edts := appendFullBox(nil, "elst", 0, 0, elst)
+
+	var mdhd []byte
+	mdhd = appendUint64BE(mdhd, 0)
+	mdhd = appendUint32BE(mdhd, mp4Timescale)
+	mdhd = appendUint32BE(mdhd, duration)
+	mdhd = appendUint16BE(mdhd, 0x55c4) // language "und"
+	mdhd = appendUint16BE(mdhd, 0)
+
+	var hdlr []byte
+	hdlr = appendUint32BE(hdlr, 0)
+	hdlr = append(hdlr, "soun"...)
+	hdlr = append(hdlr, make([]byte, 12)...)
+	hdlr = append(hdlr, "SoundHandler\x00"...)
+
+	var entry []byte
+	entry = append(entry, make([]byte, 6)...)
+	entry = appendUint16BE(entry, 1) // data reference index
+	entry = append(entry, make([]byte, 8)...)
+	entry = appendUint16BE(entry, uint16(mw.head.Channels))
+	entry = appendUint16BE(entry, 16) // sample size
+	entry = appendUint32BE(entry, 0)
+	entry = appendUint32BE(entry, mp4Timescale<<16)
+	entry = appendBox(entry, "dOps", mw.head.appendDOps(nil))
+	stsd := appendUint32BE(nil, 1)
+	stsd = appendBox(stsd, "Opus", entry)
+
+	// Runs of packets with the same duration
+	type run struct{ count, duration uint32 }
+	var runs []run
+	for _, d := range mw.durations {
+		if len(runs) == 0 || runs[len(runs)-1].duration != d {
+			runs = append(runs, run{0, d})
+		}
+		runs[len(runs)-1].count++
+	}
+	stts := appendUint32BE(nil, uint32(len(runs)))
+	for _, r := range runs {
+		stts = appendUint32BE(appendUint32BE(stts, r.count), r.duration)
+	}
+
+	// All packets are in a single chunk right after the mdat header
+	count := uint32(len(mw.sizes))
+	dataPos := uint64(mw.mdatPos + 16)
+	var stsc, stco []byte
+	switch {
+	case count == 0:
+		stsc = appendUint32BE(nil, 0)
+		stco = appendFullBox(nil, "stco", 0, 0, appendUint32BE(nil, 0))
+	case dataPos > math.MaxUint32:
+		stco = appendFullBox(nil, "co64", 0, 0, appendUint64BE(appendUint32BE(nil, 1), dataPos))
+	default:
+		stco = appendFullBox(nil, "stco", 0, 0, appendUint32BE(appendUint32BE(nil, 1), uint32(dataPos)))
+	}
+	if count > 0 {
+		stsc = appendUint32BE(nil, 1)
+		stsc = appendUint32BE(stsc, 1) // first chunk
+		stsc = appendUint32BE(stsc, count)
+		stsc = appendUint32BE(stsc, 1) // sample description index
+	}
+
+	stsz := appendUint32BE(appendUint32BE(nil, 0), count)
+	for _, s := range mw.sizes {
+		stsz = appendUint32BE(stsz, s)
+	}
+
+	var stbl []byte
+	stbl = appendFullBox(stbl, "stsd", 0, 0, stsd)
+	stbl = appendFullBox(stbl, "stts", 0, 0, stts)
+	stbl = appendFullBox(stbl, "stsc", 0, 0, stsc)
+	stbl = appendFullBox(stbl, "stsz", 0, 0, stsz)
+	stbl = append(stbl, stco...)
+	if count > 0 {
+		// Every packet needs the pre-roll of the packets before it, given
+		// as a number of packets of the shortest duration
+		shortest := mw.durations[0]
+		for _, d := range mw.durations {
+			if d < shortest {
+				shortest = d
+			}
+		}
+		roll := -int16((mp4PreRoll + shortest - 1) / shortest)
+		var sgpd []byte
+		sgpd = append(sgpd, "roll"...)
+		sgpd = appendUint32BE(sgpd, 2) // default length
+		sgpd = appendUint32BE(sgpd, 1)
+		sgpd = appendUint16BE(sgpd, uint16(roll))
+		stbl = appendFullBox(stbl, "sgpd", 1, 0, sgpd)
+		var sbgp []byte
+		sbgp = append(sbgp, "roll"...)
+		sbgp = appendUint32BE(sbgp, 1)
+		sbgp = appendUint32BE(sbgp, count)
+		sbgp = appendUint32BE(sbgp, 1)
+		stbl = appendFullBox(stbl, "sbgp", 0, 0, sbgp)
+	}
+
+	var dinf []byte
+	dref := appendUint32BE(nil, 1)
+	dref = appendFullBox(dref, "url ", 0, 1, nil) // media in the same file
+	dinf = appendFullBox(dinf, "dref", 0, 0, dref)
+
+	var minf []byte
+	minf = appendFullBox(minf, "smhd", 0, 0, make([]byte, 4))
+	minf = appendBox(minf, "dinf", dinf)
+	minf = appendBox(minf, "stbl", stbl)
+
+	var mdia []byte
+	mdia = appendFullBox(mdia, "mdhd", 0, 0, mdhd)
+	mdia = appendFullBox(mdia, "hdlr", 0, 0, hdlr)
+	mdia = appendBox(mdia, "minf", minf)
+
+	var trak []byte
+	trak = appendFullBox(trak, "tkhd", 0, 3, tkhd) // enabled, in movie
+	trak = appendBox(trak, "edts", edts)
+	trak = appendBox(trak, "mdia", mdia)
+
+	var moov []byte
+	moov = appendFullBox(moov, "mvhd", 0, 0, mvhd)
+	moov = appendBox(moov, "trak", trak)
+	return appendBox(nil, "moov", moov)
+}
@@ -0,0 +1,190 @@
+// Copyright © Go Opus Authors (see AUTHORS file)
+//
+// License for use of this code is detailed in the LICENSE file
+
+package opus
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMP4WriterReader(t *testing.T) {
+	head := &Head{
+		Version:         1,
+		Channels:        2,
+		PreSkip:         312,
+		InputSampleRate: 44100,
+		OutputGain:      -256,
+		MappingFamily:   1,
+		Streams:         1,
+		CoupledStreams:  1,
+		Mapping:         []byte{0, 1},
+	}
+	var buf seekBuffer
+	mw, err := NewMP4Writer(&buf, head)
+	if err != nil {
+		t.Fatalf("Couldn't create MP4 writer: %v", err)
+	}
+	var written [][]byte
+	durations := []int{960, 960, 960, 960, 960, 480, 480, 960}
+	for i, d := range durations {
+		p := testOpusFrame(20+i, byte(i))
+		if err := mw.WritePacket(p, d); err != nil {
+			t.Fatalf("Couldn't write packet %d: %v", i, err)
+		}
+		written = append(written, p)
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatalf("Couldn't close MP4 writer: %v", err)
+	}
+	if err := mw.WritePacket(written[0], 960); err != ErrStreamClosed {
+		t.Errorf("Expected ErrStreamClosed after Close, got %v", err)
+	}
+
+	r, err := NewMP4Reader(bytes.NewReader(buf.data))
+	if err != nil {
+		t.Fatalf("Couldn't read MP4 file: %v", err)
+	}
+	if !reflect.DeepEqual(r.Head(), head) {
+		t.Errorf("Header changed in round trip: %+v", r.Head())
+	}
+	if expected := (6*960 + 2*480 - 312) * time.Second / 48000; r.Duration() != expected {
+		t.Errorf("Unexpected duration: %v, expected %v", r.Duration(), expected)
+	}
+	// 80 ms in packets of 10 ms
+	if r.RollDistance() != -8 {
+		t.Errorf("Unexpected roll distance: %d", r.RollDistance())
+	}
+	timestamp := time.Duration(0)
+	for i, w := range written {
+		p, err := r.ReadPacket()
+		if err != nil {
+			t.Fatalf("Couldn't read packet %d: %v", i, err)
+		}
+		duration := time.Duration(durations[i]) * time.Second / 48000
+		if !bytes.Equal(p.Data, w) || p.Timestamp != timestamp || p.Duration != duration {
+			t.Errorf("Unexpected packet %d: %d bytes at %v, %v long", i, len(p.Data), p.Timestamp, p.Duration)
+		}
+		timestamp += duration
+	}
+	if _, err := r.ReadPacket(); err != io.EOF {
+		t.Errorf("Expected EOF, got %v", err)
+	}
+}
+
+func TestMP4Errors(t *testing.T) {
+	if _, err := NewMP4Reader(bytes.NewReader(appendBox(nil, "ftyp", []byte("isom")))); !errors.Is(err, ErrNoOpusTrack) {
+		t.Errorf("Expected ErrNoOpusTrack without movie box, got %v", err)
+	}
+	var buf seekBuffer
+	mw, err := NewMP4Writer(&buf, &Head{Version: 1, Channels: 1})
+	if err != nil {
+		t.Fatalf("Couldn't create MP4 writer: %v", err)
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatalf("Couldn't close MP4 writer: %v", err)
+	}
+	r, err := NewMP4Reader(bytes.NewReader(buf.data))
+	if err != nil {
+		t.Fatalf("Couldn't read empty MP4 file: %v", err)
+	}
+	if _, err := r.ReadPacket(); err != io.EOF {
+		t.Errorf("Expected EOF, got %v", err)
+	}
+	// The movie box is cut off
+	if _, err := NewMP4Reader(bytes.NewReader(buf.data[:len(buf.data)-10])); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Expected io.ErrUnexpectedEOF, got %v", err)
+	}
+	// A fixed sample size with more samples than the file can hold
+	buf = seekBuffer{}
+	mw, err = NewMP4Writer(&buf, &Head{Version: 1, Channels: 1})
+	if err != nil {
+		t.Fatalf("Couldn't create MP4 writer: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := mw.WritePacket(testOpusFrame(20, byte(i)), 960); err != nil {
+			t.Fatalf("Couldn't write packet %d: %v", i, err)
+		}
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatalf("Couldn't close MP4 writer: %v", err)
+	}
+	stsz := bytes.Index(buf.data, []byte("stsz"))
+	stts := bytes.Index(buf.data, []byte("stts"))
+	binary.BigEndian.PutUint32(buf.data[stsz+8:], 1000)
+	binary.BigEndian.PutUint32(buf.data[stsz+12:], mp4MaxSamples)
+	if _, err := NewMP4Reader(bytes.NewReader(buf.data)); !errors.Is(err, ErrInvalidContainer) {
+		t.Errorf("Expected ErrInvalidContainer for sample count without durations, got %v", err)
+	}
+	binary.BigEndian.PutUint32(buf.data[stts+12:], mp4MaxSamples)
+	if _, err := NewMP4Reader(bytes.NewReader(buf.data)); !errors.Is(err, ErrInvalidContainer) {
+		t.Errorf("Expected ErrInvalidContainer for samples beyond the end of the file, got %v", err)
+	}
+	ambisonic := &Head{Version: 1, Channels: 4, MappingFamily: 3, Streams: 2, CoupledStreams: 2,
+		DemixingMatrix: make([]byte, 32)}
+	if _, err := NewMP4Writer(&buf, ambisonic); !errors.Is(err, ErrUnimplemented) {
+		t.Errorf("Expected ErrUnimplemented for mapping family 3, got %v", err)
+	}
+}
+
+func TestMP4Decode(t *testing.T) {
+	const FRAME_SIZE = 960
+	const FRAMES = 10
+	enc, err := NewEncoder(48000, 1, AppAudio)
+	if err != nil {
+		t.Fatalf("Error creating encoder: %v", err)
+	}
+	head, err := enc.Head()
+	if err != nil {
+		t.Fatalf("Couldn't create header: %v", err)
+	}
+	var buf seekBuffer
+	mw, err := NewMP4Writer(&buf, head)
+	if err != nil {
+		t.Fatalf("Couldn't create MP4 writer: %v", err)
+	}
+	pcm := make([]int16, FRAME_SIZE)
+	addSine(pcm, 48000, 440)
+	data := make([]byte, 1000)
+	for i := 0; i < FRAMES; i++ {
+		n, err := enc.Encode(pcm, data)
+		if err != nil {
+			t.Fatalf("Couldn't encode data: %v", err)
+		}
+		if err := mw.WritePacket(data[:n], FRAME_SIZE); err != nil {
+			t.Fatalf("Couldn't write packet: %v", err)
+		}
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatalf("Couldn't close MP4 writer: %v", err)
+	}
+
+	r, err := NewMP4Reader(bytes.NewReader(buf.data))
+	if err != nil {
+		t.Fatalf("Couldn't read MP4 file: %v", err)
+	}
+	dec, err := NewDecoderFromHead(48000, r.Head())
+	if err != nil {
+		t.Fatalf("Couldn't create decoder: %v", err)
+	}
+	out := make([]int16, FRAME_SIZE)
+	for i := 0; i < FRAMES; i++ {
+		p, err := r.ReadPacket()
+		if err != nil {
+			t.Fatalf("Couldn't read packet %d: %v", i, err)
+		}
+		n, err := dec.Decode(p.Data, out)
+		if err != nil {
+			t.Fatalf("Couldn't decode packet %d: %v", i, err)
+		}
+		if n != FRAME_SIZE {
+			t.Errorf("Expected %d samples, got %d", FRAME_SIZE, n)
+		}
+	}
+}
@@ -0,0 +1,738 @@
+// Copyright © Go Opus Authors (see AUTHORS file)
+//
+// License for use of this code is detailed in the LICENSE file
+
+package opus
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	tsPacketSize = 188
+	tsSyncByte   = 0x47
+	// PIDs of the tables and the Opus stream in streams written by TSWriter
+	tsPIDPAT   = 0x0000
+	tsPIDPMT   = 0x1000
+	tsPIDAudio = 0x0100
+	// PES private data, identified by the registration descriptor
+	tsStreamTypePrivate = 0x06
+	tsStreamIDPrivate1  = 0xbd
+	// Clock of PTS and PCR
+	tsClock = 90000
+	// Delay of the PTS after the PCR, to give decoders time to buffer
+	tsPTSDelay = tsClock / 10
+	// Interval between repetitions of PAT and PMT, in samples at 48 kHz
+	tsTableInterval = 4800
+)
+
+// Descriptors of Opus in MPEG-TS
+const (
+	tsDescriptorRegistration = 0x05
+	tsDescriptorExtension    = 0x7f
+	tsExtensionOpus          = 0x80
+	// channel_config_code for an explicit channel configuration
+	tsChannelConfigExplicit = 0x80
+)
+
+// Prefix of the opus_control_header: 11 bits set
+const (
+	tsControlPrefix    = 0x7fe0
+	tsControlStartTrim = 0x10
+	tsControlEndTrim   = 0x08
+	tsControlExtension = 0x04
+)
+
+// Largest trim in an opus_control_header, in samples at 48 kHz.
+const tsMaxTrim = 1<<13 - 1
+
+// Streams, coupled streams and mapping of channel mapping family 1, which
+// channel_config_code 3 to 8 stand for.
+var tsVorbisMappings = [9]struct {
+	streams, coupledStreams int
+	mapping                 []byte
+}{
+	3: {2, 1, []byte{0, 2, 1}},
+	4: {2, 2, []byte{0, 1, 2, 3}},
+	5: {3, 2, []byte{0, 4, 1, 2, 3}},
+	6: {4, 2, []byte{0, 4, 1, 2, 3, 5}},
+	7: {4, 3, []byte{0, 4, 1, 2, 3, 5, 6}},
+	8: {5, 3, []byte{0, 6, 1, 2, 3, 4, 5, 7}},
+}
+
+// mpegCRC computes the checksum of PSI sections: like oggCRC, but with an
+// initial value of 0xffffffff.
+func mpegCRC(data []byte) uint32 {
+	crc := uint32(0xffffffff)
+	for _, b := range data {
+		crc = crc<<8 ^ oggCRCTable[byte(crc>>24)^b]
+	}
+	return crc
+}
+
+// bitsFor returns the number of bits to store values below n, i.e.
+// ceil(log2(n)).
+func bitsFor(n int) uint {
+	bits := uint(0)
+	for 1<<bits < n {
+		bits++
+	}
+	return bits
+}
+
+// tsChannelConfig returns the payload of the Opus extension descriptor for a
+// header: the channel_config_code, followed by the explicit configuration if
+// the header doesn't match one of the predefined codes.
+func tsChannelConfig(h *Head) ([]byte, error) {
+	switch h.MappingFamily {
+	case 0:
+		return []byte{byte(h.Channels)}, nil
+	case 1:
+		if h.Channels < len(tsVorbisMappings) {
+			m := tsVorbisMappings[h.Channels]
+			if m.streams == h.Streams && m.coupledStreams == h.CoupledStreams &&
+				string(m.mapping) == string(h.Mapping) {
+				return []byte{byte(h.Channels)}, nil
+			}
+		}
+	case 3:
+		return nil, fmt.Errorf("%w: mapping family 3 in MPEG-TS", ErrUnimplemented)
+	case 255:
+		// Dual mono
+		if h.Channels == 2 && h.Streams == 2 && h.CoupledStreams == 0 &&
+			h.Mapping[0] == 0 && h.Mapping[1] == 1 {
+			return []byte{0}, nil
+		}
+	}
+	b := []byte{tsChannelConfigExplicit, byte(h.Channels), byte(h.MappingFamily)}
+	var bits uint64
+	var n uint
+	put := func(v int, width uint) {
+		bits = bits<<width | uint64(v)
+		n += width
+		for n >= 8 {
+			b = append(b, byte(bits>>(n-8)))
+			n -= 8
+		}
+	}
+	put(h.Streams-1, bitsFor(h.Channels))
+	put(h.CoupledStreams, bitsFor(h.Streams+1))
+	width := bitsFor(h.Streams + h.CoupledStreams + 1)
+	for _, m := range h.Mapping {
+		v := int(m)
+		if m == 255 {
+			// Silent channel, the value after the last decoded channel
+			v = h.Streams + h.CoupledStreams
+		}
+		put(v, width)
+	}
+	if n > 0 {
+		put(0, 8-n)
+	}
+	// The descriptor also holds the extension tag
+	if len(b) > 254 {
+		return nil, fmt.Errorf("%w: channel configuration of %d bytes", ErrUnimplemented, len(b))
+	}
+	return b, nil
+}
+
+// parseTSChannelConfig returns the header described by the payload of the
+// Opus extension descriptor.
+func parseTSChannelConfig(data []byte) (*Head, error) {
+	if len(data) < 1 {
+		return nil, fmt.Errorf("%w: empty Opus descriptor", ErrInvalidContainer)
+	}
+	h := &Head{Version: 1, InputSampleRate: 48000}
+	code := int(data[0])
+	switch {
+	case code == 0:
+		h.Channels = 2
+		h.MappingFamily = 255
+		h.Streams = 2
+		h.Mapping = []byte{0, 1}
+	case code <= 2:
+		h.Channels = code
+	case code <= 8:
+		m := tsVorbisMappings[code]
+		h.Channels = code
+		h.MappingFamily = 1
+		h.Streams = m.streams
+		h.CoupledStreams = m.coupledStreams
+		h.Mapping = append([]byte(nil), m.mapping...)
+	case code == tsChannelConfigExplicit:
+		if len(data) < 3 {
+			return nil, fmt.Errorf("%w: truncated Opus descriptor", ErrInvalidContainer)
+		}
+		h.Channels = int(data[1])
+		h.MappingFamily = int(data[2])
+		if h.MappingFamily == 0 {
+			break
+		}
+		var bits uint64
+		var n uint
+		data = data[3:]
+		get := func(width uint) (int, bool) {
+			for n < width {
+				if len(data) == 0 {
+					return 0, false
+				}
+				bits = bits<<8 | uint64(data[0])
+				data = data[1:]
+				n += 8
+			}
+			n -= width
+			return int(bits>>n) & (1<<width - 1), true
+		}
+		streams, ok := get(bitsFor(h.Channels))
+		h.Streams = streams + 1
+		coupled, ok2 := get(bitsFor(h.Streams + 1))
+		h.CoupledStreams = coupled
+		if !ok || !ok2 {
+			return nil, fmt.Errorf("%w: truncated Opus descriptor", ErrInvalidContainer)
+		}
+		width := bitsFor(h.Streams + h.CoupledStreams + 1)
+		h.Mapping = make([]byte, h.Channels)
+		for i := range h.Mapping {
+			v, ok := get(width)
+			if !ok {
+				return nil, fmt.Errorf("%w: truncated Opus descriptor", ErrInvalidContainer)
+			}
+			if v == h.Streams+h.CoupledStreams {
+				v = 255
+			}
+			h.Mapping[i] = byte(v)
+		}
+	default:
+		return nil, fmt.Errorf("%w: channel_config_code %#x", ErrUnimplemented, code)
+	}
+	if err := h.Validate(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// TSAccessUnit is an Opus packet in an MPEG transport stream, with the
+// fields of its opus_control_header.
+type TSAccessUnit struct {
+	Data []byte
+	// Presentation time of the packet. Only the first packet of a PES packet
+	// carries a timestamp; the others are derived from packet durations.
+	PTS time.Duration
+	// Samples per channel at 48 kHz to drop from the start and the end of
+	// the decoded packet. The pre-skip of the stream is a start trim.
+	StartTrim int
+	EndTrim   int
+}
+
+// appendTSControlHeader appends the opus_control_header of an access unit of
+// the given size.
+func appendTSControlHeader(b []byte, size int, startTrim int, endTrim int) []byte {
+	prefix := tsControlPrefix
+	if startTrim > 0 {
+		prefix |= tsControlStartTrim
+	}
+	if endTrim > 0 {
+		prefix |= tsControlEndTrim
+	}
+	b = append(b, byte(prefix>>8), byte(prefix))
+	for ; size >= 255; size -= 255 {
+		b = append(b, 255)
+	}
+	b = append(b, byte(size))
+	if startTrim > 0 {
+		b = append(b, byte(startTrim>>8), byte(startTrim))
+	}
+	if endTrim > 0 {
+		b = append(b, byte(endTrim>>8), byte(endTrim))
+	}
+	return b
+}
+
+// TSWriter writes Opus packets to an MPEG transport stream with a single
+// program, e.g. for broadcast. Every packet is written in its own PES packet,
+// and the PAT and PMT are repeated every 100 ms.
+type TSWriter struct {
+	w io.Writer
+	// Payload of the Opus extension descriptor
+	channelConfig []byte
+	// Continuity counters by PID
+	cc map[uint16]byte
+	// Samples per channel at 48 kHz written so far
+	samples    int64
+	tables     int64
+	hasTables  bool
+	remainTrim int
+	closed     bool
+}
+
+// NewTSWriter creates a transport stream writer for the stream described by
+// head, e.g. from Encoder.Head. MPEG-TS has no Opus header, so the pre-skip is
+// written as the start trim of the first packets, and the sample rate and
+// output gain of the header are lost. Mapping family 3 is not supported.
+func NewTSWriter(w io.Writer, head *Head) (*TSWriter, error) {
+	if err := head.Validate(); err != nil {
+		return nil, err
+	}
+	config, err := tsChannelConfig(head)
+	if err != nil {
+		return nil, err
+	}
+	return &TSWriter{
+		w:             w,
+		channelConfig: config,
+		cc:            map[uint16]byte{},
+		remainTrim:    head.PreSkip,
+	}, nil
+}
+
+// WritePacket adds an encoded Opus packet to the stream. samples is the
+// duration of the packet in samples per channel at 48 kHz, regardless of the
+// sample rate of the encoder; e.g. 960 for a 20 ms packet.
+func (tw *TSWriter) WritePacket(data []byte, samples int) error {
+	return tw.writeAccessUnit(data, samples, 0)
+}
+
+// WriteLastPacket adds the last packet of the stream, of which endTrim
+// samples per channel at 48 kHz are padding to be dropped by the decoder.
+func (tw *TSWriter) WriteLastPacket(data []byte, samples int, endTrim int) error {
+	if endTrim < 0 || endTrim > samples || endTrim > tsMaxTrim {
+		return fmt.Errorf("%w: end trim %d of a packet of %d samples", ErrBadArg, endTrim, samples)
+	}
+	if err := tw.writeAccessUnit(data, samples, endTrim); err != nil {
+		return err
+	}
+	tw.closed = true
+	return nil
+}
+
+func (tw *TSWriter) writeAccessUnit(data []byte, samples int, endTrim int) error {
+	if tw.closed {
+		return ErrStreamClosed
+	}
+	if len(data) == 0 {
+		return ErrNoData
+	}
+	if samples <= 0 {
+		return fmt.Errorf("%w: packet of %d samples", ErrBadArg, samples)
+	}
+	if !tw.hasTables || tw.samples-tw.tables >= tsTableInterval {
+		if err := tw.writeTables(); err != nil {
+			return err
+		}
+	}
+	startTrim := tw.remainTrim
+	if startTrim > samples {
+		startTrim = samples
+	}
+	tw.remainTrim -= startTrim
+
+	clock := tw.samples * tsClock / 48000
+	pts := (clock + tsPTSDelay) & (1<<33 - 1)
+	pes := []byte{0, 0, 1, tsStreamIDPrivate1, 0, 0, 0x80, 0x80, 5,
+		0x21 | byte(pts>>29)&0x0e, byte(pts >> 22), byte(pts>>14) | 1, byte(pts >> 7), byte(pts<<1) | 1}
+	pes = appendTSControlHeader(pes, len(data), startTrim, endTrim)
+	pes = append(pes, data...)
+	if len(pes)-6 > 0xffff {
+		return fmt.Errorf("%w: packet of %d bytes", ErrBadArg, len(data))
+	}
+	pes[4] = byte((len(pes) - 6) >> 8)
+	pes[5] = byte(len(pes) - 6)
+	if err := tw.writePayload(tsPIDAudio, pes, clock); err != nil {
+		return err
+	}
+	tw.samples += int64(samples)
+	return nil
+}
+
+// writePayload splits a PES packet or PSI section across transport stream
+// packets. A PCR is added to the first packet unless pcr is negative.
+func (tw *TSWriter) writePayload(pid uint16, payload []byte, pcr int64) error {
+	first := true
+	for first || len(payload) > 0 {
+		// Adaptation field with its length byte
+		var adaptation []byte
+		if first && pcr >= 0 {
+			base := pcr & (1<<33 - 1)
+			adaptation = []byte{7, 0x10,
+				byte(base >> 25), byte(base >> 17), byte(base >> 9), byte(base >> 1), byte(base<<7) | 0x7e, 0}
+		}
+		n := len(payload)
+		if room := tsPacketSize - 4 - len(adaptation); n > room {
+			n = room
+		}
+		// Stuffing in the adaptation field fills the last packet
+		if stuffing := tsPacketSize - 4 - len(adaptation) - n; stuffing > 0 {
+			if adaptation == nil {
+				adaptation = []byte{0}
+				stuffing--
+				if stuffing > 0 {
+					adaptation = append(adaptation, 0)
+					stuffing--
+				}
+			}
+			for ; stuffing > 0; stuffing-- {
+				adaptation = append(adaptation, 0xff)
+			}
+			adaptation[0] = byte(len(adaptation) - 1)
+		}
+		control := byte(0x10)
+		if adaptation != nil {
+			control = 0x30
+		}
+		pusi := byte(0)
+		if first {
+			pusi = 0x40
+		}
+		pkt := make([]byte, 0, tsPacketSize)
+		pkt = append(pkt, tsSyncByte, pusi|byte(pid>>8), byte(pid), control|tw.cc[pid])
+		pkt = append(pkt, adaptation...)
+		pkt = append(pkt, payload[:n]...)
+		if _, err := tw.w.Write(pkt); err != nil {
+			return err
+		}
+		tw.cc[pid] = (tw.cc[pid] + 1) & 0x0f
+		payload = payload[n:]
+		first = false
+	}
+	return nil
+}
+
+// psiSection completes a PSI section with its length and checksum, and
+// prepends the pointer field.
+func psiSection(tableID byte, body []byte) []byte {
+	length := len(body) + 4
+	section := []byte{0, tableID, 0xb0 | byte(length>>8), byte(length)}
+	section = append(section, body...)
+	crc := mpegCRC(section[1:])
+	return append(section, byte(crc>>24), byte(crc>>16), byte(crc>>8), byte(crc))
+}
+
+func (tw *TSWriter) writeTables() error {
+	pat := psiSection(0x00, []byte{
+		0, 1, 0xc1, 0, 0, // transport stream 1, version 0, current
+		0, 1, 0xe0 | tsPIDPMT>>8, tsPIDPMT & 0xff,
+	})
+	var descriptors []byte
+	descriptors = append(descriptors, tsDescriptorRegistration, 4, 'O', 'p', 'u', 's')
+	descriptors = append(descriptors, tsDescriptorExtension, byte(1+len(tw.channelConfig)), tsExtensionOpus)
+	descriptors = append(descriptors, tw.channelConfig...)
+	pmt := []byte{
+		0, 1, 0xc1, 0, 0, // program 1, version 0, current
+		0xe0 | tsPIDAudio>>8, tsPIDAudio & 0xff, // PCR PID
+		0xf0, 0, // no program descriptors
+		tsStreamTypePrivate, 0xe0 | tsPIDAudio>>8, tsPIDAudio & 0xff,
+		0xf0 | byte(len(descriptors)>>8), byte(len(descriptors)),
+	}
+	pmt = psiSection(0x02, append(pmt, descriptors...))
+	for _, t := range []struct {
+		pid     uint16
+		section []byte
+	}{{tsPIDPAT, pat}, {tsPIDPMT, pmt}} {
+		// Sections are padded with 0xff rather than adaptation stuffing
+		for len(t.section)%(tsPacketSize-4) != 0 {
+			t.section = append(t.section, 0xff)
+		}
+		if err := tw.writePayload(t.pid, t.section, -1); err != nil {
+			return err
+		}
+	}
+	tw.tables = tw.samples
+	tw.hasTables = true
+	return nil
+}
+
+// TSReader reads Opus access units from the first Opus stream of an MPEG
+// transport stream. The stream is identified by the "Opus" registration
+// descriptor in the PMT.
+type TSReader struct {
+	r      io.Reader
+	pkt    [tsPacketSize]byte
+	pmtPID int
+	pid    int
+	head   *Head
+	// PES packet being reassembled
+	pes    []byte
+	hasPES bool
+	// Access units of the last PES packet not returned yet
+	pending []*TSAccessUnit
+	// Unwrapping of the 33-bit PTS
+	lastPTS   int64
+	ptsOffset int64
+	hasPTS    bool
+}
+
+// NewTSReader reads the transport stream up to the PMT and selects the first
+// Opus stream. Returns ErrNoOpusTrack if no Opus stream is found.
+func NewTSReader(r io.Reader) (*TSReader, error) {
+	if r == nil {
+		return nil, ErrNilReader
+	}
+	tr := &TSReader{r: r, pmtPID: -1, pid: -1}
+	for tr.head == nil {
+		if err := tr.readPacket(); err != nil {
+			if err == io.EOF {
+				return nil, fmt.Errorf("%w: no Opus stream in PMT", ErrNoOpusTrack)
+			}
+			return nil, err
+		}
+	}
+	return tr, nil
+}
+
+// Head returns a header for the decoder, described by the channel
+// configuration of the stream: NewDecoderFromHead(48000, r.Head()) creates a
+// Decoder for up to two channels and a MultistreamDecoder otherwise. Its
+// pre-skip is zero; the priming samples are given as start trims.
+func (tr *TSReader) Head() *Head {
+	return tr.head
+}
+
+// readPacket reads and handles one transport stream packet.
+func (tr *TSReader) readPacket() error {
+	if _, err := io.ReadFull(tr.r, tr.pkt[:]); err != nil {
+		return err
+	}
+	pkt := tr.pkt[:]
+	if pkt[0] != tsSyncByte {
+		return fmt.Errorf("%w: lost transport stream sync", ErrInvalidContainer)
+	}
+	pusi := pkt[1]&0x40 != 0
+	pid := int(pkt[1]&0x1f)<<8 | int(pkt[2])
+	control := pkt[3] >> 4 & 3
+	payload := pkt[4:]
+	if control&2 != 0 {
+		if int(payload[0]) >= len(payload) {
+			return fmt.Errorf("%w: adaptation field overflows packet", ErrInvalidContainer)
+		}
+		payload = payload[1+int(payload[0]):]
+	}
+	if control&1 == 0 {
+		return nil
+	}
+	switch {
+	case pid == tsPIDPAT && pusi && tr.head == nil:
+		return tr.parsePAT(payload)
+	case pid == tr.pmtPID && pusi && tr.head == nil:
+		return tr.parsePMT(payload)
+	case pid == tr.pid:
+		if pusi {
+			if err := tr.flushPES(); err != nil {
+				return err
+			}
+			tr.hasPES = true
+		}
+		if tr.hasPES {
+			tr.pes = append(tr.pes, payload...)
+		}
+	}
+	return nil
+}
+
+// psiSection returns the body of the section starting in a packet payload,
+// after checking its checksum. Sections must fit in one packet.
+func readPSISection(payload []byte, tableID byte) ([]byte, error) {
+	if len(payload) < 1 || int(payload[0])+1 > len(payload) {
+		return nil, fmt.Errorf("%w: invalid pointer field", ErrInvalidContainer)
+	}
+	section := payload[1+int(payload[0]):]
+	if len(section) < 3 {
+		return nil, fmt.Errorf("%w: truncated section", ErrInvalidContainer)
+	}
+	if section[0] != tableID {
+		return nil, fmt.Errorf("%w: table %#x, expected %#x", ErrInvalidContainer, section[0], tableID)
+	}
+	length := int(section[1]&0x0f)<<8 | int(section[2])
+	if length < 9 || 3+length > len(section) {
+		return nil, fmt.Errorf("%w: section doesn't fit in one packet", ErrUnimplemented)
+	}
+	section = section[:3+length]
+	if mpegCRC(section) != 0 {
+		return nil, fmt.Errorf("%w: section checksum mismatch", ErrInvalidContainer)
+	}
+	// Skip the common header, up to and including last_section_number
+	return section[8 : len(section)-4], nil
+}
+
+func (tr *TSReader) parsePAT(payload []byte) error {
+	body, err := readPSISection(payload, 0x00)
+	if err != nil {
+		return err
+	}
+	for ; len(body) >= 4; body = body[4:] {
+		program := int(body[0])<<8 | int(body[1])
+		// Program 0 is the network PID
+		if program != 0 {
+			tr.pmtPID = int(body[2]&0x1f)<<8 | int(body[3])
+			return nil
+		}
+	}
+	return nil
+}
+
+func (tr *TSReader) parsePMT(payload []byte) error {
+	body, err := readPSISection(payload, 0x02)
+	if err != nil {
+		return err
+	}
+	if len(body) < 4 {
+		return fmt.Errorf("%w: truncated PMT", ErrInvalidContainer)
+	}
+	infoLength := int(body[2]&0x0f)<<8 | int(body[3])
+	if 4+infoLength > len(body) {
+		return fmt.Errorf("%w: truncated PMT", ErrInvalidContainer)
+	}
+	streams := body[4+infoLength:]
+	for len(streams) >= 5 {
+		streamType := streams[0]
+		pid := int(streams[1]&0x1f)<<8 | int(streams[2])
+		esLength := int(streams[3]&0x0f)<<8 | int(streams[4])
+		if 5+esLength > len(streams) {
+			return fmt.Errorf("%w: truncated PMT", ErrInvalidContainer)
+		}
+		descriptors := streams[5 : 5+esLength]
+		streams = streams[5+esLength:]
+		if streamType != tsStreamTypePrivate {
+			continue
+		}
+		isOpus := false
+		var config []byte
+		for len(descriptors) >= 2 {
+			tag, length := descriptors[0], int(descriptors[1])
+			if 2+length > len(descriptors) {
+				return fmt.Errorf("%w: truncated descriptor", ErrInvalidContainer)
+			}
+			data := descriptors[2 : 2+length]
+			descriptors = descriptors[2+length:]
+			switch {
+			case tag == tsDescriptorRegistration && string(data) == "Opus":
+				isOpus = true
+			case tag == tsDescriptorExtension && len(data) >= 1 && data[0] == tsExtensionOpus:
+				config = data[1:]
+			}
+		}
+		if !isOpus || config == nil {
+			continue
+		}
+		head, err := parseTSChannelConfig(config)
+		if err != nil {
+			return err
+		}
+		tr.head = head
+		tr.pid = pid
+		return nil
+	}
+	return nil
+}
+
+// flushPES parses the reassembled PES packet into access units.
+func (tr *TSReader) flushPES() error {
+	pes := tr.pes
+	tr.pes = tr.pes[:0]
+	if !tr.hasPES {
+		return nil
+	}
+	tr.hasPES = false
+	if len(pes) < 9 || pes[0] != 0 || pes[1] != 0 || pes[2] != 1 {
+		return fmt.Errorf("%w: invalid PES packet", ErrInvalidContainer)
+	}
+	if length := int(pes[4])<<8 | int(pes[5]); length != 0 && 6+length <= len(pes) {
+		pes = pes[:6+length]
+	}
+	headerEnd := 9 + int(pes[8])
+	if headerEnd > len(pes) {
+		return fmt.Errorf("%w: truncated PES header", ErrInvalidContainer)
+	}
+	var pts time.Duration
+	if pes[7]&0x80 != 0 && pes[8] >= 5 {
+		p := pes[9:]
+		ticks := int64(p[0]&0x0e)<<29 | int64(p[1])<<22 | int64(p[2]&0xfe)<<14 |
+			int64(p[3])<<7 | int64(p[4])>>1
+		pts = tr.unwrapPTS(ticks)
+	}
+	payload := pes[headerEnd:]
+	for len(payload) > 0 {
+		if len(payload) < 3 || int(payload[0])<<8|int(payload[1]&0xe0) != tsControlPrefix {
+			return fmt.Errorf("%w: invalid opus_control_header", ErrInvalidContainer)
+		}
+		flags := payload[1]
+		pos := 2
+		size := 0
+		for {
+			if pos >= len(payload) {
+				return fmt.Errorf("%w: truncated opus_control_header", ErrInvalidContainer)
+			}
+			b := payload[pos]
+			pos++
+			size += int(b)
+			if b != 255 {
+				break
+			}
+		}
+		au := &TSAccessUnit{PTS: pts}
+		if flags&tsControlStartTrim != 0 {
+			if pos+2 > len(payload) {
+				return fmt.Errorf("%w: truncated opus_control_header", ErrInvalidContainer)
+			}
+			au.StartTrim = (int(payload[pos])<<8 | int(payload[pos+1])) & tsMaxTrim
+			pos += 2
+		}
+		if flags&tsControlEndTrim != 0 {
+			if pos+2 > len(payload) {
+				return fmt.Errorf("%w: truncated opus_control_header", ErrInvalidContainer)
+			}
+			au.EndTrim = (int(payload[pos])<<8 | int(payload[pos+1])) & tsMaxTrim
+			pos += 2
+		}
+		if flags&tsControlExtension != 0 {
+			if pos >= len(payload) {
+				return fmt.Errorf("%w: truncated opus_control_header", ErrInvalidContainer)
+			}
+			pos += 1 + int(payload[pos])
+		}
+		if pos+size > len(payload) {
+			return fmt.Errorf("%w: access unit overflows PES packet", ErrInvalidContainer)
+		}
+		au.Data = append([]byte(nil), payload[pos:pos+size]...)
+		payload = payload[pos+size:]
+		tr.pending = append(tr.pending, au)
+		pts += time.Duration(opusPacketSamples(au.Data)) * time.Second / 48000
+	}
+	return nil
+}
+
+// unwrapPTS converts a 33-bit PTS to a duration that keeps increasing when
+// the PTS wraps around.
+func (tr *TSReader) unwrapPTS(ticks int64) time.Duration {
+	if tr.hasPTS && ticks+tr.ptsOffset < tr.lastPTS-1<<32 {
+		tr.ptsOffset += 1 << 33
+	}
+	tr.hasPTS = true
+	tr.lastPTS = ticks + tr.ptsOffset
+	// Multiplying first overflows after 28 hours
+	return time.Duration(tr.lastPTS/tsClock)*time.Second + time.Duration(tr.lastPTS%tsClock)*time.Second/tsClock
+}
+
+// ReadPacket returns the next access unit of the Opus stream, or io.EOF at
+// the end of the transport stream.
+func (tr *TSReader) ReadPacket() (*TSAccessUnit, error) {
+	for len(tr.pending) == 0 {
+		err := tr.readPacket()
+		if err == io.EOF {
+			if err := tr.flushPES(); err != nil {
+				return nil, err
+			}
+			if len(tr.pending) == 0 {
+				return nil, io.EOF
+			}
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	au := tr.pending[0]
+	tr.pending = tr.pending[1:]
+	return au, nil
+}
@@ -0,0 +1,219 @@
+// Copyright © Go Opus Authors (see AUTHORS file)
+//
+// License for use of this code is detailed in the LICENSE file
+
+package opus
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTSChannelConfig(t *testing.T) {
+	for _, h := range []*Head{
+		{Channels: 1},
+		{Channels: 2},
+		{Channels: 2, MappingFamily: 255, Streams: 2, Mapping: []byte{0, 1}},
+		{Channels: 6, MappingFamily: 1, Streams: 4, CoupledStreams: 2, Mapping: []byte{0, 4, 1, 2, 3, 5}},
+		{Channels: 8, MappingFamily: 1, Streams: 5, CoupledStreams: 3, Mapping: []byte{0, 6, 1, 2, 3, 4, 5, 7}},
+		// Explicit configurations
+		{Channels: 3, MappingFamily: 255, Streams: 3, Mapping: []byte{0, 1, 2}},
+		{Channels: 4, MappingFamily: 1, Streams: 3, CoupledStreams: 1, Mapping: []byte{0, 1, 2, 255}},
+		{Channels: 16, MappingFamily: 2, Streams: 16, Mapping: []byte{
+			0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}},
+	} {
+		h.Version = 1
+		h.InputSampleRate = 48000
+		config, err := tsChannelConfig(h)
+		if err != nil {
+			t.Errorf("Couldn't create channel config for %+v: %v", h, err)
+			continue
+		}
+		got, err := parseTSChannelConfig(config)
+		if err != nil {
+			t.Errorf("Couldn't parse channel config %x: %v", config, err)
+			continue
+		}
+		if h.MappingFamily == 0 {
+			// Family 0 has no mapping in the header
+			h.Streams = 0
+		}
+		if !reflect.DeepEqual(got, h) {
+			t.Errorf("Channel config %x changed %+v to %+v", config, h, got)
+		}
+	}
+	if config, _ := tsChannelConfig(&Head{Channels: 2}); !bytes.Equal(config, []byte{2}) {
+		t.Errorf("Unexpected channel config for stereo: %x", config)
+	}
+	if _, err := parseTSChannelConfig([]byte{0x81}); !errors.Is(err, ErrUnimplemented) {
+		t.Errorf("Expected ErrUnimplemented, got %v", err)
+	}
+}
+
+func TestTSControlHeader(t *testing.T) {
+	b := appendTSControlHeader(nil, 600, 312, 0)
+	if expected := []byte{0x7f, 0xf0, 255, 255, 90, 0x01, 0x38}; !bytes.Equal(b, expected) {
+		t.Errorf("Unexpected control header: %x, expected %x", b, expected)
+	}
+}
+
+func TestTSWriterReader(t *testing.T) {
+	head := &Head{Version: 1, Channels: 6, PreSkip: 1500, InputSampleRate: 48000,
+		MappingFamily: 1, Streams: 4, CoupledStreams: 2, Mapping: []byte{0, 4, 1, 2, 3, 5}}
+	var buf bytes.Buffer
+	tw, err := NewTSWriter(&buf, head)
+	if err != nil {
+		t.Fatalf("Couldn't create TS writer: %v", err)
+	}
+	const PACKETS = 20
+	var written [][]byte
+	for i := 0; i < PACKETS; i++ {
+		// Large enough to span several transport stream packets
+		p := testOpusFrame(100+50*i, byte(i))
+		if i == PACKETS-1 {
+			err = tw.WriteLastPacket(p, 960, 100)
+		} else {
+			err = tw.WritePacket(p, 960)
+		}
+		if err != nil {
+			t.Fatalf("Couldn't write packet %d: %v", i, err)
+		}
+		written = append(written, p)
+	}
+	if err := tw.WritePacket(written[0], 960); err != ErrStreamClosed {
+		t.Errorf("Expected ErrStreamClosed after the last packet, got %v", err)
+	}
+	if buf.Len()%tsPacketSize != 0 {
+		t.Fatalf("Stream of %d bytes isn't made of transport stream packets", buf.Len())
+	}
+
+	r, err := NewTSReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("Couldn't read TS header: %v", err)
+	}
+	expectedHead := *head
+	expectedHead.PreSkip = 0
+	if !reflect.DeepEqual(r.Head(), &expectedHead) {
+		t.Errorf("Unexpected header: %+v", r.Head())
+	}
+	for i, w := range written {
+		au, err := r.ReadPacket()
+		if err != nil {
+			t.Fatalf("Couldn't read packet %d: %v", i, err)
+		}
+		startTrim := 0
+		switch i {
+		case 0:
+			startTrim = 960
+		case 1:
+			startTrim = 1500 - 960
+		}
+		endTrim := 0
+		if i == PACKETS-1 {
+			endTrim = 100
+		}
+		pts := 100*time.Millisecond + time.Duration(i)*20*time.Millisecond
+		if !bytes.Equal(au.Data, w) || au.PTS != pts || au.StartTrim != startTrim || au.EndTrim != endTrim {
+			t.Errorf("Unexpected packet %d: %d bytes at %v, trims %d and %d",
+				i, len(au.Data), au.PTS, au.StartTrim, au.EndTrim)
+		}
+	}
+	if _, err := r.ReadPacket(); err != io.EOF {
+		t.Errorf("Expected EOF, got %v", err)
+	}
+
+	// A corrupt PMT checksum
+	data := append([]byte(nil), buf.Bytes()...)
+	data[tsPacketSize+20] ^= 1
+	if _, err := NewTSReader(bytes.NewReader(data)); !errors.Is(err, ErrInvalidContainer) {
+		t.Errorf("Expected ErrInvalidContainer, got %v", err)
+	}
+	if _, err := NewTSReader(bytes.NewReader(nil)); !errors.Is(err, ErrNoOpusTrack) {
+		t.Errorf("Expected ErrNoOpusTrack, got %v", err)
+	}
+}
+
+func TestTSUnwrapPTS(t *testing.T) {
+	// Untyped, so that the expected values don't overflow before the division
+	const wrap = 1 << 33
+	const second = 1000000000
+	var tr TSReader
+	for i, c := range []struct {
+		ticks    int64
+		expected time.Duration
+	}{
+		{wrap - 2*tsClock, (wrap - 2*tsClock) * second / tsClock},
+		{wrap - tsClock, (wrap - tsClock) * second / tsClock},
+		// Across the wrap
+		{tsClock / 2, (wrap + tsClock/2) * second / tsClock},
+		{tsClock + 1, (wrap + tsClock + 1) * second / tsClock},
+		// A packet slightly out of order does not unwrap again
+		{tsClock / 2, (wrap + tsClock/2) * second / tsClock},
+		{wrap - tsClock, (2*wrap - tsClock) * second / tsClock},
+		{7, (2*wrap + 7) * second / tsClock},
+	} {
+		if got := tr.unwrapPTS(c.ticks); got != c.expected {
+			t.Errorf("Unexpected time for PTS %d (%d): %v, expected %v", c.ticks, i, got, c.expected)
+		}
+	}
+}
+
+func TestTSDecode(t *testing.T) {
+	const FRAME_SIZE = 960
+	const FRAMES = 10
+	enc, err := NewSurroundEncoder(48000, 6, 1, AppAudio)
+	if err != nil {
+		t.Fatalf("Error creating encoder: %v", err)
+	}
+	head, err := enc.Head()
+	if err != nil {
+		t.Fatalf("Couldn't create header: %v", err)
+	}
+	var buf bytes.Buffer
+	tw, err := NewTSWriter(&buf, head)
+	if err != nil {
+		t.Fatalf("Couldn't create TS writer: %v", err)
+	}
+	pcm := make([]int16, FRAME_SIZE*6)
+	addSine(pcm, 48000, 440)
+	data := make([]byte, 4000)
+	for i := 0; i < FRAMES; i++ {
+		n, err := enc.Encode(pcm, data)
+		if err != nil {
+			t.Fatalf("Couldn't encode data: %v", err)
+		}
+		if err := tw.WritePacket(data[:n], FRAME_SIZE); err != nil {
+			t.Fatalf("Couldn't write packet: %v", err)
+		}
+	}
+
+	r, err := NewTSReader(&buf)
+	if err != nil {
+		t.Fatalf("Couldn't read TS header: %v", err)
+	}
+	dec, err := NewDecoderFromHead(48000, r.Head())
+	if err != nil {
+		t.Fatalf("Couldn't create decoder: %v", err)
+	}
+	if _, ok := dec.(*MultistreamDecoder); !ok {
+		t.Errorf("Expected a multistream decoder for 6 channels, got %T", dec)
+	}
+	out := make([]int16, FRAME_SIZE*6)
+	for i := 0; i < FRAMES; i++ {
+		au, err := r.ReadPacket()
+		if err != nil {
+			t.Fatalf("Couldn't read packet %d: %v", i, err)
+		}
+		n, err := dec.Decode(au.Data, out)
+		if err != nil {
+			t.Fatalf("Couldn't decode packet %d: %v", i, err)
+		}
+		if n != FRAME_SIZE {
+			t.Errorf("Expected %d samples, got %d", FRAME_SIZE, n)
+		}
+	}
+}
@@ -0,0 +1,1656 @@
+// Copyright © Go Opus Authors (see AUTHORS file)
+//
+// License for use of this code is detailed in the LICENSE file
+
+package opus
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+/*
+#cgo pkg-config: opus
+#include <opus_multistream.h>
+
+int
+bridge_ms_encoder_ctl(OpusMSEncoder *st, int request)
+{
+	return opus_multistream_encoder_ctl(st, request);
+}
+
+int
+bridge_ms_encoder_set_int32(OpusMSEncoder *st, int request, opus_int32 value)
+{
+	return opus_multistream_encoder_ctl(st, request, value);
+}
+
+int
+bridge_ms_encoder_get_int32(OpusMSEncoder *st, int request, opus_int32 *value)
+{
+	return opus_multistream_encoder_ctl(st, request, value);
+}
+
+int
+bridge_ms_encoder_get_uint32(OpusMSEncoder *st, int request, opus_uint32 *value)
+{
+	return opus_multistream_encoder_ctl(st, request, value);
+}
+
+int
+bridge_ms_encoder_set_bitrate(OpusMSEncoder *st, opus_int32 bitrate)
+{
+	return opus_multistream_encoder_ctl(st, OPUS_SET_BITRATE(bitrate));
+}
+
+int
+bridge_ms_encoder_get_bitrate(OpusMSEncoder *st, opus_int32 *bitrate)
+{
+	return opus_multistream_encoder_ctl(st, OPUS_GET_BITRATE(bitrate));
+}
+
+int
+bridge_ms_encoder_set_complexity(OpusMSEncoder *st, opus_int32 complexity)
+{
+	return opus_multistream_encoder_ctl(st, OPUS_SET_COMPLEXITY(complexity));
+}
+
+int
+bridge_ms_encoder_get_complexity(OpusMSEncoder *st, opus_int32 *complexity)
+{
+	return opus_multistream_encoder_ctl(st, OPUS_GET_COMPLEXITY(complexity));
+}
+
+int
+bridge_ms_encoder_set_max_bandwidth(OpusMSEncoder *st, opus_int32 max_bw)
+{
+	return opus_multistream_encoder_ctl(st, OPUS_SET_MAX_BANDWIDTH(max_bw));
+}
+
+int
+bridge_ms_encoder_get_max_bandwidth(OpusMSEncoder *st, opus_int32 *max_bw)
+{
+	return opus_multistream_encoder_ctl(st, OPUS_GET_MAX_BANDWIDTH(max_bw));
+}
+
+int
+bridge_ms_encoder_set_bandwidth(OpusMSEncoder *st, opus_int32 bw)
+{
+	return opus_multistream_encoder_ctl(st, OPUS_SET_BANDWIDTH(bw));
+}
+
+int
+bridge_ms_encoder_get_bandwidth(OpusMSEncoder *st, opus_int32 *bw)
+{
+	return opus_multistream_encoder_ctl(st, OPUS_GET_BANDWIDTH(bw));
+}
+
+int
+bridge_ms_encoder_set_inband_fec(OpusMSEncoder *st, opus_int32 fec)
+{
+	return opus_multistream_encoder_ctl(st, OPUS_SET_INBAND_FEC(fec));
+}
+
+int
+bridge_ms_encoder_get_inband_fec(OpusMSEncoder *st, opus_int32 *fec)
+{
+	return opus_multistream_encoder_ctl(st, OPUS_GET_INBAND_FEC(fec));
+}
+
+int
+bridge_ms_encoder_set_packet_loss_perc(OpusMSEncoder *st, opus_int32 loss_perc)
+{
+	return opus_multistream_encoder_ctl(st, OPUS_SET_PACKET_LOSS_PERC(loss_perc));
+}
+
+int
+bridge_ms_encoder_get_packet_loss_perc(OpusMSEncoder *st, opus_int32 *loss_perc)
+{
+	return opus_multistream_encoder_ctl(st, OPUS_GET_PACKET_LOSS_PERC(loss_perc));
+}
+
+int
+bridge_ms_encoder_set_dtx(OpusMSEncoder *st, opus_int32 dtx)
+{
+	return opus_multistream_encoder_ctl(st, OPUS_SET_DTX(dtx));
+}
+
+int
+bridge_ms_encoder_get_dtx(OpusMSEncoder *st, opus_int32 *dtx)
+{
+	return opus_multistream_encoder_ctl(st, OPUS_GET_DTX(dtx));
+}
+
+int
+bridge_ms_encoder_set_vbr(OpusMSEncoder *st, opus_int32 vbr)
+{
+	return opus_multistream_encoder_ctl(st, OPUS_SET_VBR(vbr));
+}
+
+int
+bridge_ms_encoder_get_vbr(OpusMSEncoder *st, opus_int32 *vbr)
+{
+	return opus_multistream_encoder_ctl(st, OPUS_GET_VBR(vbr));
+}
+
+int
+bridge_ms_encoder_set_vbr_constraint(OpusMSEncoder *st, opus_int32 constraint)
+{
+	return opus_multistream_encoder_ctl(st, OPUS_SET_VBR_CONSTRAINT(constraint));
+}
+
+int
+bridge_ms_encoder_get_vbr_constraint(OpusMSEncoder *st, opus_int32 *constraint)
+{
+	return opus_multistream_encoder_ctl(st, OPUS_GET_VBR_CONSTRAINT(constraint));
+}
+
+int
+bridge_ms_encoder_set_signal(OpusMSEncoder *st, opus_int32 signal)
+{
+	return opus_multistream_encoder_ctl(st, OPUS_SET_SIGNAL(signal));
+}
+
+int
+bridge_ms_encoder_get_signal(OpusMSEncoder *st, opus_int32 *signal)
+{
+	return opus_multistream_encoder_ctl(st, OPUS_GET_SIGNAL(signal));
+}
+
+int
+bridge_ms_encoder_set_application(OpusMSEncoder *st, opus_int32 application)
+{
+	return opus_multistream_encoder_ctl(st, OPUS_SET_APPLICATION(application));
+}
+
+int
+bridge_ms_encoder_get_application(OpusMSEncoder *st, opus_int32 *application)
+{
+	return opus_multistream_encoder_ctl(st, OPUS_GET_APPLICATION(application));
+}
+
+int
+bridge_ms_encoder_set_lsb_depth(OpusMSEncoder *st, opus_int32 depth)
+{
+	return opus_multistream_encoder_ctl(st, OPUS_SET_LSB_DEPTH(depth));
+}
+
+int
+bridge_ms_encoder_get_lsb_depth(OpusMSEncoder *st, opus_int32 *depth)
+{
+	return opus_multistream_encoder_ctl(st, OPUS_GET_LSB_DEPTH(depth));
+}
+
+int
+bridge_ms_encoder_set_prediction_disabled(OpusMSEncoder *st, opus_int32 disabled)
+{
+	return opus_multistream_encoder_ctl(st, OPUS_SET_PREDICTION_DISABLED(disabled));
+}
+
+int
+bridge_ms_encoder_get_prediction_disabled(OpusMSEncoder *st, opus_int32 *disabled)
+{
+	return opus_multistream_encoder_ctl(st, OPUS_GET_PREDICTION_DISABLED(disabled));
+}
+
+int
+bridge_ms_encoder_set_phase_inversion_disabled(OpusMSEncoder *st, opus_int32 disabled)
+{
+	return opus_multistream_encoder_ctl(st, OPUS_SET_PHASE_INVERSION_DISABLED(disabled));
+}
+
+int
+bridge_ms_encoder_get_phase_inversion_disabled(OpusMSEncoder *st, opus_int32 *disabled)
+{
+	return opus_multistream_encoder_ctl(st, OPUS_GET_PHASE_INVERSION_DISABLED(disabled));
+}
+
+int
+bridge_ms_encoder_set_expert_frame_duration(OpusMSEncoder *st, opus_int32 duration)
+{
+	return opus_multistream_encoder_ctl(st, OPUS_SET_EXPERT_FRAME_DURATION(duration));
+}
+
+int
+bridge_ms_encoder_get_expert_frame_duration(OpusMSEncoder *st, opus_int32 *duration)
+{
+	return opus_multistream_encoder_ctl(st, OPUS_GET_EXPERT_FRAME_DURATION(duration));
+}
+
+int
+bridge_ms_encoder_get_lookahead(OpusMSEncoder *st, opus_int32 *lookahead)
+{
+	return opus_multistream_encoder_ctl(st, OPUS_GET_LOOKAHEAD(lookahead));
+}
+
+int
+bridge_ms_encoder_get_sample_rate(OpusMSEncoder *st, opus_int32 *sample_rate)
+{
+	return opus_multistream_encoder_ctl(st, OPUS_GET_SAMPLE_RATE(sample_rate));
+}
+
+int
+bridge_ms_encoder_get_final_range(OpusMSEncoder *st, opus_uint32 *final_range)
+{
+	return opus_multistream_encoder_ctl(st, OPUS_GET_FINAL_RANGE(final_range));
+}
+
+int
+bridge_ms_encoder_reset_state(OpusMSEncoder *st)
+{
+	return opus_multistream_encoder_ctl(st, OPUS_RESET_STATE);
+}
+
+int
+bridge_ms_decoder_ctl(OpusMSDecoder *st, int request)
+{
+	return opus_multistream_decoder_ctl(st, request);
+}
+
+int
+bridge_ms_decoder_set_int32(OpusMSDecoder *st, int request, opus_int32 value)
+{
+	return opus_multistream_decoder_ctl(st, request, value);
+}
+
+int
+bridge_ms_decoder_get_int32(OpusMSDecoder *st, int request, opus_int32 *value)
+{
+	return opus_multistream_decoder_ctl(st, request, value);
+}
+
+int
+bridge_ms_decoder_get_uint32(OpusMSDecoder *st, int request, opus_uint32 *value)
+{
+	return opus_multistream_decoder_ctl(st, request, value);
+}
+
+int
+bridge_ms_decoder_get_last_packet_duration(OpusMSDecoder *st, opus_int32 *samples)
+{
+	return opus_multistream_decoder_ctl(st, OPUS_GET_LAST_PACKET_DURATION(samples));
+}
+
+int
+bridge_ms_decoder_set_gain(OpusMSDecoder *st, opus_int32 gain)
+{
+	return opus_multistream_decoder_ctl(st, OPUS_SET_GAIN(gain));
+}
+
+int
+bridge_ms_decoder_get_gain(OpusMSDecoder *st, opus_int32 *gain)
+{
+	return opus_multistream_decoder_ctl(st, OPUS_GET_GAIN(gain));
+}
+
+int
+bridge_ms_decoder_get_bandwidth(OpusMSDecoder *st, opus_int32 *bw)
+{
+	return opus_multistream_decoder_ctl(st, OPUS_GET_BANDWIDTH(bw));
+}
+
+int
+bridge_ms_decoder_get_sample_rate(OpusMSDecoder *st, opus_int32 *sample_rate)
+{
+	return opus_multistream_decoder_ctl(st, OPUS_GET_SAMPLE_RATE(sample_rate));
+}
+
+int
+bridge_ms_decoder_set_phase_inversion_disabled(OpusMSDecoder *st, opus_int32 disabled)
+{
+	return opus_multistream_decoder_ctl(st, OPUS_SET_PHASE_INVERSION_DISABLED(disabled));
+}
+
+int
+bridge_ms_decoder_get_phase_inversion_disabled(OpusMSDecoder *st, opus_int32 *disabled)
+{
+	return opus_multistream_decoder_ctl(st, OPUS_GET_PHASE_INVERSION_DISABLED(disabled));
+}
+
+int
+bridge_ms_decoder_get_final_range(OpusMSDecoder *st, opus_uint32 *final_range)
+{
+	return opus_multistream_decoder_ctl(st, OPUS_GET_FINAL_RANGE(final_range));
+}
+
+int
+bridge_ms_decoder_reset_state(OpusMSDecoder *st)
+{
+	return opus_multistream_decoder_ctl(st, OPUS_RESET_STATE);
+}
+*/
+import "C"
+
+// checkMapping validates the stream layout of a multistream encoder or
+// decoder. Each entry of the mapping selects the coded channel for one input
+// or output channel: the coupled streams come first with two coded channels
+// each, followed by the uncoupled streams. 255 marks a silent channel.
+func checkMapping(channels int, streams int, coupledStreams int, mapping []byte) error {
+	if channels < 1 || channels > 255 {
+		return fmt.Errorf("%w: must be 1 to 255, got %d", ErrInvalidChannels, channels)
+	}
+	if streams < 1 || coupledStreams < 0 || coupledStreams > streams || streams+coupledStreams > 255 {
+		return fmt.Errorf("%w: %d streams of which %d coupled", ErrBadArg, streams, coupledStreams)
+	}
+	if len(mapping) != channels {
+		return fmt.Errorf("%w: mapping has %d entries for %d channels", ErrBadArg, len(mapping), channels)
+	}
+	for i, m := range mapping {
+		if m != 255 && int(m) >= streams+coupledStreams {
+			return fmt.Errorf("%w: mapping entry %d refers to coded channel %d, but there are only %d",
+				ErrBadArg, i, m, streams+coupledStreams)
+		}
+	}
+	return nil
+}
+
+// MultistreamEncoder contains the state of a libopus multistream encoder. It
+// encodes up to 255 channels into a single packet, made up of one Opus stream
+// per mono or stereo (coupled) pair of channels. This is needed for surround
+// sound; use Encoder for mono and stereo.
+type MultistreamEncoder struct {
+	p              *C.struct_OpusMSEncoder
+	channels       int
+	streams        int
+	coupledStreams int
+	mapping        []byte
+	mappingFamily  int
+	sample_rate    int
+	frameDuration  FrameDuration
+	// Same purpose as encoder struct
+	mem []byte
+}
+
+// NewMultistreamEncoder allocates a new multistream encoder and initializes
+// it with the given stream layout. See Init.
+func NewMultistreamEncoder(sample_rate int, channels int, streams int, coupledStreams int,
+	mapping []byte, application Application) (*MultistreamEncoder, error) {
+	var enc MultistreamEncoder
+	err := enc.Init(sample_rate, channels, streams, coupledStreams, mapping, application)
+	if err != nil {
+		return nil, err
+	}
+	return &enc, nil
+}
+
+// Init initializes a pre-allocated multistream encoder. The mapping has one
+// entry per input channel, selecting the coded channel it is encoded in: coded
+// channels 0 to 2*coupledStreams-1 are the left and right channels of the
+// coupled streams, the rest are the uncoupled streams. 255 drops the input
+// channel.
+func (enc *MultistreamEncoder) Init(sample_rate int, channels int, streams int, coupledStreams int,
+	mapping []byte, application Application) error {
+	if enc.p != nil {
+		return ErrAlreadyInitialized
+	}
+	if err := checkMapping(channels, streams, coupledStreams, mapping); err != nil {
+		return err
+	}
+	size := C.opus_multistream_encoder_get_size(C.int(streams), C.int(coupledStreams))
+	if size <= 0 {
+		return ErrBadArg
+	}
+	enc.mem = make([]byte, size)
+	enc.p = (*C.OpusMSEncoder)(unsafe.Pointer(&enc.mem[0]))
+	enc.mapping = append([]byte(nil), mapping...)
+	errno := int(C.opus_multistream_encoder_init(
+		enc.p,
+		C.opus_int32(sample_rate),
+		C.int(channels),
+		C.int(streams),
+		C.int(coupledStreams),
+		(*C.uchar)(&enc.mapping[0]),
+		C.int(application)))
+	if errno != 0 {
+		enc.p = nil
+		return &OpError{
+			Op: "opus_multistream_encoder_init",
+			Args: fmt.Sprintf("Fs=%d, channels=%d, streams=%d, coupled_streams=%d, application=%d",
+				sample_rate, channels, streams, coupledStreams, application),
+			Err: Error(errno),
+		}
+	}
+	enc.channels = channels
+	enc.streams = streams
+	enc.coupledStreams = coupledStreams
+	enc.mappingFamily = 255
+	enc.sample_rate = sample_rate
+	enc.frameDuration = FrameDurationArg
+	return nil
+}
+
+// NewSurroundEncoder allocates a new multistream encoder for the channel
+// layout of the given Ogg Opus channel mapping family, letting libopus choose
+// the streams and the channel mapping. Use Streams, CoupledStreams and Mapping
+// to get the chosen layout, e.g. for the OpusHead.
+//
+// Mapping family 0 supports mono and stereo, family 1 supports 1 to 8 channels
+// in Vorbis channel order, family 2 supports ambisonics and family 255 encodes
+// up to 255 unrelated channels as separate mono streams.
+func NewSurroundEncoder(sample_rate int, channels int, mappingFamily int,
+	application Application) (*MultistreamEncoder, error) {
+	var enc MultistreamEncoder
+	err := enc.InitSurround(sample_rate, channels, mappingFamily, application)
+	if err != nil {
+		return nil, err
+	}
+	return &enc, nil
+}
+
+// InitSurround initializes a pre-allocated multistream encoder for the given
+// channel mapping family. See NewSurroundEncoder.
+func (enc *MultistreamEncoder) InitSurround(sample_rate int, channels int, mappingFamily int,
+	application Application) error {
+	if enc.p != nil {
+		return ErrAlreadyInitialized
+	}
+	if channels < 1 || channels > 255 {
+		return fmt.Errorf("%w: must be 1 to 255, got %d", ErrInvalidChannels, channels)
+	}
+	size := C.opus_multistream_surround_encoder_get_size(C.int(channels), C.int(mappingFamily))
+	if size <= 0 {
+		return fmt.Errorf("%w: %d channels are not supported by mapping family %d",
+			ErrBadArg, channels, mappingFamily)
+	}
+	enc.mem = make([]byte, size)
+	enc.p = (*C.OpusMSEncoder)(unsafe.Pointer(&enc.mem[0]))
+	enc.mapping = make([]byte, channels)
+	var streams, coupledStreams C.int
+	errno := int(C.opus_multistream_surround_encoder_init(
+		enc.p,
+		C.opus_int32(sample_rate),
+		C.int(channels),
+		C.int(mappingFamily),
+		&streams,
+		&coupledStreams,
+		(*C.uchar)(&enc.mapping[0]),
+		C.int(application)))
+	if errno != 0 {
+		enc.p = nil
+		return &OpError{
+			Op: "opus_multistream_surround_encoder_init",
+			Args: fmt.Sprintf("Fs=%d, channels=%d, mapping_family=%d, application=%d",
+				sample_rate, channels, mappingFamily, application),
+			Err: Error(errno),
+		}
+	}
+	enc.channels = channels
+	enc.streams = int(streams)
+	enc.coupledStreams = int(coupledStreams)
+	enc.mappingFamily = mappingFamily
+	enc.sample_rate = sample_rate
+	enc.frameDuration = FrameDurationArg
+	return nil
+}
+
+// NewDiscreteEncoder allocates a new multistream encoder for up to 255
+// unrelated channels, like separate microphones, using Ogg Opus channel
+// mapping family 255. Every channel is encoded in its own mono stream, so no
+// channel leaks into another.
+func NewDiscreteEncoder(sample_rate int, channels int, application Application) (*MultistreamEncoder, error) {
+	return NewSurroundEncoder(sample_rate, channels, 255, application)
+}
+
+// Encode raw interleaved PCM data and store the resulting multistream packet
+// in the supplied buffer. On success, returns the number of bytes used up by
+// the encoded data.
+func (enc *MultistreamEncoder) Encode(pcm []int16, data []byte) (int, error) {
+	if enc.p == nil {
+		return 0, ErrEncoderUninitialized
+	}
+	if len(pcm) == 0 {
+		return 0, ErrNoData
+	}
+	if len(data) == 0 {
+		return 0, ErrTargetBufferEmpty
+	}
+	if len(pcm)%enc.channels != 0 {
+		return 0, ErrBufferChannels
+	}
+	samples := len(pcm) / enc.channels
+	if err := checkFrameDuration(enc.frameDuration, enc.sample_rate, samples); err != nil {
+		return 0, err
+	}
+	n := int(C.opus_multistream_encode(
+		enc.p,
+		(*C.opus_int16)(&pcm[0]),
+		C.int(samples),
+		(*C.uchar)(&data[0]),
+		C.opus_int32(cap(data))))
+	if n < 0 {
+		return 0, &OpError{
+			Op:   "opus_multistream_encode",
+			Args: fmt.Sprintf("frame_size=%d, max_data_bytes=%d", samples, cap(data)),
+			Err:  Error(n),
+		}
+	}
+	return n, nil
+}
+
+// EncodeFloat32 is the same as Encode, but takes float32 PCM data.
+func (enc *MultistreamEncoder) EncodeFloat32(pcm []float32, data []byte) (int, error) {
+	if enc.p == nil {
+		return 0, ErrEncoderUninitialized
+	}
+	if len(pcm) == 0 {
+		return 0, ErrNoData
+	}
+	if len(data) == 0 {
+		return 0, ErrTargetBufferEmpty
+	}
+	if len(pcm)%enc.channels != 0 {
+		return 0, ErrBufferChannels
+	}
+	samples := len(pcm) / enc.channels
+	if err := checkFrameDuration(enc.frameDuration, enc.sample_rate, samples); err != nil {
+		return 0, err
+	}
+	n := int(C.opus_multistream_encode_float(
+		enc.p,
+		(*C.float)(&pcm[0]),
+		C.int(samples),
+		(*C.uchar)(&data[0]),
+		C.opus_int32(cap(data))))
+	if n < 0 {
+		return 0, &OpError{
+			Op:   "opus_multistream_encode_float",
+			Args: fmt.Sprintf("frame_size=%d, max_data_bytes=%d", samples, cap(data)),
+			Err:  Error(n),
+		}
+	}
+	return n, nil
+}
+
+// Channels returns the number of input channels.
+func (enc *MultistreamEncoder) Channels() int {
+	return enc.channels
+}
+
+// Streams returns the total number of Opus streams in each packet.
+func (enc *MultistreamEncoder) Streams() int {
+	return enc.streams
+}
+
+// CoupledStreams returns the number of stereo streams in each packet.
+func (enc *MultistreamEncoder) CoupledStreams() int {
+	return enc.coupledStreams
+}
+
+// Mapping returns a copy of the channel mapping.
+func (enc *MultistreamEncoder) Mapping() []byte {
+	return append([]byte(nil), enc.mapping...)
+}
+
+// MappingFamily returns the Ogg Opus channel mapping family of the encoder:
+// the family passed to NewSurroundEncoder, or 255 for an explicit stream
+// layout.
+func (enc *MultistreamEncoder) MappingFamily() int {
+	return enc.mappingFamily
+}
+
+// Head returns the header of an Ogg Opus stream encoded by this encoder. The
+// pre-skip is the encoder lookahead.
+func (enc *MultistreamEncoder) Head() (*Head, error) {
+	if enc.p == nil {
+		return nil, ErrEncoderUninitialized
+	}
+	lookahead, err := enc.Lookahead()
+	if err != nil {
+		return nil, err
+	}
+	head := &Head{
+		Version:         1,
+		Channels:        enc.channels,
+		PreSkip:         lookahead * 48000 / enc.sample_rate,
+		InputSampleRate: enc.sample_rate,
+		MappingFamily:   enc.mappingFamily,
+	}
+	if enc.mappingFamily != 0 {
+		head.Streams = enc.streams
+		head.CoupledStreams = enc.coupledStreams
+		head.Mapping = enc.Mapping()
+	}
+	return head, nil
+}
+
+// SetBitrate sets the total bitrate of all streams.
+func (enc *MultistreamEncoder) SetBitrate(bitrate int) error {
+	res := C.bridge_ms_encoder_set_bitrate(enc.p, C.opus_int32(bitrate))
+	if res != C.OPUS_OK {
+		return &OpError{
+			Op:   "opus_multistream_encoder_ctl",
+			Args: fmt.Sprintf("OPUS_SET_BITRATE(%d)", bitrate),
+			Err:  Error(res),
+		}
+	}
+	return nil
+}
+
+// SetBitrateToAuto will allow the encoder to automatically set the bitrate
+func (enc *MultistreamEncoder) SetBitrateToAuto() error {
+	res := C.bridge_ms_encoder_set_bitrate(enc.p, C.opus_int32(C.OPUS_AUTO))
+	if res != C.OPUS_OK {
+		return &OpError{
+			Op:   "opus_multistream_encoder_ctl",
+			Args: "OPUS_SET_BITRATE(OPUS_AUTO)",
+			Err:  Error(res),
+		}
+	}
+	return nil
+}
+
+// SetBitrateToMax causes the encoder to use as much rate as it can.
+func (enc *MultistreamEncoder) SetBitrateToMax() error {
+	res := C.bridge_ms_encoder_set_bitrate(enc.p, C.opus_int32(C.OPUS_BITRATE_MAX))
+	if res != C.OPUS_OK {
+		return &OpError{
+			Op:   "opus_multistream_encoder_ctl",
+			Args: "OPUS_SET_BITRATE(OPUS_BITRATE_MAX)",
+			Err:  Error(res),
+		}
+	}
+	return nil
+}
+
+// Bitrate returns the total bitrate of all streams.
+func (enc *MultistreamEncoder) Bitrate() (int, error) {
+	var bitrate C.opus_int32
+	res := C.bridge_ms_encoder_get_bitrate(enc.p, &bitrate)
+	if res != C.OPUS_OK {
+		return 0, &OpError{
+			Op:   "opus_multistream_encoder_ctl",
+			Args: "OPUS_GET_BITRATE",
+			Err:  Error(res),
+		}
+	}
+	return int(bitrate), nil
+}
+
+// SetComplexity sets the encoder's computational complexity for all streams.
+func (enc *MultistreamEncoder) SetComplexity(complexity int) error {
+	res := C.bridge_ms_encoder_set_complexity(enc.p, C.opus_int32(complexity))
+	if res != C.OPUS_OK {
+		return &OpError{
+			Op:   "opus_multistream_encoder_ctl",
+			Args: fmt.Sprintf("OPUS_SET_COMPLEXITY(%d)", complexity),
+			Err:  Error(res),
+		}
+	}
+	return nil
+}
+
+// Complexity returns the computational complexity used by the encoder.
+func (enc *MultistreamEncoder) Complexity() (int, error) {
+	var complexity C.opus_int32
+	res := C.bridge_ms_encoder_get_complexity(enc.p, &complexity)
+	if res != C.OPUS_OK {
+		return 0, &OpError{
+			Op:   "opus_multistream_encoder_ctl",
+			Args: "OPUS_GET_COMPLEXITY",
+			Err:  Error(res),
+		}
+	}
+	return int(complexity), nil
+}
+
+// SetMaxBandwidth configures the maximum bandpass that the encoder will
+// select automatically.
+func (enc *MultistreamEncoder) SetMaxBandwidth(maxBw Bandwidth) error {
+	res := C.bridge_ms_encoder_set_max_bandwidth(enc.p, C.opus_int32(maxBw))
+	if res != C.OPUS_OK {
+		return &OpError{
+			Op:   "opus_multistream_encoder_ctl",
+			Args: fmt.Sprintf("OPUS_SET_MAX_BANDWIDTH(%d)", maxBw),
+			Err:  Error(res),
+		}
+	}
+	return nil
+}
+
+// MaxBandwidth returns the maximum allowed bandpass value.
+func (enc *MultistreamEncoder) MaxBandwidth() (Bandwidth, error) {
+	var maxBw C.opus_int32
+	res := C.bridge_ms_encoder_get_max_bandwidth(enc.p, &maxBw)
+	if res != C.OPUS_OK {
+		return 0, &OpError{
+			Op:   "opus_multistream_encoder_ctl",
+			Args: "OPUS_GET_MAX_BANDWIDTH",
+			Err:  Error(res),
+		}
+	}
+	return Bandwidth(maxBw), nil
+}
+
+// SetBandwidth sets the bandpass of all streams, see Encoder.SetBandwidth.
+func (enc *MultistreamEncoder) SetBandwidth(bw Bandwidth) error {
+	res := C.bridge_ms_encoder_set_bandwidth(enc.p, C.opus_int32(bw))
+	if res != C.OPUS_OK {
+		return &OpError{
+			Op:   "opus_multistream_encoder_ctl",
+			Args: fmt.Sprintf("OPUS_SET_BANDWIDTH(%d)", bw),
+			Err:  Error(res),
+		}
+	}
+	return nil
+}
+
+// Bandwidth returns the bandpass of the most recently encoded packet.
+func (enc *MultistreamEncoder) Bandwidth() (Bandwidth, error) {
+	var bw C.opus_int32
+	res := C.bridge_ms_encoder_get_bandwidth(enc.p, &bw)
+	if res != C.OPUS_OK {
+		return 0, &OpError{
+			Op:   "opus_multistream_encoder_ctl",
+			Args: "OPUS_GET_BANDWIDTH",
+			Err:  Error(res),
+		}
+	}
+	return Bandwidth(bw), nil
+}
+
+// SetInBandFEC configures the encoder's use of inband forward error
+// correction (FEC).
+func (enc *MultistreamEncoder) SetInBandFEC(fec bool) error {
+	i := 0
+	if fec {
+		i = 1
+	}
+	res := C.bridge_ms_encoder_set_inband_fec(enc.p, C.opus_int32(i))
+	if res != C.OPUS_OK {
+		return &OpError{
+			Op:   "opus_multistream_encoder_ctl",
+			Args: fmt.Sprintf("OPUS_SET_INBAND_FEC(%d)", i),
+			Err:  Error(res),
+		}
+	}
+	return nil
+}
+
+// InBandFEC gets the encoder's configured inband forward error correction
+// (FEC).
+func (enc *MultistreamEncoder) InBandFEC() (bool, error) {
+	var fec C.opus_int32
+	res := C.bridge_ms_encoder_get_inband_fec(enc.p, &fec)
+	if res != C.OPUS_OK {
+		return false, &OpError{
+			Op:   "opus_multistream_encoder_ctl",
+			Args: "OPUS_GET_INBAND_FEC",
+			Err:  Error(res),
+		}
+	}
+	return fec != 0, nil
+}
+
+// SetPacketLossPerc configures the encoder's expected packet loss percentage.
+func (enc *MultistreamEncoder) SetPacketLossPerc(lossPerc int) error {
+	res := C.bridge_ms_encoder_set_packet_loss_perc(enc.p, C.opus_int32(lossPerc))
+	if res != C.OPUS_OK {
+		return &OpError{
+			Op:   "opus_multistream_encoder_ctl",
+			Args: fmt.Sprintf("OPUS_SET_PACKET_LOSS_PERC(%d)", lossPerc),
+			Err:  Error(res),
+		}
+	}
+	return nil
+}
+
+// PacketLossPerc gets the encoder's configured packet loss percentage.
+func (enc *MultistreamEncoder) PacketLossPerc() (int, error) {
+	var lossPerc C.opus_int32
+	res := C.bridge_ms_encoder_get_packet_loss_perc(enc.p, &lossPerc)
+	if res != C.OPUS_OK {
+		return 0, &OpError{
+			Op:   "opus_multistream_encoder_ctl",
+			Args: "OPUS_GET_PACKET_LOSS_PERC",
+			Err:  Error(res),
+		}
+	}
+	return int(lossPerc), nil
+}
+
+// SetDTX configures the encoder's use of discontinuous transmission (DTX).
+func (enc *MultistreamEncoder) SetDTX(dtx bool) error {
+	i := 0
+	if dtx {
+		i = 1
+	}
+	res := C.bridge_ms_encoder_set_dtx(enc.p, C.opus_int32(i))
+	if res != C.OPUS_OK {
+		return &OpError{
+			Op:   "opus_multistream_encoder_ctl",
+			Args: fmt.Sprintf("OPUS_SET_DTX(%d)", i),
+			Err:  Error(res),
+		}
+	}
+	return nil
+}
+
+// DTX reports whether this encoder is configured to use discontinuous
+// transmission (DTX).
+func (enc *MultistreamEncoder) DTX() (bool, error) {
+	var dtx C.opus_int32
+	res := C.bridge_ms_encoder_get_dtx(enc.p, &dtx)
+	if res != C.OPUS_OK {
+		return false, &OpError{
+			Op:   "opus_multistream_encoder_ctl",
+			Args: "OPUS_GET_DTX",
+			Err:  Error(res),
+		}
+	}
+	return dtx != 0, nil
+}
+
+// SetVBR configures whether the encoder uses variable bitrate (VBR).
+func (enc *MultistreamEncoder) SetVBR(vbr bool) error {
+	i := 0
+	if vbr {
+		i = 1
+	}
+	res := C.bridge_ms_encoder_set_vbr(enc.p, C.opus_int32(i))
+	if res != C.OPUS_OK {
+		return &OpError{
+			Op:   "opus_multistream_encoder_ctl",
+			Args: fmt.Sprintf("OPUS_SET_VBR(%d)", i),
+			Err:  Error(res),
+		}
+	}
+	return nil
+}
+
+// VBR reports whether the encoder uses variable bitrate (VBR).
+func (enc *MultistreamEncoder) VBR() (bool, error) {
+	var vbr C.opus_int32
+	res := C.bridge_ms_encoder_get_vbr(enc.p, &vbr)
+	if res != C.OPUS_OK {
+		return false, &OpError{
+			Op:   "opus_multistream_encoder_ctl",
+			Args: "OPUS_GET_VBR",
+			Err:  Error(res),
+		}
+	}
+	return vbr != 0, nil
+}
+
+// SetVBRConstraint configures whether VBR is constrained, see
+// Encoder.SetVBRConstraint.
+func (enc *MultistreamEncoder) SetVBRConstraint(constraint bool) error {
+	i := 0
+	if constraint {
+		i = 1
+	}
+	res := C.bridge_ms_encoder_set_vbr_constraint(enc.p, C.opus_int32(i))
+	if res != C.OPUS_OK {
+		return &OpError{
+			Op:   "opus_multistream_encoder_ctl",
+			Args: fmt.Sprintf("OPUS_SET_VBR_CONSTRAINT(%d)", i),
+			Err:  Error(res),
+		}
+	}
+	return nil
+}
+
+// VBRConstraint reports whether VBR is constrained.
+func (enc *MultistreamEncoder) VBRConstraint() (bool, error) {
+	var constraint C.opus_int32
+	res := C.bridge_ms_encoder_get_vbr_constraint(enc.p, &constraint)
+	if res != C.OPUS_OK {
+		return false, &OpError{
+			Op:   "opus_multistream_encoder_ctl",
+			Args: "OPUS_GET_VBR_CONSTRAINT",
+			Err:  Error(res),
+		}
+	}
+	return constraint != 0, nil
+}
+
+// SetSignal hints the encoder about the type of audio, see Encoder.SetSignal.
+func (enc *MultistreamEncoder) SetSignal(signal Signal) error {
+	res := C.bridge_ms_encoder_set_signal(enc.p, C.opus_int32(signal))
+	if res != C.OPUS_OK {
+		return &OpError{
+			Op:   "opus_multistream_encoder_ctl",
+			Args: fmt.Sprintf("OPUS_SET_SIGNAL(%d)", signal),
+			Err:  Error(res),
+		}
+	}
+	return nil
+}
+
+// Signal returns the configured signal type.
+func (enc *MultistreamEncoder) Signal() (Signal, error) {
+	var signal C.opus_int32
+	res := C.bridge_ms_encoder_get_signal(enc.p, &signal)
+	if res != C.OPUS_OK {
+		return 0, &OpError{
+			Op:   "opus_multistream_encoder_ctl",
+			Args: "OPUS_GET_SIGNAL",
+			Err:  Error(res),
+		}
+	}
+	return Signal(signal), nil
+}
+
+// SetApplication changes the application of all streams, see
+// Encoder.SetApplication.
+func (enc *MultistreamEncoder) SetApplication(application Application) error {
+	res := C.bridge_ms_encoder_set_application(enc.p, C.opus_int32(application))
+	if res != C.OPUS_OK {
+		return &OpError{
+			Op:   "opus_multistream_encoder_ctl",
+			Args: fmt.Sprintf("OPUS_SET_APPLICATION(%d)", application),
+			Err:  Error(res),
+		}
+	}
+	return nil
+}
+
+// Application returns the configured application.
+func (enc *MultistreamEncoder) Application() (Application, error) {
+	var application C.opus_int32
+	res := C.bridge_ms_encoder_get_application(enc.p, &application)
+	if res != C.OPUS_OK {
+		return 0, &OpError{
+			Op:   "opus_multistream_encoder_ctl",
+			Args: "OPUS_GET_APPLICATION",
+			Err:  Error(res),
+		}
+	}
+	return Application(application), nil
+}
+
+// SetLSBDepth sets the depth of the input signal, see Encoder.SetLSBDepth.
+func (enc *MultistreamEncoder) SetLSBDepth(depth int) error {
+	res := C.bridge_ms_encoder_set_lsb_depth(enc.p, C.opus_int32(depth))
+	if res != C.OPUS_OK {
+		return &OpError{
+			Op:   "opus_multistream_encoder_ctl",
+			Args: fmt.Sprintf("OPUS_SET_LSB_DEPTH(%d)", depth),
+			Err:  Error(res),
+		}
+	}
+	return nil
+}
+
+// LSBDepth returns the configured depth of the input signal.
+func (enc *MultistreamEncoder) LSBDepth() (int, error) {
+	var depth C.opus_int32
+	res := C.bridge_ms_encoder_get_lsb_depth(enc.p, &depth)
+	if res != C.OPUS_OK {
+		return 0, &OpError{
+			Op:   "opus_multistream_encoder_ctl",
+			Args: "OPUS_GET_LSB_DEPTH",
+			Err:  Error(res),
+		}
+	}
+	return int(depth), nil
+}
+
+// SetPredictionDisabled configures whether the encoder avoids prediction
+// between frames, see Encoder.SetPredictionDisabled.
+func (enc *MultistreamEncoder) SetPredictionDisabled(disabled bool) error {
+	i := 0
+	if disabled {
+		i = 1
+	}
+	res := C.bridge_ms_encoder_set_prediction_disabled(enc.p, C.opus_int32(i))
+	if res != C.OPUS_OK {
+		return &OpError{
+			Op:   "opus_multistream_encoder_ctl",
+			Args: fmt.Sprintf("OPUS_SET_PREDICTION_DISABLED(%d)", i),
+			Err:  Error(res),
+		}
+	}
+	return nil
+}
+
+// PredictionDisabled reports whether prediction between frames is disabled.
+func (enc *MultistreamEncoder) PredictionDisabled() (bool, error) {
+	var disabled C.opus_int32
+	res := C.bridge_ms_encoder_get_prediction_disabled(enc.p, &disabled)
+	if res != C.OPUS_OK {
+		return false, &OpError{
+			Op:   "opus_multistream_encoder_ctl",
+			Args: "OPUS_GET_PREDICTION_DISABLED",
+			Err:  Error(res),
+		}
+	}
+	return disabled != 0, nil
+}
+
+// SetPhaseInversionDisabled configures whether the encoder may use phase
+// inversion for intensity stereo, see Encoder.SetPhaseInversionDisabled.
+func (enc *MultistreamEncoder) SetPhaseInversionDisabled(disabled bool) error {
+	i := 0
+	if disabled {
+		i = 1
+	}
+	res := C.bridge_ms_encoder_set_phase_inversion_disabled(enc.p, C.opus_int32(i))
+	if res != C.OPUS_OK {
+		return &OpError{
+			Op:   "opus_multistream_encoder_ctl",
+			Args: fmt.Sprintf("OPUS_SET_PHASE_INVERSION_DISABLED(%d)", i),
+			Err:  Error(res),
+		}
+	}
+	return nil
+}
+
+// PhaseInversionDisabled reports whether phase inversion is disabled.
+func (enc *MultistreamEncoder) PhaseInversionDisabled() (bool, error) {
+	var disabled C.opus_int32
+	res := C.bridge_ms_encoder_get_phase_inversion_disabled(enc.p, &disabled)
+	if res != C.OPUS_OK {
+		return false, &OpError{
+			Op:   "opus_multistream_encoder_ctl",
+			Args: "OPUS_GET_PHASE_INVERSION_DISABLED",
+			Err:  Error(res),
+		}
+	}
+	return disabled != 0, nil
+}
+
+// SetExpertFrameDuration configures the frame duration, see
+// Encoder.SetExpertFrameDuration.
+func (enc *MultistreamEncoder) SetExpertFrameDuration(duration FrameDuration) error {
+	res := C.bridge_ms_encoder_set_expert_frame_duration(enc.p, C.opus_int32(duration))
+	if res != C.OPUS_OK {
+		return &OpError{
+			Op:   "opus_multistream_encoder_ctl",
+			Args: fmt.Sprintf("OPUS_SET_EXPERT_FRAME_DURATION(%d)", duration),
+			Err:  Error(res),
+		}
+	}
+	enc.frameDuration = duration
+	return nil
+}
+
+// ExpertFrameDuration returns the configured frame duration.
+func (enc *MultistreamEncoder) ExpertFrameDuration() (FrameDuration, error) {
+	var duration C.opus_int32
+	res := C.bridge_ms_encoder_get_expert_frame_duration(enc.p, &duration)
+	if res != C.OPUS_OK {
+		return 0, &OpError{
+			Op:   "opus_multistream_encoder_ctl",
+			Args: "OPUS_GET_EXPERT_FRAME_DURATION",
+			Err:  Error(res),
+		}
+	}
+	return FrameDuration(duration), nil
+}
+
+// Lookahead returns the number of samples of delay added by the encoder, at
+// the encoder sample rate.
+func (enc *MultistreamEncoder) Lookahead() (int, error) {
+	var lookahead C.opus_int32
+	res := C.bridge_ms_encoder_get_lookahead(enc.p, &lookahead)
+	if res != C.OPUS_OK {
+		return 0, &OpError{
+			Op:   "opus_multistream_encoder_ctl",
+			Args: "OPUS_GET_LOOKAHEAD",
+			Err:  Error(res),
+		}
+	}
+	return int(lookahead), nil
+}
+
+// SampleRate returns the encoder sample rate in Hz.
+func (enc *MultistreamEncoder) SampleRate() (int, error) {
+	var sampleRate C.opus_int32
+	res := C.bridge_ms_encoder_get_sample_rate(enc.p, &sampleRate)
+	if res != C.OPUS_OK {
+		return 0, &OpError{
+			Op:   "opus_multistream_encoder_ctl",
+			Args: "OPUS_GET_SAMPLE_RATE",
+			Err:  Error(res),
+		}
+	}
+	return int(sampleRate), nil
+}
+
+// FinalRange returns the final state of the range coders of the most recently
+// encoded packet, combined over all streams. See Encoder.FinalRange.
+func (enc *MultistreamEncoder) FinalRange() (uint32, error) {
+	var finalRange C.opus_uint32
+	res := C.bridge_ms_encoder_get_final_range(enc.p, &finalRange)
+	if res != C.OPUS_OK {
+		return 0, &OpError{
+			Op:   "opus_multistream_encoder_ctl",
+			Args: "OPUS_GET_FINAL_RANGE",
+			Err:  Error(res),
+		}
+	}
+	return uint32(finalRange), nil
+}
+
+// Reset resets the codec state of all streams to be equivalent to a freshly
+// initialized state.
+func (enc *MultistreamEncoder) Reset() error {
+	res := C.bridge_ms_encoder_reset_state(enc.p)
+	if res != C.OPUS_OK {
+		return &OpError{
+			Op:   "opus_multistream_encoder_ctl",
+			Args: "OPUS_RESET_STATE",
+			Err:  Error(res),
+		}
+	}
+	return nil
+}
+
+// CtlInt32 performs a ctl that takes a single opus_int32 value. See
+// Encoder.CtlInt32.
+func (enc *MultistreamEncoder) CtlInt32(request int, value int32) error {
+	if enc.p == nil {
+		return ErrEncoderUninitialized
+	}
+	if err := checkCtl(request, false); err != nil {
+		return err
+	}
+	if request == int(C.OPUS_SET_EXPERT_FRAME_DURATION_REQUEST) {
+		return enc.SetExpertFrameDuration(FrameDuration(value))
+	}
+	res := C.bridge_ms_encoder_set_int32(enc.p, C.int(request), C.opus_int32(value))
+	if res != C.OPUS_OK {
+		return &OpError{
+			Op:   "opus_multistream_encoder_ctl",
+			Args: fmt.Sprintf("%d, %d", request, value),
+			Err:  Error(res),
+		}
+	}
+	return nil
+}
+
+// CtlGetInt32 performs a ctl that returns a single opus_int32 value. See
+// Encoder.CtlGetInt32.
+func (enc *MultistreamEncoder) CtlGetInt32(request int) (int32, error) {
+	if enc.p == nil {
+		return 0, ErrEncoderUninitialized
+	}
+	if err := checkCtl(request, true); err != nil {
+		return 0, err
+	}
+	var value C.opus_int32
+	res := C.bridge_ms_encoder_get_int32(enc.p, C.int(request), &value)
+	if res != C.OPUS_OK {
+		return 0, &OpError{
+			Op:   "opus_multistream_encoder_ctl",
+			Args: fmt.Sprintf("%d", request),
+			Err:  Error(res),
+		}
+	}
+	return int32(value), nil
+}
+
+// CtlGetUint32 performs a ctl that returns a single opus_uint32 value.
+func (enc *MultistreamEncoder) CtlGetUint32(request int) (uint32, error) {
+	if enc.p == nil {
+		return 0, ErrEncoderUninitialized
+	}
+	if err := checkCtl(request, true); err != nil {
+		return 0, err
+	}
+	var value C.opus_uint32
+	res := C.bridge_ms_encoder_get_uint32(enc.p, C.int(request), &value)
+	if res != C.OPUS_OK {
+		return 0, &OpError{
+			Op:   "opus_multistream_encoder_ctl",
+			Args: fmt.Sprintf("%d", request),
+			Err:  Error(res),
+		}
+	}
+	return uint32(value), nil
+}
+
+// Ctl performs a ctl that takes no argument. The only such request is
+// OPUS_RESET_STATE (4028); any other request returns ErrBadArg.
+func (enc *MultistreamEncoder) Ctl(request int) error {
+	if enc.p == nil {
+		return ErrEncoderUninitialized
+	}
+	if err := checkNoArgCtl(request); err != nil {
+		return err
+	}
+	res := C.bridge_ms_encoder_ctl(enc.p, C.int(request))
+	if res != C.OPUS_OK {
+		return &OpError{
+			Op:   "opus_multistream_encoder_ctl",
+			Args: fmt.Sprintf("%d", request),
+			Err:  Error(res),
+		}
+	}
+	return nil
+}
+
+// MultistreamDecoder contains the state of a libopus multistream decoder, the
+// counterpart of MultistreamEncoder.
+type MultistreamDecoder struct {
+	p              *C.struct_OpusMSDecoder
+	channels       int
+	streams        int
+	coupledStreams int
+	mapping        []byte
+	sample_rate    int
+	// Same purpose as encoder struct
+	mem []byte
+}
+
+// NewMultistreamDecoder allocates a new multistream decoder and initializes
+// it with the given stream layout. See Init.
+func NewMultistreamDecoder(sample_rate int, channels int, streams int, coupledStreams int,
+	mapping []byte) (*MultistreamDecoder, error) {
+	var dec MultistreamDecoder
+	err := dec.Init(sample_rate, channels, streams, coupledStreams, mapping)
+	if err != nil {
+		return nil, err
+	}
+	return &dec, nil
+}
+
+// NewDiscreteDecoder allocates a new multistream decoder for a stream encoded
+// by NewDiscreteEncoder: one mono stream per channel, in order.
+func NewDiscreteDecoder(sample_rate int, channels int) (*MultistreamDecoder, error) {
+	if channels < 1 || channels > 255 {
+		return nil, fmt.Errorf("%w: must be 1 to 255, got %d", ErrInvalidChannels, channels)
+	}
+	mapping := make([]byte, channels)
+	for i := range mapping {
+		mapping[i] = byte(i)
+	}
+	return NewMultistreamDecoder(sample_rate, channels, channels, 0, mapping)
+}
+
+// Init initializes a pre-allocated multistream decoder. The mapping has one
+// entry per output channel, selecting the decoded channel to play on it, as
+// described for MultistreamEncoder.Init. 255 makes the output channel silent.
+func (dec *MultistreamDecoder) Init(sample_rate int, channels int, streams int, coupledStreams int,
+	mapping []byte) error {
+	if dec.p != nil {
+		return ErrAlreadyInitialized
+	}
+	if err := checkMapping(channels, streams, coupledStreams, mapping); err != nil {
+		return err
+	}
+	size := C.opus_multistream_decoder_get_size(C.int(streams), C.int(coupledStreams))
+	if size <= 0 {
+		return ErrBadArg
+	}
+	dec.mem = make([]byte, size)
+	dec.p = (*C.OpusMSDecoder)(unsafe.Pointer(&dec.mem[0]))
+	dec.mapping = append([]byte(nil), mapping...)
+	errno := int(C.opus_multistream_decoder_init(
+		dec.p,
+		C.opus_int32(sample_rate),
+		C.int(channels),
+		C.int(streams),
+		C.int(coupledStreams),
+		(*C.uchar)(&dec.mapping[0])))
+	if errno != 0 {
+		dec.p = nil
+		return &OpError{
+			Op: "opus_multistream_decoder_init",
+			Args: fmt.Sprintf("Fs=%d, channels=%d, streams=%d, coupled_streams=%d",
+				sample_rate, channels, streams, coupledStreams),
+			Err: Error(errno),
+		}
+	}
+	dec.channels = channels
+	dec.streams = streams
+	dec.coupledStreams = coupledStreams
+	dec.sample_rate = sample_rate
+	return nil
+}
+
+// decode wraps opus_multistream_decode. A nil packet conceals a lost packet.
+func (dec *MultistreamDecoder) decode(data []byte, pcm []int16, fec bool) (int, error) {
+	if dec.p == nil {
+		return 0, ErrDecoderUninitialized
+	}
+	if len(pcm) == 0 {
+		return 0, ErrTargetBufferEmpty
+	}
+	if cap(pcm)%dec.channels != 0 {
+		return 0, ErrBufferChannels
+	}
+	var ptr *C.uchar
+	if len(data) > 0 {
+		ptr = (*C.uchar)(&data[0])
+	}
+	decodeFEC := 0
+	if fec {
+		decodeFEC = 1
+	}
+	n := int(C.opus_multistream_decode(
+		dec.p,
+		ptr,
+		C.opus_int32(len(data)),
+		(*C.opus_int16)(&pcm[0]),
+		C.int(cap(pcm)/dec.channels),
+		C.int(decodeFEC)))
+	if n < 0 {
+		return 0, &OpError{
+			Op: "opus_multistream_decode",
+			Args: fmt.Sprintf("len=%d, frame_size=%d, decode_fec=%d",
+				len(data), cap(pcm)/dec.channels, decodeFEC),
+			Err: Error(n),
+		}
+	}
+	return n, nil
+}
+
+// decodeFloat32 wraps opus_multistream_decode_float.
+func (dec *MultistreamDecoder) decodeFloat32(data []byte, pcm []float32, fec bool) (int, error) {
+	if dec.p == nil {
+		return 0, ErrDecoderUninitialized
+	}
+	if len(pcm) == 0 {
+		return 0, ErrTargetBufferEmpty
+	}
+	if cap(pcm)%dec.channels != 0 {
+		return 0, ErrBufferChannels
+	}
+	var ptr *C.uchar
+	if len(data) > 0 {
+		ptr = (*C.uchar)(&data[0])
+	}
+	decodeFEC := 0
+	if fec {
+		decodeFEC = 1
+	}
+	n := int(C.opus_multistream_decode_float(
+		dec.p,
+		ptr,
+		C.opus_int32(len(data)),
+		(*C.float)(&pcm[0]),
+		C.int(cap(pcm)/dec.channels),
+		C.int(decodeFEC)))
+	if n < 0 {
+		return 0, &OpError{
+			Op: "opus_multistream_decode_float",
+			Args: fmt.Sprintf("len=%d, frame_size=%d, decode_fec=%d",
+				len(data), cap(pcm)/dec.channels, decodeFEC),
+			Err: Error(n),
+		}
+	}
+	return n, nil
+}
+
+// Decode a multistream packet into the supplied buffer as interleaved PCM
+// data. On success, returns the number of samples per channel written to the
+// target buffer.
+func (dec *MultistreamDecoder) Decode(data []byte, pcm []int16) (int, error) {
+	if len(data) == 0 {
+		return 0, ErrNoData
+	}
+	return dec.decode(data, pcm, false)
+}
+
+// DecodeFloat32 is the same as Decode, but decodes to float32 PCM data.
+func (dec *MultistreamDecoder) DecodeFloat32(data []byte, pcm []float32) (int, error) {
+	if len(data) == 0 {
+		return 0, ErrNoData
+	}
+	return dec.decodeFloat32(data, pcm, false)
+}
+
+// DecodeFEC recovers a lost packet from the forward error correction data in
+// the packet directly following it. See Decoder.DecodeFEC.
+func (dec *MultistreamDecoder) DecodeFEC(data []byte, pcm []int16) error {
+	if len(data) == 0 {
+		return ErrNoData
+	}
+	_, err := dec.decode(data, pcm, true)
+	return err
+}
+
+// DecodeFECFloat32 is the same as DecodeFEC, but decodes to float32 PCM data.
+func (dec *MultistreamDecoder) DecodeFECFloat32(data []byte, pcm []float32) error {
+	if len(data) == 0 {
+		return ErrNoData
+	}
+	_, err := dec.decodeFloat32(data, pcm, true)
+	return err
+}
+
+// DecodePLC conceals a lost packet using packet loss concealment. See
+// Decoder.DecodePLC.
+func (dec *MultistreamDecoder) DecodePLC(pcm []int16) error {
+	_, err := dec.decode(nil, pcm, false)
+	return err
+}
+
+// DecodePLCFloat32 is the same as DecodePLC, but decodes to float32 PCM data.
+func (dec *MultistreamDecoder) DecodePLCFloat32(pcm []float32) error {
+	_, err := dec.decodeFloat32(nil, pcm, false)
+	return err
+}
+
+// Channels returns the number of output channels.
+func (dec *MultistreamDecoder) Channels() int {
+	return dec.channels
+}
+
+// Streams returns the total number of Opus streams in each packet.
+func (dec *MultistreamDecoder) Streams() int {
+	return dec.streams
+}
+
+// CoupledStreams returns the number of stereo streams in each packet.
+func (dec *MultistreamDecoder) CoupledStreams() int {
+	return dec.coupledStreams
+}
+
+// Mapping returns a copy of the channel mapping.
+func (dec *MultistreamDecoder) Mapping() []byte {
+	return append([]byte(nil), dec.mapping...)
+}
+
+// LastPacketDuration gets the duration (in samples) of the last packet
+// successfully decoded or concealed.
+func (dec *MultistreamDecoder) LastPacketDuration() (int, error) {
+	var samples C.opus_int32
+	res := C.bridge_ms_decoder_get_last_packet_duration(dec.p, &samples)
+	if res != C.OPUS_OK {
+		return 0, &OpError{
+			Op:   "opus_multistream_decoder_ctl",
+			Args: "OPUS_GET_LAST_PACKET_DURATION",
+			Err:  Error(res),
+		}
+	}
+	return int(samples), nil
+}
+
+// SetGain configures the output gain in Q8 dB units, see Decoder.SetGain.
+func (dec *MultistreamDecoder) SetGain(gain int) error {
+	res := C.bridge_ms_decoder_set_gain(dec.p, C.opus_int32(gain))
+	if res != C.OPUS_OK {
+		return &OpError{
+			Op:   "opus_multistream_decoder_ctl",
+			Args: fmt.Sprintf("OPUS_SET_GAIN(%d)", gain),
+			Err:  Error(res),
+		}
+	}
+	return nil
+}
+
+// Gain returns the configured output gain in Q8 dB units.
+func (dec *MultistreamDecoder) Gain() (int, error) {
+	var gain C.opus_int32
+	res := C.bridge_ms_decoder_get_gain(dec.p, &gain)
+	if res != C.OPUS_OK {
+		return 0, &OpError{
+			Op:   "opus_multistream_decoder_ctl",
+			Args: "OPUS_GET_GAIN",
+			Err:  Error(res),
+		}
+	}
+	return int(gain), nil
+}
+
+// Bandwidth returns the bandwidth of the most recently decoded packet.
+func (dec *MultistreamDecoder) Bandwidth() (Bandwidth, error) {
+	var bw C.opus_int32
+	res := C.bridge_ms_decoder_get_bandwidth(dec.p, &bw)
+	if res != C.OPUS_OK {
+		return 0, &OpError{
+			Op:   "opus_multistream_decoder_ctl",
+			Args: "OPUS_GET_BANDWIDTH",
+			Err:  Error(res),
+		}
+	}
+	return Bandwidth(bw), nil
+}
+
+// SampleRate returns the decoder sample rate in Hz.
+func (dec *MultistreamDecoder) SampleRate() (int, error) {
+	var sampleRate C.opus_int32
+	res := C.bridge_ms_decoder_get_sample_rate(dec.p, &sampleRate)
+	if res != C.OPUS_OK {
+		return 0, &OpError{
+			Op:   "opus_multistream_decoder_ctl",
+			Args: "OPUS_GET_SAMPLE_RATE",
+			Err:  Error(res),
+		}
+	}
+	return int(sampleRate), nil
+}
+
+// SetPhaseInversionDisabled configures whether phase inversion is disabled,
+// see Decoder.SetPhaseInversionDisabled.
+func (dec *MultistreamDecoder) SetPhaseInversionDisabled(disabled bool) error {
+	i := 0
+	if disabled {
+		i = 1
+	}
+	res := C.bridge_ms_decoder_set_phase_inversion_disabled(dec.p, C.opus_int32(i))
+	if res != C.OPUS_OK {
+		return &OpError{
+			Op:   "opus_multistream_decoder_ctl",
+			Args: fmt.Sprintf("OPUS_SET_PHASE_INVERSION_DISABLED(%d)", i),
+			Err:  Error(res),
+		}
+	}
+	return nil
+}
+
+// PhaseInversionDisabled reports whether phase inversion is disabled.
+func (dec *MultistreamDecoder) PhaseInversionDisabled() (bool, error) {
+	var disabled C.opus_int32
+	res := C.bridge_ms_decoder_get_phase_inversion_disabled(dec.p, &disabled)
+	if res != C.OPUS_OK {
+		return false, &OpError{
+			Op:   "opus_multistream_decoder_ctl",
+			Args: "OPUS_GET_PHASE_INVERSION_DISABLED",
+			Err:  Error(res),
+		}
+	}
+	return disabled != 0, nil
+}
+
+// FinalRange returns the final state of the range decoders after the most
+// recently decoded packet, combined over all streams.
+func (dec *MultistreamDecoder) FinalRange() (uint32, error) {
+	var finalRange C.opus_uint32
+	res := C.bridge_ms_decoder_get_final_range(dec.p, &finalRange)
+	if res != C.OPUS_OK {
+		return 0, &OpError{
+			Op:   "opus_multistream_decoder_ctl",
+			Args: "OPUS_GET_FINAL_RANGE",
+			Err:  Error(res),
+		}
+	}
+	return uint32(finalRange), nil
+}
+
+// Reset resets the decoder state of all streams, e.g. after a discontinuity in
+// the stream.
+func (dec *MultistreamDecoder) Reset() error {
+	res := C.bridge_ms_decoder_reset_state(dec.p)
+	if res != C.OPUS_OK {
+		return &OpError{
+			Op:   "opus_multistream_decoder_ctl",
+			Args: "OPUS_RESET_STATE",
+			Err:  Error(res),
+		}
+	}
+	return nil
+}
+
+// CtlInt32 performs a ctl that takes a single opus_int32 value. See
+// Encoder.CtlInt32.
+func (dec *MultistreamDecoder) CtlInt32(request int, value int32) error {
+	if dec.p == nil {
+		return ErrDecoderUninitialized
+	}
+	if err := checkCtl(request, false); err != nil {
+		return err
+	}
+	res := C.bridge_ms_decoder_set_int32(dec.p, C.int(request), C.opus_int32(value))
+	if res != C.OPUS_OK {
+		return &OpError{
+			Op:   "opus_multistream_decoder_ctl",
+			Args: fmt.Sprintf("%d, %d", request, value),
+			Err:  Error(res),
+		}
+	}
+	return nil
+}
+
+// CtlGetInt32 performs a ctl that returns a single opus_int32 value. See
+// Encoder.CtlGetInt32.
+func (dec *MultistreamDecoder) CtlGetInt32(request int) (int32, error) {
+	if dec.p == nil {
+		return 0, ErrDecoderUninitialized
+	}
+	if err := checkCtl(request, true); err != nil {
+		return 0, err
+	}
+	var value C.opus_int32
+	res := C.bridge_ms_decoder_get_int32(dec.p, C.int(request), &value)
+	if res != C.OPUS_OK {
+		return 0, &OpError{
+			Op:   "opus_multistream_decoder_ctl",
+			Args: fmt.Sprintf("%d", request),
+			Err:  Error(res),
+		}
+	}
+	return int32(value), nil
+}
+
+// CtlGetUint32 performs a ctl that returns a single opus_uint32 value.
+func (dec *MultistreamDecoder) CtlGetUint32(request int) (uint32, error) {
+	if dec.p == nil {
+		return 0, ErrDecoderUninitialized
+	}
+	if err := checkCtl(request, true); err != nil {
+		return 0, err
+	}
+	var value C.opus_uint32
+	res := C.bridge_ms_decoder_get_uint32(dec.p, C.int(request), &value)
+	if res != C.OPUS_OK {
+		return 0, &OpError{
+			Op:   "opus_multistream_decoder_ctl",
+			Args: fmt.Sprintf("%d", request),
+			Err:  Error(res),
+		}
+	}
+	return uint32(value), nil
+}
+
+// Ctl performs a ctl that takes no argument. The only such request is
+// OPUS_RESET_STATE (4028); any other request returns ErrBadArg.
+func (dec *MultistreamDecoder) Ctl(request int) error {
+	if dec.p == nil {
+		return ErrDecoderUninitialized
+	}
+	if err := checkNoArgCtl(request); err != nil {
+		return err
+	}
+	res := C.bridge_ms_decoder_ctl(dec.p, C.int(request))
+	if res != C.OPUS_OK {
+		return &OpError{
+			Op:   "opus_multistream_decoder_ctl",
+			Args: fmt.Sprintf("%d", request),
+			Err:  Error(res),
+		}
+	}
+	return nil
+}
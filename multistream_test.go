@@ -0,0 +1,289 @@
+// Copyright © Go Opus Authors (see AUTHORS file)
+//
+// License for use of this code is detailed in the LICENSE file
+
+package opus
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// Stream layout of 5.1 surround sound, as used by Ogg Opus mapping family 1
+var (
+	surround51Streams        = 4
+	surround51CoupledStreams = 2
+	surround51Mapping        = []byte{0, 4, 1, 2, 3, 5}
+)
+
+func TestMultistreamCodec(t *testing.T) {
+	const SAMPLE_RATE = 48000
+	const FRAME_SIZE = SAMPLE_RATE * 20 / 1000
+	const CHANNELS = 6
+	enc, err := NewMultistreamEncoder(SAMPLE_RATE, CHANNELS, surround51Streams,
+		surround51CoupledStreams, surround51Mapping, AppAudio)
+	if err != nil || enc == nil {
+		t.Fatalf("Error creating new multistream encoder: %v", err)
+	}
+	if enc.Channels() != CHANNELS || enc.Streams() != 4 || enc.CoupledStreams() != 2 {
+		t.Errorf("Unexpected stream layout: %d channels, %d streams, %d coupled",
+			enc.Channels(), enc.Streams(), enc.CoupledStreams())
+	}
+	if err := enc.SetBitrate(256000); err != nil {
+		t.Fatalf("Error setting bitrate: %v", err)
+	}
+	if bitrate, err := enc.Bitrate(); err != nil || bitrate != 256000 {
+		t.Errorf("Unexpected bitrate: %d (%v)", bitrate, err)
+	}
+	dec, err := NewMultistreamDecoder(SAMPLE_RATE, CHANNELS, surround51Streams,
+		surround51CoupledStreams, surround51Mapping)
+	if err != nil || dec == nil {
+		t.Fatalf("Error creating new multistream decoder: %v", err)
+	}
+	// A different tone on every channel
+	channels := make([][]int16, CHANNELS)
+	for i := range channels {
+		channels[i] = make([]int16, FRAME_SIZE)
+		addSine(channels[i], SAMPLE_RATE, float64(200+100*i))
+	}
+	pcm := make([]int16, FRAME_SIZE*CHANNELS)
+	for i := range pcm {
+		pcm[i] = channels[i%CHANNELS][i/CHANNELS]
+	}
+	data := make([]byte, 4000)
+	n, err := enc.Encode(pcm, data)
+	if err != nil {
+		t.Fatalf("Couldn't encode data: %v", err)
+	}
+	out := make([]int16, FRAME_SIZE*CHANNELS)
+	m, err := dec.Decode(data[:n], out)
+	if err != nil {
+		t.Fatalf("Couldn't decode data: %v", err)
+	}
+	if m != FRAME_SIZE {
+		t.Errorf("Length mismatch: %d samples in, %d out", FRAME_SIZE, m)
+	}
+	encRange, _ := enc.FinalRange()
+	decRange, _ := dec.FinalRange()
+	if encRange != decRange {
+		t.Errorf("Final range mismatch: encoder %#x, decoder %#x", encRange, decRange)
+	}
+	if err := dec.DecodePLC(out); err != nil {
+		t.Errorf("Couldn't conceal lost packet: %v", err)
+	}
+	if err := dec.DecodeFEC(data[:n], out); err != nil {
+		t.Errorf("Couldn't decode FEC data: %v", err)
+	}
+	outFloat := make([]float32, FRAME_SIZE*CHANNELS)
+	if _, err := dec.DecodeFloat32(data[:n], outFloat); err != nil {
+		t.Errorf("Couldn't decode data to float32: %v", err)
+	}
+	if _, err := enc.Encode(pcm[:len(pcm)-1], data); err != ErrBufferChannels {
+		t.Errorf("Expected ErrBufferChannels, got %v", err)
+	}
+}
+
+func TestMultistreamSilentChannel(t *testing.T) {
+	// Stereo input, where the right channel is dropped, played back on three
+	// channels with a silent one in the middle
+	enc, err := NewMultistreamEncoder(48000, 2, 1, 0, []byte{0, 255}, AppAudio)
+	if err != nil {
+		t.Fatalf("Error creating new multistream encoder: %v", err)
+	}
+	dec, err := NewMultistreamDecoder(48000, 3, 1, 0, []byte{0, 255, 0})
+	if err != nil {
+		t.Fatalf("Error creating new multistream decoder: %v", err)
+	}
+	pcm := make([]int16, 960*2)
+	addSine(pcm, 48000, 440)
+	data := make([]byte, 1000)
+	n, err := enc.Encode(pcm, data)
+	if err != nil {
+		t.Fatalf("Couldn't encode data: %v", err)
+	}
+	out := make([]int16, 960*3)
+	if _, err := dec.Decode(data[:n], out); err != nil {
+		t.Fatalf("Couldn't decode data: %v", err)
+	}
+	for i := 1; i < len(out); i += 3 {
+		if out[i] != 0 {
+			t.Fatalf("Expected silence on channel 1, got %d at sample %d", out[i], i/3)
+		}
+	}
+}
+
+func TestMultistreamMapping(t *testing.T) {
+	for _, c := range []struct {
+		channels, streams, coupled int
+		mapping                    []byte
+		valid                      bool
+	}{
+		{6, 4, 2, []byte{0, 4, 1, 2, 3, 5}, true},
+		{2, 1, 0, []byte{0, 255}, true},
+		{0, 1, 0, []byte{}, false},
+		{2, 0, 0, []byte{0, 1}, false},
+		{2, 1, 2, []byte{0, 1}, false},
+		{2, 1, 1, []byte{0}, false},
+		{2, 1, 1, []byte{0, 2}, false},
+	} {
+		err := checkMapping(c.channels, c.streams, c.coupled, c.mapping)
+		if (err == nil) != c.valid {
+			t.Errorf("Unexpected result for %d channels, %d streams, %d coupled, mapping %v: %v",
+				c.channels, c.streams, c.coupled, c.mapping, err)
+		}
+	}
+	if err := checkMapping(256, 1, 0, make([]byte, 256)); !errors.Is(err, ErrInvalidChannels) {
+		t.Errorf("Expected ErrInvalidChannels, got %v", err)
+	}
+}
+
+func TestSurroundEncoder(t *testing.T) {
+	const SAMPLE_RATE = 48000
+	const FRAME_SIZE = SAMPLE_RATE * 20 / 1000
+	// Vorbis channel layouts, as chosen by libopus for mapping family 1
+	layouts := []struct {
+		streams, coupled int
+		mapping          []byte
+	}{
+		{1, 0, []byte{0}},
+		{1, 1, []byte{0, 1}},
+		{2, 1, []byte{0, 2, 1}},
+		{2, 2, []byte{0, 1, 2, 3}},
+		{3, 2, []byte{0, 4, 1, 2, 3}},
+		{4, 2, []byte{0, 4, 1, 2, 3, 5}},
+		{4, 3, []byte{0, 4, 1, 2, 3, 5, 6}},
+		{5, 3, []byte{0, 6, 1, 2, 3, 4, 5, 7}},
+	}
+	for i, layout := range layouts {
+		channels := i + 1
+		enc, err := NewSurroundEncoder(SAMPLE_RATE, channels, 1, AppAudio)
+		if err != nil || enc == nil {
+			t.Fatalf("Error creating surround encoder for %d channels: %v", channels, err)
+		}
+		if enc.Streams() != layout.streams || enc.CoupledStreams() != layout.coupled ||
+			!bytes.Equal(enc.Mapping(), layout.mapping) {
+			t.Errorf("Unexpected layout for %d channels: %d streams, %d coupled, mapping %v",
+				channels, enc.Streams(), enc.CoupledStreams(), enc.Mapping())
+		}
+		dec, err := NewMultistreamDecoder(SAMPLE_RATE, channels, enc.Streams(),
+			enc.CoupledStreams(), enc.Mapping())
+		if err != nil || dec == nil {
+			t.Fatalf("Error creating multistream decoder for %d channels: %v", channels, err)
+		}
+		// Low tones, so they pass the low-pass of the LFE channel
+		pcm := make([]int16, FRAME_SIZE*channels)
+		for c := 0; c < channels; c++ {
+			mono := make([]int16, FRAME_SIZE)
+			addSine(mono, SAMPLE_RATE, float64(60+10*c))
+			for j, v := range mono {
+				pcm[j*channels+c] = v
+			}
+		}
+		data := make([]byte, 4000)
+		out := make([]int16, FRAME_SIZE*channels)
+		// The first frames contain the encoder's start-up delay
+		for frame := 0; frame < 5; frame++ {
+			n, err := enc.Encode(pcm, data)
+			if err != nil {
+				t.Fatalf("Couldn't encode %d channels: %v", channels, err)
+			}
+			m, err := dec.Decode(data[:n], out)
+			if err != nil {
+				t.Fatalf("Couldn't decode %d channels: %v", channels, err)
+			}
+			if m != FRAME_SIZE {
+				t.Errorf("Length mismatch for %d channels: %d samples in, %d out", channels, FRAME_SIZE, m)
+			}
+		}
+		for c := 0; c < channels; c++ {
+			var peak int16
+			for j := c; j < len(out); j += channels {
+				if out[j] > peak {
+					peak = out[j]
+				}
+			}
+			if peak < 1000 {
+				t.Errorf("Channel %d of %d lost in round trip, peak %d", c, channels, peak)
+			}
+		}
+	}
+	if _, err := NewSurroundEncoder(SAMPLE_RATE, 9, 1, AppAudio); err == nil {
+		t.Errorf("Expected error for 9 channels in mapping family 1")
+	}
+}
+
+// Encode three unrelated tracks, with a silent one in the middle, into a
+// discrete multistream packet.
+func encodeDiscrete(t *testing.T, enc *MultistreamEncoder, frames int) [][]byte {
+	const FRAME_SIZE = 960
+	pcm := make([]int16, FRAME_SIZE*3)
+	for c := 0; c < 3; c += 2 {
+		mono := make([]int16, FRAME_SIZE)
+		addSine(mono, 48000, float64(300+200*c))
+		for i, v := range mono {
+			pcm[i*3+c] = v
+		}
+	}
+	var packets [][]byte
+	for i := 0; i < frames; i++ {
+		data := make([]byte, 4000)
+		n, err := enc.Encode(pcm, data)
+		if err != nil {
+			t.Fatalf("Couldn't encode data: %v", err)
+		}
+		packets = append(packets, data[:n])
+	}
+	return packets
+}
+
+// checkDiscrete verifies the silent middle channel did not pick up the others.
+func checkDiscrete(t *testing.T, pcm []int16) {
+	for c := 0; c < 3; c++ {
+		ch, err := ExtractChannel(pcm, 3, c)
+		if err != nil {
+			t.Fatalf("Couldn't extract channel %d: %v", c, err)
+		}
+		var peak int16
+		for _, v := range ch {
+			if v > peak {
+				peak = v
+			}
+		}
+		if c == 1 && peak > 100 {
+			t.Errorf("Silent channel leaked, peak %d", peak)
+		} else if c != 1 && peak < 1000 {
+			t.Errorf("Channel %d lost, peak %d", c, peak)
+		}
+	}
+}
+
+func TestDiscreteCodec(t *testing.T) {
+	enc, err := NewDiscreteEncoder(48000, 3, AppAudio)
+	if err != nil {
+		t.Fatalf("Error creating discrete encoder: %v", err)
+	}
+	if enc.Streams() != 3 || enc.CoupledStreams() != 0 || enc.MappingFamily() != 255 {
+		t.Errorf("Unexpected layout: %d streams, %d coupled, family %d",
+			enc.Streams(), enc.CoupledStreams(), enc.MappingFamily())
+	}
+	head, err := enc.Head()
+	if err != nil {
+		t.Fatalf("Couldn't create header: %v", err)
+	}
+	if head.Channels != 3 || head.MappingFamily != 255 || head.Streams != 3 ||
+		head.CoupledStreams != 0 || !bytes.Equal(head.Mapping, []byte{0, 1, 2}) {
+		t.Errorf("Unexpected header: %+v", head)
+	}
+	dec, err := NewDiscreteDecoder(48000, 3)
+	if err != nil {
+		t.Fatalf("Error creating discrete decoder: %v", err)
+	}
+	out := make([]int16, 960*3)
+	for _, packet := range encodeDiscrete(t, enc, 5) {
+		if _, err := dec.Decode(packet, out); err != nil {
+			t.Fatalf("Couldn't decode data: %v", err)
+		}
+	}
+	checkDiscrete(t, out)
+}
@@ -0,0 +1,190 @@
+// Copyright © Go Opus Authors (see AUTHORS file)
+//
+// License for use of this code is detailed in the LICENSE file
+
+package opus
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+)
+
+// Ogg page header flags
+const (
+	oggContinued = 0x01
+	oggBOS       = 0x02
+	oggEOS       = 0x04
+)
+
+// Granule position of a page on which no packet ends
+const oggNoGranule = ^uint64(0)
+
+var oggCRCTable = func() (table [256]uint32) {
+	for i := range table {
+		r := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if r&0x80000000 != 0 {
+				r = r<<1 ^ 0x04c11db7
+			} else {
+				r <<= 1
+			}
+		}
+		table[i] = r
+	}
+	return
+}()
+
+// oggCRC computes the Ogg page checksum: CRC-32 with polynomial 0x04c11db7,
+// no reflection, initial value and final XOR of zero.
+func oggCRC(data []byte) uint32 {
+	var crc uint32
+	for _, b := range data {
+		crc = crc<<8 ^ oggCRCTable[byte(crc>>24)^b]
+	}
+	return crc
+}
+
+// OggWriter writes Opus packets to an Ogg Opus stream (RFC 7845), e.g. a .opus
+// file. Every audio packet is written on its own page.
+type OggWriter struct {
+	w       io.Writer
+	serial  uint32
+	seq     uint32
+	granule uint64
+	// The last packet is held back, so Close can mark its page as the end of
+	// the stream.
+	pending        []byte
+	pendingGranule uint64
+	hasPending     bool
+	closed         bool
+}
+
+// NewOggWriter starts an Ogg Opus stream on w, writing the header pages with
+// the given header, e.g. from MultistreamEncoder.Head, and comments. If tags is
+// nil, the comment header only holds the libopus version as vendor string.
+//
+// The stream gets a random serial number, so that streams can be chained or
+// multiplexed.
+func NewOggWriter(w io.Writer, head *Head, tags *Tags) (*OggWriter, error) {
+	var serial [4]byte
+	if _, err := rand.Read(serial[:]); err != nil {
+		return nil, err
+	}
+	return NewOggWriterWithSerial(w, head, tags, binary.LittleEndian.Uint32(serial[:]))
+}
+
+// NewOggWriterWithSerial is like NewOggWriter, with the given serial number
+// instead of a random one, e.g. for reproducible output.
+func NewOggWriterWithSerial(w io.Writer, head *Head, tags *Tags, serial uint32) (*OggWriter, error) {
+	headData, err := head.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	if tags == nil {
+		tags = &Tags{Vendor: Version()}
+	}
+	tagsData, err := tags.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	ow := &OggWriter{w: w, serial: serial}
+	if err := ow.writePacket(headData, 0, oggBOS); err != nil {
+		return nil, err
+	}
+	if err := ow.writePacket(tagsData, 0, 0); err != nil {
+		return nil, err
+	}
+	return ow, nil
+}
+
+// WritePacket adds an encoded Opus packet to the stream. samples is the
+// duration of the packet in samples per channel at 48 kHz, regardless of the
+// sample rate of the encoder; e.g. 960 for a 20 ms packet.
+func (ow *OggWriter) WritePacket(data []byte, samples int) error {
+	if ow.closed {
+		return ErrStreamClosed
+	}
+	if len(data) == 0 {
+		return ErrNoData
+	}
+	if ow.hasPending {
+		if err := ow.writePacket(ow.pending, ow.pendingGranule, 0); err != nil {
+			return err
+		}
+	}
+	ow.granule += uint64(samples)
+	ow.pending = append(ow.pending[:0], data...)
+	ow.pendingGranule = ow.granule
+	ow.hasPending = true
+	return nil
+}
+
+// Close writes the last page, marked as the end of the stream. It does not
+// close the underlying writer.
+func (ow *OggWriter) Close() error {
+	if ow.closed {
+		return ErrStreamClosed
+	}
+	ow.closed = true
+	if !ow.hasPending {
+		// An empty page is the only way to end a stream without audio
+		return ow.writePage(nil, nil, ow.granule, oggEOS)
+	}
+	return ow.writePacket(ow.pending, ow.pendingGranule, oggEOS)
+}
+
+// writePacket writes a packet on as many pages as needed, starting on a new
+// page. flags apply to the first page (BOS) or the last page (EOS).
+func (ow *OggWriter) writePacket(data []byte, granule uint64, flags byte) error {
+	// Lacing values: 255 for every full segment, then the remainder, which
+	// is 0 if the packet length is a multiple of 255
+	lacing := make([]byte, len(data)/255+1)
+	for i := range lacing {
+		lacing[i] = 255
+	}
+	lacing[len(lacing)-1] = byte(len(data) % 255)
+	first := true
+	for len(lacing) > 0 {
+		n := len(lacing)
+		if n > 255 {
+			n = 255
+		}
+		size := 0
+		for _, l := range lacing[:n] {
+			size += int(l)
+		}
+		pageFlags := flags & oggBOS
+		if !first {
+			pageFlags = oggContinued
+		}
+		pageGranule := oggNoGranule
+		if n == len(lacing) {
+			pageGranule = granule
+			pageFlags |= flags & oggEOS
+		}
+		if err := ow.writePage(lacing[:n], data[:size], pageGranule, pageFlags); err != nil {
+			return err
+		}
+		lacing = lacing[n:]
+		data = data[size:]
+		first = false
+	}
+	return nil
+}
+
+func (ow *OggWriter) writePage(lacing []byte, data []byte, granule uint64, flags byte) error {
+	page := make([]byte, 27, 27+len(lacing)+len(data))
+	copy(page, "OggS")
+	page[5] = flags
+	binary.LittleEndian.PutUint64(page[6:], granule)
+	binary.LittleEndian.PutUint32(page[14:], ow.serial)
+	binary.LittleEndian.PutUint32(page[18:], ow.seq)
+	page[26] = byte(len(lacing))
+	page = append(page, lacing...)
+	page = append(page, data...)
+	binary.LittleEndian.PutUint32(page[22:], oggCRC(page))
+	ow.seq++
+	_, err := ow.w.Write(page)
+	return err
+}
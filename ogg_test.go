@@ -0,0 +1,151 @@
+// Copyright © Go Opus Authors (see AUTHORS file)
+//
+// License for use of this code is detailed in the LICENSE file
+
+package opus
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+type oggTestPage struct {
+	flags   byte
+	granule uint64
+	serial  uint32
+	seq     uint32
+	lacing  []byte
+	data    []byte
+}
+
+// readOggPages splits an Ogg stream into pages, checking the checksums.
+func readOggPages(t *testing.T, stream []byte) []oggTestPage {
+	var pages []oggTestPage
+	for len(stream) > 0 {
+		if len(stream) < 27 || string(stream[:4]) != "OggS" {
+			t.Fatalf("Malformed page header at page %d", len(pages))
+		}
+		nsegs := int(stream[26])
+		lacing := stream[27 : 27+nsegs]
+		size := 27 + nsegs
+		for _, l := range lacing {
+			size += int(l)
+		}
+		page := append([]byte(nil), stream[:size]...)
+		crc := binary.LittleEndian.Uint32(page[22:])
+		binary.LittleEndian.PutUint32(page[22:], 0)
+		if oggCRC(page) != crc {
+			t.Errorf("Checksum mismatch on page %d", len(pages))
+		}
+		pages = append(pages, oggTestPage{
+			flags:   stream[5],
+			granule: binary.LittleEndian.Uint64(stream[6:]),
+			serial:  binary.LittleEndian.Uint32(stream[14:]),
+			seq:     binary.LittleEndian.Uint32(stream[18:]),
+			lacing:  lacing,
+			data:    stream[27+nsegs : size],
+		})
+		stream = stream[size:]
+	}
+	return pages
+}
+
+func TestOggCRC(t *testing.T) {
+	if crc := oggCRC([]byte("123456789")); crc != 0x89a1897f {
+		t.Errorf("Unexpected checksum: %#x", crc)
+	}
+}
+
+func TestOggWriter(t *testing.T) {
+	var buf bytes.Buffer
+	head := &Head{Version: 1, Channels: 2, PreSkip: 312, InputSampleRate: 48000}
+	headData, _ := head.MarshalBinary()
+	w, err := NewOggWriter(&buf, head, &Tags{Vendor: "test", Comments: []string{"TITLE=test"}})
+	if err != nil {
+		t.Fatalf("Couldn't create Ogg writer: %v", err)
+	}
+	// The big packet does not fit on a single page
+	big := make([]byte, 70000)
+	for i := range big {
+		big[i] = byte(i)
+	}
+	packets := [][]byte{{1, 2, 3}, big, make([]byte, 255)}
+	for _, p := range packets {
+		if err := w.WritePacket(p, 960); err != nil {
+			t.Fatalf("Couldn't write packet: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Couldn't close Ogg writer: %v", err)
+	}
+	if err := w.WritePacket([]byte{1}, 960); err != ErrStreamClosed {
+		t.Errorf("Expected ErrStreamClosed, got %v", err)
+	}
+	pages := readOggPages(t, buf.Bytes())
+	if len(pages) != 6 {
+		t.Fatalf("Expected 6 pages, got %d", len(pages))
+	}
+	if pages[0].flags != oggBOS || !bytes.Equal(pages[0].data, headData) || pages[0].granule != 0 {
+		t.Errorf("Unexpected OpusHead page: %+v", pages[0])
+	}
+	if !bytes.HasPrefix(pages[1].data, []byte("OpusTags")) || !bytes.Contains(pages[1].data, []byte("TITLE=test")) {
+		t.Errorf("Unexpected OpusTags page: %q", pages[1].data)
+	}
+	if !bytes.Equal(pages[2].data, packets[0]) || pages[2].granule != 960 {
+		t.Errorf("Unexpected first audio page: %+v", pages[2])
+	}
+	// The big packet continues on the next page, which completes it
+	if pages[3].granule != oggNoGranule || pages[4].flags != oggContinued || pages[4].granule != 1920 {
+		t.Errorf("Unexpected split packet pages: %d, %#x, %d", pages[3].granule, pages[4].flags, pages[4].granule)
+	}
+	if got := append(append([]byte(nil), pages[3].data...), pages[4].data...); !bytes.Equal(got, big) {
+		t.Errorf("Split packet mismatch")
+	}
+	// A 255 byte packet needs a terminating 0 lacing value
+	if pages[5].flags != oggEOS || !bytes.Equal(pages[5].lacing, []byte{255, 0}) || pages[5].granule != 2880 {
+		t.Errorf("Unexpected last page: %+v", pages[5])
+	}
+	for i, p := range pages {
+		if p.seq != uint32(i) {
+			t.Errorf("Unexpected sequence number %d for page %d", p.seq, i)
+		}
+	}
+	if _, err := NewOggWriter(&buf, &Head{Channels: 3}, nil); !errors.Is(err, ErrInvalidHeader) {
+		t.Errorf("Expected ErrInvalidHeader, got %v", err)
+	}
+}
+
+func TestOggWriterSerial(t *testing.T) {
+	head := &Head{Version: 1, Channels: 1, PreSkip: 312, InputSampleRate: 48000}
+	var buf bytes.Buffer
+	w, err := NewOggWriterWithSerial(&buf, head, nil, 0x12345678)
+	if err != nil {
+		t.Fatalf("Couldn't create Ogg writer: %v", err)
+	}
+	if err := w.WritePacket([]byte{1, 2, 3}, 960); err != nil {
+		t.Fatalf("Couldn't write packet: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Couldn't close Ogg writer: %v", err)
+	}
+	for i, p := range readOggPages(t, buf.Bytes()) {
+		if p.serial != 0x12345678 {
+			t.Errorf("Unexpected serial number %#x on page %d", p.serial, i)
+		}
+	}
+
+	// Random serial numbers differ between streams
+	serials := map[uint32]bool{}
+	for i := 0; i < 4; i++ {
+		buf.Reset()
+		if _, err := NewOggWriter(&buf, head, nil); err != nil {
+			t.Fatalf("Couldn't create Ogg writer: %v", err)
+		}
+		serials[readOggPages(t, buf.Bytes())[0].serial] = true
+	}
+	if len(serials) < 2 {
+		t.Errorf("Expected random serial numbers, got %v", serials)
+	}
+}
@@ -4,6 +4,11 @@
 
 package opus
 
+import (
+	"fmt"
+	"unsafe"
+)
+
 /*
 // Link opus using pkg-config.
 #cgo pkg-config: opus
@@ -34,3 +39,41 @@ const (
 func Version() string {
 	return C.GoString(C.opus_get_version_string())
 }
+
+// libopusAtLeast reports whether the linked libopus is at least the given
+// version. Version strings that cannot be parsed, e.g. from development
+// builds, are treated as too old.
+func libopusAtLeast(major, minor int) bool {
+	var gotMajor, gotMinor int
+	_, err := fmt.Sscanf(Version(), "libopus %d.%d", &gotMajor, &gotMinor)
+	if err != nil {
+		return false
+	}
+	return gotMajor > major || (gotMajor == major && gotMinor >= minor)
+}
+
+// pcmBuffer is a buffer of int16 or float32 samples, so that both sample
+// types share one implementation of encoding and decoding.
+type pcmBuffer struct {
+	// First sample, or nil if the buffer has no capacity
+	p     unsafe.Pointer
+	len   int
+	cap   int
+	float bool
+}
+
+func int16PCM(pcm []int16) pcmBuffer {
+	b := pcmBuffer{len: len(pcm), cap: cap(pcm)}
+	if cap(pcm) > 0 {
+		b.p = unsafe.Pointer(&pcm[:1][0])
+	}
+	return b
+}
+
+func float32PCM(pcm []float32) pcmBuffer {
+	b := pcmBuffer{len: len(pcm), cap: cap(pcm), float: true}
+	if cap(pcm) > 0 {
+		b.p = unsafe.Pointer(&pcm[:1][0])
+	}
+	return b
+}
@@ -5,6 +5,7 @@
 package opus
 
 import (
+	"errors"
 	"strings"
 	"testing"
 )
@@ -25,6 +26,52 @@ func TestOpusErrstr(t *testing.T) {
 	}
 }
 
+func TestOpError(t *testing.T) {
+	dec, err := NewDecoder(48000, 1)
+	if err != nil || dec == nil {
+		t.Fatalf("Error creating new decoder: %v", err)
+	}
+	// Code 3 packet with a frame count of 0
+	_, err = dec.Decode([]byte{0x03, 0x00}, make([]int16, 960))
+	if !errors.Is(err, ErrInvalidPacket) {
+		t.Fatalf("Expected ErrInvalidPacket, got %v", err)
+	}
+	var opErr *OpError
+	if !errors.As(err, &opErr) || opErr.Op != "opus_decode" {
+		t.Errorf("Expected OpError for opus_decode, got %v", err)
+	}
+	var code Error
+	if !errors.As(err, &code) || code != ErrInvalidPacket {
+		t.Errorf("Expected libopus error code in %v", err)
+	}
+	if !strings.HasPrefix(err.Error(), "opus: opus_decode(") {
+		t.Errorf("Unexpected error message: %v", err)
+	}
+	if _, err := dec.Decode(nil, make([]int16, 960)); err != ErrNoData {
+		t.Errorf("Expected ErrNoData, got %v", err)
+	}
+	if _, err := dec.Decode([]byte{0x08}, nil); err != ErrTargetBufferEmpty {
+		t.Errorf("Expected ErrTargetBufferEmpty, got %v", err)
+	}
+	if err := dec.Init(48000, 1); err != ErrAlreadyInitialized {
+		t.Errorf("Expected ErrAlreadyInitialized, got %v", err)
+	}
+	if _, err := NewEncoder(48000, 3, AppVoIP); !errors.Is(err, ErrInvalidChannels) {
+		t.Errorf("Expected ErrInvalidChannels, got %v", err)
+	}
+	enc, err := NewEncoder(48000, 1, AppVoIP)
+	if err != nil || enc == nil {
+		t.Fatalf("Error creating new encoder: %v", err)
+	}
+	err = enc.SetComplexity(11)
+	if !errors.As(err, &opErr) || opErr.Op != "opus_encoder_ctl" || opErr.Args != "OPUS_SET_COMPLEXITY(11)" {
+		t.Errorf("Expected OpError for OPUS_SET_COMPLEXITY, got %v", err)
+	}
+	if !errors.Is(err, ErrBadArg) {
+		t.Errorf("Expected ErrBadArg, got %v", err)
+	}
+}
+
 func TestCodec(t *testing.T) {
 	const SAMPLE_RATE = 48000
 	enc, err := NewEncoder(SAMPLE_RATE, 1, AppVoIP)
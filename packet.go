@@ -0,0 +1,340 @@
+// Copyright © Go Opus Authors (see AUTHORS file)
+//
+// License for use of this code is detailed in the LICENSE file
+
+package opus
+
+import (
+	"time"
+)
+
+// Mode is the coding mode used for an Opus packet.
+type Mode int
+
+const (
+	// Linear prediction, used for speech at low bandwidths
+	ModeSILK Mode = iota + 1
+	// SILK for the low band combined with CELT for the high band
+	ModeHybrid
+	// MDCT based, used for music and low delay
+	ModeCELT
+)
+
+func (m Mode) String() string {
+	switch m {
+	case ModeSILK:
+		return "SILK"
+	case ModeHybrid:
+		return "Hybrid"
+	case ModeCELT:
+		return "CELT"
+	default:
+		return "unknown"
+	}
+}
+
+const (
+	// Largest frame allowed in an Opus packet, in bytes.
+	maxFrameBytes = 1275
+	// Largest number of frames in an Opus packet.
+	maxPacketFrames = 48
+	// Longest allowed packet duration, in samples at 48 kHz (120 ms).
+	maxPacketSamples = 5760
+)
+
+// TOC is the table-of-contents byte found at the start of every Opus packet.
+// It describes the mode, bandwidth, frame size and channel count of all frames
+// in the packet. See RFC 6716, section 3.1.
+type TOC byte
+
+// Mode returns the coding mode of the packet.
+func (toc TOC) Mode() Mode {
+	switch {
+	case toc&0x80 != 0:
+		return ModeCELT
+	case toc&0x60 == 0x60:
+		return ModeHybrid
+	default:
+		return ModeSILK
+	}
+}
+
+// Bandwidth returns the audio bandwidth of the packet.
+func (toc TOC) Bandwidth() Bandwidth {
+	switch toc.Mode() {
+	case ModeCELT:
+		bw := Mediumband + Bandwidth((toc>>5)&0x3)
+		// CELT has no mediumband
+		if bw == Mediumband {
+			bw = Narrowband
+		}
+		return bw
+	case ModeHybrid:
+		if toc&0x10 != 0 {
+			return Fullband
+		}
+		return SuperWideband
+	default:
+		return Narrowband + Bandwidth((toc>>5)&0x3)
+	}
+}
+
+// FrameSize returns the number of samples per frame at 48 kHz.
+func (toc TOC) FrameSize() int {
+	const fs = 48000
+	size := int(toc>>3) & 0x3
+	switch toc.Mode() {
+	case ModeCELT:
+		return (fs << uint(size)) / 400
+	case ModeHybrid:
+		if toc&0x08 != 0 {
+			return fs / 50
+		}
+		return fs / 100
+	default:
+		if size == 3 {
+			return fs * 60 / 1000
+		}
+		return (fs << uint(size)) / 100
+	}
+}
+
+// Duration returns the duration of a single frame.
+func (toc TOC) Duration() time.Duration {
+	return time.Duration(toc.FrameSize()) * time.Second / 48000
+}
+
+// Stereo reports whether the packet is coded in stereo.
+func (toc TOC) Stereo() bool {
+	return toc&0x4 != 0
+}
+
+// Code returns the frame count code of the packet: 0 for a single frame, 1 for
+// two frames of equal size, 2 for two frames of different sizes and 3 for an
+// arbitrary number of frames.
+func (toc TOC) Code() int {
+	return int(toc & 0x3)
+}
+
+// Packet is a parsed Opus packet. The frames and padding point into the
+// buffer the packet was parsed from.
+type Packet struct {
+	TOC    TOC
+	Frames [][]byte
+	// Padding found at the end of a packet using code 3. Since libopus 1.5,
+	// padding can carry extensions; see PacketExtensions.
+	Padding []byte
+}
+
+// ParsePacket splits an Opus packet into its frames and padding, validating
+// the framing as described in RFC 6716, section 3.2. Returns ErrInvalidPacket
+// for malformed packets.
+func ParsePacket(data []byte) (*Packet, error) {
+	if len(data) == 0 {
+		return nil, ErrInvalidPacket
+	}
+	p := Packet{TOC: TOC(data[0])}
+	rest := data[1:]
+	var sizes []int
+	switch p.TOC.Code() {
+	case 0:
+		sizes = []int{len(rest)}
+	case 1:
+		if len(rest)%2 != 0 {
+			return nil, ErrInvalidPacket
+		}
+		sizes = []int{len(rest) / 2, len(rest) / 2}
+	case 2:
+		n, size := parseFrameSize(rest)
+		if n < 0 || size > len(rest)-n {
+			return nil, ErrInvalidPacket
+		}
+		rest = rest[n:]
+		sizes = []int{size, len(rest) - size}
+	case 3:
+		if len(rest) < 1 {
+			return nil, ErrInvalidPacket
+		}
+		ch := rest[0]
+		rest = rest[1:]
+		count := int(ch & 0x3f)
+		if count == 0 || count*p.TOC.FrameSize() > maxPacketSamples {
+			return nil, ErrInvalidPacket
+		}
+		if ch&0x40 != 0 {
+			padding := 0
+			for {
+				if len(rest) == 0 {
+					return nil, ErrInvalidPacket
+				}
+				b := int(rest[0])
+				rest = rest[1:]
+				if b == 255 {
+					padding += 254
+				} else {
+					padding += b
+					break
+				}
+			}
+			if padding > len(rest) {
+				return nil, ErrInvalidPacket
+			}
+			p.Padding = rest[len(rest)-padding:]
+			rest = rest[:len(rest)-padding]
+		}
+		if ch&0x80 != 0 {
+			// VBR: explicit sizes for all but the last frame
+			total := 0
+			for i := 0; i < count-1; i++ {
+				n, size := parseFrameSize(rest)
+				if n < 0 {
+					return nil, ErrInvalidPacket
+				}
+				rest = rest[n:]
+				sizes = append(sizes, size)
+				total += size
+			}
+			if total > len(rest) {
+				return nil, ErrInvalidPacket
+			}
+			sizes = append(sizes, len(rest)-total)
+		} else {
+			if len(rest)%count != 0 {
+				return nil, ErrInvalidPacket
+			}
+			for i := 0; i < count; i++ {
+				sizes = append(sizes, len(rest)/count)
+			}
+		}
+	}
+	p.Frames = make([][]byte, len(sizes))
+	for i, size := range sizes {
+		if size > maxFrameBytes {
+			return nil, ErrInvalidPacket
+		}
+		p.Frames[i] = rest[:size:size]
+		rest = rest[size:]
+	}
+	return &p, nil
+}
+
+// parseFrameSize decodes a frame length. Returns the number of bytes used by
+// the length, or -1 if data is too short.
+func parseFrameSize(data []byte) (int, int) {
+	if len(data) < 1 {
+		return -1, 0
+	}
+	if data[0] < 252 {
+		return 1, int(data[0])
+	}
+	if len(data) < 2 {
+		return -1, 0
+	}
+	return 2, 4*int(data[1]) + int(data[0])
+}
+
+// appendFrameSize encodes a frame length as described in RFC 6716, section
+// 3.2.1.
+func appendFrameSize(b []byte, size int) []byte {
+	if size < 252 {
+		return append(b, byte(size))
+	}
+	first := 252 + size&0x3
+	return append(b, byte(first), byte((size-first)>>2))
+}
+
+// Samples returns the duration of the packet in samples at 48 kHz.
+func (p *Packet) Samples() int {
+	return len(p.Frames) * p.TOC.FrameSize()
+}
+
+// Duration returns the duration of the packet.
+func (p *Packet) Duration() time.Duration {
+	return time.Duration(len(p.Frames)) * p.TOC.Duration()
+}
+
+// DTX reports whether the packet carries no audio because the encoder was in
+// discontinuous transmission (DTX). Like libopus, frames of at most one byte
+// are treated as DTX frames, which the decoder fills in using PLC.
+func (p *Packet) DTX() bool {
+	for _, f := range p.Frames {
+		if len(f) > 1 {
+			return false
+		}
+	}
+	return true
+}
+
+// MarshalBinary encodes the packet, using the most compact framing that can
+// represent its frames and padding.
+func (p *Packet) MarshalBinary() ([]byte, error) {
+	count := len(p.Frames)
+	if count == 0 || count > maxPacketFrames || count*p.TOC.FrameSize() > maxPacketSamples {
+		return nil, ErrBadArg
+	}
+	size := 1
+	cbr := true
+	for _, f := range p.Frames {
+		if len(f) > maxFrameBytes {
+			return nil, ErrBadArg
+		}
+		if len(f) != len(p.Frames[0]) {
+			cbr = false
+		}
+		size += len(f) + 2
+	}
+	toc := p.TOC &^ 0x3
+	b := make([]byte, 0, size+len(p.Padding)/254+2+len(p.Padding))
+	switch {
+	case len(p.Padding) == 0 && count == 1:
+		b = append(b, byte(toc))
+	case len(p.Padding) == 0 && count == 2 && cbr:
+		b = append(b, byte(toc|1))
+	case len(p.Padding) == 0 && count == 2:
+		b = append(b, byte(toc|2))
+		b = appendFrameSize(b, len(p.Frames[0]))
+	default:
+		ch := byte(count)
+		if !cbr {
+			ch |= 0x80
+		}
+		if len(p.Padding) > 0 {
+			ch |= 0x40
+		}
+		b = append(b, byte(toc|3), ch)
+		if len(p.Padding) > 0 {
+			for i := 0; i < len(p.Padding)/254; i++ {
+				b = append(b, 255)
+			}
+			b = append(b, byte(len(p.Padding)%254))
+		}
+		if !cbr {
+			for _, f := range p.Frames[:count-1] {
+				b = appendFrameSize(b, len(f))
+			}
+		}
+	}
+	for _, f := range p.Frames {
+		b = append(b, f...)
+	}
+	return append(b, p.Padding...), nil
+}
+
+// PacketFrames returns the number of frames in an Opus packet.
+func PacketFrames(data []byte) (int, error) {
+	p, err := ParsePacket(data)
+	if err != nil {
+		return 0, err
+	}
+	return len(p.Frames), nil
+}
+
+// PacketSamples returns the number of samples per channel that decoding the
+// packet yields at the given sample rate.
+func PacketSamples(data []byte, sample_rate int) (int, error) {
+	p, err := ParsePacket(data)
+	if err != nil {
+		return 0, err
+	}
+	return p.Samples() * sample_rate / 48000, nil
+}
@@ -0,0 +1,156 @@
+// Copyright © Go Opus Authors (see AUTHORS file)
+//
+// License for use of this code is detailed in the LICENSE file
+
+package opus
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTOC(t *testing.T) {
+	tests := []struct {
+		toc       TOC
+		mode      Mode
+		bandwidth Bandwidth
+		frameSize int
+		stereo    bool
+	}{
+		{0<<3 | 0, ModeSILK, Narrowband, 480, false},
+		{3<<3 | 4, ModeSILK, Narrowband, 2880, true},
+		{5 << 3, ModeSILK, Mediumband, 960, false},
+		{10 << 3, ModeSILK, Wideband, 1920, false},
+		{12 << 3, ModeHybrid, SuperWideband, 480, false},
+		{15<<3 | 4, ModeHybrid, Fullband, 960, true},
+		{16 << 3, ModeCELT, Narrowband, 120, false},
+		{21 << 3, ModeCELT, Wideband, 240, false},
+		{26 << 3, ModeCELT, SuperWideband, 480, false},
+		{31<<3 | 4, ModeCELT, Fullband, 960, true},
+	}
+	for _, test := range tests {
+		if m := test.toc.Mode(); m != test.mode {
+			t.Errorf("TOC %#02x: unexpected mode %v, expected %v", byte(test.toc), m, test.mode)
+		}
+		if bw := test.toc.Bandwidth(); bw != test.bandwidth {
+			t.Errorf("TOC %#02x: unexpected bandwidth %d, expected %d", byte(test.toc), bw, test.bandwidth)
+		}
+		if fs := test.toc.FrameSize(); fs != test.frameSize {
+			t.Errorf("TOC %#02x: unexpected frame size %d, expected %d", byte(test.toc), fs, test.frameSize)
+		}
+		if s := test.toc.Stereo(); s != test.stereo {
+			t.Errorf("TOC %#02x: unexpected stereo flag %t", byte(test.toc), s)
+		}
+	}
+	if d := TOC(16 << 3).Duration(); d != 2500*time.Microsecond {
+		t.Errorf("Unexpected duration of 2.5 ms CELT frame: %v", d)
+	}
+}
+
+func TestParsePacket(t *testing.T) {
+	const toc = 31 << 3
+	big := bytes.Repeat([]byte{7}, 300)
+	tests := []struct {
+		name    string
+		data    []byte
+		frames  [][]byte
+		padding []byte
+	}{
+		{"code 0", []byte{toc, 1, 2, 3}, [][]byte{{1, 2, 3}}, nil},
+		{"code 0 empty", []byte{toc}, [][]byte{{}}, nil},
+		{"code 1", []byte{toc | 1, 1, 2, 3, 4}, [][]byte{{1, 2}, {3, 4}}, nil},
+		{"code 2", []byte{toc | 2, 1, 1, 2, 3}, [][]byte{{1}, {2, 3}}, nil},
+		{"code 2 long", append([]byte{toc | 2, 252 + 300&3, (300 - 252 - 300&3) >> 2}, append(big, 9)...),
+			[][]byte{big, {9}}, nil},
+		{"code 3 cbr", []byte{toc | 3, 3, 1, 2, 3}, [][]byte{{1}, {2}, {3}}, nil},
+		{"code 3 vbr", []byte{toc | 3, 0x80 | 3, 1, 0, 1, 2, 3}, [][]byte{{1}, {}, {2, 3}}, nil},
+		{"code 3 padding", []byte{toc | 3, 0x40 | 1, 2, 1, 2, 0, 0}, [][]byte{{1, 2}}, []byte{0, 0}},
+	}
+	for _, test := range tests {
+		p, err := ParsePacket(test.data)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(p.Frames, test.frames) {
+			t.Errorf("%s: unexpected frames: %v", test.name, p.Frames)
+		}
+		if !bytes.Equal(p.Padding, test.padding) {
+			t.Errorf("%s: unexpected padding: %v", test.name, p.Padding)
+		}
+		out, err := p.MarshalBinary()
+		if err != nil {
+			t.Errorf("%s: couldn't marshal packet: %v", test.name, err)
+			continue
+		}
+		p2, err := ParsePacket(out)
+		if err != nil {
+			t.Errorf("%s: couldn't parse marshalled packet: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(p, p2) {
+			t.Errorf("%s: packet changed after marshalling: %v, %v", test.name, p, p2)
+		}
+	}
+}
+
+func TestParseInvalidPacket(t *testing.T) {
+	const toc = 31 << 3
+	tests := map[string][]byte{
+		"empty":              {},
+		"code 1 odd":         {toc | 1, 1, 2, 3},
+		"code 2 short":       {toc | 2, 5, 1},
+		"code 3 no count":    {toc | 3},
+		"code 3 zero frames": {toc | 3, 0},
+		"code 3 too long":    {toc | 3, 7, 1, 1, 1, 1, 1, 1, 1},
+		"code 3 cbr uneven":  {toc | 3, 2, 1, 2, 3},
+		"code 3 padding":     {toc | 3, 0x40 | 1, 5, 1},
+		"oversized frame":    append([]byte{toc}, make([]byte, 1276)...),
+	}
+	for name, data := range tests {
+		if _, err := ParsePacket(data); err != ErrInvalidPacket {
+			t.Errorf("%s: expected ErrInvalidPacket, got: %v", name, err)
+		}
+	}
+}
+
+func TestPacketSamples(t *testing.T) {
+	// 3 frames of 20 ms
+	data := []byte{31<<3 | 3, 3, 1, 2, 3}
+	n, err := PacketFrames(data)
+	if err != nil || n != 3 {
+		t.Errorf("Unexpected number of frames: %d (%v)", n, err)
+	}
+	n, err = PacketSamples(data, 16000)
+	if err != nil || n != 960 {
+		t.Errorf("Unexpected number of samples: %d (%v)", n, err)
+	}
+}
+
+func TestParseEncodedPacket(t *testing.T) {
+	const SAMPLE_RATE = 48000
+	const FRAME_SIZE = SAMPLE_RATE * 20 / 1000
+	enc, err := NewEncoder(SAMPLE_RATE, 2, AppAudio)
+	if err != nil || enc == nil {
+		t.Fatalf("Error creating new encoder: %v", err)
+	}
+	pcm := make([]int16, FRAME_SIZE*2)
+	addSine(pcm, SAMPLE_RATE, 440)
+	data := make([]byte, 1000)
+	n, err := enc.Encode(pcm, data)
+	if err != nil {
+		t.Fatalf("Couldn't encode data: %v", err)
+	}
+	p, err := ParsePacket(data[:n])
+	if err != nil {
+		t.Fatalf("Couldn't parse encoded packet: %v", err)
+	}
+	if p.Samples() != FRAME_SIZE {
+		t.Errorf("Unexpected number of samples in packet: %d", p.Samples())
+	}
+	if !p.TOC.Stereo() {
+		t.Errorf("Expected stereo packet")
+	}
+}
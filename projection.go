@@ -0,0 +1,940 @@
+// Copyright © Go Opus Authors (see AUTHORS file)
+//
+// License for use of this code is detailed in the LICENSE file
+
+package opus
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+/*
+#cgo pkg-config: opus
+#include <opus_projection.h>
+
+int
+bridge_projection_encoder_ctl(OpusProjectionEncoder *st, int request)
+{
+	return opus_projection_encoder_ctl(st, request);
+}
+
+int
+bridge_projection_encoder_set_int32(OpusProjectionEncoder *st, int request, opus_int32 value)
+{
+	return opus_projection_encoder_ctl(st, request, value);
+}
+
+int
+bridge_projection_encoder_get_int32(OpusProjectionEncoder *st, int request, opus_int32 *value)
+{
+	return opus_projection_encoder_ctl(st, request, value);
+}
+
+int
+bridge_projection_encoder_get_uint32(OpusProjectionEncoder *st, int request, opus_uint32 *value)
+{
+	return opus_projection_encoder_ctl(st, request, value);
+}
+
+int
+bridge_projection_encoder_get_demixing_matrix(OpusProjectionEncoder *st, unsigned char *matrix, opus_int32 size)
+{
+	return opus_projection_encoder_ctl(st, OPUS_PROJECTION_GET_DEMIXING_MATRIX(matrix, size));
+}
+
+int
+bridge_projection_encoder_get_demixing_matrix_size(OpusProjectionEncoder *st, opus_int32 *size)
+{
+	return opus_projection_encoder_ctl(st, OPUS_PROJECTION_GET_DEMIXING_MATRIX_SIZE(size));
+}
+
+int
+bridge_projection_encoder_get_demixing_matrix_gain(OpusProjectionEncoder *st, opus_int32 *gain)
+{
+	return opus_projection_encoder_ctl(st, OPUS_PROJECTION_GET_DEMIXING_MATRIX_GAIN(gain));
+}
+
+int
+bridge_projection_encoder_set_bitrate(OpusProjectionEncoder *st, opus_int32 bitrate)
+{
+	return opus_projection_encoder_ctl(st, OPUS_SET_BITRATE(bitrate));
+}
+
+int
+bridge_projection_encoder_get_bitrate(OpusProjectionEncoder *st, opus_int32 *bitrate)
+{
+	return opus_projection_encoder_ctl(st, OPUS_GET_BITRATE(bitrate));
+}
+
+int
+bridge_projection_encoder_set_complexity(OpusProjectionEncoder *st, opus_int32 complexity)
+{
+	return opus_projection_encoder_ctl(st, OPUS_SET_COMPLEXITY(complexity));
+}
+
+int
+bridge_projection_encoder_get_complexity(OpusProjectionEncoder *st, opus_int32 *complexity)
+{
+	return opus_projection_encoder_ctl(st, OPUS_GET_COMPLEXITY(complexity));
+}
+
+int
+bridge_projection_encoder_get_lookahead(OpusProjectionEncoder *st, opus_int32 *lookahead)
+{
+	return opus_projection_encoder_ctl(st, OPUS_GET_LOOKAHEAD(lookahead));
+}
+
+int
+bridge_projection_encoder_get_final_range(OpusProjectionEncoder *st, opus_uint32 *final_range)
+{
+	return opus_projection_encoder_ctl(st, OPUS_GET_FINAL_RANGE(final_range));
+}
+
+int
+bridge_projection_encoder_reset_state(OpusProjectionEncoder *st)
+{
+	return opus_projection_encoder_ctl(st, OPUS_RESET_STATE);
+}
+
+int
+bridge_projection_decoder_ctl(OpusProjectionDecoder *st, int request)
+{
+	return opus_projection_decoder_ctl(st, request);
+}
+
+int
+bridge_projection_decoder_set_int32(OpusProjectionDecoder *st, int request, opus_int32 value)
+{
+	return opus_projection_decoder_ctl(st, request, value);
+}
+
+int
+bridge_projection_decoder_get_int32(OpusProjectionDecoder *st, int request, opus_int32 *value)
+{
+	return opus_projection_decoder_ctl(st, request, value);
+}
+
+int
+bridge_projection_decoder_get_uint32(OpusProjectionDecoder *st, int request, opus_uint32 *value)
+{
+	return opus_projection_decoder_ctl(st, request, value);
+}
+
+int
+bridge_projection_decoder_set_gain(OpusProjectionDecoder *st, opus_int32 gain)
+{
+	return opus_projection_decoder_ctl(st, OPUS_SET_GAIN(gain));
+}
+
+int
+bridge_projection_decoder_get_gain(OpusProjectionDecoder *st, opus_int32 *gain)
+{
+	return opus_projection_decoder_ctl(st, OPUS_GET_GAIN(gain));
+}
+
+int
+bridge_projection_decoder_get_last_packet_duration(OpusProjectionDecoder *st, opus_int32 *samples)
+{
+	return opus_projection_decoder_ctl(st, OPUS_GET_LAST_PACKET_DURATION(samples));
+}
+
+int
+bridge_projection_decoder_get_final_range(OpusProjectionDecoder *st, opus_uint32 *final_range)
+{
+	return opus_projection_decoder_ctl(st, OPUS_GET_FINAL_RANGE(final_range));
+}
+
+int
+bridge_projection_decoder_reset_state(OpusProjectionDecoder *st)
+{
+	return opus_projection_decoder_ctl(st, OPUS_RESET_STATE);
+}
+*/
+import "C"
+
+// Ogg Opus channel mapping family for ambisonics with a demixing matrix.
+const projectionMappingFamily = 3
+
+// AmbisonicOrder returns the ambisonic order for a channel count, and whether
+// the channel count is valid for ambisonics: (order+1)² ambisonic channels,
+// optionally followed by two non-diegetic (head-locked) stereo channels. See
+// RFC 8486, section 3.
+func AmbisonicOrder(channels int) (int, bool) {
+	if channels < 1 || channels > 227 {
+		return 0, false
+	}
+	for order := 0; order <= 14; order++ {
+		n := (order + 1) * (order + 1)
+		if channels == n || channels == n+2 {
+			return order, true
+		}
+	}
+	return 0, false
+}
+
+func checkAmbisonicChannels(channels int) error {
+	if _, ok := AmbisonicOrder(channels); !ok {
+		return fmt.Errorf("%w: %d is not a valid ambisonic channel count", ErrInvalidChannels, channels)
+	}
+	return nil
+}
+
+// ProjectionEncoder encodes ambisonics with Ogg Opus channel mapping family 3.
+// The input channels are mixed into the coded streams with a mixing matrix;
+// decoders need the matching demixing matrix, see DemixingMatrix.
+//
+// libopus supports ambisonic orders 1 to 3 since version 1.3, and up to order
+// 5 in later versions.
+type ProjectionEncoder struct {
+	p              *C.struct_OpusProjectionEncoder
+	channels       int
+	streams        int
+	coupledStreams int
+	sample_rate    int
+	// Same purpose as encoder struct
+	mem []byte
+}
+
+// NewProjectionEncoder allocates a new projection encoder for the given
+// number of ambisonic channels.
+func NewProjectionEncoder(sample_rate int, channels int, application Application) (*ProjectionEncoder, error) {
+	var enc ProjectionEncoder
+	err := enc.Init(sample_rate, channels, application)
+	if err != nil {
+		return nil, err
+	}
+	return &enc, nil
+}
+
+// Init initializes a pre-allocated projection encoder.
+func (enc *ProjectionEncoder) Init(sample_rate int, channels int, application Application) error {
+	if enc.p != nil {
+		return ErrAlreadyInitialized
+	}
+	if err := checkAmbisonicChannels(channels); err != nil {
+		return err
+	}
+	size := C.opus_projection_ambisonics_encoder_get_size(C.int(channels), projectionMappingFamily)
+	if size <= 0 {
+		return fmt.Errorf("%w: %d ambisonic channels are not supported by this libopus",
+			ErrUnimplemented, channels)
+	}
+	enc.mem = make([]byte, size)
+	enc.p = (*C.OpusProjectionEncoder)(unsafe.Pointer(&enc.mem[0]))
+	var streams, coupledStreams C.int
+	errno := int(C.opus_projection_ambisonics_encoder_init(
+		enc.p,
+		C.opus_int32(sample_rate),
+		C.int(channels),
+		projectionMappingFamily,
+		&streams,
+		&coupledStreams,
+		C.int(application)))
+	if errno != 0 {
+		enc.p = nil
+		return &OpError{
+			Op:   "opus_projection_ambisonics_encoder_init",
+			Args: fmt.Sprintf("Fs=%d, channels=%d, application=%d", sample_rate, channels, application),
+			Err:  Error(errno),
+		}
+	}
+	enc.channels = channels
+	enc.streams = int(streams)
+	enc.coupledStreams = int(coupledStreams)
+	enc.sample_rate = sample_rate
+	return nil
+}
+
+// Encode raw interleaved ambisonic PCM data (ACN channel order, SN3D
+// normalization) and store the resulting packet in the supplied buffer. On
+// success, returns the number of bytes used up by the encoded data.
+func (enc *ProjectionEncoder) Encode(pcm []int16, data []byte) (int, error) {
+	if enc.p == nil {
+		return 0, ErrEncoderUninitialized
+	}
+	if len(pcm) == 0 {
+		return 0, ErrNoData
+	}
+	if len(data) == 0 {
+		return 0, ErrTargetBufferEmpty
+	}
+	if len(pcm)%enc.channels != 0 {
+		return 0, ErrBufferChannels
+	}
+	samples := len(pcm) / enc.channels
+	n := int(C.opus_projection_encode(
+		enc.p,
+		(*C.opus_int16)(&pcm[0]),
+		C.int(samples),
+		(*C.uchar)(&data[0]),
+		C.opus_int32(cap(data))))
+	if n < 0 {
+		return 0, &OpError{
+			Op:   "opus_projection_encode",
+			Args: fmt.Sprintf("frame_size=%d, max_data_bytes=%d", samples, cap(data)),
+			Err:  Error(n),
+		}
+	}
+	return n, nil
+}
+
+// EncodeFloat32 is the same as Encode, but takes float32 PCM data.
+func (enc *ProjectionEncoder) EncodeFloat32(pcm []float32, data []byte) (int, error) {
+	if enc.p == nil {
+		return 0, ErrEncoderUninitialized
+	}
+	if len(pcm) == 0 {
+		return 0, ErrNoData
+	}
+	if len(data) == 0 {
+		return 0, ErrTargetBufferEmpty
+	}
+	if len(pcm)%enc.channels != 0 {
+		return 0, ErrBufferChannels
+	}
+	samples := len(pcm) / enc.channels
+	n := int(C.opus_projection_encode_float(
+		enc.p,
+		(*C.float)(&pcm[0]),
+		C.int(samples),
+		(*C.uchar)(&data[0]),
+		C.opus_int32(cap(data))))
+	if n < 0 {
+		return 0, &OpError{
+			Op:   "opus_projection_encode_float",
+			Args: fmt.Sprintf("frame_size=%d, max_data_bytes=%d", samples, cap(data)),
+			Err:  Error(n),
+		}
+	}
+	return n, nil
+}
+
+// Channels returns the number of input channels.
+func (enc *ProjectionEncoder) Channels() int {
+	return enc.channels
+}
+
+// Streams returns the total number of Opus streams in each packet.
+func (enc *ProjectionEncoder) Streams() int {
+	return enc.streams
+}
+
+// CoupledStreams returns the number of stereo streams in each packet.
+func (enc *ProjectionEncoder) CoupledStreams() int {
+	return enc.coupledStreams
+}
+
+// DemixingMatrix returns the matrix that decoders need to turn the decoded
+// streams back into ambisonic channels, in the format stored in the OpusHead
+// for mapping family 3: little endian 16-bit values, column by column, with
+// one column per coded channel and one row per output channel.
+func (enc *ProjectionEncoder) DemixingMatrix() ([]byte, error) {
+	var size C.opus_int32
+	res := C.bridge_projection_encoder_get_demixing_matrix_size(enc.p, &size)
+	if res != C.OPUS_OK {
+		return nil, &OpError{
+			Op:   "opus_projection_encoder_ctl",
+			Args: "OPUS_PROJECTION_GET_DEMIXING_MATRIX_SIZE",
+			Err:  Error(res),
+		}
+	}
+	if size <= 0 {
+		return nil, ErrInternalError
+	}
+	matrix := make([]byte, size)
+	res = C.bridge_projection_encoder_get_demixing_matrix(enc.p, (*C.uchar)(&matrix[0]), size)
+	if res != C.OPUS_OK {
+		return nil, &OpError{
+			Op:   "opus_projection_encoder_ctl",
+			Args: fmt.Sprintf("OPUS_PROJECTION_GET_DEMIXING_MATRIX(%d)", size),
+			Err:  Error(res),
+		}
+	}
+	return matrix, nil
+}
+
+// DemixingMatrixGain returns the gain of the demixing matrix in Q8 dB units.
+// It must be added to the output gain in the OpusHead, see Head.
+func (enc *ProjectionEncoder) DemixingMatrixGain() (int, error) {
+	var gain C.opus_int32
+	res := C.bridge_projection_encoder_get_demixing_matrix_gain(enc.p, &gain)
+	if res != C.OPUS_OK {
+		return 0, &OpError{
+			Op:   "opus_projection_encoder_ctl",
+			Args: "OPUS_PROJECTION_GET_DEMIXING_MATRIX_GAIN",
+			Err:  Error(res),
+		}
+	}
+	return int(gain), nil
+}
+
+// Head returns the header of an Ogg Opus stream encoded by this encoder, with
+// mapping family 3. The output gain is the gain of the demixing matrix and the
+// pre-skip is the encoder lookahead.
+func (enc *ProjectionEncoder) Head() (*Head, error) {
+	lookahead, err := enc.Lookahead()
+	if err != nil {
+		return nil, err
+	}
+	matrix, err := enc.DemixingMatrix()
+	if err != nil {
+		return nil, err
+	}
+	gain, err := enc.DemixingMatrixGain()
+	if err != nil {
+		return nil, err
+	}
+	return &Head{
+		Version:         1,
+		Channels:        enc.channels,
+		PreSkip:         lookahead * 48000 / enc.sample_rate,
+		InputSampleRate: enc.sample_rate,
+		OutputGain:      gain,
+		MappingFamily:   projectionMappingFamily,
+		Streams:         enc.streams,
+		CoupledStreams:  enc.coupledStreams,
+		DemixingMatrix:  matrix,
+	}, nil
+}
+
+// SetBitrate sets the total bitrate of all streams.
+func (enc *ProjectionEncoder) SetBitrate(bitrate int) error {
+	res := C.bridge_projection_encoder_set_bitrate(enc.p, C.opus_int32(bitrate))
+	if res != C.OPUS_OK {
+		return &OpError{
+			Op:   "opus_projection_encoder_ctl",
+			Args: fmt.Sprintf("OPUS_SET_BITRATE(%d)", bitrate),
+			Err:  Error(res),
+		}
+	}
+	return nil
+}
+
+// Bitrate returns the total bitrate of all streams.
+func (enc *ProjectionEncoder) Bitrate() (int, error) {
+	var bitrate C.opus_int32
+	res := C.bridge_projection_encoder_get_bitrate(enc.p, &bitrate)
+	if res != C.OPUS_OK {
+		return 0, &OpError{
+			Op:   "opus_projection_encoder_ctl",
+			Args: "OPUS_GET_BITRATE",
+			Err:  Error(res),
+		}
+	}
+	return int(bitrate), nil
+}
+
+// SetComplexity sets the encoder's computational complexity for all streams.
+func (enc *ProjectionEncoder) SetComplexity(complexity int) error {
+	res := C.bridge_projection_encoder_set_complexity(enc.p, C.opus_int32(complexity))
+	if res != C.OPUS_OK {
+		return &OpError{
+			Op:   "opus_projection_encoder_ctl",
+			Args: fmt.Sprintf("OPUS_SET_COMPLEXITY(%d)", complexity),
+			Err:  Error(res),
+		}
+	}
+	return nil
+}
+
+// Complexity returns the computational complexity used by the encoder.
+func (enc *ProjectionEncoder) Complexity() (int, error) {
+	var complexity C.opus_int32
+	res := C.bridge_projection_encoder_get_complexity(enc.p, &complexity)
+	if res != C.OPUS_OK {
+		return 0, &OpError{
+			Op:   "opus_projection_encoder_ctl",
+			Args: "OPUS_GET_COMPLEXITY",
+			Err:  Error(res),
+		}
+	}
+	return int(complexity), nil
+}
+
+// Lookahead returns the number of samples of delay added by the encoder, at
+// the encoder sample rate.
+func (enc *ProjectionEncoder) Lookahead() (int, error) {
+	var lookahead C.opus_int32
+	res := C.bridge_projection_encoder_get_lookahead(enc.p, &lookahead)
+	if res != C.OPUS_OK {
+		return 0, &OpError{
+			Op:   "opus_projection_encoder_ctl",
+			Args: "OPUS_GET_LOOKAHEAD",
+			Err:  Error(res),
+		}
+	}
+	return int(lookahead), nil
+}
+
+// FinalRange returns the final state of the range coders of the most recently
+// encoded packet, combined over all streams.
+func (enc *ProjectionEncoder) FinalRange() (uint32, error) {
+	var finalRange C.opus_uint32
+	res := C.bridge_projection_encoder_get_final_range(enc.p, &finalRange)
+	if res != C.OPUS_OK {
+		return 0, &OpError{
+			Op:   "opus_projection_encoder_ctl",
+			Args: "OPUS_GET_FINAL_RANGE",
+			Err:  Error(res),
+		}
+	}
+	return uint32(finalRange), nil
+}
+
+// Reset resets the codec state of all streams.
+func (enc *ProjectionEncoder) Reset() error {
+	res := C.bridge_projection_encoder_reset_state(enc.p)
+	if res != C.OPUS_OK {
+		return &OpError{
+			Op:   "opus_projection_encoder_ctl",
+			Args: "OPUS_RESET_STATE",
+			Err:  Error(res),
+		}
+	}
+	return nil
+}
+
+// CtlInt32 performs a ctl that takes a single opus_int32 value. See
+// Encoder.CtlInt32.
+func (enc *ProjectionEncoder) CtlInt32(request int, value int32) error {
+	if enc.p == nil {
+		return ErrEncoderUninitialized
+	}
+	if err := checkCtl(request, false); err != nil {
+		return err
+	}
+	res := C.bridge_projection_encoder_set_int32(enc.p, C.int(request), C.opus_int32(value))
+	if res != C.OPUS_OK {
+		return &OpError{
+			Op:   "opus_projection_encoder_ctl",
+			Args: fmt.Sprintf("%d, %d", request, value),
+			Err:  Error(res),
+		}
+	}
+	return nil
+}
+
+// CtlGetInt32 performs a ctl that returns a single opus_int32 value. See
+// Encoder.CtlGetInt32.
+func (enc *ProjectionEncoder) CtlGetInt32(request int) (int32, error) {
+	if enc.p == nil {
+		return 0, ErrEncoderUninitialized
+	}
+	if err := checkCtl(request, true); err != nil {
+		return 0, err
+	}
+	var value C.opus_int32
+	res := C.bridge_projection_encoder_get_int32(enc.p, C.int(request), &value)
+	if res != C.OPUS_OK {
+		return 0, &OpError{
+			Op:   "opus_projection_encoder_ctl",
+			Args: fmt.Sprintf("%d", request),
+			Err:  Error(res),
+		}
+	}
+	return int32(value), nil
+}
+
+// CtlGetUint32 performs a ctl that returns a single opus_uint32 value.
+func (enc *ProjectionEncoder) CtlGetUint32(request int) (uint32, error) {
+	if enc.p == nil {
+		return 0, ErrEncoderUninitialized
+	}
+	if err := checkCtl(request, true); err != nil {
+		return 0, err
+	}
+	var value C.opus_uint32
+	res := C.bridge_projection_encoder_get_uint32(enc.p, C.int(request), &value)
+	if res != C.OPUS_OK {
+		return 0, &OpError{
+			Op:   "opus_projection_encoder_ctl",
+			Args: fmt.Sprintf("%d", request),
+			Err:  Error(res),
+		}
+	}
+	return uint32(value), nil
+}
+
+// Ctl performs a ctl that takes no argument. The only such request is
+// OPUS_RESET_STATE (4028); any other request returns ErrBadArg.
+func (enc *ProjectionEncoder) Ctl(request int) error {
+	if enc.p == nil {
+		return ErrEncoderUninitialized
+	}
+	if err := checkNoArgCtl(request); err != nil {
+		return err
+	}
+	res := C.bridge_projection_encoder_ctl(enc.p, C.int(request))
+	if res != C.OPUS_OK {
+		return &OpError{
+			Op:   "opus_projection_encoder_ctl",
+			Args: fmt.Sprintf("%d", request),
+			Err:  Error(res),
+		}
+	}
+	return nil
+}
+
+// ProjectionDecoder decodes ambisonics encoded with Ogg Opus channel mapping
+// family 3, the counterpart of ProjectionEncoder.
+type ProjectionDecoder struct {
+	p              *C.struct_OpusProjectionDecoder
+	channels       int
+	streams        int
+	coupledStreams int
+	sample_rate    int
+	// Same purpose as encoder struct
+	mem []byte
+}
+
+// NewProjectionDecoder allocates a new projection decoder. The stream counts
+// and the demixing matrix come from the OpusHead, or directly from
+// ProjectionEncoder.DemixingMatrix.
+func NewProjectionDecoder(sample_rate int, channels int, streams int, coupledStreams int,
+	demixingMatrix []byte) (*ProjectionDecoder, error) {
+	var dec ProjectionDecoder
+	err := dec.Init(sample_rate, channels, streams, coupledStreams, demixingMatrix)
+	if err != nil {
+		return nil, err
+	}
+	return &dec, nil
+}
+
+// Init initializes a pre-allocated projection decoder.
+func (dec *ProjectionDecoder) Init(sample_rate int, channels int, streams int, coupledStreams int,
+	demixingMatrix []byte) error {
+	if dec.p != nil {
+		return ErrAlreadyInitialized
+	}
+	if err := checkAmbisonicChannels(channels); err != nil {
+		return err
+	}
+	if streams < 1 || coupledStreams < 0 || coupledStreams > streams || streams+coupledStreams > 255 {
+		return fmt.Errorf("%w: %d streams of which %d coupled", ErrBadArg, streams, coupledStreams)
+	}
+	if expected := 2 * channels * (streams + coupledStreams); len(demixingMatrix) != expected {
+		return fmt.Errorf("%w: demixing matrix has %d bytes, expected %d",
+			ErrBadArg, len(demixingMatrix), expected)
+	}
+	size := C.opus_projection_decoder_get_size(C.int(channels), C.int(streams), C.int(coupledStreams))
+	if size <= 0 {
+		return ErrBadArg
+	}
+	dec.mem = make([]byte, size)
+	dec.p = (*C.OpusProjectionDecoder)(unsafe.Pointer(&dec.mem[0]))
+	// libopus does not modify the matrix, but does not declare it const
+	matrix := append([]byte(nil), demixingMatrix...)
+	errno := int(C.opus_projection_decoder_init(
+		dec.p,
+		C.opus_int32(sample_rate),
+		C.int(channels),
+		C.int(streams),
+		C.int(coupledStreams),
+		(*C.uchar)(&matrix[0]),
+		C.opus_int32(len(matrix))))
+	if errno != 0 {
+		dec.p = nil
+		return &OpError{
+			Op: "opus_projection_decoder_init",
+			Args: fmt.Sprintf("Fs=%d, channels=%d, streams=%d, coupled_streams=%d",
+				sample_rate, channels, streams, coupledStreams),
+			Err: Error(errno),
+		}
+	}
+	dec.channels = channels
+	dec.streams = streams
+	dec.coupledStreams = coupledStreams
+	dec.sample_rate = sample_rate
+	return nil
+}
+
+// decode wraps opus_projection_decode. A nil packet conceals a lost packet.
+func (dec *ProjectionDecoder) decode(data []byte, pcm []int16, fec bool) (int, error) {
+	if dec.p == nil {
+		return 0, ErrDecoderUninitialized
+	}
+	if len(pcm) == 0 {
+		return 0, ErrTargetBufferEmpty
+	}
+	if cap(pcm)%dec.channels != 0 {
+		return 0, ErrBufferChannels
+	}
+	var ptr *C.uchar
+	if len(data) > 0 {
+		ptr = (*C.uchar)(&data[0])
+	}
+	decodeFEC := 0
+	if fec {
+		decodeFEC = 1
+	}
+	n := int(C.opus_projection_decode(
+		dec.p,
+		ptr,
+		C.opus_int32(len(data)),
+		(*C.opus_int16)(&pcm[0]),
+		C.int(cap(pcm)/dec.channels),
+		C.int(decodeFEC)))
+	if n < 0 {
+		return 0, &OpError{
+			Op: "opus_projection_decode",
+			Args: fmt.Sprintf("len=%d, frame_size=%d, decode_fec=%d",
+				len(data), cap(pcm)/dec.channels, decodeFEC),
+			Err: Error(n),
+		}
+	}
+	return n, nil
+}
+
+// decodeFloat32 wraps opus_projection_decode_float.
+func (dec *ProjectionDecoder) decodeFloat32(data []byte, pcm []float32, fec bool) (int, error) {
+	if dec.p == nil {
+		return 0, ErrDecoderUninitialized
+	}
+	if len(pcm) == 0 {
+		return 0, ErrTargetBufferEmpty
+	}
+	if cap(pcm)%dec.channels != 0 {
+		return 0, ErrBufferChannels
+	}
+	var ptr *C.uchar
+	if len(data) > 0 {
+		ptr = (*C.uchar)(&data[0])
+	}
+	decodeFEC := 0
+	if fec {
+		decodeFEC = 1
+	}
+	n := int(C.opus_projection_decode_float(
+		dec.p,
+		ptr,
+		C.opus_int32(len(data)),
+		(*C.float)(&pcm[0]),
+		C.int(cap(pcm)/dec.channels),
+		C.int(decodeFEC)))
+	if n < 0 {
+		return 0, &OpError{
+			Op: "opus_projection_decode_float",
+			Args: fmt.Sprintf("len=%d, frame_size=%d, decode_fec=%d",
+				len(data), cap(pcm)/dec.channels, decodeFEC),
+			Err: Error(n),
+		}
+	}
+	return n, nil
+}
+
+// Decode a packet into the supplied buffer as interleaved ambisonic PCM data.
+// On success, returns the number of samples per channel written to the target
+// buffer.
+func (dec *ProjectionDecoder) Decode(data []byte, pcm []int16) (int, error) {
+	if len(data) == 0 {
+		return 0, ErrNoData
+	}
+	return dec.decode(data, pcm, false)
+}
+
+// DecodeFloat32 is the same as Decode, but decodes to float32 PCM data.
+func (dec *ProjectionDecoder) DecodeFloat32(data []byte, pcm []float32) (int, error) {
+	if len(data) == 0 {
+		return 0, ErrNoData
+	}
+	return dec.decodeFloat32(data, pcm, false)
+}
+
+// DecodeFEC recovers a lost packet from the forward error correction data in
+// the packet directly following it. See Decoder.DecodeFEC.
+func (dec *ProjectionDecoder) DecodeFEC(data []byte, pcm []int16) error {
+	if len(data) == 0 {
+		return ErrNoData
+	}
+	_, err := dec.decode(data, pcm, true)
+	return err
+}
+
+// DecodeFECFloat32 is the same as DecodeFEC, but decodes to float32 PCM data.
+func (dec *ProjectionDecoder) DecodeFECFloat32(data []byte, pcm []float32) error {
+	if len(data) == 0 {
+		return ErrNoData
+	}
+	_, err := dec.decodeFloat32(data, pcm, true)
+	return err
+}
+
+// DecodePLC conceals a lost packet using packet loss concealment. See
+// Decoder.DecodePLC.
+func (dec *ProjectionDecoder) DecodePLC(pcm []int16) error {
+	_, err := dec.decode(nil, pcm, false)
+	return err
+}
+
+// DecodePLCFloat32 is the same as DecodePLC, but decodes to float32 PCM data.
+func (dec *ProjectionDecoder) DecodePLCFloat32(pcm []float32) error {
+	_, err := dec.decodeFloat32(nil, pcm, false)
+	return err
+}
+
+// Channels returns the number of output channels.
+func (dec *ProjectionDecoder) Channels() int {
+	return dec.channels
+}
+
+// Streams returns the total number of Opus streams in each packet.
+func (dec *ProjectionDecoder) Streams() int {
+	return dec.streams
+}
+
+// CoupledStreams returns the number of stereo streams in each packet.
+func (dec *ProjectionDecoder) CoupledStreams() int {
+	return dec.coupledStreams
+}
+
+// SetGain configures the output gain in Q8 dB units, see Decoder.SetGain.
+func (dec *ProjectionDecoder) SetGain(gain int) error {
+	res := C.bridge_projection_decoder_set_gain(dec.p, C.opus_int32(gain))
+	if res != C.OPUS_OK {
+		return &OpError{
+			Op:   "opus_projection_decoder_ctl",
+			Args: fmt.Sprintf("OPUS_SET_GAIN(%d)", gain),
+			Err:  Error(res),
+		}
+	}
+	return nil
+}
+
+// Gain returns the configured output gain in Q8 dB units.
+func (dec *ProjectionDecoder) Gain() (int, error) {
+	var gain C.opus_int32
+	res := C.bridge_projection_decoder_get_gain(dec.p, &gain)
+	if res != C.OPUS_OK {
+		return 0, &OpError{
+			Op:   "opus_projection_decoder_ctl",
+			Args: "OPUS_GET_GAIN",
+			Err:  Error(res),
+		}
+	}
+	return int(gain), nil
+}
+
+// LastPacketDuration gets the duration (in samples) of the last packet
+// successfully decoded or concealed.
+func (dec *ProjectionDecoder) LastPacketDuration() (int, error) {
+	var samples C.opus_int32
+	res := C.bridge_projection_decoder_get_last_packet_duration(dec.p, &samples)
+	if res != C.OPUS_OK {
+		return 0, &OpError{
+			Op:   "opus_projection_decoder_ctl",
+			Args: "OPUS_GET_LAST_PACKET_DURATION",
+			Err:  Error(res),
+		}
+	}
+	return int(samples), nil
+}
+
+// FinalRange returns the final state of the range decoders after the most
+// recently decoded packet, combined over all streams.
+func (dec *ProjectionDecoder) FinalRange() (uint32, error) {
+	var finalRange C.opus_uint32
+	res := C.bridge_projection_decoder_get_final_range(dec.p, &finalRange)
+	if res != C.OPUS_OK {
+		return 0, &OpError{
+			Op:   "opus_projection_decoder_ctl",
+			Args: "OPUS_GET_FINAL_RANGE",
+			Err:  Error(res),
+		}
+	}
+	return uint32(finalRange), nil
+}
+
+// Reset resets the decoder state of all streams.
+func (dec *ProjectionDecoder) Reset() error {
+	res := C.bridge_projection_decoder_reset_state(dec.p)
+	if res != C.OPUS_OK {
+		return &OpError{
+			Op:   "opus_projection_decoder_ctl",
+			Args: "OPUS_RESET_STATE",
+			Err:  Error(res),
+		}
+	}
+	return nil
+}
+
+// CtlInt32 performs a ctl that takes a single opus_int32 value. See
+// Encoder.CtlInt32.
+func (dec *ProjectionDecoder) CtlInt32(request int, value int32) error {
+	if dec.p == nil {
+		return ErrDecoderUninitialized
+	}
+	if err := checkCtl(request, false); err != nil {
+		return err
+	}
+	res := C.bridge_projection_decoder_set_int32(dec.p, C.int(request), C.opus_int32(value))
+	if res != C.OPUS_OK {
+		return &OpError{
+			Op:   "opus_projection_decoder_ctl",
+			Args: fmt.Sprintf("%d, %d", request, value),
+			Err:  Error(res),
+		}
+	}
+	return nil
+}
+
+// CtlGetInt32 performs a ctl that returns a single opus_int32 value. See
+// Encoder.CtlGetInt32.
+func (dec *ProjectionDecoder) CtlGetInt32(request int) (int32, error) {
+	if dec.p == nil {
+		return 0, ErrDecoderUninitialized
+	}
+	if err := checkCtl(request, true); err != nil {
+		return 0, err
+	}
+	var value C.opus_int32
+	res := C.bridge_projection_decoder_get_int32(dec.p, C.int(request), &value)
+	if res != C.OPUS_OK {
+		return 0, &OpError{
+			Op:   "opus_projection_decoder_ctl",
+			Args: fmt.Sprintf("%d", request),
+			Err:  Error(res),
+		}
+	}
+	return int32(value), nil
+}
+
+// CtlGetUint32 performs a ctl that returns a single opus_uint32 value.
+func (dec *ProjectionDecoder) CtlGetUint32(request int) (uint32, error) {
+	if dec.p == nil {
+		return 0, ErrDecoderUninitialized
+	}
+	if err := checkCtl(request, true); err != nil {
+		return 0, err
+	}
+	var value C.opus_uint32
+	res := C.bridge_projection_decoder_get_uint32(dec.p, C.int(request), &value)
+	if res != C.OPUS_OK {
+		return 0, &OpError{
+			Op:   "opus_projection_decoder_ctl",
+			Args: fmt.Sprintf("%d", request),
+			Err:  Error(res),
+		}
+	}
+	return uint32(value), nil
+}
+
+// Ctl performs a ctl that takes no argument. The only such request is
+// OPUS_RESET_STATE (4028); any other request returns ErrBadArg.
+func (dec *ProjectionDecoder) Ctl(request int) error {
+	if dec.p == nil {
+		return ErrDecoderUninitialized
+	}
+	if err := checkNoArgCtl(request); err != nil {
+		return err
+	}
+	res := C.bridge_projection_decoder_ctl(dec.p, C.int(request))
+	if res != C.OPUS_OK {
+		return &OpError{
+			Op:   "opus_projection_decoder_ctl",
+			Args: fmt.Sprintf("%d", request),
+			Err:  Error(res),
+		}
+	}
+	return nil
+}
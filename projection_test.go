@@ -0,0 +1,133 @@
+// Copyright © Go Opus Authors (see AUTHORS file)
+//
+// License for use of this code is detailed in the LICENSE file
+
+package opus
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestAmbisonicOrder(t *testing.T) {
+	for _, c := range []struct {
+		channels, order int
+		valid           bool
+	}{
+		{1, 0, true},
+		{3, 0, true},
+		{4, 1, true},
+		{6, 1, true},
+		{9, 2, true},
+		{16, 3, true},
+		{18, 3, true},
+		{225, 14, true},
+		{227, 14, true},
+		{0, 0, false},
+		{2, 0, false},
+		{5, 0, false},
+		{17, 0, false},
+		{226, 0, false},
+		{256, 0, false},
+	} {
+		order, ok := AmbisonicOrder(c.channels)
+		if ok != c.valid || order != c.order {
+			t.Errorf("Unexpected result for %d channels: order %d, valid %v", c.channels, order, ok)
+		}
+	}
+	if _, err := NewProjectionEncoder(48000, 5, AppAudio); !errors.Is(err, ErrInvalidChannels) {
+		t.Errorf("Expected ErrInvalidChannels, got %v", err)
+	}
+	if _, err := NewProjectionDecoder(48000, 5, 3, 2, make([]byte, 50)); !errors.Is(err, ErrInvalidChannels) {
+		t.Errorf("Expected ErrInvalidChannels, got %v", err)
+	}
+}
+
+func TestProjectionCodec(t *testing.T) {
+	const SAMPLE_RATE = 48000
+	const FRAME_SIZE = SAMPLE_RATE * 20 / 1000
+	// First and third order ambisonics
+	for _, channels := range []int{4, 16} {
+		enc, err := NewProjectionEncoder(SAMPLE_RATE, channels, AppAudio)
+		if err != nil || enc == nil {
+			t.Fatalf("Error creating projection encoder for %d channels: %v", channels, err)
+		}
+		if enc.Streams()+enc.CoupledStreams() != channels {
+			t.Errorf("Unexpected layout for %d channels: %d streams, %d coupled",
+				channels, enc.Streams(), enc.CoupledStreams())
+		}
+		matrix, err := enc.DemixingMatrix()
+		if err != nil {
+			t.Fatalf("Couldn't get demixing matrix: %v", err)
+		}
+		if len(matrix) != 2*channels*channels {
+			t.Errorf("Unexpected demixing matrix size for %d channels: %d", channels, len(matrix))
+		}
+		if _, err := enc.DemixingMatrixGain(); err != nil {
+			t.Errorf("Couldn't get demixing matrix gain: %v", err)
+		}
+		head, err := enc.Head()
+		if err != nil || head.MappingFamily != 3 || !bytes.Equal(head.DemixingMatrix, matrix) {
+			t.Fatalf("Unexpected header: %+v (%v)", head, err)
+		}
+		// The matrix travels in the OpusHead
+		headData, err := head.MarshalBinary()
+		if err != nil || len(headData) != 21+len(matrix) {
+			t.Fatalf("Couldn't marshal header: %d bytes (%v)", len(headData), err)
+		}
+		var parsed Head
+		if err := parsed.UnmarshalBinary(headData); err != nil {
+			t.Fatalf("Couldn't unmarshal header: %v", err)
+		}
+		anyDec, err := NewDecoderFromHead(SAMPLE_RATE, &parsed)
+		if err != nil {
+			t.Fatalf("Error creating projection decoder for %d channels: %v", channels, err)
+		}
+		dec, ok := anyDec.(*ProjectionDecoder)
+		if !ok {
+			t.Fatalf("Expected ProjectionDecoder, got %T", anyDec)
+		}
+		if gain, err := dec.Gain(); err != nil || gain != head.OutputGain {
+			t.Errorf("Unexpected decoder gain: %d (%v)", gain, err)
+		}
+		// Only the omnidirectional W channel carries a tone
+		mono := make([]int16, FRAME_SIZE)
+		addSine(mono, SAMPLE_RATE, 440)
+		pcm := make([]int16, FRAME_SIZE*channels)
+		for i, v := range mono {
+			pcm[i*channels] = v / 2
+		}
+		data := make([]byte, 8000)
+		out := make([]int16, FRAME_SIZE*channels)
+		for frame := 0; frame < 5; frame++ {
+			n, err := enc.Encode(pcm, data)
+			if err != nil {
+				t.Fatalf("Couldn't encode %d channels: %v", channels, err)
+			}
+			m, err := dec.Decode(data[:n], out)
+			if err != nil {
+				t.Fatalf("Couldn't decode %d channels: %v", channels, err)
+			}
+			if m != FRAME_SIZE {
+				t.Errorf("Length mismatch for %d channels: %d samples in, %d out", channels, FRAME_SIZE, m)
+			}
+		}
+		var peak int16
+		for i := 0; i < len(out); i += channels {
+			if out[i] > peak {
+				peak = out[i]
+			}
+		}
+		if peak < 1000 {
+			t.Errorf("W channel of %d lost in round trip, peak %d", channels, peak)
+		}
+		if err := dec.DecodePLC(out); err != nil {
+			t.Errorf("Couldn't conceal lost packet: %v", err)
+		}
+		if _, err := NewProjectionDecoder(SAMPLE_RATE, channels, enc.Streams(), enc.CoupledStreams(),
+			matrix[1:]); !errors.Is(err, ErrBadArg) {
+			t.Errorf("Expected ErrBadArg for truncated matrix, got %v", err)
+		}
+	}
+}
@@ -0,0 +1,296 @@
+// Copyright © Go Opus Authors (see AUTHORS file)
+//
+// License for use of this code is detailed in the LICENSE file
+
+package opus
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+	"unsafe"
+)
+
+/*
+#cgo pkg-config: opus
+#include <opus.h>
+*/
+import "C"
+
+// Saved states start with a small header, so that a state is never restored
+// into an incompatible encoder or decoder:
+//
+//	magic          "GoOpusSt"
+//	format         uint8
+//	kind           uint8 (stateEncoder or stateDecoder)
+//	pointer size   uint8
+//	little endian  uint8 (0 or 1)
+//	version        uint16 length, followed by the libopus version string
+//	channels       uint32
+//	sample rate    uint32
+//	frame duration int32 (encoder only)
+//	process        16 bytes, identifying the process that saved the state
+//	state          uint32 length, followed by the raw libopus state
+//
+// All header fields are little endian.
+const (
+	stateMagic   = "GoOpusSt"
+	stateFormat  = 1
+	stateEncoder = 1
+	stateDecoder = 2
+)
+
+// stateHeader holds the Go-side fields of a saved state.
+type stateHeader struct {
+	kind          uint8
+	channels      int
+	sampleRate    int
+	frameDuration FrameDuration
+	process       [16]byte
+}
+
+var (
+	stateProcessOnce sync.Once
+	stateProcess     [16]byte
+	stateProcessErr  error
+)
+
+// stateProcessID returns a random ID for this process. The libopus state
+// contains pointers to static tables, like the CELT mode, and the layout of
+// the state is private to libopus, so these pointers cannot be told apart from
+// other data and rebased. A saved state is therefore only valid in the process
+// that saved it.
+func stateProcessID() ([16]byte, error) {
+	stateProcessOnce.Do(func() {
+		_, stateProcessErr = rand.Read(stateProcess[:])
+	})
+	return stateProcess, stateProcessErr
+}
+
+func littleEndian() bool {
+	x := uint16(1)
+	return *(*byte)(unsafe.Pointer(&x)) == 1
+}
+
+// saveState serializes a libopus state with its header.
+func saveState(h stateHeader, mem []byte) ([]byte, error) {
+	process, err := stateProcessID()
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	version := Version()
+	le := uint8(0)
+	if littleEndian() {
+		le = 1
+	}
+	buf.WriteString(stateMagic)
+	buf.Write([]byte{stateFormat, h.kind, uint8(unsafe.Sizeof(uintptr(0))), le})
+	binary.Write(&buf, binary.LittleEndian, uint16(len(version)))
+	buf.WriteString(version)
+	binary.Write(&buf, binary.LittleEndian, uint32(h.channels))
+	binary.Write(&buf, binary.LittleEndian, uint32(h.sampleRate))
+	if h.kind == stateEncoder {
+		binary.Write(&buf, binary.LittleEndian, int32(h.frameDuration))
+	}
+	buf.Write(process[:])
+	binary.Write(&buf, binary.LittleEndian, uint32(len(mem)))
+	buf.Write(mem)
+	return buf.Bytes(), nil
+}
+
+var errInvalidState = fmt.Errorf("%w: malformed data", ErrIncompatibleState)
+
+// parseState parses a saved state and checks that it was saved from the same
+// kind of object, by the same libopus build on the same architecture. Returns
+// the header and the raw libopus state.
+func parseState(data []byte, kind uint8) (stateHeader, []byte, error) {
+	var h stateHeader
+	r := bytes.NewReader(data)
+	magic := make([]byte, len(stateMagic))
+	var fixed [4]byte
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != stateMagic {
+		return h, nil, errInvalidState
+	}
+	if _, err := io.ReadFull(r, fixed[:]); err != nil || fixed[0] != stateFormat {
+		return h, nil, errInvalidState
+	}
+	h.kind = fixed[1]
+	if h.kind != kind {
+		if kind == stateEncoder {
+			return h, nil, fmt.Errorf("%w: not an encoder state", ErrIncompatibleState)
+		}
+		return h, nil, fmt.Errorf("%w: not a decoder state", ErrIncompatibleState)
+	}
+	le := uint8(0)
+	if littleEndian() {
+		le = 1
+	}
+	if int(fixed[2]) != int(unsafe.Sizeof(uintptr(0))) || fixed[3] != le {
+		return h, nil, fmt.Errorf("%w: saved on a different architecture", ErrIncompatibleState)
+	}
+	var versionLen uint16
+	if err := binary.Read(r, binary.LittleEndian, &versionLen); err != nil {
+		return h, nil, errInvalidState
+	}
+	version := make([]byte, versionLen)
+	if _, err := io.ReadFull(r, version); err != nil {
+		return h, nil, errInvalidState
+	}
+	if string(version) != Version() {
+		return h, nil, fmt.Errorf("%w: saved by %q, but this is %q", ErrIncompatibleState, version, Version())
+	}
+	var channels, sampleRate uint32
+	var frameDuration int32
+	if err := binary.Read(r, binary.LittleEndian, &channels); err != nil {
+		return h, nil, errInvalidState
+	}
+	if err := binary.Read(r, binary.LittleEndian, &sampleRate); err != nil {
+		return h, nil, errInvalidState
+	}
+	if kind == stateEncoder {
+		if err := binary.Read(r, binary.LittleEndian, &frameDuration); err != nil {
+			return h, nil, errInvalidState
+		}
+	}
+	if _, err := io.ReadFull(r, h.process[:]); err != nil {
+		return h, nil, errInvalidState
+	}
+	var size uint32
+	if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+		return h, nil, errInvalidState
+	}
+	if int(size) != r.Len() {
+		return h, nil, errInvalidState
+	}
+	mem := data[len(data)-int(size):]
+	h.channels = int(channels)
+	h.sampleRate = int(sampleRate)
+	h.frameDuration = FrameDuration(frameDuration)
+	return h, mem, nil
+}
+
+// restoreState copies a saved libopus state into mem. States saved by another
+// process are rejected: their pointers to static libopus data are only valid
+// in the process that saved them.
+func restoreState(h stateHeader, saved []byte, mem []byte) error {
+	process, err := stateProcessID()
+	if err != nil {
+		return err
+	}
+	if h.process != process {
+		return fmt.Errorf("%w: saved by another process, which is not supported", ErrIncompatibleState)
+	}
+	if len(saved) != len(mem) {
+		return fmt.Errorf("%w: size %d, expected %d", ErrIncompatibleState, len(saved), len(mem))
+	}
+	copy(mem, saved)
+	return nil
+}
+
+// Clone returns an independent copy of the encoder, including all settings
+// and the state built up by previous calls to Encode. This can be used for
+// speculative encoding, e.g. encoding the same frame at two bitrates and
+// keeping the better packet.
+func (enc *Encoder) Clone() (*Encoder, error) {
+	if enc.p == nil {
+		return nil, ErrEncoderUninitialized
+	}
+	clone := *enc
+	clone.mem = make([]byte, len(enc.mem))
+	copy(clone.mem, enc.mem)
+	clone.p = (*C.OpusEncoder)(unsafe.Pointer(&clone.mem[0]))
+	return &clone, nil
+}
+
+// SaveState serializes the complete encoder state, to be restored with
+// RestoreState.
+//
+// Moving a state to another process is not supported. The libopus state
+// contains pointers to static libopus data, in a layout that is private to
+// libopus, so it cannot be made portable from the outside. RestoreState returns
+// ErrIncompatibleState for a state saved by another process; the state is not
+// a format for storage either.
+func (enc *Encoder) SaveState() ([]byte, error) {
+	if enc.p == nil {
+		return nil, ErrEncoderUninitialized
+	}
+	return saveState(stateHeader{
+		kind:          stateEncoder,
+		channels:      enc.channels,
+		sampleRate:    enc.sample_rate,
+		frameDuration: enc.frameDuration,
+	}, enc.mem)
+}
+
+// RestoreState replaces the encoder state with one saved by SaveState. An
+// encoder that has not been initialized yet is initialized with the channels
+// and sample rate of the saved state; otherwise these must match.
+func (enc *Encoder) RestoreState(data []byte) error {
+	h, saved, err := parseState(data, stateEncoder)
+	if err != nil {
+		return err
+	}
+	if enc.p == nil {
+		if err := enc.Init(h.sampleRate, h.channels, AppAudio); err != nil {
+			return err
+		}
+	} else if enc.channels != h.channels || enc.sample_rate != h.sampleRate {
+		return fmt.Errorf("%w: %d channels at %d Hz, encoder has %d channels at %d Hz",
+			ErrIncompatibleState, h.channels, h.sampleRate, enc.channels, enc.sample_rate)
+	}
+	if err := restoreState(h, saved, enc.mem); err != nil {
+		return err
+	}
+	enc.frameDuration = h.frameDuration
+	return nil
+}
+
+// Clone returns an independent copy of the decoder, including the state built
+// up by previous calls to Decode.
+func (dec *Decoder) Clone() (*Decoder, error) {
+	if dec.p == nil {
+		return nil, ErrDecoderUninitialized
+	}
+	clone := *dec
+	clone.mem = make([]byte, len(dec.mem))
+	copy(clone.mem, dec.mem)
+	clone.p = (*C.OpusDecoder)(unsafe.Pointer(&clone.mem[0]))
+	return &clone, nil
+}
+
+// SaveState serializes the complete decoder state, e.g. to move a stream to
+// another goroutine. Like with Encoder.SaveState, moving a state to another
+// process is not supported.
+func (dec *Decoder) SaveState() ([]byte, error) {
+	if dec.p == nil {
+		return nil, ErrDecoderUninitialized
+	}
+	return saveState(stateHeader{
+		kind:       stateDecoder,
+		channels:   dec.channels,
+		sampleRate: dec.sample_rate,
+	}, dec.mem)
+}
+
+// RestoreState replaces the decoder state with one saved by SaveState. A
+// decoder that has not been initialized yet is initialized with the channels
+// and sample rate of the saved state; otherwise these must match.
+func (dec *Decoder) RestoreState(data []byte) error {
+	h, saved, err := parseState(data, stateDecoder)
+	if err != nil {
+		return err
+	}
+	if dec.p == nil {
+		if err := dec.Init(h.sampleRate, h.channels); err != nil {
+			return err
+		}
+	} else if dec.channels != h.channels || dec.sample_rate != h.sampleRate {
+		return fmt.Errorf("%w: %d channels at %d Hz, decoder has %d channels at %d Hz",
+			ErrIncompatibleState, h.channels, h.sampleRate, dec.channels, dec.sample_rate)
+	}
+	return restoreState(h, saved, dec.mem)
+}
@@ -0,0 +1,183 @@
+// Copyright © Go Opus Authors (see AUTHORS file)
+//
+// License for use of this code is detailed in the LICENSE file
+
+package opus
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func encodeFrames(t *testing.T, enc *Encoder, n int, frameSize int) [][]byte {
+	var packets [][]byte
+	for i := 0; i < n; i++ {
+		pcm := make([]int16, frameSize*enc.Channels())
+		addSine(pcm, 48000, float64(200+100*i))
+		data := make([]byte, 1000)
+		m, err := enc.Encode(pcm, data)
+		if err != nil {
+			t.Fatalf("Couldn't encode data: %v", err)
+		}
+		packets = append(packets, data[:m])
+	}
+	return packets
+}
+
+func TestDecoder_SaveRestoreState(t *testing.T) {
+	const SAMPLE_RATE = 48000
+	const FRAME_SIZE = SAMPLE_RATE * 20 / 1000
+	enc, err := NewEncoder(SAMPLE_RATE, 2, AppVoIP)
+	if err != nil || enc == nil {
+		t.Fatalf("Error creating new encoder: %v", err)
+	}
+	packets := encodeFrames(t, enc, 20, FRAME_SIZE)
+	dec, err := NewDecoder(SAMPLE_RATE, 2)
+	if err != nil || dec == nil {
+		t.Fatalf("Error creating new decoder: %v", err)
+	}
+	pcm := make([]int16, FRAME_SIZE*2)
+	for _, packet := range packets[:10] {
+		if _, err := dec.Decode(packet, pcm); err != nil {
+			t.Fatalf("Couldn't decode data: %v", err)
+		}
+	}
+	state, err := dec.SaveState()
+	if err != nil {
+		t.Fatalf("Error saving decoder state: %v", err)
+	}
+	var restored Decoder
+	if err := restored.RestoreState(state); err != nil {
+		t.Fatalf("Error restoring decoder state: %v", err)
+	}
+	clone, err := dec.Clone()
+	if err != nil {
+		t.Fatalf("Error cloning decoder: %v", err)
+	}
+	pcmRestored := make([]int16, FRAME_SIZE*2)
+	pcmClone := make([]int16, FRAME_SIZE*2)
+	for i, packet := range packets[10:] {
+		if _, err := dec.Decode(packet, pcm); err != nil {
+			t.Fatalf("Couldn't decode data: %v", err)
+		}
+		if _, err := restored.Decode(packet, pcmRestored); err != nil {
+			t.Fatalf("Couldn't decode data with restored decoder: %v", err)
+		}
+		if _, err := clone.Decode(packet, pcmClone); err != nil {
+			t.Fatalf("Couldn't decode data with cloned decoder: %v", err)
+		}
+		if maxDiff(pcm, pcmRestored) != 0 {
+			t.Errorf("Restored decoder output differs in packet %d", i+10)
+		}
+		if maxDiff(pcm, pcmClone) != 0 {
+			t.Errorf("Cloned decoder output differs in packet %d", i+10)
+		}
+	}
+}
+
+func TestEncoder_CloneSaveRestoreState(t *testing.T) {
+	const SAMPLE_RATE = 48000
+	const FRAME_SIZE = SAMPLE_RATE * 20 / 1000
+	enc, err := NewEncoder(SAMPLE_RATE, 1, AppAudio)
+	if err != nil || enc == nil {
+		t.Fatalf("Error creating new encoder: %v", err)
+	}
+	if err := enc.SetExpertFrameDuration(FrameDuration20Ms); err != nil {
+		t.Fatalf("Error setting frame duration: %v", err)
+	}
+	encodeFrames(t, enc, 5, FRAME_SIZE)
+	clone, err := enc.Clone()
+	if err != nil {
+		t.Fatalf("Error cloning encoder: %v", err)
+	}
+	state, err := enc.SaveState()
+	if err != nil {
+		t.Fatalf("Error saving encoder state: %v", err)
+	}
+	var restored Encoder
+	if err := restored.RestoreState(state); err != nil {
+		t.Fatalf("Error restoring encoder state: %v", err)
+	}
+	if fd, _ := restored.ExpertFrameDuration(); fd != FrameDuration20Ms || restored.frameDuration != FrameDuration20Ms {
+		t.Errorf("Frame duration not restored: %v", fd)
+	}
+	// Speculative encoding: a different bitrate on the clone must not affect
+	// the original
+	if err := clone.SetBitrate(6000); err != nil {
+		t.Fatalf("Error setting bitrate: %v", err)
+	}
+	expected := encodeFrames(t, enc, 5, FRAME_SIZE)
+	for i, packet := range encodeFrames(t, &restored, 5, FRAME_SIZE) {
+		if !bytes.Equal(packet, expected[i]) {
+			t.Errorf("Restored encoder output differs in packet %d", i)
+		}
+	}
+	if got := encodeFrames(t, clone, 1, FRAME_SIZE); bytes.Equal(got[0], expected[0]) {
+		t.Errorf("Cloned encoder shares state with the original")
+	}
+}
+
+func TestRestoreState_Checks(t *testing.T) {
+	enc, err := NewEncoder(48000, 1, AppVoIP)
+	if err != nil || enc == nil {
+		t.Fatalf("Error creating new encoder: %v", err)
+	}
+	dec, err := NewDecoder(48000, 1)
+	if err != nil || dec == nil {
+		t.Fatalf("Error creating new decoder: %v", err)
+	}
+	encState, err := enc.SaveState()
+	if err != nil {
+		t.Fatalf("Error saving encoder state: %v", err)
+	}
+	decState, err := dec.SaveState()
+	if err != nil {
+		t.Fatalf("Error saving decoder state: %v", err)
+	}
+	if err := dec.RestoreState(encState); !errors.Is(err, ErrIncompatibleState) {
+		t.Errorf("Expected error restoring encoder state into decoder")
+	}
+	if err := enc.RestoreState(decState); !errors.Is(err, ErrIncompatibleState) {
+		t.Errorf("Expected error restoring decoder state into encoder")
+	}
+	stereo, err := NewDecoder(48000, 2)
+	if err != nil || stereo == nil {
+		t.Fatalf("Error creating new decoder: %v", err)
+	}
+	if err := stereo.RestoreState(decState); !errors.Is(err, ErrIncompatibleState) {
+		t.Errorf("Expected error restoring mono state into stereo decoder")
+	}
+	resampled, err := NewDecoder(16000, 1)
+	if err != nil || resampled == nil {
+		t.Fatalf("Error creating new decoder: %v", err)
+	}
+	if err := resampled.RestoreState(decState); !errors.Is(err, ErrIncompatibleState) {
+		t.Errorf("Expected error restoring 48 kHz state into 16 kHz decoder")
+	}
+	if err := dec.RestoreState(decState[:len(decState)-1]); !errors.Is(err, ErrIncompatibleState) {
+		t.Errorf("Expected error restoring truncated state")
+	}
+	var uninitialized Decoder
+	if _, err := uninitialized.SaveState(); err != ErrDecoderUninitialized {
+		t.Errorf("Expected \"unitialized decoder\" error: %v", err)
+	}
+}
+
+func TestRestoreState_OtherProcess(t *testing.T) {
+	h := stateHeader{kind: stateDecoder, channels: 1, sampleRate: 48000}
+	process, err := stateProcessID()
+	if err != nil {
+		t.Fatalf("Error getting process ID: %v", err)
+	}
+	h.process = process
+	h.process[0]++
+	saved := bytes.Repeat([]byte{0xff}, 64)
+	mem := make([]byte, len(saved))
+	if err := restoreState(h, saved, mem); !errors.Is(err, ErrIncompatibleState) {
+		t.Errorf("Expected error restoring state of another process, got %v", err)
+	}
+	if bytes.Equal(mem, saved) {
+		t.Errorf("State of another process was copied")
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright © Go Opus Authors (see AUTHORS file)
+//
+// License for use of this code is detailed in the LICENSE file
+
+package opus
+
+import (
+	"time"
+)
+
+// Stats collects aggregate statistics about a stream of Opus packets. Packets
+// can come from any source: an Encoder, a container or the network.
+//
+// Time is measured by adding up the durations of all packets, so packets that
+// were never sent because of DTX do not count towards the duration of the
+// stream.
+type Stats struct {
+	// Length of the intervals over which the bitrate is reported. Changing
+	// it after the first packet has been added has no effect.
+	Interval time.Duration
+
+	packets    int
+	invalid    int
+	dtx        int
+	stereo     int
+	bytes      int64
+	samples    int64
+	modes      map[Mode]int
+	bandwidths map[Bandwidth]int
+	frameSizes map[int]int
+	interval   time.Duration
+	// Number of bytes per interval
+	buckets []int64
+}
+
+// StatsReport is a summary of a packet stream, suitable for marshalling to
+// JSON. Shares and ratios are fractions between 0 and 1 of all valid packets.
+type StatsReport struct {
+	Packets        int     `json:"packets"`
+	InvalidPackets int     `json:"invalid_packets"`
+	Bytes          int64   `json:"bytes"`
+	Duration       float64 `json:"duration_seconds"`
+	// Average bitrate in bits per second
+	Bitrate float64 `json:"bitrate"`
+	// Share of packets per mode, keyed by Mode.String()
+	Modes map[string]float64 `json:"modes"`
+	// Share of packets per bandwidth, keyed by Bandwidth.String()
+	Bandwidths map[string]float64 `json:"bandwidths"`
+	// Number of frames per frame duration, keyed by e.g. "20ms"
+	FrameDurations map[string]int `json:"frame_durations"`
+	// Bitrate in bits per second for each consecutive interval
+	BitrateOverTime []float64 `json:"bitrate_over_time"`
+	Interval        float64   `json:"interval_seconds"`
+	DTXRatio        float64   `json:"dtx_ratio"`
+	StereoShare     float64   `json:"stereo_share"`
+}
+
+// NewStats creates a statistics collector reporting the bitrate per second.
+func NewStats() *Stats {
+	return &Stats{Interval: time.Second}
+}
+
+// Add adds a packet to the statistics. Invalid packets are counted separately
+// and otherwise ignored; the returned error describes why they are invalid.
+func (s *Stats) Add(data []byte) error {
+	p, err := ParsePacket(data)
+	if err != nil {
+		s.invalid++
+		return err
+	}
+	if s.modes == nil {
+		s.modes = map[Mode]int{}
+		s.bandwidths = map[Bandwidth]int{}
+		s.frameSizes = map[int]int{}
+		s.interval = s.Interval
+		if s.interval <= 0 {
+			s.interval = time.Second
+		}
+	}
+	elapsed := time.Duration(s.samples) * time.Second / 48000
+	idx := int(elapsed / s.interval)
+	for len(s.buckets) <= idx {
+		s.buckets = append(s.buckets, 0)
+	}
+	s.buckets[idx] += int64(len(data))
+	s.packets++
+	s.bytes += int64(len(data))
+	s.samples += int64(p.Samples())
+	s.modes[p.TOC.Mode()]++
+	s.bandwidths[p.TOC.Bandwidth()]++
+	s.frameSizes[p.TOC.FrameSize()] += len(p.Frames)
+	if p.DTX() {
+		s.dtx++
+	}
+	if p.TOC.Stereo() {
+		s.stereo++
+	}
+	return nil
+}
+
+// Report summarizes all packets added so far.
+func (s *Stats) Report() StatsReport {
+	r := StatsReport{
+		Packets:        s.packets,
+		InvalidPackets: s.invalid,
+		Bytes:          s.bytes,
+		Duration:       float64(s.samples) / 48000,
+		Modes:          map[string]float64{},
+		Bandwidths:     map[string]float64{},
+		FrameDurations: map[string]int{},
+		Interval:       s.Interval.Seconds(),
+	}
+	if s.packets == 0 {
+		return r
+	}
+	r.Interval = s.interval.Seconds()
+	if r.Duration > 0 {
+		r.Bitrate = float64(s.bytes*8) / r.Duration
+	}
+	for m, n := range s.modes {
+		r.Modes[m.String()] = float64(n) / float64(s.packets)
+	}
+	for bw, n := range s.bandwidths {
+		r.Bandwidths[bw.String()] = float64(n) / float64(s.packets)
+	}
+	for size, n := range s.frameSizes {
+		d := time.Duration(size) * time.Second / 48000
+		r.FrameDurations[d.String()] = n
+	}
+	r.BitrateOverTime = make([]float64, len(s.buckets))
+	for i, b := range s.buckets {
+		secs := s.interval.Seconds()
+		if i == len(s.buckets)-1 {
+			// The last interval is usually not complete
+			elapsed := float64(s.samples)/48000 - float64(i)*secs
+			if elapsed > 0 && elapsed < secs {
+				secs = elapsed
+			}
+		}
+		r.BitrateOverTime[i] = float64(b*8) / secs
+	}
+	r.DTXRatio = float64(s.dtx) / float64(s.packets)
+	r.StereoShare = float64(s.stereo) / float64(s.packets)
+	return r
+}
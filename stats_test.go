@@ -0,0 +1,68 @@
+// Copyright © Go Opus Authors (see AUTHORS file)
+//
+// License for use of this code is detailed in the LICENSE file
+
+package opus
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	s := NewStats()
+	// 1.5 s of 20 ms SILK wideband mono, 50 bytes per packet
+	for i := 0; i < 75; i++ {
+		data := make([]byte, 50)
+		data[0] = 9 << 3
+		if err := s.Add(data); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	// 0.5 s of 10 ms CELT fullband stereo DTX packets
+	for i := 0; i < 50; i++ {
+		if err := s.Add([]byte{30<<3 | 4}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if err := s.Add([]byte{31<<3 | 1, 1, 2, 3}); err == nil {
+		t.Errorf("Expected error for invalid packet")
+	}
+	r := s.Report()
+	if r.Packets != 125 || r.InvalidPackets != 1 {
+		t.Errorf("Unexpected packet counts: %d valid, %d invalid", r.Packets, r.InvalidPackets)
+	}
+	if math.Abs(r.Duration-2) > 1e-9 {
+		t.Errorf("Unexpected duration: %f", r.Duration)
+	}
+	if r.Modes["SILK"] != 0.6 || r.Modes["CELT"] != 0.4 {
+		t.Errorf("Unexpected mode shares: %v", r.Modes)
+	}
+	if r.Bandwidths["wideband"] != 0.6 || r.Bandwidths["fullband"] != 0.4 {
+		t.Errorf("Unexpected bandwidth shares: %v", r.Bandwidths)
+	}
+	if r.FrameDurations["20ms"] != 75 || r.FrameDurations["10ms"] != 50 {
+		t.Errorf("Unexpected frame durations: %v", r.FrameDurations)
+	}
+	if r.DTXRatio != 0.4 || r.StereoShare != 0.4 {
+		t.Errorf("Unexpected DTX ratio %f or stereo share %f", r.DTXRatio, r.StereoShare)
+	}
+	expected := []float64{20000, (25*50 + 50) * 8}
+	if len(r.BitrateOverTime) != 2 || r.BitrateOverTime[0] != expected[0] || r.BitrateOverTime[1] != expected[1] {
+		t.Errorf("Unexpected bitrate over time: %v", r.BitrateOverTime)
+	}
+	if _, err := json.Marshal(r); err != nil {
+		t.Errorf("Couldn't marshal report: %v", err)
+	}
+}
+
+func TestStatsEmpty(t *testing.T) {
+	r := NewStats().Report()
+	if r.Packets != 0 || r.Bitrate != 0 {
+		t.Errorf("Unexpected report for empty stream: %v", r)
+	}
+	if _, err := json.Marshal(r); err != nil {
+		t.Errorf("Couldn't marshal report: %v", err)
+	}
+}
@@ -88,10 +88,10 @@ func NewStream(read io.Reader) (*Stream, error) {
 // but with zero bytes.
 func (s *Stream) Init(read io.Reader) error {
 	if s.oggfile != nil {
-		return fmt.Errorf("opus stream is already initialized")
+		return ErrAlreadyInitialized
 	}
 	if read == nil {
-		return fmt.Errorf("Reader must be non-nil")
+		return ErrNilReader
 	}
 
 	s.read = read
@@ -108,7 +108,7 @@ func (s *Stream) Init(read io.Reader) error {
 	defer streams.Del(s)
 	oggfile := C.my_open_callbacks(C.uintptr_t(s.id), &errno)
 	if errno != 0 {
-		return StreamError(errno)
+		return &OpError{Op: "op_open_callbacks", Err: StreamError(errno)}
 	}
 	s.oggfile = oggfile
 	return nil
@@ -121,12 +121,12 @@ func (s *Stream) Init(read io.Reader) error {
 // Read may successfully read less bytes than requested, but it will never read
 // exactly zero bytes succesfully if a non-zero buffer is supplied.
 //
-// The number of channels in the output data must be known in advance. It is
-// possible to extract this information from the stream itself, but I'm not
-// motivated to do that. Feel free to send a pull request.
+// The output is interleaved with the number of channels reported by Channels.
+// Surround streams (mapping family 1) are in Vorbis channel order, discrete
+// streams (mapping family 255) have every channel unmixed, in order.
 func (s *Stream) Read(pcm []int16) (int, error) {
 	if s.oggfile == nil {
-		return 0, fmt.Errorf("opus stream is uninitialized or already closed")
+		return 0, ErrStreamClosed
 	}
 	if len(pcm) == 0 {
 		return 0, nil
@@ -139,7 +139,11 @@ func (s *Stream) Read(pcm []int16) (int, error) {
 		C.int(len(pcm)),
 		nil)
 	if n < 0 {
-		return 0, StreamError(n)
+		return 0, &OpError{
+			Op:   "op_read",
+			Args: fmt.Sprintf("buf_size=%d", len(pcm)),
+			Err:  StreamError(n),
+		}
 	}
 	if n == 0 {
 		return 0, io.EOF
@@ -150,7 +154,7 @@ func (s *Stream) Read(pcm []int16) (int, error) {
 // ReadFloat32 is the same as Read, but decodes to float32 instead of int16.
 func (s *Stream) ReadFloat32(pcm []float32) (int, error) {
 	if s.oggfile == nil {
-		return 0, fmt.Errorf("opus stream is uninitialized or already closed")
+		return 0, ErrStreamClosed
 	}
 	if len(pcm) == 0 {
 		return 0, nil
@@ -163,7 +167,11 @@ func (s *Stream) ReadFloat32(pcm []float32) (int, error) {
 		C.int(len(pcm)),
 		nil)
 	if n < 0 {
-		return 0, StreamError(n)
+		return 0, &OpError{
+			Op:   "op_read_float",
+			Args: fmt.Sprintf("buf_size=%d", len(pcm)),
+			Err:  StreamError(n),
+		}
 	}
 	if n == 0 {
 		return 0, io.EOF
@@ -171,9 +179,18 @@ func (s *Stream) ReadFloat32(pcm []float32) (int, error) {
 	return int(n), nil
 }
 
+// Channels returns the number of channels of the current link of the stream,
+// i.e. the number of interleaved channels returned by Read.
+func (s *Stream) Channels() (int, error) {
+	if s.oggfile == nil {
+		return 0, ErrStreamClosed
+	}
+	return int(C.op_channel_count(s.oggfile, -1)), nil
+}
+
 func (s *Stream) Close() error {
 	if s.oggfile == nil {
-		return fmt.Errorf("opus stream is uninitialized or already closed")
+		return ErrStreamClosed
 	}
 	C.op_free(s.oggfile)
 	if closer, ok := s.read.(io.Closer); ok {
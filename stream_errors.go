@@ -6,6 +6,10 @@
 
 package opus
 
+import (
+	"fmt"
+)
+
 /*
 #cgo pkg-config: opusfile
 #include <opusfile.h>
@@ -70,6 +74,6 @@ func (i StreamError) Error() string {
 	case ErrStreamBadTimestamp:
 		return "OP_EBADTIMESTAMP"
 	default:
-		return "libopusfile error: %d (unknown code)"
+		return fmt.Sprintf("libopusfile error: %d (unknown code)", int(i))
 	}
 }
@@ -7,6 +7,8 @@
 package opus
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -23,6 +25,23 @@ func TestStreamIllegal(t *testing.T) {
 	if err == nil {
 		t.Fatalf("Expected error while initializing illegal opus stream")
 	}
+	var code StreamError
+	if !errors.As(err, &code) || code != ErrStreamNotFormat {
+		t.Errorf("Expected OP_ENOTFORMAT, got %v", err)
+	}
+}
+
+func TestStreamErrorUnknown(t *testing.T) {
+	if msg := StreamError(-12345).Error(); msg != "libopusfile error: -12345 (unknown code)" {
+		t.Errorf("Unexpected message for unknown libopusfile error: %s", msg)
+	}
+}
+
+func TestStreamClosed(t *testing.T) {
+	var stream Stream
+	if _, err := stream.Read(make([]int16, 10)); !errors.Is(err, ErrStreamClosed) {
+		t.Errorf("Expected ErrStreamClosed, got %v", err)
+	}
 }
 
 func readStreamPcm(t *testing.T, stream *Stream, buffersize int) []int16 {
@@ -132,3 +151,49 @@ func TestCloser(t *testing.T) {
 		t.Error("Expected opus stream to call .Close on the reader")
 	}
 }
+
+func TestStreamDiscrete(t *testing.T) {
+	enc, err := NewDiscreteEncoder(48000, 3, AppAudio)
+	if err != nil {
+		t.Fatalf("Error creating discrete encoder: %v", err)
+	}
+	head, err := enc.Head()
+	if err != nil {
+		t.Fatalf("Couldn't create header: %v", err)
+	}
+	var buf bytes.Buffer
+	w, err := NewOggWriter(&buf, head, nil)
+	if err != nil {
+		t.Fatalf("Couldn't create Ogg writer: %v", err)
+	}
+	for _, packet := range encodeDiscrete(t, enc, 10) {
+		if err := w.WritePacket(packet, 960); err != nil {
+			t.Fatalf("Couldn't write packet: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Couldn't close Ogg writer: %v", err)
+	}
+	s := mustOpenStream(t, &buf)
+	defer s.Close()
+	channels, err := s.Channels()
+	if err != nil || channels != 3 {
+		t.Fatalf("Unexpected channel count: %d (%v)", channels, err)
+	}
+	// Read returns samples per channel
+	var pcm []int16
+	pcmbuf := make([]int16, 960*channels)
+	for {
+		n, err := s.Read(pcmbuf)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Error while decoding opus stream: %v", err)
+		}
+		pcm = append(pcm, pcmbuf[:n*channels]...)
+	}
+	if len(pcm) < 960*channels {
+		t.Fatalf("Unexpected amount of PCM data: %d", len(pcm))
+	}
+	checkDiscrete(t, pcm[len(pcm)-960*channels:])
+}
@@ -0,0 +1,90 @@
+// Copyright © Go Opus Authors (see AUTHORS file)
+//
+// License for use of this code is detailed in the LICENSE file
+
+package opus
+
+// RangeMismatch describes a packet for which the final range of the decoder
+// did not match the final range reported by the encoder.
+type RangeMismatch struct {
+	// Index of the packet in the verified stream, starting at 0.
+	Packet  int
+	Encoder uint32
+	Decoder uint32
+}
+
+// RangeVerifier checks a stream of packets for corruption by decoding every
+// packet and comparing the decoder's final range to the final range reported
+// by the encoder for that packet.
+//
+// Typical use is to send the value of Encoder.FinalRange() alongside each
+// packet, and feed both into Verify on the receiving end of the transport.
+type RangeVerifier struct {
+	dec        *Decoder
+	pcm        []int16
+	packets    int
+	mismatches []RangeMismatch
+}
+
+// NewRangeVerifier creates a verifier for packets produced by an encoder with
+// the given sample rate and number of channels.
+func NewRangeVerifier(sample_rate int, channels int) (*RangeVerifier, error) {
+	dec, err := NewDecoder(sample_rate, channels)
+	if err != nil {
+		return nil, err
+	}
+	// Room for the longest possible packet (120 ms)
+	pcm := make([]int16, sample_rate*120/1000*channels)
+	return &RangeVerifier{dec: dec, pcm: pcm}, nil
+}
+
+// Verify decodes a packet and compares the resulting final range with the
+// one reported by the encoder. Returns whether the ranges matched. Mismatches
+// are recorded and can be retrieved with Mismatches.
+//
+// Packets must be verified in the order in which they were encoded, because
+// the decoder state depends on previous packets. A non-nil error means the
+// packet could not be decoded at all; it is not recorded as a mismatch.
+//
+// An empty packet stands for a lost packet. It is concealed, to keep the
+// decoder state in line with a real receiver, and its range is not compared.
+func (v *RangeVerifier) Verify(data []byte, encRange uint32) (bool, error) {
+	idx := v.packets
+	v.packets++
+	if len(data) == 0 {
+		samples, err := v.dec.concealSamples()
+		if err != nil {
+			return false, err
+		}
+		if err := v.dec.DecodePLC(v.pcm[:samples*v.dec.channels]); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	if _, err := v.dec.Decode(data, v.pcm); err != nil {
+		return false, err
+	}
+	decRange, err := v.dec.FinalRange()
+	if err != nil {
+		return false, err
+	}
+	if decRange != encRange {
+		v.mismatches = append(v.mismatches, RangeMismatch{
+			Packet:  idx,
+			Encoder: encRange,
+			Decoder: decRange,
+		})
+		return false, nil
+	}
+	return true, nil
+}
+
+// Packets returns the number of packets passed to Verify so far.
+func (v *RangeVerifier) Packets() int {
+	return v.packets
+}
+
+// Mismatches returns all mismatches found so far, in stream order.
+func (v *RangeVerifier) Mismatches() []RangeMismatch {
+	return v.mismatches
+}
@@ -0,0 +1,140 @@
+// Copyright © Go Opus Authors (see AUTHORS file)
+//
+// License for use of this code is detailed in the LICENSE file
+
+package opus
+
+import (
+	"testing"
+)
+
+func TestFinalRange(t *testing.T) {
+	const G4 = 391.995
+	const SAMPLE_RATE = 48000
+	const FRAME_SIZE_MS = 20
+	const FRAME_SIZE = SAMPLE_RATE * FRAME_SIZE_MS / 1000
+	pcm := make([]int16, FRAME_SIZE)
+	addSine(pcm, SAMPLE_RATE, G4)
+	enc, err := NewEncoder(SAMPLE_RATE, 1, AppVoIP)
+	if err != nil || enc == nil {
+		t.Fatalf("Error creating new encoder: %v", err)
+	}
+	dec, err := NewDecoder(SAMPLE_RATE, 1)
+	if err != nil || dec == nil {
+		t.Fatalf("Error creating new decoder: %v", err)
+	}
+	data := make([]byte, 1000)
+	out := make([]int16, FRAME_SIZE)
+	for i := 0; i < 3; i++ {
+		n, err := enc.Encode(pcm, data)
+		if err != nil {
+			t.Fatalf("Couldn't encode data: %v", err)
+		}
+		encRange, err := enc.FinalRange()
+		if err != nil {
+			t.Fatalf("Couldn't get encoder final range: %v", err)
+		}
+		if encRange == 0 {
+			t.Errorf("Encoder final range of packet %d is 0", i)
+		}
+		if _, err := dec.Decode(data[:n], out); err != nil {
+			t.Fatalf("Couldn't decode data: %v", err)
+		}
+		decRange, err := dec.FinalRange()
+		if err != nil {
+			t.Fatalf("Couldn't get decoder final range: %v", err)
+		}
+		if encRange != decRange {
+			t.Errorf("Final range mismatch in packet %d: encoder %#08x, decoder %#08x", i, encRange, decRange)
+		}
+	}
+}
+
+func TestRangeVerifier(t *testing.T) {
+	const G4 = 391.995
+	const SAMPLE_RATE = 48000
+	const FRAME_SIZE_MS = 20
+	const FRAME_SIZE = SAMPLE_RATE * FRAME_SIZE_MS / 1000
+	const NUMBER_OF_FRAMES = 5
+	enc, err := NewEncoder(SAMPLE_RATE, 2, AppAudio)
+	if err != nil || enc == nil {
+		t.Fatalf("Error creating new encoder: %v", err)
+	}
+	v, err := NewRangeVerifier(SAMPLE_RATE, 2)
+	if err != nil {
+		t.Fatalf("Error creating range verifier: %v", err)
+	}
+	mono := make([]int16, FRAME_SIZE*NUMBER_OF_FRAMES)
+	addSine(mono, SAMPLE_RATE, G4)
+	pcm := interleave(mono, mono)
+	for i := 0; i < NUMBER_OF_FRAMES; i++ {
+		data := make([]byte, 1000)
+		n, err := enc.Encode(pcm[i*FRAME_SIZE*2:(i+1)*FRAME_SIZE*2], data)
+		if err != nil {
+			t.Fatalf("Couldn't encode data: %v", err)
+		}
+		data = data[:n]
+		encRange, err := enc.FinalRange()
+		if err != nil {
+			t.Fatalf("Couldn't get encoder final range: %v", err)
+		}
+		// Corrupt packet 3 in "transport"
+		if i == 3 {
+			data[n-1] ^= 0x80
+		}
+		ok, err := v.Verify(data, encRange)
+		if err != nil {
+			t.Fatalf("Couldn't verify packet %d: %v", i, err)
+		}
+		if ok != (i != 3) {
+			t.Errorf("Unexpected verification result for packet %d: %t", i, ok)
+		}
+	}
+	if v.Packets() != NUMBER_OF_FRAMES {
+		t.Errorf("Unexpected number of verified packets: %d", v.Packets())
+	}
+	mismatches := v.Mismatches()
+	if len(mismatches) != 1 || mismatches[0].Packet != 3 {
+		t.Errorf("Expected a single mismatch in packet 3, got: %v", mismatches)
+	}
+}
+
+func TestRangeVerifierLostPacket(t *testing.T) {
+	const SAMPLE_RATE = 48000
+	const FRAME_SIZE = 960
+	enc, err := NewEncoder(SAMPLE_RATE, 1, AppVoIP)
+	if err != nil || enc == nil {
+		t.Fatalf("Error creating new encoder: %v", err)
+	}
+	v, err := NewRangeVerifier(SAMPLE_RATE, 1)
+	if err != nil {
+		t.Fatalf("Error creating range verifier: %v", err)
+	}
+	// A lost packet before anything was decoded
+	if ok, err := v.Verify(nil, 0); err != nil || !ok {
+		t.Errorf("Unexpected result for lost first packet: %t, %v", ok, err)
+	}
+	pcm := make([]int16, FRAME_SIZE)
+	addSine(pcm, SAMPLE_RATE, 440)
+	data := make([]byte, 1000)
+	for i := 0; i < 3; i++ {
+		n, err := enc.Encode(pcm, data)
+		if err != nil {
+			t.Fatalf("Couldn't encode data: %v", err)
+		}
+		encRange, err := enc.FinalRange()
+		if err != nil {
+			t.Fatalf("Couldn't get encoder final range: %v", err)
+		}
+		if i == 1 {
+			// Lost in transport
+			n = 0
+		}
+		if ok, err := v.Verify(data[:n], encRange); err != nil || !ok {
+			t.Errorf("Unexpected result for packet %d: %t, %v", i, ok, err)
+		}
+	}
+	if len(v.Mismatches()) != 0 {
+		t.Errorf("Unexpected mismatches: %v", v.Mismatches())
+	}
+}
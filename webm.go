@@ -0,0 +1,633 @@
+// Copyright © Go Opus Authors (see AUTHORS file)
+//
+// License for use of this code is detailed in the LICENSE file
+
+package opus
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"time"
+)
+
+// WebMPacket is an Opus packet read from a WebM or Matroska file.
+type WebMPacket struct {
+	Data []byte
+	// Container timestamp of the packet. The decoded audio of the whole track
+	// starts with CodecDelay of priming samples, so the presentation time of
+	// this packet is Timestamp - CodecDelay.
+	Timestamp time.Duration
+	// Duration of the packet from its TOC byte.
+	Duration time.Duration
+	// Amount of audio to drop from the end of the decoded packet, usually on
+	// the last packet of the track.
+	DiscardPadding time.Duration
+}
+
+// WebMReader reads Opus packets from the first Opus track of a WebM or
+// Matroska file. It only reads forward, so it works on live streams, such as
+// the output of a browser's MediaRecorder, where the Segment and Clusters have
+// an unknown size.
+type WebMReader struct {
+	r              *bufio.Reader
+	head           *Head
+	track          uint64
+	timestampScale int64
+	codecDelay     time.Duration
+	seekPreRoll    time.Duration
+	// Timestamp of the current Cluster, in timestamp scale units
+	clusterTimestamp int64
+	// Remaining frames of a laced block
+	pending []*WebMPacket
+}
+
+// NewWebMReader reads the headers of a WebM file up to the track list and
+// selects the first Opus track. Returns ErrNoOpusTrack if there is none.
+func NewWebMReader(r io.Reader) (*WebMReader, error) {
+	if r == nil {
+		return nil, ErrNilReader
+	}
+	wr := &WebMReader{r: bufio.NewReader(r), timestampScale: 1000000}
+	id, size, err := wr.readElementHeader()
+	if err != nil {
+		return nil, wr.headerError(err)
+	}
+	if id != ebmlIDHeader {
+		return nil, fmt.Errorf("%w: not an EBML file", ErrInvalidContainer)
+	}
+	header, err := wr.readPayload(size)
+	if err != nil {
+		return nil, wr.headerError(err)
+	}
+	docType := "matroska"
+	err = parseElements(header, func(id uint32, payload []byte) error {
+		if id == ebmlIDDocType {
+			docType = string(payload)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if docType != "webm" && docType != "matroska" {
+		return nil, fmt.Errorf("%w: unsupported document type %q", ErrInvalidContainer, docType)
+	}
+	for wr.head == nil {
+		id, size, err := wr.readElementHeader()
+		if err != nil {
+			return nil, wr.headerError(err)
+		}
+		switch id {
+		case mkvIDSegment:
+			// Descend
+		case mkvIDInfo:
+			payload, err := wr.readPayload(size)
+			if err != nil {
+				return nil, wr.headerError(err)
+			}
+			if err := wr.parseInfo(payload); err != nil {
+				return nil, err
+			}
+		case mkvIDTracks:
+			payload, err := wr.readPayload(size)
+			if err != nil {
+				return nil, wr.headerError(err)
+			}
+			if err := wr.parseTracks(payload); err != nil {
+				return nil, err
+			}
+		case mkvIDCluster:
+			return nil, fmt.Errorf("%w: Cluster before Tracks", ErrInvalidContainer)
+		default:
+			if err := wr.skip(size); err != nil {
+				return nil, wr.headerError(err)
+			}
+		}
+	}
+	return wr, nil
+}
+
+func (wr *WebMReader) headerError(err error) error {
+	if err == io.EOF {
+		return fmt.Errorf("%w: %v", ErrNoOpusTrack, io.ErrUnexpectedEOF)
+	}
+	return err
+}
+
+// readElementHeader reads the ID and size of the next element. Returns io.EOF
+// only at the end of the data between elements.
+func (wr *WebMReader) readElementHeader() (uint32, int64, error) {
+	id, n, err := readVint(wr.r, true)
+	if err != nil {
+		if err == io.EOF && n > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, 0, err
+	}
+	size, _, err := readVint(wr.r, false)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return uint32(id), size, err
+}
+
+func (wr *WebMReader) readPayload(size int64) ([]byte, error) {
+	if size == ebmlUnknownSize || size > ebmlMaxElementSize {
+		return nil, fmt.Errorf("%w: unsupported element size", ErrInvalidContainer)
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(wr.r, payload); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return payload, nil
+}
+
+func (wr *WebMReader) skip(size int64) error {
+	if size == ebmlUnknownSize {
+		return fmt.Errorf("%w: cannot skip element of unknown size", ErrInvalidContainer)
+	}
+	n, err := io.CopyN(ioutil.Discard, wr.r, size)
+	if err == io.EOF && n < size {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func (wr *WebMReader) parseInfo(payload []byte) error {
+	return parseElements(payload, func(id uint32, payload []byte) error {
+		if id != mkvIDTimestampScale {
+			return nil
+		}
+		scale, err := ebmlUint(payload)
+		if err != nil {
+			return err
+		}
+		if scale == 0 || scale > math.MaxInt32 {
+			return fmt.Errorf("%w: timestamp scale %d", ErrInvalidContainer, scale)
+		}
+		wr.timestampScale = int64(scale)
+		return nil
+	})
+}
+
+func (wr *WebMReader) parseTracks(payload []byte) error {
+	err := parseElements(payload, func(id uint32, payload []byte) error {
+		if id != mkvIDTrackEntry || wr.head != nil {
+			return nil
+		}
+		return wr.parseTrackEntry(payload)
+	})
+	if err != nil {
+		return err
+	}
+	if wr.head == nil {
+		return ErrNoOpusTrack
+	}
+	return nil
+}
+
+// parseTrackEntry selects the track if it is an Opus track.
+func (wr *WebMReader) parseTrackEntry(payload []byte) error {
+	var number, codecDelay, seekPreRoll uint64
+	var codecID string
+	var codecPrivate []byte
+	channels := 0
+	err := parseElements(payload, func(id uint32, payload []byte) error {
+		var err error
+		switch id {
+		case mkvIDTrackNumber:
+			number, err = ebmlUint(payload)
+		case mkvIDCodecID:
+			codecID = string(payload)
+		case mkvIDCodecPrivate:
+			codecPrivate = payload
+		case mkvIDCodecDelay:
+			codecDelay, err = ebmlUint(payload)
+		case mkvIDSeekPreRoll:
+			seekPreRoll, err = ebmlUint(payload)
+		case mkvIDAudio:
+			err = parseElements(payload, func(id uint32, payload []byte) error {
+				if id == mkvIDChannels {
+					c, err := ebmlUint(payload)
+					channels = int(c)
+					return err
+				}
+				return nil
+			})
+		}
+		return err
+	})
+	if err != nil || codecID != mkvCodecOpus {
+		return err
+	}
+	head := &Head{Version: 1, Channels: channels}
+	if len(codecPrivate) > 0 {
+		if err := head.UnmarshalBinary(codecPrivate); err != nil {
+			return err
+		}
+	} else if err := head.Validate(); err != nil {
+		// Without CodecPrivate, only mono and stereo are possible
+		return err
+	}
+	wr.head = head
+	wr.track = number
+	wr.codecDelay = time.Duration(codecDelay)
+	wr.seekPreRoll = time.Duration(seekPreRoll)
+	return nil
+}
+
+// Head returns the OpusHead of the track, from its CodecPrivate.
+func (wr *WebMReader) Head() *Head {
+	return wr.head
+}
+
+// TrackNumber returns the number of the Opus track.
+func (wr *WebMReader) TrackNumber() uint64 {
+	return wr.track
+}
+
+// CodecDelay returns the amount of audio to drop from the start of the decoded
+// track, the equivalent of the Ogg Opus pre-skip.
+func (wr *WebMReader) CodecDelay() time.Duration {
+	return wr.codecDelay
+}
+
+// SeekPreRoll returns the amount of audio a decoder must decode and discard
+// before the target after a seek, to converge to the correct output.
+func (wr *WebMReader) SeekPreRoll() time.Duration {
+	return wr.seekPreRoll
+}
+
+// ReadPacket returns the next packet of the Opus track, or io.EOF at the end
+// of the file. Packets of other tracks are skipped.
+func (wr *WebMReader) ReadPacket() (*WebMPacket, error) {
+	for len(wr.pending) == 0 {
+		id, size, err := wr.readElementHeader()
+		if err != nil {
+			return nil, err
+		}
+		switch id {
+		case mkvIDSegment, mkvIDCluster:
+			// Descend, their children follow
+		case mkvIDTimestamp:
+			payload, err := wr.readPayload(size)
+			if err != nil {
+				return nil, err
+			}
+			ts, err := ebmlUint(payload)
+			if err != nil {
+				return nil, err
+			}
+			wr.clusterTimestamp = int64(ts)
+		case mkvIDSimpleBlock:
+			payload, err := wr.readPayload(size)
+			if err != nil {
+				return nil, err
+			}
+			if err := wr.parseBlock(payload, 0); err != nil {
+				return nil, err
+			}
+		case mkvIDBlockGroup:
+			payload, err := wr.readPayload(size)
+			if err != nil {
+				return nil, err
+			}
+			if err := wr.parseBlockGroup(payload); err != nil {
+				return nil, err
+			}
+		default:
+			if err := wr.skip(size); err != nil {
+				return nil, err
+			}
+		}
+	}
+	p := wr.pending[0]
+	wr.pending = wr.pending[1:]
+	return p, nil
+}
+
+func (wr *WebMReader) parseBlockGroup(payload []byte) error {
+	var block []byte
+	var discardPadding int64
+	err := parseElements(payload, func(id uint32, payload []byte) error {
+		var err error
+		switch id {
+		case mkvIDBlock:
+			block = payload
+		case mkvIDDiscardPadding:
+			discardPadding, err = ebmlInt(payload)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if block == nil {
+		return fmt.Errorf("%w: BlockGroup without Block", ErrInvalidContainer)
+	}
+	return wr.parseBlock(block, time.Duration(discardPadding))
+}
+
+// parseBlock queues the frames of a Block or SimpleBlock of the Opus track.
+func (wr *WebMReader) parseBlock(data []byte, discardPadding time.Duration) error {
+	r := &byteSliceReader{data: data}
+	track, _, err := readVint(r, false)
+	if err != nil || len(data)-r.pos < 3 {
+		return fmt.Errorf("%w: truncated block", ErrInvalidContainer)
+	}
+	if uint64(track) != wr.track {
+		return nil
+	}
+	rel := int64(int16(uint16(data[r.pos])<<8 | uint16(data[r.pos+1])))
+	flags := data[r.pos+2]
+	r.pos += 3
+	frames, err := splitLacedFrames(r, flags)
+	if err != nil {
+		return err
+	}
+	ts := time.Duration((wr.clusterTimestamp + rel) * wr.timestampScale)
+	for i, frame := range frames {
+		p := &WebMPacket{
+			Data:      frame,
+			Timestamp: ts,
+			Duration:  time.Duration(opusPacketSamples(frame)) * time.Second / 48000,
+		}
+		if i == len(frames)-1 {
+			p.DiscardPadding = discardPadding
+		}
+		// Only the first frame of a laced block has a timestamp
+		ts += p.Duration
+		wr.pending = append(wr.pending, p)
+	}
+	return nil
+}
+
+// splitLacedFrames splits the rest of a block into its frames, according to
+// the lacing in the block flags.
+func splitLacedFrames(r *byteSliceReader, flags byte) ([][]byte, error) {
+	lacing := (flags >> 1) & 0x3
+	if lacing == 0 {
+		return [][]byte{r.data[r.pos:]}, nil
+	}
+	countByte, err := r.ReadByte()
+	if err != nil {
+		return nil, fmt.Errorf("%w: truncated lacing", ErrInvalidContainer)
+	}
+	count := int(countByte) + 1
+	sizes := make([]int, count)
+	switch lacing {
+	case 1: // Xiph
+		for i := 0; i < count-1; i++ {
+			for {
+				b, err := r.ReadByte()
+				if err != nil {
+					return nil, fmt.Errorf("%w: truncated lacing", ErrInvalidContainer)
+				}
+				sizes[i] += int(b)
+				if b != 255 {
+					break
+				}
+			}
+		}
+	case 2: // Fixed
+		rest := len(r.data) - r.pos
+		if rest%count != 0 {
+			return nil, fmt.Errorf("%w: %d bytes in %d fixed size frames", ErrInvalidContainer, rest, count)
+		}
+		for i := range sizes {
+			sizes[i] = rest / count
+		}
+	case 3: // EBML: the first size, then signed differences
+		for i := 0; i < count-1; i++ {
+			v, n, err := readVint(r, false)
+			if err != nil || v == ebmlUnknownSize {
+				return nil, fmt.Errorf("%w: invalid EBML lacing", ErrInvalidContainer)
+			}
+			if i == 0 {
+				sizes[i] = int(v)
+			} else {
+				sizes[i] = sizes[i-1] + int(v-(int64(1)<<(7*n-1)-1))
+			}
+		}
+	}
+	if lacing != 2 {
+		sum := 0
+		for _, s := range sizes[:count-1] {
+			if s < 0 {
+				return nil, fmt.Errorf("%w: negative laced frame size", ErrInvalidContainer)
+			}
+			sum += s
+		}
+		sizes[count-1] = len(r.data) - r.pos - sum
+		if sizes[count-1] < 0 {
+			return nil, fmt.Errorf("%w: laced frames exceed block", ErrInvalidContainer)
+		}
+	}
+	frames := make([][]byte, count)
+	for i, s := range sizes {
+		frames[i] = r.data[r.pos : r.pos+s]
+		r.pos += s
+	}
+	return frames, nil
+}
+
+// opusPacketSamples returns the number of samples at 48 kHz in an Opus packet,
+// or the first stream of a multistream packet, from its TOC byte. Returns 0
+// for a malformed packet.
+func opusPacketSamples(data []byte) int {
+	if len(data) == 0 {
+		return 0
+	}
+	toc := TOC(data[0])
+	switch toc.Code() {
+	case 0:
+		return toc.FrameSize()
+	case 1, 2:
+		return 2 * toc.FrameSize()
+	}
+	if len(data) < 2 {
+		return 0
+	}
+	return int(data[1]&0x3f) * toc.FrameSize()
+}
+
+// WebMStream decodes the Opus track of a WebM file to PCM data at 48 kHz, like
+// Stream does for Ogg Opus files. It drops the codec delay from the start and
+// the discard padding from the end of the track.
+type WebMStream struct {
+	reader *WebMReader
+	dec    PacketDecoder
+	// Samples per channel to drop before returning audio
+	skip int
+	// Decoded samples not returned yet
+	pending []float32
+	buf     []float32
+}
+
+// NewWebMStream creates a decoding stream for the Opus track of a WebM file.
+func NewWebMStream(r io.Reader) (*WebMStream, error) {
+	reader, err := NewWebMReader(r)
+	if err != nil {
+		return nil, err
+	}
+	dec, err := NewDecoderFromHead(48000, reader.Head())
+	if err != nil {
+		return nil, err
+	}
+	skip := reader.Head().PreSkip
+	if reader.CodecDelay() > 0 {
+		skip = durationToSamples(reader.CodecDelay())
+	}
+	return &WebMStream{
+		reader: reader,
+		dec:    dec,
+		skip:   skip,
+		buf:    make([]float32, maxPacketSamples*reader.Head().Channels),
+	}, nil
+}
+
+func durationToSamples(d time.Duration) int {
+	return int((int64(d)*48000 + int64(time.Second)/2) / int64(time.Second))
+}
+
+// Reader returns the underlying WebMReader, e.g. for the header.
+func (s *WebMStream) Reader() *WebMReader {
+	return s.reader
+}
+
+// Channels returns the number of interleaved channels returned by Read.
+func (s *WebMStream) Channels() int {
+	return s.reader.Head().Channels
+}
+
+// fill decodes packets until there is audio to return.
+func (s *WebMStream) fill() error {
+	channels := s.Channels()
+	for len(s.pending) == 0 {
+		p, err := s.reader.ReadPacket()
+		if err != nil {
+			return err
+		}
+		n, err := s.dec.DecodeFloat32(p.Data, s.buf)
+		if err != nil {
+			return err
+		}
+		if p.DiscardPadding > 0 {
+			n -= durationToSamples(p.DiscardPadding)
+			if n < 0 {
+				n = 0
+			}
+		}
+		start := s.skip
+		if start > n {
+			start = n
+		}
+		s.skip -= start
+		s.pending = s.buf[start*channels : n*channels]
+	}
+	return nil
+}
+
+// ReadFloat32 decodes audio into pcm, interleaved. Returns the number of
+// samples per channel, or io.EOF at the end of the track.
+func (s *WebMStream) ReadFloat32(pcm []float32) (int, error) {
+	channels := s.Channels()
+	if len(pcm) < channels {
+		return 0, nil
+	}
+	if err := s.fill(); err != nil {
+		return 0, err
+	}
+	n := copy(pcm[:len(pcm)/channels*channels], s.pending)
+	s.pending = s.pending[n:]
+	return n / channels, nil
+}
+
+// Read is the same as ReadFloat32, but decodes to int16.
+func (s *WebMStream) Read(pcm []int16) (int, error) {
+	channels := s.Channels()
+	if len(pcm) < channels {
+		return 0, nil
+	}
+	if err := s.fill(); err != nil {
+		return 0, err
+	}
+	n := len(pcm) / channels * channels
+	if n > len(s.pending) {
+		n = len(s.pending)
+	}
+	for i, v := range s.pending[:n] {
+		pcm[i] = floatToInt16(v)
+	}
+	s.pending = s.pending[n:]
+	return n / channels, nil
+}
+
+func floatToInt16(v float32) int16 {
+	v *= 32768
+	if v >= math.MaxInt16 {
+		return math.MaxInt16
+	}
+	if v <= math.MinInt16 {
+		return math.MinInt16
+	}
+	return int16(math.Round(float64(v)))
+}
+
+// SkipTo moves forward to the given presentation time, skipping packets
+// without decoding them where possible. It decodes and discards SeekPreRoll
+// of audio before the target, as required for the decoder output to be
+// correct.
+func (s *WebMStream) SkipTo(t time.Duration) error {
+	s.pending = nil
+	preRoll := t - s.reader.SeekPreRoll()
+	skipped := false
+	for {
+		p, err := s.reader.ReadPacket()
+		if err != nil {
+			return err
+		}
+		start := p.Timestamp - s.reader.CodecDelay()
+		if start+p.Duration <= preRoll {
+			skipped = true
+			continue
+		}
+		if skipped {
+			if err := s.dec.Reset(); err != nil {
+				return err
+			}
+		}
+		// Decode this packet and drop everything up to the target
+		channels := s.Channels()
+		n, err := s.dec.DecodeFloat32(p.Data, s.buf)
+		if err != nil {
+			return err
+		}
+		if p.DiscardPadding > 0 {
+			n -= durationToSamples(p.DiscardPadding)
+			if n < 0 {
+				n = 0
+			}
+		}
+		s.skip = 0
+		if start < t {
+			s.skip = durationToSamples(t - start)
+		}
+		if s.skip < n {
+			s.pending = s.buf[s.skip*channels : n*channels]
+			s.skip = 0
+			return nil
+		}
+		s.skip -= n
+		if s.skip == 0 && start+p.Duration >= t {
+			return nil
+		}
+		skipped = false
+	}
+}
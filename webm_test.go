@@ -0,0 +1,238 @@
+// Copyright © Go Opus Authors (see AUTHORS file)
+//
+// License for use of this code is detailed in the LICENSE file
+
+package opus
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestEBMLVint(t *testing.T) {
+	for _, v := range []int64{0, 1, 126, 127, 128, 16382, 16383, 1 << 20, 1<<56 - 2, ebmlUnknownSize} {
+		data := appendVint(nil, v, 1)
+		got, n, err := readVint(&byteSliceReader{data: data}, false)
+		if err != nil || got != v || n != len(data) {
+			t.Errorf("Vint %d changed in round trip: %d, %d bytes (%v)", v, got, n, err)
+		}
+	}
+	// 127 in one byte would be the unknown size
+	if data := appendVint(nil, 127, 1); len(data) != 2 {
+		t.Errorf("Unexpected encoding of 127: %x", data)
+	}
+	if data := appendVint(nil, 5, 4); !bytes.Equal(data, []byte{0x10, 0, 0, 5}) {
+		t.Errorf("Unexpected padded encoding of 5: %x", data)
+	}
+	id, _, err := readVint(&byteSliceReader{data: appendID(nil, mkvIDSegment)}, true)
+	if err != nil || id != mkvIDSegment {
+		t.Errorf("Unexpected element ID: %#x (%v)", id, err)
+	}
+	if _, _, err := readVint(&byteSliceReader{data: []byte{0}}, false); !errors.Is(err, ErrInvalidContainer) {
+		t.Errorf("Expected ErrInvalidContainer, got %v", err)
+	}
+}
+
+// testWebMHeader builds the start of a live WebM file, with an unknown size
+// Segment, a video track 1 and an Opus track 2.
+func testWebMHeader(head *Head, codecDelay time.Duration) []byte {
+	var ebml []byte
+	ebml = appendElement(ebml, ebmlIDDocType, []byte("webm"))
+	b := appendElement(nil, ebmlIDHeader, ebml)
+	b = appendID(b, mkvIDSegment)
+	b = appendVint(b, ebmlUnknownSize, 1)
+	b = appendElement(b, mkvIDInfo, appendUintElement(nil, mkvIDTimestampScale, 1000000))
+	video := appendUintElement(nil, mkvIDTrackNumber, 1)
+	video = appendElement(video, mkvIDCodecID, []byte("V_VP8"))
+	headData, _ := head.MarshalBinary()
+	audio := appendUintElement(nil, mkvIDTrackNumber, 2)
+	audio = appendUintElement(audio, mkvIDTrackType, mkvTrackTypeAudio)
+	audio = appendElement(audio, mkvIDCodecID, []byte(mkvCodecOpus))
+	audio = appendElement(audio, mkvIDCodecPrivate, headData)
+	audio = appendUintElement(audio, mkvIDCodecDelay, uint64(codecDelay))
+	audio = appendUintElement(audio, mkvIDSeekPreRoll, uint64(80*time.Millisecond))
+	var tracks []byte
+	tracks = appendElement(tracks, mkvIDTrackEntry, video)
+	tracks = appendElement(tracks, mkvIDTrackEntry, audio)
+	return appendElement(b, mkvIDTracks, tracks)
+}
+
+// testWebMBlock builds a SimpleBlock for a track with the given lacing and
+// frames.
+func testWebMBlock(track int64, timestamp int16, lacing byte, frames ...[]byte) []byte {
+	block := appendVint(nil, track, 1)
+	block = append(block, byte(uint16(timestamp)>>8), byte(timestamp), 0x80|lacing<<1)
+	if lacing != 0 {
+		block = append(block, byte(len(frames)-1))
+	}
+	for i, f := range frames[:len(frames)-1] {
+		switch lacing {
+		case 1:
+			for n := len(f); ; n -= 255 {
+				if n < 255 {
+					block = append(block, byte(n))
+					break
+				}
+				block = append(block, 255)
+			}
+		case 3:
+			if i == 0 {
+				block = appendVint(block, int64(len(f)), 1)
+			} else {
+				// Signed difference, biased by 8191 in two bytes
+				diff := int64(len(f)-len(frames[i-1])) + 8191
+				block = append(block, 0x40|byte(diff>>8), byte(diff))
+			}
+		}
+	}
+	for _, f := range frames {
+		block = append(block, f...)
+	}
+	return appendElement(nil, mkvIDSimpleBlock, block)
+}
+
+// testOpusFrame is a fake 20 ms CELT packet of the given size.
+func testOpusFrame(size int, tag byte) []byte {
+	f := make([]byte, size)
+	f[0] = 0xF8
+	for i := 1; i < size; i++ {
+		f[i] = tag
+	}
+	return f
+}
+
+func TestWebMReader(t *testing.T) {
+	head := &Head{Version: 1, Channels: 1, PreSkip: 312, InputSampleRate: 48000}
+	b := testWebMHeader(head, 6500*time.Microsecond)
+	headerSize := len(b)
+	// Live cluster of unknown size
+	b = appendID(b, mkvIDCluster)
+	b = appendVint(b, ebmlUnknownSize, 1)
+	b = appendUintElement(b, mkvIDTimestamp, 0)
+	b = append(b, testWebMBlock(2, 0, 0, testOpusFrame(10, 1))...)
+	b = append(b, testWebMBlock(1, 0, 0, []byte{0xde, 0xad})...)
+	b = append(b, testWebMBlock(2, 20, 1, testOpusFrame(300, 2), testOpusFrame(20, 3))...)
+	b = append(b, testWebMBlock(2, 60, 3, testOpusFrame(30, 4), testOpusFrame(20, 5), testOpusFrame(40, 6))...)
+	// Finished cluster with a known size, and the padded last packet
+	var cluster []byte
+	cluster = appendUintElement(cluster, mkvIDTimestamp, 120)
+	cluster = append(cluster, testWebMBlock(2, 0, 2, testOpusFrame(8, 7), testOpusFrame(8, 8))...)
+	group := appendElement(nil, mkvIDBlock, testWebMBlock(2, 40, 0, testOpusFrame(5, 9))[2:])
+	group = appendIntElement(group, mkvIDDiscardPadding, int64(5*time.Millisecond))
+	cluster = appendElement(cluster, mkvIDBlockGroup, group)
+	b = appendElement(b, mkvIDCluster, cluster)
+	b = appendElement(b, mkvIDCues, []byte{1, 2, 3})
+
+	r, err := NewWebMReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("Couldn't read WebM header: %v", err)
+	}
+	if r.TrackNumber() != 2 || r.Head().PreSkip != 312 || r.CodecDelay() != 6500*time.Microsecond ||
+		r.SeekPreRoll() != 80*time.Millisecond {
+		t.Errorf("Unexpected track: %d, %+v, %v, %v", r.TrackNumber(), r.Head(), r.CodecDelay(), r.SeekPreRoll())
+	}
+	expected := []struct {
+		size      int
+		timestamp time.Duration
+	}{
+		{10, 0}, {300, 20}, {20, 40}, {30, 60}, {20, 80}, {40, 100}, {8, 120}, {8, 140}, {5, 160},
+	}
+	for i, e := range expected {
+		p, err := r.ReadPacket()
+		if err != nil {
+			t.Fatalf("Couldn't read packet %d: %v", i, err)
+		}
+		if len(p.Data) != e.size || p.Data[len(p.Data)-1] != byte(i+1) ||
+			p.Timestamp != e.timestamp*time.Millisecond || p.Duration != 20*time.Millisecond {
+			t.Errorf("Unexpected packet %d: %d bytes, at %v, %v long", i, len(p.Data), p.Timestamp, p.Duration)
+		}
+		if (i == len(expected)-1) != (p.DiscardPadding == 5*time.Millisecond) {
+			t.Errorf("Unexpected discard padding on packet %d: %v", i, p.DiscardPadding)
+		}
+	}
+	if _, err := r.ReadPacket(); err != io.EOF {
+		t.Errorf("Expected EOF, got %v", err)
+	}
+
+	if _, err := NewWebMReader(bytes.NewReader(b[:headerSize-5])); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Expected io.ErrUnexpectedEOF for truncated header, got %v", err)
+	}
+	if _, err := NewWebMReader(bytes.NewReader([]byte("OggS"))); !errors.Is(err, ErrInvalidContainer) {
+		t.Errorf("Expected ErrInvalidContainer, got %v", err)
+	}
+}
+
+func TestWebMStream(t *testing.T) {
+	const FRAME_SIZE = 960
+	const FRAMES = 25
+	enc, err := NewEncoder(48000, 1, AppAudio)
+	if err != nil {
+		t.Fatalf("Error creating encoder: %v", err)
+	}
+	head, err := enc.Head()
+	if err != nil {
+		t.Fatalf("Couldn't create header: %v", err)
+	}
+	codecDelay := time.Duration(head.PreSkip) * time.Second / 48000
+	b := testWebMHeader(head, codecDelay)
+	var cluster []byte
+	cluster = appendUintElement(cluster, mkvIDTimestamp, 0)
+	pcm := make([]int16, FRAME_SIZE)
+	addSine(pcm, 48000, 440)
+	data := make([]byte, 1000)
+	for i := 0; i < FRAMES; i++ {
+		n, err := enc.Encode(pcm, data)
+		if err != nil {
+			t.Fatalf("Couldn't encode data: %v", err)
+		}
+		cluster = append(cluster, testWebMBlock(2, int16(20*i), 0, data[:n])...)
+	}
+	b = appendElement(b, mkvIDCluster, cluster)
+
+	s, err := NewWebMStream(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("Couldn't open WebM stream: %v", err)
+	}
+	if s.Channels() != 1 {
+		t.Errorf("Unexpected channel count: %d", s.Channels())
+	}
+	total := 0
+	out := make([]int16, 1000)
+	for {
+		n, err := s.Read(out)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Couldn't decode WebM stream: %v", err)
+		}
+		total += n
+	}
+	if total != FRAMES*FRAME_SIZE-head.PreSkip {
+		t.Errorf("Expected %d samples after codec delay, got %d", FRAMES*FRAME_SIZE-head.PreSkip, total)
+	}
+
+	s, err = NewWebMStream(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("Couldn't open WebM stream: %v", err)
+	}
+	if err := s.SkipTo(300 * time.Millisecond); err != nil {
+		t.Fatalf("Couldn't skip: %v", err)
+	}
+	total = 0
+	outFloat := make([]float32, 1000)
+	for {
+		n, err := s.ReadFloat32(outFloat)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Couldn't decode WebM stream: %v", err)
+		}
+		total += n
+	}
+	if expected := FRAMES*FRAME_SIZE - head.PreSkip - 300*48; total != expected {
+		t.Errorf("Expected %d samples after skipping, got %d", expected, total)
+	}
+}
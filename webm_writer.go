@@ -0,0 +1,305 @@
+// Copyright © Go Opus Authors (see AUTHORS file)
+//
+// License for use of this code is detailed in the LICENSE file
+
+package opus
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Seek pre-roll for Opus recommended by the Matroska codec mapping.
+const webmSeekPreRoll = 80 * time.Millisecond
+
+// Space reserved at the start of a finalized file for the SeekHead, which is
+// written on Close. Three entries take 68 bytes.
+const webmSeekHeadReserve = 96
+
+// Number of the Opus track in files written by WebMWriter.
+const webmTrackNumber = 1
+
+// WebMWriterConfig configures a WebMWriter.
+type WebMWriterConfig struct {
+	// Live writes the Segment and Clusters with an unknown size, so the file
+	// can be played while it is being written, e.g. over HTTP. Otherwise the
+	// writer must be an io.WriteSeeker, and the sizes, the duration and the
+	// SeekHead are filled in on Close.
+	Live bool
+	// Cues writes an index of the Clusters at the end of the file, for
+	// seeking.
+	Cues bool
+	// ClusterDuration is the maximum duration of a Cluster. Defaults to 5
+	// seconds, which is also the upper limit recommended for WebM.
+	ClusterDuration time.Duration
+}
+
+// WebMWriter writes Opus packets to a WebM file with a single audio track.
+type WebMWriter struct {
+	w      io.Writer
+	seeker io.WriteSeeker
+	cfg    WebMWriterConfig
+	// Position of the file in seeker, which the offsets below are relative to
+	start int64
+	// Bytes written so far
+	pos int64
+	// Offset of the Segment payload, which Cues and SeekHead positions are
+	// relative to
+	segmentStart int64
+	// Offsets of the fields patched on Close
+	segmentSizePos int64
+	durationPos    int64
+	seekHeadPos    int64
+	infoPos        int64
+	tracksPos      int64
+	// Total duration written, in samples at 48 kHz
+	samples int64
+	// Timestamp of the current Cluster in milliseconds, and its blocks in
+	// finalized mode
+	clusterOpen      bool
+	clusterTimestamp int64
+	cluster          []byte
+	cuePoints        []webmCuePoint
+	closed           bool
+}
+
+type webmCuePoint struct {
+	timestamp int64
+	position  int64
+}
+
+// NewWebMWriter starts a WebM file on w, writing the headers for an Opus
+// track described by head, e.g. from Encoder.Head. The pre-skip of the header
+// becomes the CodecDelay of the track.
+//
+// A nil config writes a finalized file with Cues if w is an io.WriteSeeker,
+// and a live file otherwise.
+func NewWebMWriter(w io.Writer, head *Head, cfg *WebMWriterConfig) (*WebMWriter, error) {
+	seeker, canSeek := w.(io.WriteSeeker)
+	if cfg == nil {
+		cfg = &WebMWriterConfig{Live: !canSeek, Cues: canSeek}
+	}
+	if !cfg.Live && !canSeek {
+		return nil, fmt.Errorf("%w: a finalized WebM file needs an io.WriteSeeker", ErrBadArg)
+	}
+	headData, err := head.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	ww := &WebMWriter{w: w, cfg: *cfg}
+	if !cfg.Live {
+		ww.seeker = seeker
+		if ww.start, err = seeker.Seek(0, io.SeekCurrent); err != nil {
+			return nil, err
+		}
+	}
+	if ww.cfg.ClusterDuration <= 0 {
+		ww.cfg.ClusterDuration = 5 * time.Second
+	}
+	if ww.cfg.ClusterDuration > 30*time.Second {
+		// Block timestamps are 16-bit milliseconds relative to the Cluster
+		ww.cfg.ClusterDuration = 30 * time.Second
+	}
+
+	var ebml []byte
+	ebml = appendUintElement(ebml, ebmlIDVersion, 1)
+	ebml = appendUintElement(ebml, ebmlIDReadVersion, 1)
+	ebml = appendUintElement(ebml, ebmlIDMaxIDLength, 4)
+	ebml = appendUintElement(ebml, ebmlIDMaxSizeLength, 8)
+	ebml = appendElement(ebml, ebmlIDDocType, []byte("webm"))
+	ebml = appendUintElement(ebml, ebmlIDDocTypeVersion, 4)
+	ebml = appendUintElement(ebml, ebmlIDDocTypeReadVersion, 2)
+	b := appendElement(nil, ebmlIDHeader, ebml)
+
+	b = appendID(b, mkvIDSegment)
+	ww.segmentSizePos = int64(len(b))
+	// Unknown size, patched on Close in finalized mode
+	b = appendVint(b, ebmlUnknownSize, 8)
+	ww.segmentStart = int64(len(b))
+
+	if !cfg.Live {
+		ww.seekHeadPos = int64(len(b))
+		b = appendVoid(b, webmSeekHeadReserve)
+	}
+
+	ww.infoPos = int64(len(b))
+	var info []byte
+	info = appendUintElement(info, mkvIDTimestampScale, 1000000)
+	info = appendElement(info, mkvIDMuxingApp, []byte("hraban/opus"))
+	info = appendElement(info, mkvIDWritingApp, []byte("hraban/opus"))
+	if !cfg.Live {
+		// Patched on Close: ID, size and 8 byte float
+		ww.durationPos = int64(len(b)) + 5 + int64(len(info)) + 3
+		info = appendFloatElement(info, mkvIDDuration, 0)
+	}
+	b = appendElement(b, mkvIDInfo, info)
+
+	ww.tracksPos = int64(len(b))
+	var audio []byte
+	audio = appendFloatElement(audio, mkvIDSamplingFrequency, 48000)
+	audio = appendUintElement(audio, mkvIDChannels, uint64(head.Channels))
+	var track []byte
+	track = appendUintElement(track, mkvIDTrackNumber, webmTrackNumber)
+	track = appendUintElement(track, mkvIDTrackUID, webmTrackNumber)
+	track = appendUintElement(track, mkvIDTrackType, mkvTrackTypeAudio)
+	track = appendElement(track, mkvIDCodecID, []byte(mkvCodecOpus))
+	track = appendElement(track, mkvIDCodecPrivate, headData)
+	track = appendUintElement(track, mkvIDCodecDelay,
+		uint64(time.Duration(head.PreSkip)*time.Second/48000))
+	track = appendUintElement(track, mkvIDSeekPreRoll, uint64(webmSeekPreRoll))
+	track = appendElement(track, mkvIDAudio, audio)
+	b = appendElement(b, mkvIDTracks, appendElement(nil, mkvIDTrackEntry, track))
+
+	if err := ww.write(b); err != nil {
+		return nil, err
+	}
+	return ww, nil
+}
+
+// appendVoid appends a Void element of exactly size bytes, at least 2.
+func appendVoid(b []byte, size int) []byte {
+	b = appendID(b, ebmlIDVoid)
+	if size-1 < 128 {
+		b = appendVint(b, int64(size-2), 1)
+		return append(b, make([]byte, size-2)...)
+	}
+	b = appendVint(b, int64(size-9), 8)
+	return append(b, make([]byte, size-9)...)
+}
+
+func (ww *WebMWriter) write(b []byte) error {
+	n, err := ww.w.Write(b)
+	ww.pos += int64(n)
+	return err
+}
+
+// WritePacket adds an encoded Opus packet to the track. samples is the
+// duration of the packet in samples per channel at 48 kHz, regardless of the
+// sample rate of the encoder; e.g. 960 for a 20 ms packet.
+func (ww *WebMWriter) WritePacket(data []byte, samples int) error {
+	if ww.closed {
+		return ErrStreamClosed
+	}
+	if len(data) == 0 {
+		return ErrNoData
+	}
+	timestamp := ww.samples * 1000 / 48000
+	if !ww.clusterOpen ||
+		time.Duration(timestamp-ww.clusterTimestamp)*time.Millisecond >= ww.cfg.ClusterDuration {
+		if err := ww.flushCluster(); err != nil {
+			return err
+		}
+		if err := ww.startCluster(timestamp); err != nil {
+			return err
+		}
+	}
+	rel := timestamp - ww.clusterTimestamp
+	block := appendVint(nil, webmTrackNumber, 1)
+	// Keyframe: every Opus packet can be decoded on its own
+	block = append(block, byte(rel>>8), byte(rel), 0x80)
+	block = append(block, data...)
+	ww.samples += int64(samples)
+	if ww.cfg.Live {
+		return ww.write(appendElement(nil, mkvIDSimpleBlock, block))
+	}
+	ww.cluster = appendElement(ww.cluster, mkvIDSimpleBlock, block)
+	return nil
+}
+
+func (ww *WebMWriter) startCluster(timestamp int64) error {
+	ww.clusterOpen = true
+	ww.clusterTimestamp = timestamp
+	// A buffered Cluster starts where the previous one ended
+	ww.cuePoints = append(ww.cuePoints, webmCuePoint{timestamp, ww.pos - ww.segmentStart})
+	ts := appendUintElement(nil, mkvIDTimestamp, uint64(timestamp))
+	if !ww.cfg.Live {
+		ww.cluster = ts
+		return nil
+	}
+	b := appendID(nil, mkvIDCluster)
+	b = appendVint(b, ebmlUnknownSize, 8)
+	return ww.write(append(b, ts...))
+}
+
+func (ww *WebMWriter) flushCluster() error {
+	if !ww.clusterOpen || ww.cfg.Live {
+		return nil
+	}
+	ww.clusterOpen = false
+	return ww.write(appendElement(nil, mkvIDCluster, ww.cluster))
+}
+
+// Close writes the last Cluster and the Cues, and in finalized mode fills in
+// the sizes, the duration and the SeekHead. It does not close the underlying
+// writer.
+func (ww *WebMWriter) Close() error {
+	if ww.closed {
+		return ErrStreamClosed
+	}
+	ww.closed = true
+	if err := ww.flushCluster(); err != nil {
+		return err
+	}
+	cuesPos := int64(-1)
+	if ww.cfg.Cues && len(ww.cuePoints) > 0 {
+		cuesPos = ww.pos
+		var cues []byte
+		for _, c := range ww.cuePoints {
+			var positions []byte
+			positions = appendUintElement(positions, mkvIDCueTrack, webmTrackNumber)
+			positions = appendUintElement(positions, mkvIDCueClusterPos, uint64(c.position))
+			var point []byte
+			point = appendUintElement(point, mkvIDCueTime, uint64(c.timestamp))
+			point = appendElement(point, mkvIDCueTrackPositions, positions)
+			cues = appendElement(cues, mkvIDCuePoint, point)
+		}
+		if err := ww.write(appendElement(nil, mkvIDCues, cues)); err != nil {
+			return err
+		}
+	}
+	if ww.cfg.Live {
+		return nil
+	}
+
+	end := ww.pos
+	seeks := []struct {
+		id  uint32
+		pos int64
+	}{{mkvIDInfo, ww.infoPos}, {mkvIDTracks, ww.tracksPos}, {mkvIDCues, cuesPos}}
+	var seekHead []byte
+	for _, s := range seeks {
+		if s.pos < 0 {
+			continue
+		}
+		seek := appendElement(nil, mkvIDSeekID, appendID(nil, s.id))
+		// Fixed size position, so the reserved space always suffices
+		position := make([]byte, 8)
+		binary.BigEndian.PutUint64(position, uint64(s.pos-ww.segmentStart))
+		seek = appendElement(seek, mkvIDSeekPosition, position)
+		seekHead = appendElement(seekHead, mkvIDSeek, seek)
+	}
+	seekHead = appendElement(nil, mkvIDSeekHead, seekHead)
+	seekHead = appendVoid(seekHead, webmSeekHeadReserve-len(seekHead))
+
+	duration := appendFloatElement(nil, mkvIDDuration, float64(ww.samples)*1000/48000)
+	patches := []struct {
+		pos  int64
+		data []byte
+	}{
+		{ww.segmentSizePos, appendVint(nil, end-ww.segmentStart, 8)},
+		{ww.seekHeadPos, seekHead},
+		{ww.durationPos, duration[len(duration)-8:]},
+	}
+	for _, p := range patches {
+		if _, err := ww.seeker.Seek(ww.start+p.pos, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := ww.seeker.Write(p.data); err != nil {
+			return err
+		}
+	}
+	_, err := ww.seeker.Seek(ww.start+end, io.SeekStart)
+	return err
+}
@@ -0,0 +1,219 @@
+// Copyright © Go Opus Authors (see AUTHORS file)
+//
+// License for use of this code is detailed in the LICENSE file
+
+package opus
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+// seekBuffer is an in-memory io.WriteSeeker.
+type seekBuffer struct {
+	data []byte
+	pos  int
+}
+
+func (b *seekBuffer) Write(p []byte) (int, error) {
+	if end := b.pos + len(p); end > len(b.data) {
+		b.data = append(b.data, make([]byte, end-len(b.data))...)
+	}
+	b.pos += copy(b.data[b.pos:], p)
+	return len(p), nil
+}
+
+func (b *seekBuffer) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += int64(b.pos)
+	case io.SeekEnd:
+		offset += int64(len(b.data))
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	b.pos = int(offset)
+	return offset, nil
+}
+
+// writeTestWebM writes packets of 20 ms with 100 ms clusters and returns the
+// packets.
+func writeTestWebM(t *testing.T, w io.Writer, cfg *WebMWriterConfig, head *Head, packets int) [][]byte {
+	ww, err := NewWebMWriter(w, head, cfg)
+	if err != nil {
+		t.Fatalf("Couldn't create WebM writer: %v", err)
+	}
+	var written [][]byte
+	for i := 0; i < packets; i++ {
+		p := testOpusFrame(10+i, byte(i))
+		if err := ww.WritePacket(p, 960); err != nil {
+			t.Fatalf("Couldn't write packet %d: %v", i, err)
+		}
+		written = append(written, p)
+	}
+	if err := ww.Close(); err != nil {
+		t.Fatalf("Couldn't close WebM writer: %v", err)
+	}
+	if err := ww.WritePacket(written[0], 960); err != ErrStreamClosed {
+		t.Errorf("Expected ErrStreamClosed after Close, got %v", err)
+	}
+	return written
+}
+
+func checkTestWebM(t *testing.T, data []byte, head *Head, written [][]byte) {
+	r, err := NewWebMReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Couldn't read WebM header: %v", err)
+	}
+	if r.Head().Channels != head.Channels || r.Head().PreSkip != head.PreSkip ||
+		r.CodecDelay() != time.Duration(head.PreSkip)*time.Second/48000 ||
+		r.SeekPreRoll() != 80*time.Millisecond {
+		t.Errorf("Unexpected track: %+v, %v, %v", r.Head(), r.CodecDelay(), r.SeekPreRoll())
+	}
+	for i, w := range written {
+		p, err := r.ReadPacket()
+		if err != nil {
+			t.Fatalf("Couldn't read packet %d: %v", i, err)
+		}
+		if !bytes.Equal(p.Data, w) || p.Timestamp != time.Duration(i)*20*time.Millisecond {
+			t.Errorf("Unexpected packet %d: %d bytes at %v", i, len(p.Data), p.Timestamp)
+		}
+	}
+	if _, err := r.ReadPacket(); err != io.EOF {
+		t.Errorf("Expected EOF, got %v", err)
+	}
+}
+
+func TestWebMWriterLive(t *testing.T) {
+	head := &Head{Version: 1, Channels: 2, PreSkip: 312, InputSampleRate: 48000}
+	var buf bytes.Buffer
+	cfg := &WebMWriterConfig{Live: true, ClusterDuration: 100 * time.Millisecond}
+	written := writeTestWebM(t, &buf, cfg, head, 12)
+	checkTestWebM(t, buf.Bytes(), head, written)
+	if !bytes.Contains(buf.Bytes(), appendVint(appendID(nil, mkvIDCluster), ebmlUnknownSize, 1)) {
+		t.Errorf("Expected a Cluster of unknown size")
+	}
+	if bytes.Contains(buf.Bytes(), appendID(nil, mkvIDCues)) {
+		t.Errorf("Unexpected Cues")
+	}
+	if _, err := NewWebMWriter(&buf, head, &WebMWriterConfig{}); !errors.Is(err, ErrBadArg) {
+		t.Errorf("Expected ErrBadArg for a finalized file without seeking, got %v", err)
+	}
+}
+
+func TestWebMWriterFinalized(t *testing.T) {
+	head := &Head{Version: 1, Channels: 1, PreSkip: 312, InputSampleRate: 16000}
+	var buf seekBuffer
+	cfg := &WebMWriterConfig{Cues: true, ClusterDuration: 100 * time.Millisecond}
+	written := writeTestWebM(t, &buf, cfg, head, 12)
+	if buf.pos != len(buf.data) {
+		t.Errorf("Writer not left at the end: %d of %d", buf.pos, len(buf.data))
+	}
+	checkTestWebM(t, buf.data, head, written)
+
+	// The same file, after other data in the same seeker
+	prefix := []byte("not part of the file")
+	offset := seekBuffer{data: append([]byte(nil), prefix...), pos: len(prefix)}
+	writeTestWebM(t, &offset, cfg, head, 12)
+	if !bytes.Equal(offset.data[:len(prefix)], prefix) || !bytes.Equal(offset.data[len(prefix):], buf.data) {
+		t.Errorf("Unexpected file after %d other bytes", len(prefix))
+	}
+
+	// Walk the Segment, which must have a known size now
+	var segment []byte
+	err := parseElements(buf.data, func(id uint32, payload []byte) error {
+		if id == mkvIDSegment {
+			segment = payload
+		}
+		return nil
+	})
+	if err != nil || segment == nil {
+		t.Fatalf("Couldn't parse Segment: %v", err)
+	}
+	seeks := map[uint32]uint64{}
+	var cueTimes, cuePositions []uint64
+	var duration float64
+	err = parseElements(segment, func(id uint32, payload []byte) error {
+		switch id {
+		case mkvIDSeekHead:
+			return parseElements(payload, func(id uint32, payload []byte) error {
+				var seekID, seekPos uint64
+				err := parseElements(payload, func(id uint32, payload []byte) error {
+					var err error
+					switch id {
+					case mkvIDSeekID:
+						seekID, err = ebmlUint(payload)
+					case mkvIDSeekPosition:
+						seekPos, err = ebmlUint(payload)
+					}
+					return err
+				})
+				seeks[uint32(seekID)] = seekPos
+				return err
+			})
+		case mkvIDInfo:
+			return parseElements(payload, func(id uint32, payload []byte) error {
+				var err error
+				if id == mkvIDDuration {
+					duration, err = ebmlFloat(payload)
+				}
+				return err
+			})
+		case mkvIDCues:
+			return parseElements(payload, func(id uint32, payload []byte) error {
+				return parseElements(payload, func(id uint32, payload []byte) error {
+					switch id {
+					case mkvIDCueTime:
+						v, err := ebmlUint(payload)
+						cueTimes = append(cueTimes, v)
+						return err
+					case mkvIDCueTrackPositions:
+						return parseElements(payload, func(id uint32, payload []byte) error {
+							if id != mkvIDCueClusterPos {
+								return nil
+							}
+							v, err := ebmlUint(payload)
+							cuePositions = append(cuePositions, v)
+							return err
+						})
+					}
+					return nil
+				})
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Couldn't parse Segment: %v", err)
+	}
+	if duration != 240 {
+		t.Errorf("Unexpected duration: %v", duration)
+	}
+	for _, id := range []uint32{mkvIDInfo, mkvIDTracks, mkvIDCues} {
+		pos, ok := seeks[id]
+		if !ok {
+			t.Errorf("No SeekHead entry for %#x", id)
+			continue
+		}
+		got, _, err := readVint(&byteSliceReader{data: segment[pos:]}, true)
+		if err != nil || uint32(got) != id {
+			t.Errorf("SeekHead entry for %#x points to %#x (%v)", id, got, err)
+		}
+	}
+	if len(cueTimes) != 3 || len(cuePositions) != 3 {
+		t.Fatalf("Expected 3 cue points, got %v at %v", cueTimes, cuePositions)
+	}
+	for i, pos := range cuePositions {
+		if cueTimes[i] != uint64(100*i) {
+			t.Errorf("Unexpected time of cue point %d: %d", i, cueTimes[i])
+		}
+		got, _, err := readVint(&byteSliceReader{data: segment[pos:]}, true)
+		if err != nil || got != mkvIDCluster {
+			t.Errorf("Cue point %d points to %#x (%v)", i, got, err)
+		}
+	}
+}